@@ -13,6 +13,7 @@ import (
 	"github.com/eviltomorrow/omega/internal/system"
 	"github.com/eviltomorrow/omega/pkg/lock"
 	"github.com/eviltomorrow/omega/pkg/self"
+	"github.com/eviltomorrow/omega/pkg/systemd"
 
 	"github.com/spf13/cobra"
 )
@@ -68,6 +69,18 @@ var root = &cobra.Command{
 		}
 		registerCleanFuncs(func() error { return lock.DestroyFileLock(plock) })
 
+		var stop = make(chan struct{})
+		registerCleanFuncs(func() error {
+			close(stop)
+			return nil
+		})
+		// readiness and keepalives are sent if it is started by systemd
+		if err := systemd.Ready(); err != nil {
+			log.Printf("[W] Notify systemd failure, nest error: %v\r\n", err)
+		}
+		registerCleanFuncs(systemd.Stopping)
+		go systemd.Keepalive(stop)
+
 		blockingUntilTermination()
 	},
 }
@@ -0,0 +1,345 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/remoteconf"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var config_root = &cobra.Command{
+	Use:   "config",
+	Short: "config's api support",
+	Long:  "  \r\nomega-ctl config api support, config of a group and of its hosts is kept in etcd and overlaid on omega.conf of agents, only plugins, agent.period and agent.collector-group may be set",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var config_get = &cobra.Command{
+	Use:   "get",
+	Short: "print config of group or host",
+	Long:  "  \r\nprint config of group, or of host if --host is set, and the versions applied by hosts of group with --status",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiConfigGet(); err != nil {
+			log.Printf("[E] Get config failure, nest error: %v", err)
+		}
+	},
+}
+
+var config_set = &cobra.Command{
+	Use:   "set",
+	Short: "set config of group or host",
+	Long:  "  \r\nset config of group, or of host if --host is set, agents apply it without restart. The config is validated before it is set, and it isn't set if --version is given and the config is changed by others since",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiConfigSet(); err != nil {
+			log.Printf("[E] Set config failure, nest error: %v", err)
+		}
+	},
+}
+
+var config_diff = &cobra.Command{
+	Use:   "diff",
+	Short: "diff config of group or host",
+	Long:  "  \r\ndiff the latest config of group or host with --file, or with the version of --rev",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiConfigDiff(); err != nil {
+			log.Printf("[E] Diff config failure, nest error: %v", err)
+		}
+	},
+}
+
+var config_history = &cobra.Command{
+	Use:   "history",
+	Short: "list versions of config of group or host",
+	Long:  "  \r\nlist versions of config of group or host from the latest, versions compacted by etcd are lost",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiConfigHistory(); err != nil {
+			log.Printf("[E] List config history failure, nest error: %v", err)
+		}
+	},
+}
+
+var (
+	cfgGroup   string
+	cfgHost    string
+	cfgRev     int64
+	cfgStatus  bool
+	cfgFile    string
+	cfgDelete  bool
+	cfgVersion int64
+	cfgLimit   int
+)
+
+func init() {
+	root.AddCommand(config_root)
+	config_root.AddCommand(config_get)
+	config_root.AddCommand(config_set)
+	config_root.AddCommand(config_diff)
+	config_root.AddCommand(config_history)
+
+	var flags = config_root.PersistentFlags()
+	flags.StringVar(&cfgGroup, "group", "", "group of omega")
+	flags.StringVar(&cfgHost, "host", "", "inner ip of host, config of group if it is empty")
+
+	config_get.Flags().Int64Var(&cfgRev, "rev", 0, "version of config, the latest if it is 0")
+	config_get.Flags().BoolVar(&cfgStatus, "status", false, "print versions applied by hosts of group")
+	config_set.Flags().StringVar(&cfgFile, "file", "", "toml file of config")
+	config_set.Flags().BoolVar(&cfgDelete, "delete", false, "delete config, omega.conf or config of group is used again")
+	config_set.Flags().Int64Var(&cfgVersion, "version", -1, "current version of config which is replaced, 0 if it doesn't exist, not checked if it is negative")
+	config_diff.Flags().StringVar(&cfgFile, "file", "", "toml file of config")
+	config_diff.Flags().Int64Var(&cfgRev, "rev", 0, "version of config")
+	config_history.Flags().IntVar(&cfgLimit, "limit", 10, "max versions")
+}
+
+// configKey returns the key of config of cfgGroup or cfgHost
+func configKey() (string, error) {
+	if cfgGroup == "" {
+		return "", fmt.Errorf("invalid group, group is empty")
+	}
+	if cfgHost != "" {
+		return remoteconf.HostKey(cfgGroup, cfgHost), nil
+	}
+	return remoteconf.GroupKey(cfgGroup), nil
+}
+
+func apiConfigGet() error {
+	key, err := configKey()
+	if err != nil {
+		return err
+	}
+	client, err := newEtcdClient(EtcdEndpoints)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	value, err := remoteconf.Get(client, key, cfgRev)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		log.Printf("[W] No config of key[%s], omega.conf is used", key)
+	} else {
+		fmt.Printf("# %s, version: %d\r\n", key, value.Version)
+		fmt.Println(strings.TrimRight(value.Text, "\n"))
+	}
+	if !cfgStatus {
+		return nil
+	}
+	return printConfigStatus(client)
+}
+
+// printConfigStatus prints versions applied by hosts of cfgGroup, or cfgHost only
+func printConfigStatus(client *clientv3.Client) error {
+	statuses, err := remoteconf.Statuses(client, cfgGroup)
+	if err != nil {
+		return err
+	}
+	var hosts = make([]string, 0, len(statuses))
+	for host := range statuses {
+		if cfgHost == "" || host == cfgHost {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Host", "Applied Group", "Applied Host", "Time", "Rejected", "Error"})
+	for _, host := range hosts {
+		var (
+			s        = statuses[host]
+			rejected string
+		)
+		if s.Rejected != nil {
+			rejected = color.RedString(s.Rejected.String())
+		}
+		table.Append([]string{host, strconv.FormatInt(s.Applied.Group, 10), strconv.FormatInt(s.Applied.Host, 10),
+			time.Unix(s.Time, 0).Format("2006-01-02 15:04:05"), rejected, s.Error})
+	}
+	table.Render()
+	return nil
+}
+
+func apiConfigSet() error {
+	key, err := configKey()
+	if err != nil {
+		return err
+	}
+	var text string
+	switch {
+	case cfgDelete && cfgFile != "":
+		return fmt.Errorf("--file and --delete can't be set at the same time")
+	case cfgDelete:
+	case cfgFile == "":
+		return fmt.Errorf("invalid file, file is empty")
+	default:
+		buf, err := ioutil.ReadFile(cfgFile)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(buf)) == "" {
+			return fmt.Errorf("file[%s] is empty, use --delete to delete config", cfgFile)
+		}
+		text = string(buf)
+	}
+
+	client, err := newEtcdClient(EtcdEndpoints)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	version, err := remoteconf.Set(client, key, text, cfgVersion)
+	if err != nil {
+		return err
+	}
+	if cfgDelete {
+		log.Printf("[I] Delete config of key[%s] %s", key, color.BlueString("OK"))
+	} else {
+		log.Printf("[I] Set config of key[%s] %s, version: %d", key, color.BlueString("OK"), version)
+	}
+	return nil
+}
+
+func apiConfigDiff() error {
+	key, err := configKey()
+	if err != nil {
+		return err
+	}
+	if (cfgFile == "") == (cfgRev == 0) {
+		return fmt.Errorf("either --file or --rev must be set")
+	}
+	client, err := newEtcdClient(EtcdEndpoints)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	latest, err := remoteconf.Get(client, key, 0)
+	if err != nil {
+		return err
+	}
+	var (
+		from     = configText(latest)
+		fromName = fmt.Sprintf("%s@%d", key, configVersion(latest))
+		to       string
+		toName   string
+	)
+	if cfgFile != "" {
+		buf, err := ioutil.ReadFile(cfgFile)
+		if err != nil {
+			return err
+		}
+		to, toName = string(buf), cfgFile
+	} else {
+		value, err := remoteconf.Get(client, key, cfgRev)
+		if err != nil {
+			return err
+		}
+		// the version of rev is compared to the latest
+		from, fromName = configText(value), fmt.Sprintf("%s@%d", key, configVersion(value))
+		to, toName = configText(latest), fmt.Sprintf("%s@%d", key, configVersion(latest))
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		log.Printf("[I] No difference")
+		return nil
+	}
+	fmt.Print(diff)
+	return nil
+}
+
+func apiConfigHistory() error {
+	key, err := configKey()
+	if err != nil {
+		return err
+	}
+	if cfgLimit <= 0 {
+		return fmt.Errorf("invalid limit[%d], limit must be greater than 0", cfgLimit)
+	}
+	client, err := newEtcdClient(EtcdEndpoints)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	values, err := remoteconf.History(client, key, cfgLimit+1)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		log.Printf("[W] No config of key[%s], omega.conf is used", key)
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Version", "Lines", "Changes"})
+	for i, value := range values {
+		if i == cfgLimit {
+			break
+		}
+		var changes = "created"
+		if i+1 < len(values) {
+			var added, deleted = diffLines(values[i+1].Text, value.Text)
+			changes = fmt.Sprintf("+%d -%d", added, deleted)
+		}
+		table.Append([]string{strconv.FormatInt(value.Version, 10), strconv.Itoa(strings.Count(strings.TrimRight(value.Text, "\n")+"\n", "\n")), changes})
+	}
+	table.Render()
+	return nil
+}
+
+// diffLines returns count of lines added and deleted from a to b
+func diffLines(a, b string) (int, int) {
+	var (
+		matcher        = difflib.NewMatcher(difflib.SplitLines(a), difflib.SplitLines(b))
+		added, deleted int
+	)
+	for _, op := range matcher.GetOpCodes() {
+		switch op.Tag {
+		case 'r':
+			added, deleted = added+op.J2-op.J1, deleted+op.I2-op.I1
+		case 'i':
+			added += op.J2 - op.J1
+		case 'd':
+			deleted += op.I2 - op.I1
+		}
+	}
+	return added, deleted
+}
+
+func configText(value *remoteconf.Value) string {
+	if value == nil {
+		return ""
+	}
+	return value.Text
+}
+
+func configVersion(value *remoteconf.Value) int64 {
+	if value == nil {
+		return 0
+	}
+	return value.Version
+}
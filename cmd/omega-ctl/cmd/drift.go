@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eviltomorrow/omega/internal/installer"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// apiWatchdogCheck reports drift of hosts in resource.txt or inventory from what install
+// would do with the image, nothing is changed.
+func apiWatchdogCheck(num int) (string, error) {
+	var (
+		resourceFile = filepath.Join(imageDir, "resource.txt")
+		imageFile    = filepath.Join(imageDir, "omega.tar.gz")
+	)
+	if err := checkFiles(imageFile); err != nil {
+		return "", err
+	}
+	expected, err := md5InTarball(imageFile, "omega/bin/omega-watchdog")
+	if err != nil {
+		return "", err
+	}
+
+	return runResources("check", resourceFile, num, func(r *resource) (string, error) {
+		drifts, err := drift(r, expected)
+		if err != nil {
+			return "", fmt.Errorf("check failure, nest error: %v", err)
+		}
+		if len(drifts) != 0 {
+			return "", fmt.Errorf("drift found: %s", strings.Join(drifts, "; "))
+		}
+		return "no drift", nil
+	})
+}
+
+// drift returns differences of the host of r from an install of omega-watchdog
+// with md5 expected
+func drift(r *resource, expected string) ([]string, error) {
+	scp, err := dial(r)
+	if err != nil {
+		return nil, err
+	}
+	defer scp.Close()
+
+	output, err := installer.Run(scp, fmt.Sprintf(`cd %s 2> /dev/null || { echo "missing: install dir"; exit 0; }
+[ -e bin/omega-watchdog ] || echo "missing: bin/omega-watchdog"
+[ -e bin/omega-watchdog ] && md5sum bin/omega-watchdog | awk '{print "md5: "$1}'
+if [ -e etc/omega.conf ]; then
+    ./bin/omega-watchdog config %s 2> /dev/null | diff -q - etc/omega.conf > /dev/null 2>&1 || echo "config: etc/omega.conf differs from generated config"
+else
+    echo "missing: etc/omega.conf"
+fi
+for name in omega-watchdog omega; do
+    if [ -e var/run/${name}.pid ] && kill -0 $(cat var/run/${name}.pid) 2> /dev/null; then
+        :
+    else
+        echo "stopped: ${name}"
+    fi
+done
+exit 0`, installer.Quote(filepath.Join(r.HomeDir, "omega")), r.target().Attrs()), timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts = make([]string, 0, 4)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "md5: "):
+			if md5 := strings.TrimPrefix(line, "md5: "); md5 != expected {
+				drifts = append(drifts, fmt.Sprintf("binary: omega-watchdog md5 is %s, image has %s", md5, expected))
+			}
+		default:
+			drifts = append(drifts, line)
+		}
+	}
+
+	registered, err := registered(strings.Split(r.Endpoints, ","), r.GroupName, r.InnerIP)
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range []string{"omega-watchdog", "omega"} {
+		if !registered[service] {
+			drifts = append(drifts, fmt.Sprintf("unregistered: %s in etcd", service))
+		}
+	}
+	return drifts, nil
+}
+
+// registered returns services of omega-watchdog and omega registered by ip in group
+func registered(endpoints []string, group, ip string) (map[string]bool, error) {
+	client, err := newEtcdClient(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var services = make(map[string]bool, 2)
+	for _, service := range []string{"omega-watchdog", "omega"} {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		resp, err := client.Get(ctx, registeredKey(service, group, ip), clientv3.WithPrefix(), clientv3.WithCountOnly())
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		services[service] = resp.Count != 0
+	}
+	return services, nil
+}
+
+// md5InTarball returns md5 of file name in tar.gz path
+func md5InTarball(path, name string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+
+	var reader = tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("%s not found in %s", name, path)
+		}
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimPrefix(header.Name, "./") != name {
+			continue
+		}
+		var h = md5.New()
+		if _, err := io.Copy(h, reader); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", h.Sum(nil)), nil
+	}
+}
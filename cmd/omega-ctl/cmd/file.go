@@ -1,17 +1,34 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"io/fs"
 	"log"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/file"
+	"github.com/eviltomorrow/omega/internal/api/file/pb"
 	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
+var file_root = &cobra.Command{
+	Use:   "file",
+	Short: "file's api support",
+	Long:  "  \r\nomega-ctl omega file api support",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
 var file_upload = &cobra.Command{
 	Use:   "upload",
 	Short: "upload file to omega",
-	Long:  "  \r\file api(Upload)",
+	Long:  "  \r\nfile api(Upload)",
 	Run: func(cmd *cobra.Command, args []string) {
 		err := apiFileUpload()
 		if err != nil {
@@ -24,8 +41,8 @@ var file_upload = &cobra.Command{
 
 var file_download = &cobra.Command{
 	Use:   "download",
-	Short: "download file from omega",
-	Long:  "  \r\file api(Download)",
+	Short: "download file or folder from omega",
+	Long:  "  \r\nfile api(Download)",
 	Run: func(cmd *cobra.Command, args []string) {
 		err := apiFileDownload()
 		if err != nil {
@@ -36,6 +53,166 @@ var file_download = &cobra.Command{
 	},
 }
 
+// omega_upload and omega_download are kept for compatibility, use "omega file upload/download" instead
+var omega_upload = &cobra.Command{
+	Use:        "upload",
+	Short:      "upload file to omega",
+	Long:       "  \r\nfile api(Upload)",
+	Deprecated: "use \"omega file upload\" instead",
+	Run:        file_upload.Run,
+}
+
+var omega_download = &cobra.Command{
+	Use:        "download",
+	Short:      "download file from omega",
+	Long:       "  \r\nfile api(Download)",
+	Deprecated: "use \"omega file download\" instead",
+	Run:        file_download.Run,
+}
+
+var file_ls = &cobra.Command{
+	Use:   "ls",
+	Short: "list directory of omega",
+	Long:  "  \r\nfile api(List)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiFileList(); err != nil {
+			log.Printf("[E] List directory failure, nest error: %v", err)
+		}
+	},
+}
+
+var file_rm = &cobra.Command{
+	Use:   "rm",
+	Short: "remove file or directory of omega",
+	Long:  "  \r\nfile api(Remove)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiFileRemove(); err != nil {
+			log.Printf("[E] Remove failure, nest error: %v", err)
+		} else {
+			log.Printf("[%s]", color.BlueString("OK"))
+		}
+	},
+}
+
+var file_mv = &cobra.Command{
+	Use:   "mv",
+	Short: "rename file or directory of omega",
+	Long:  "  \r\nfile api(Rename)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiFileRename(); err != nil {
+			log.Printf("[E] Rename failure, nest error: %v", err)
+		} else {
+			log.Printf("[%s]", color.BlueString("OK"))
+		}
+	},
+}
+
+var file_mkdir = &cobra.Command{
+	Use:   "mkdir",
+	Short: "make directory of omega",
+	Long:  "  \r\nfile api(Mkdir)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiFileMkdir(); err != nil {
+			log.Printf("[E] Make directory failure, nest error: %v", err)
+		} else {
+			log.Printf("[%s]", color.BlueString("OK"))
+		}
+	},
+}
+
+var file_sync = &cobra.Command{
+	Use:   "sync",
+	Short: "sync local directory to omega",
+	Long:  "  \r\nfile api(Manifest/Patch), only changed blocks are transferred",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiFileSync(); err != nil {
+			log.Printf("[E] Sync failure, nest error: %v", err)
+		} else {
+			log.Printf("[%s]", color.BlueString("OK"))
+		}
+	},
+}
+
+var (
+	filePath    string
+	depth       int
+	recursive   bool
+	parents     bool
+	dirMode     string
+	from, to    string
+	dryRun      bool
+	deleteExtra bool
+	preserve    bool
+)
+
+func init() {
+	omega_root.AddCommand(file_root)
+
+	// upload
+	file_root.AddCommand(file_upload)
+	file_upload.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	file_upload.MarkFlagRequired("addr")
+	file_upload.Flags().StringVar(&local, "local", "", "local file path")
+	file_upload.MarkFlagRequired("local")
+	file_upload.Flags().StringVar(&remote, "remote", "", "remote file path")
+	file_upload.MarkFlagRequired("remote")
+
+	// download
+	file_root.AddCommand(file_download)
+	file_download.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	file_download.MarkFlagRequired("addr")
+	file_download.Flags().StringVar(&local, "local", "", "local file path")
+	file_download.MarkFlagRequired("local")
+	file_download.Flags().StringVar(&remote, "remote", "", "remote file or folder path")
+	file_download.MarkFlagRequired("remote")
+
+	// ls
+	file_root.AddCommand(file_ls)
+	file_ls.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	file_ls.MarkFlagRequired("addr")
+	file_ls.Flags().StringVar(&filePath, "path", "", "remote directory path")
+	file_ls.MarkFlagRequired("path")
+	file_ls.Flags().IntVar(&depth, "depth", 1, "depth of recursion")
+
+	// rm
+	file_root.AddCommand(file_rm)
+	file_rm.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	file_rm.MarkFlagRequired("addr")
+	file_rm.Flags().StringVar(&filePath, "path", "", "remote path")
+	file_rm.MarkFlagRequired("path")
+	file_rm.Flags().BoolVarP(&recursive, "recursive", "r", false, "remove directory and its contents")
+
+	// mv
+	file_root.AddCommand(file_mv)
+	file_mv.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	file_mv.MarkFlagRequired("addr")
+	file_mv.Flags().StringVar(&from, "from", "", "remote source path")
+	file_mv.MarkFlagRequired("from")
+	file_mv.Flags().StringVar(&to, "to", "", "remote target path")
+	file_mv.MarkFlagRequired("to")
+
+	// mkdir
+	file_root.AddCommand(file_mkdir)
+	file_mkdir.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	file_mkdir.MarkFlagRequired("addr")
+	file_mkdir.Flags().StringVar(&filePath, "path", "", "remote directory path")
+	file_mkdir.MarkFlagRequired("path")
+	file_mkdir.Flags().BoolVarP(&parents, "parents", "p", false, "make parent directories as needed")
+	file_mkdir.Flags().StringVar(&dirMode, "mode", "0755", "directory mode")
+
+	// sync
+	file_root.AddCommand(file_sync)
+	file_sync.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	file_sync.MarkFlagRequired("addr")
+	file_sync.Flags().StringVar(&local, "local", "", "local directory path")
+	file_sync.MarkFlagRequired("local")
+	file_sync.Flags().StringVar(&remote, "remote", "", "remote directory path")
+	file_sync.MarkFlagRequired("remote")
+	file_sync.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be done")
+	file_sync.Flags().BoolVar(&deleteExtra, "delete", false, "delete remote files which don't exist in local")
+	file_sync.Flags().BoolVar(&preserve, "preserve", false, "preserve modes and mtimes")
+}
+
 func apiFileUpload() error {
 	return file.Upload(addr, local, remote)
 }
@@ -43,3 +220,96 @@ func apiFileUpload() error {
 func apiFileDownload() error {
 	return file.Download(addr, local, remote)
 }
+
+func apiFileList() error {
+	client, destroy, err := file.NewClient(addr)
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	resp, err := client.List(context.Background(), &pb.ListRequest{Path: filePath, Depth: int32(depth)})
+	if err != nil {
+		return err
+	}
+	if len(resp.Entries) == 0 {
+		log.Printf("Empty")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Mode", "Size", "ModTime", "Path"})
+	for _, entry := range resp.Entries {
+		var name = entry.Path
+		if entry.Link != "" {
+			name = fmt.Sprintf("%s -> %s", entry.Path, entry.Link)
+		}
+		table.Append([]string{
+			fs.FileMode(uint32(entry.Mode)).String(),
+			fmt.Sprintf("%d", entry.Size),
+			time.Unix(entry.ModTime, 0).Format("2006-01-02 15:04:05"),
+			name,
+		})
+	}
+	table.Render()
+	return nil
+}
+
+func apiFileRemove() error {
+	client, destroy, err := file.NewClient(addr)
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	_, err = client.Remove(context.Background(), &pb.RemoveRequest{Path: filePath, Recursive: recursive})
+	return err
+}
+
+func apiFileRename() error {
+	client, destroy, err := file.NewClient(addr)
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	_, err = client.Rename(context.Background(), &pb.RenameRequest{From: from, To: to})
+	return err
+}
+
+func apiFileMkdir() error {
+	mode, err := strconv.ParseUint(dirMode, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid mode[%s], nest error: %v", dirMode, err)
+	}
+
+	client, destroy, err := file.NewClient(addr)
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	_, err = client.Mkdir(context.Background(), &pb.MkdirRequest{Path: filePath, Mode: int32(mode), Parents: parents})
+	return err
+}
+
+func apiFileSync() error {
+	actions, err := file.Sync(addr, local, remote, &file.SyncOptions{Delete: deleteExtra, Preserve: preserve, DryRun: dryRun})
+	for _, action := range actions {
+		log.Printf("[I] %s", action)
+	}
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, action := range actions {
+		size += action.Size
+	}
+	if dryRun {
+		log.Printf("[I] Dry run, %d actions, %d bytes would be transferred", len(actions), size)
+	} else {
+		log.Printf("[I] %d actions, %d bytes transferred", len(actions), size)
+	}
+	return nil
+}
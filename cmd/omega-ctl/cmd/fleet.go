@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/hub"
+	"github.com/eviltomorrow/omega/internal/fleet"
+	"github.com/eviltomorrow/omega/pkg/self"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var fleet_root = &cobra.Command{
+	Use:   "fleet",
+	Short: "fleet's api support",
+	Long:  "  \r\nomega-ctl fleet api support",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var fleet_upgrade = &cobra.Command{
+	Use:   "upgrade",
+	Short: "upgrade omega of watchdogs in etcd batch by batch",
+	Long:  "  \r\nfleet upgrade, it is resumed from --state after it is interrupted or stopped",
+	Run: func(cmd *cobra.Command, args []string) {
+		destroy, err := self.RegisterEtcd(EtcdEndpoints)
+		if err != nil {
+			log.Printf("[E] Register etcd failure, nest error: %v", err)
+			return
+		}
+		defer destroy()
+
+		if err := apiFleetUpgrade(); err != nil {
+			log.Printf("[E] Upgrade fleet failure, nest error: %v", err)
+		}
+	},
+}
+
+var (
+	group     string
+	batch     string
+	pause     time.Duration
+	threshold string
+	stateFile string
+)
+
+func init() {
+	fleet_root.AddCommand(fleet_upgrade)
+	fleet_upgrade.Flags().StringVar(&tag, "tag", "", "omega image tag, channel or latest")
+	fleet_upgrade.MarkFlagRequired("tag")
+	fleet_upgrade.Flags().StringVar(&group, "group", "", "group of watchdogs, all groups if it is empty")
+	fleet_upgrade.Flags().StringVar(&batch, "batch", "10%", "hosts upgraded at the same time, percent of hosts or a count")
+	fleet_upgrade.Flags().DurationVar(&pause, "pause", 2*time.Minute, "pause between batches")
+	fleet_upgrade.Flags().StringVar(&threshold, "failure_threshold", "10%", "stop once failed hosts pass it, percent of upgraded hosts or a count")
+	fleet_upgrade.Flags().StringVar(&stateFile, "state", "", "state file of the upgrade, fleet-<tag>.json if it is empty")
+	fleet_upgrade.Flags().DurationVar(&fleet.VerifyTimeout, "verify_timeout", fleet.VerifyTimeout, "how long a host has to run the tag after it is started")
+	inventoryFlags(fleet_upgrade)
+}
+
+func apiFleetUpgrade() error {
+	image, err := hub.Resolve(tag)
+	if err != nil {
+		return err
+	}
+	if stateFile == "" {
+		stateFile = fmt.Sprintf("fleet-%s.json", image.Tag)
+	}
+
+	state, err := fleet.LoadState(stateFile, image.Tag, group)
+	if err != nil {
+		return err
+	}
+	hosts, err := fleet.Discover(EtcdEndpoints, group)
+	if err != nil {
+		return err
+	}
+	if inventoryFile != "" {
+		if hosts, err = targetHosts(hosts); err != nil {
+			return err
+		}
+	}
+	state.Merge(hosts)
+	if len(state.Hosts) == 0 {
+		return fmt.Errorf("no watchdog is found in group[%s]", group)
+	}
+	if state.Stopped != "" {
+		log.Printf("[W] Resume the stopped upgrade, stopped: %s", state.Stopped)
+	}
+	log.Printf("[I] Upgrade %d hosts to %s, %d upgraded already, state: %s", len(state.Hosts), image.Tag, state.Count(fleet.StateUpgraded), stateFile)
+
+	var opts = fleet.Options{
+		Batch:     batch,
+		Pause:     pause,
+		Threshold: threshold,
+		Progress: func(batch, batches int, h *fleet.Host) {
+			if h.State == fleet.StateFailed {
+				log.Printf("[E] [%d/%d] %s (%s) failure, nest error: %s", batch, batches, h.Watchdog, h.Group, h.Error)
+			} else {
+				log.Printf("[I] [%d/%d] %s (%s) [%s]", batch, batches, h.Watchdog, h.Group, color.BlueString("OK"))
+			}
+		},
+	}
+	err = fleet.Upgrade(state, opts, func(h *fleet.Host) error {
+		return fleet.UpgradeHost(h, image.Tag)
+	})
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Watchdog", "Group", "State", "Error"})
+	for _, h := range state.Hosts {
+		table.Append([]string{h.Watchdog, h.Group, h.State, h.Error})
+	}
+	table.Render()
+	if err != nil {
+		return err
+	}
+	log.Printf("[I] %d hosts upgraded to %s [%s]", state.Count(fleet.StateUpgraded), image.Tag, color.BlueString("OK"))
+	return nil
+}
+
+// targetHosts returns hosts of which watchdogs are on hosts of target in inventory
+func targetHosts(hosts []*fleet.Host) ([]*fleet.Host, error) {
+	resources, err := inventoryResources()
+	if err != nil {
+		return nil, err
+	}
+	var ips = make(map[string]bool, 2*len(resources))
+	for _, r := range resources {
+		ips[r.InnerIP] = true
+		if r.OuterIP != "" {
+			ips[r.OuterIP] = true
+		}
+	}
+
+	var targets = make([]*fleet.Host, 0, len(hosts))
+	for _, h := range hosts {
+		ip, _, err := net.SplitHostPort(h.Watchdog)
+		if err == nil && ips[ip] {
+			targets = append(targets, h)
+		}
+	}
+	log.Printf("[I] %d of %d watchdogs are in target[%s] of inventory", len(targets), len(hosts), target)
+	return targets, nil
+}
@@ -2,11 +2,16 @@ package cmd
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/hub"
+	pb_hub "github.com/eviltomorrow/omega/internal/api/hub/pb"
 	"github.com/eviltomorrow/omega/pkg/self"
 	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
@@ -45,6 +50,60 @@ var hub_push = &cobra.Command{
 	},
 }
 
+var hub_pull = &cobra.Command{
+	Use:   "pull",
+	Short: "pull omega image or one artifact of it from hub",
+	Long:  "  \r\nhub api(pull)",
+	Run: func(cmd *cobra.Command, args []string) {
+		destroy, err := self.RegisterEtcd(EtcdEndpoints)
+		if err != nil {
+			log.Printf("[E] Register etcd failure, nest error: %v", err)
+			return
+		}
+		defer destroy()
+
+		if err := apiHubPull(); err != nil {
+			log.Printf("[E] Pull image failure, nest error: %v", err)
+		} else {
+			log.Printf("[%s]", color.BlueString("OK"))
+		}
+	},
+}
+
+var hub_sign = &cobra.Command{
+	Use:   "sign",
+	Short: "sign manifest of omega image",
+	Long:  "  \r\nhub api(sign)",
+	Run: func(cmd *cobra.Command, args []string) {
+		destroy, err := self.RegisterEtcd(EtcdEndpoints)
+		if err != nil {
+			log.Printf("[E] Register etcd failure, nest error: %v", err)
+			return
+		}
+		defer destroy()
+
+		if err := apiHubSign(); err != nil {
+			log.Printf("[E] Sign image failure, nest error: %v", err)
+		} else {
+			log.Printf("[%s]", color.BlueString("OK"))
+		}
+	},
+}
+
+var hub_keygen = &cobra.Command{
+	Use:   "keygen",
+	Short: "generate ed25519 key pair for signing images",
+	Long:  "  \r\nhub keygen",
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := hub.GenerateKey(signKey)
+		if err != nil {
+			log.Printf("[E] Generate key failure, nest error: %v", err)
+		} else {
+			log.Printf(" | %s, %s.pub (key id: %s) [%s]", signKey, signKey, hub.KeyID(key), color.BlueString("OK"))
+		}
+	},
+}
+
 var hub_list = &cobra.Command{
 	Use:   "list",
 	Short: "list omega images",
@@ -84,20 +143,137 @@ var hub_del = &cobra.Command{
 	},
 }
 
+var hub_promote = &cobra.Command{
+	Use:   "promote [tag]",
+	Short: "point a release channel at omega image",
+	Long:  "  \r\nhub api(promote)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 && !rollback {
+			log.Printf("[E] Tag is required unless --rollback is set")
+			return
+		}
+		destroy, err := self.RegisterEtcd(EtcdEndpoints)
+		if err != nil {
+			log.Printf("[E] Register etcd failure, nest error: %v", err)
+			return
+		}
+		defer destroy()
+
+		var target string
+		if len(args) != 0 {
+			target = args[0]
+		}
+		move, err := hub.Promote(channel, target, rollback)
+		if err != nil {
+			log.Printf("[E] Promote image failure, nest error: %v", err)
+		} else {
+			var from = move.From
+			if from == "" {
+				from = "-"
+			}
+			log.Printf(" | %s: %s -> %s [%s]", move.Channel, from, move.To, color.BlueString("OK"))
+		}
+	},
+}
+
+var hub_channels = &cobra.Command{
+	Use:   "channels",
+	Short: "list release channels and their history",
+	Long:  "  \r\nhub api(channels)",
+	Run: func(cmd *cobra.Command, args []string) {
+		destroy, err := self.RegisterEtcd(EtcdEndpoints)
+		if err != nil {
+			log.Printf("[E] Register etcd failure, nest error: %v", err)
+			return
+		}
+		defer destroy()
+
+		if err := apiHubChannels(); err != nil {
+			log.Printf("[E] List channels failure, nest error: %v", err)
+		}
+	},
+}
+
+var hub_gc = &cobra.Command{
+	Use:   "gc",
+	Short: "show omega images which retention of hub collects",
+	Long:  "  \r\nhub api(gc), images are deleted with --apply only",
+	Run: func(cmd *cobra.Command, args []string) {
+		destroy, err := self.RegisterEtcd(EtcdEndpoints)
+		if err != nil {
+			log.Printf("[E] Register etcd failure, nest error: %v", err)
+			return
+		}
+		defer destroy()
+
+		if err := apiHubGC(); err != nil {
+			log.Printf("[E] GC images failure, nest error: %v", err)
+		}
+	},
+}
+
 var (
+	apply       bool
+	channel     string
+	rollback    bool
 	releaseNote string
+	artifacts   []string
+	artifact    string
+	platform    string
+	signKey     string
+	trustedKeys []string
+	unsigned    bool
 )
 
 func init() {
 	// push
 	hub_root.AddCommand(hub_push)
 	hub_push.Flags().StringVar(&releaseNote, "release_note", "", "release_note about omega image")
-	hub_push.MarkFlagRequired("release_note")
 	hub_push.Flags().StringVar(&local, "local", "", "local path about omega image")
-	hub_push.MarkFlagRequired("local")
+	hub_push.Flags().StringVar(&tag, "tag", "", "tag of the image, it is required for --local built for other platforms, or for adding --artifact only")
+	hub_push.Flags().StringArrayVar(&artifacts, "artifact", nil, "artifact pushed with image, format: kind:path, kind is binary/config/script/plugin")
+	hub_push.Flags().StringVar(&signKey, "sign_key", "", "ed25519 private key which signs the image after pushing")
+
+	// sign
+	hub_root.AddCommand(hub_sign)
+	hub_sign.Flags().StringVar(&tag, "tag", "", "omega image tag")
+	hub_sign.MarkFlagRequired("tag")
+	hub_sign.Flags().StringVar(&signKey, "key", "", "ed25519 private key")
+	hub_sign.MarkFlagRequired("key")
+
+	// keygen
+	hub_root.AddCommand(hub_keygen)
+	hub_keygen.Flags().StringVar(&signKey, "out", "", "path of private key, public key is written to <out>.pub")
+	hub_keygen.MarkFlagRequired("out")
+
+	// pull
+	hub_root.AddCommand(hub_pull)
+	hub_pull.Flags().StringVar(&tag, "tag", "", "omega image tag or channel, latest if it is empty")
+	hub_pull.Flags().StringVar(&artifact, "artifact", "", "pull one artifact into --local file, all artifacts are pulled into --local folder if it is empty")
+	hub_pull.Flags().StringVar(&platform, "platform", hub.Platform, "GOOS/GOARCH of pulled binaries")
+	hub_pull.Flags().StringVar(&local, "local", "", "local path")
+	hub_pull.MarkFlagRequired("local")
+	hub_pull.Flags().StringSliceVar(&trustedKeys, "trusted_keys", nil, "ed25519 public key files or folders of *.pub files, the image must be signed by one of them")
+	hub_pull.Flags().BoolVar(&unsigned, "allow_unsigned", false, "pull the image without verifying its signatures")
+
+	// promote
+	hub_root.AddCommand(hub_promote)
+	hub_promote.Flags().StringVar(&channel, "channel", "", "release channel, such as canary, stable or lts")
+	hub_promote.MarkFlagRequired("channel")
+	hub_promote.Flags().BoolVar(&rollback, "rollback", false, "move the channel back to its previous image")
+
+	// channels
+	hub_root.AddCommand(hub_channels)
+	hub_channels.Flags().StringVar(&channel, "channel", "", "show history of the channel only")
+
+	// gc
+	hub_root.AddCommand(hub_gc)
+	hub_gc.Flags().BoolVar(&apply, "apply", false, "delete the images instead of showing them")
 
 	// list
 	hub_root.AddCommand(hub_list)
+	hub_list.Flags().StringVar(&tag, "tag", "", "list artifacts of the image")
 
 	// del
 	hub_root.AddCommand(hub_del)
@@ -106,11 +282,99 @@ func init() {
 }
 
 func apiHubPush() (string, error) {
-	return hub.Push(local, releaseNote)
+	type pending struct {
+		kind, path string
+	}
+	var list = make([]pending, 0, len(artifacts))
+	for _, a := range artifacts {
+		var attr = strings.SplitN(a, ":", 2)
+		if len(attr) != 2 || attr[0] == "" || attr[1] == "" {
+			return "", fmt.Errorf("invalid artifact[%s], expect: kind:path", a)
+		}
+		list = append(list, pending{kind: attr[0], path: attr[1]})
+	}
+
+	var key ed25519.PrivateKey
+	if signKey != "" {
+		var err error
+		if key, err = hub.LoadPrivateKey(signKey); err != nil {
+			return "", err
+		}
+	}
+
+	var md5 string
+	switch {
+	case local != "":
+		var err error
+		if tag, md5, err = hub.Push(local, tag, releaseNote); err != nil {
+			return "", err
+		}
+
+	case tag != "":
+		if len(list) == 0 {
+			return "", fmt.Errorf("no artifact to push")
+		}
+
+	default:
+		return "", fmt.Errorf("--local or --tag is required")
+	}
+
+	for _, a := range list {
+		sum, err := hub.PushArtifact(tag, a.path, "", a.kind)
+		if err != nil {
+			return "", fmt.Errorf("push artifact[%s] failure, nest error: %v", a.path, err)
+		}
+		if md5 == "" {
+			md5 = sum
+		}
+	}
+
+	if key != nil {
+		if err := hub.Sign(tag, key); err != nil {
+			return "", fmt.Errorf("sign image failure, nest error: %v", err)
+		}
+	}
+	return md5, nil
+}
+
+func apiHubSign() error {
+	key, err := hub.LoadPrivateKey(signKey)
+	if err != nil {
+		return err
+	}
+	return hub.Sign(tag, key)
+}
+
+func apiHubPull() error {
+	if tag == "" {
+		tag = "latest"
+	}
+	hub.AllowUnsigned = unsigned
+	if !unsigned {
+		if len(trustedKeys) == 0 {
+			return fmt.Errorf("no trusted key, set --trusted_keys or --allow_unsigned")
+		}
+		keys, err := hub.LoadPublicKeys(trustedKeys)
+		if err != nil {
+			return fmt.Errorf("load trusted keys failure, nest error: %v", err)
+		}
+		hub.TrustedKeys = keys
+	}
+	if artifact != "" {
+		return hub.PullArtifact(local, tag, artifact, platform)
+	}
+	image, err := hub.PullImage(local, tag, platform)
+	if err != nil {
+		return err
+	}
+	for _, a := range image.Artifacts {
+		log.Printf(" | %s/%s (%s)", local, a.Name, a.Kind)
+	}
+	return nil
 }
 
 func apiHubDel() (string, error) {
-	client, destroy, err := hub.NewClient()
+	client, destroy, err := hub.NewPrimaryClient()
 	if err != nil {
 		return "", err
 	}
@@ -134,6 +398,9 @@ func apiHubList() error {
 	if err != nil {
 		return err
 	}
+	if tag != "" {
+		return listArtifacts(resp.Images)
+	}
 	if len(resp.Images) == 0 {
 		log.Printf("Empty")
 	} else {
@@ -148,11 +415,14 @@ func apiHubList() error {
 			lines = append(lines, image.Tag)
 			lines = append(lines, image.Md5)
 			lines = append(lines, image.CreateTime)
+			lines = append(lines, strings.Join(hub.PlatformsOf(image), ","))
+			lines = append(lines, fmt.Sprintf("%d", len(image.Artifacts)))
+			lines = append(lines, strings.Join(keyIDs(image), ","))
 			lines = append(lines, image.ReleaseNotes)
 			data = append(data, lines)
 		}
 		table := tablewriter.NewWriter(os.Stdout)
-		table.SetHeader([]string{"No", "Tag", "MD5", "CreateTime", "Note"})
+		table.SetHeader([]string{"No", "Tag", "MD5", "CreateTime", "Platforms", "Artifacts", "Signed", "Note"})
 		for _, v := range data {
 			table.Append(v)
 		}
@@ -160,3 +430,109 @@ func apiHubList() error {
 	}
 	return nil
 }
+
+func apiHubChannels() error {
+	client, destroy, err := hub.NewClient()
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	resp, err := client.Channels(context.Background(), &wrapperspb.StringValue{Value: channel})
+	if err != nil {
+		return err
+	}
+	if len(resp.Channels) == 0 {
+		log.Printf("Empty")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Channel", "Tag", "UpdateTime", "Operator"})
+	for _, move := range resp.Channels {
+		if channel == "" || move.Channel == channel {
+			table.Append([]string{move.Channel, move.To, time.Unix(move.Time, 0).Format("2006-01-02 15:04:05"), move.Operator})
+		}
+	}
+	table.Render()
+
+	table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Time", "Channel", "From", "To", "Operator", "Peer", "Rollback"})
+	for _, move := range resp.History {
+		table.Append([]string{time.Unix(move.Time, 0).Format("2006-01-02 15:04:05"), move.Channel, move.From, move.To, move.Operator, move.Peer, fmt.Sprintf("%v", move.Rollback)})
+	}
+	table.Render()
+	return nil
+}
+
+func apiHubGC() error {
+	client, destroy, err := hub.NewPrimaryClient()
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	resp, err := client.GC(context.Background(), &pb_hub.GCRequest{DryRun: !apply})
+	if err != nil {
+		return err
+	}
+
+	var collected int
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Tag", "Size", "Action", "KeptBy"})
+	for _, image := range resp.Images {
+		var action = "keep"
+		if len(image.KeptBy) == 0 {
+			collected++
+			action = "delete"
+			if resp.DryRun {
+				action = "would delete"
+			}
+		}
+		table.Append([]string{image.Tag, fmt.Sprintf("%d", image.Size), action, strings.Join(image.KeptBy, ", ")})
+	}
+	table.Render()
+	if resp.DryRun {
+		log.Printf("[I] Dry run, %d images, %d bytes would be freed", collected, resp.Freed)
+	} else {
+		log.Printf("[I] %d images deleted, %d bytes freed [%s]", collected, resp.Freed, color.BlueString("OK"))
+	}
+	return nil
+}
+
+func listArtifacts(images []*pb_hub.Image) error {
+	var image *pb_hub.Image
+	for _, i := range images {
+		if i.Tag == tag {
+			image = i
+		}
+	}
+	if image == nil {
+		return fmt.Errorf("image[%s] not exist", tag)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Kind", "Platform", "Size", "Mode", "SHA256"})
+	for _, a := range image.Artifacts {
+		var platform = a.Platform
+		if platform == "" {
+			platform = "any"
+		}
+		table.Append([]string{a.Name, a.Kind, platform, fmt.Sprintf("%d", a.Size), fs.FileMode(a.Mode).String(), a.Sha256})
+	}
+	table.Render()
+	if ids := keyIDs(image); len(ids) != 0 {
+		log.Printf("Signed by: %s", strings.Join(ids, ", "))
+	} else {
+		log.Printf("Unsigned")
+	}
+	return nil
+}
+
+func keyIDs(image *pb_hub.Image) []string {
+	var ids = make([]string, 0, len(image.Signatures))
+	for _, sig := range image.Signatures {
+		ids = append(ids, hub.KeyID(sig.PublicKey))
+	}
+	return ids
+}
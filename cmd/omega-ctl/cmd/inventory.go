@@ -0,0 +1,511 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eviltomorrow/omega/internal/installer"
+	"github.com/eviltomorrow/omega/internal/inventory"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var inventory_root = &cobra.Command{
+	Use:   "inventory",
+	Short: "inventory's api support",
+	Long:  "  \r\nomega-ctl inventory api support, hosts are kept in a file encrypted with a passphrase or a key file, the passphrase is read from $OMEGA_INVENTORY_PASSPHRASE or prompted",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var inventory_add = &cobra.Command{
+	Use:   "add",
+	Short: "add host, group or private key to inventory",
+	Long:  "  \r\nadd host, group or private key to inventory, the inventory is created if it doesn't exist",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var inventory_add_host = &cobra.Command{
+	Use:   "host",
+	Short: "add or replace host",
+	Long:  "  \r\nadd host, or replace the host with the same name, its group is created if it doesn't exist",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiInventoryAddHost(); err != nil {
+			log.Printf("[E] Add host failure, nest error: %v", err)
+		}
+	},
+}
+
+var inventory_add_group = &cobra.Command{
+	Use:   "group",
+	Short: "add group or set its vars",
+	Long:  "  \r\nadd group or set its vars, a var with empty value is deleted. Vars of group are the defaults of its hosts, home_dir, endpoints and trusted_keys(local *.pub files separated by comma) are used by install, and vars named <section>.<key> override omega.conf, e.g. watchdog.memory-limit=512MB",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiInventoryAddGroup(); err != nil {
+			log.Printf("[E] Add group failure, nest error: %v", err)
+		}
+	},
+}
+
+var inventory_add_key = &cobra.Command{
+	Use:   "key",
+	Short: "add ssh private key which hosts refer to by name",
+	Long:  "  \r\nadd ssh private key into inventory, hosts refer to it with --key <name>",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiInventoryAddKey(); err != nil {
+			log.Printf("[E] Add key failure, nest error: %v", err)
+		}
+	},
+}
+
+var inventory_edit = &cobra.Command{
+	Use:   "edit",
+	Short: "edit inventory with $EDITOR",
+	Long:  "  \r\ndecrypt inventory into a temp file, open it with $EDITOR and encrypt it again, the inventory is unchanged if it is invalid",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiInventoryEdit(); err != nil {
+			log.Printf("[E] Edit inventory failure, nest error: %v", err)
+		}
+	},
+}
+
+var inventory_list = &cobra.Command{
+	Use:   "list",
+	Short: "list groups and hosts of inventory",
+	Long:  "  \r\nlist groups and hosts of inventory, passwords and keys are not printed",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiInventoryList(); err != nil {
+			log.Printf("[E] List inventory failure, nest error: %v", err)
+		}
+	},
+}
+
+var inventory_import = &cobra.Command{
+	Use:   "import",
+	Short: "import hosts of resource.txt",
+	Long:  "  \r\nimport hosts of resource.txt, home_dir and endpoints become vars of their group and private key files are copied into inventory",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiInventoryImport(); err != nil {
+			log.Printf("[E] Import resource failure, nest error: %v", err)
+		}
+	},
+}
+
+const (
+	envInventory           = "OMEGA_INVENTORY"
+	envInventoryPassphrase = "OMEGA_INVENTORY_PASSPHRASE"
+)
+
+var (
+	inventoryFile    string
+	inventoryKeyFile string
+	target           string
+
+	invName        string
+	invInnerIP     string
+	invOuterIP     string
+	invPort        int
+	invUsername    string
+	invPassword    string
+	invAskPassword bool
+	invKey         string
+	invGroup       string
+	invVars        []string
+	invKeyFile     string
+	invResource    string
+)
+
+func init() {
+	root.AddCommand(inventory_root)
+	inventory_root.AddCommand(inventory_add)
+	inventory_root.AddCommand(inventory_edit)
+	inventory_root.AddCommand(inventory_list)
+	inventory_root.AddCommand(inventory_import)
+	inventory_add.AddCommand(inventory_add_host)
+	inventory_add.AddCommand(inventory_add_group)
+	inventory_add.AddCommand(inventory_add_key)
+
+	var flags = inventory_root.PersistentFlags()
+	flags.StringVar(&inventoryFile, "inventory", "", "encrypted inventory file, $OMEGA_INVENTORY or inventory.enc if it is empty")
+	flags.StringVar(&inventoryKeyFile, "inventory_key_file", "", "key file of inventory, the passphrase is used if it is empty")
+
+	inventory_add_host.Flags().StringVar(&invName, "name", "", "name of host, inner ip if it is empty")
+	inventory_add_host.Flags().StringVar(&invInnerIP, "inner_ip", "", "inner ip of host, which omega is registered with")
+	inventory_add_host.MarkFlagRequired("inner_ip")
+	inventory_add_host.Flags().StringVar(&invOuterIP, "outer_ip", "", "outer ip of host, ssh connects to it if it is set")
+	inventory_add_host.Flags().IntVar(&invPort, "port", 22, "ssh port of host")
+	inventory_add_host.Flags().StringVar(&invUsername, "username", "root", "ssh username of host")
+	inventory_add_host.Flags().StringVar(&invPassword, "password", "", "ssh password of host, prefer --ask_password or --key")
+	inventory_add_host.Flags().BoolVar(&invAskPassword, "ask_password", false, "prompt for ssh password of host")
+	inventory_add_host.Flags().StringVar(&invKey, "key", "", fmt.Sprintf("name of private key in inventory, or %s<path> of a private key file", inventory.KeyFilePrefix))
+	inventory_add_host.Flags().StringVar(&invGroup, "group", "", "group of host")
+	inventory_add_host.MarkFlagRequired("group")
+	inventory_add_host.Flags().StringArrayVar(&invVars, "var", nil, "var of host which overrides var of its group, key=value")
+
+	inventory_add_group.Flags().StringVar(&invName, "name", "", "name of group")
+	inventory_add_group.MarkFlagRequired("name")
+	inventory_add_group.Flags().StringArrayVar(&invVars, "var", nil, "var of group, key=value")
+
+	inventory_add_key.Flags().StringVar(&invName, "name", "", "name of key, base name of --file if it is empty")
+	inventory_add_key.Flags().StringVar(&invKeyFile, "file", "", "ssh private key file")
+	inventory_add_key.MarkFlagRequired("file")
+
+	inventory_list.Flags().StringVar(&target, "target", "all", "all, or groups and hosts separated by comma")
+
+	inventory_import.Flags().StringVar(&invResource, "resource", "", "resource.txt to import")
+	inventory_import.MarkFlagRequired("resource")
+}
+
+// inventoryFlags adds flags which select hosts of inventory to cmd
+func inventoryFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&inventoryFile, "inventory", "", "encrypted inventory file used instead of resource.txt")
+	cmd.Flags().StringVar(&inventoryKeyFile, "inventory_key_file", "", "key file of inventory, the passphrase is used if it is empty")
+	cmd.Flags().StringVar(&target, "target", "all", "hosts of inventory, all, or groups and hosts separated by comma")
+}
+
+// inventorySecret returns the secret of inventory, the passphrase is prompted
+// twice if confirm is true
+func inventorySecret(confirm bool) (inventory.Secret, error) {
+	if inventoryKeyFile != "" {
+		return inventory.Secret{KeyFile: inventoryKeyFile}, nil
+	}
+	if passphrase := os.Getenv(envInventoryPassphrase); passphrase != "" {
+		return inventory.Secret{Passphrase: passphrase}, nil
+	}
+
+	passphrase, err := prompt("Inventory passphrase: ")
+	if err != nil {
+		return inventory.Secret{}, err
+	}
+	if passphrase == "" {
+		return inventory.Secret{}, fmt.Errorf("passphrase is empty")
+	}
+	if confirm {
+		again, err := prompt("Confirm passphrase: ")
+		if err != nil {
+			return inventory.Secret{}, err
+		}
+		if again != passphrase {
+			return inventory.Secret{}, fmt.Errorf("passphrases don't match")
+		}
+	}
+	return inventory.Secret{Passphrase: passphrase}, nil
+}
+
+// prompt reads a line from terminal without echo
+func prompt(msg string) (string, error) {
+	var fd = int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("stdin isn't a terminal, set $%s or --inventory_key_file", envInventoryPassphrase)
+	}
+	fmt.Fprint(os.Stderr, msg)
+	buf, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// openInventory loads inventory, a new one is returned if it doesn't exist
+// and create is true
+func openInventory(create bool) (*inventory.Inventory, inventory.Secret, error) {
+	if inventoryFile == "" {
+		inventoryFile = os.Getenv(envInventory)
+	}
+	if inventoryFile == "" {
+		inventoryFile = "inventory.enc"
+	}
+	_, err := os.Stat(inventoryFile)
+	if os.IsNotExist(err) && create {
+		log.Printf("[I] Create inventory: %s", inventoryFile)
+		s, err := inventorySecret(inventoryKeyFile == "")
+		return inventory.New(), s, err
+	}
+	if err != nil {
+		return nil, inventory.Secret{}, err
+	}
+
+	s, err := inventorySecret(false)
+	if err != nil {
+		return nil, s, err
+	}
+	inv, err := inventory.Load(inventoryFile, s)
+	return inv, s, err
+}
+
+func apiInventoryAddHost() error {
+	inv, s, err := openInventory(true)
+	if err != nil {
+		return err
+	}
+	vars, err := inventory.ParseVars(invVars)
+	if err != nil {
+		return err
+	}
+	if invAskPassword {
+		if invPassword, err = prompt(fmt.Sprintf("Password of %s@%s: ", invUsername, invInnerIP)); err != nil {
+			return err
+		}
+	}
+
+	var h = &inventory.Host{
+		Name:     invName,
+		InnerIP:  invInnerIP,
+		OuterIP:  invOuterIP,
+		Port:     invPort,
+		Username: invUsername,
+		Password: invPassword,
+		Key:      invKey,
+		Group:    invGroup,
+		Vars:     vars,
+	}
+	var replaced = inv.PutHost(h)
+	if err := inv.Save(inventoryFile, s); err != nil {
+		return err
+	}
+	if replaced {
+		log.Printf("[I] Replace host %s (%s) [%s]", h.Name, h.Group, color.BlueString("OK"))
+	} else {
+		log.Printf("[I] Add host %s (%s) [%s]", h.Name, h.Group, color.BlueString("OK"))
+	}
+	return nil
+}
+
+func apiInventoryAddGroup() error {
+	inv, s, err := openInventory(true)
+	if err != nil {
+		return err
+	}
+	vars, err := inventory.ParseVars(invVars)
+	if err != nil {
+		return err
+	}
+
+	g, ok := inv.Groups[invName]
+	if !ok {
+		g = &inventory.Group{}
+		inv.Groups[invName] = g
+	}
+	if g.Vars == nil {
+		g.Vars = make(map[string]string, len(vars))
+	}
+	for k, v := range vars {
+		if v == "" {
+			delete(g.Vars, k)
+		} else {
+			g.Vars[k] = v
+		}
+	}
+	if err := inv.Save(inventoryFile, s); err != nil {
+		return err
+	}
+	log.Printf("[I] Set group %s, vars: %s [%s]", invName, formatVars(g.Vars), color.BlueString("OK"))
+	return nil
+}
+
+func apiInventoryAddKey() error {
+	buf, err := ioutil.ReadFile(invKeyFile)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(buf, []byte("PRIVATE KEY")) {
+		return fmt.Errorf("%s isn't a private key", invKeyFile)
+	}
+	if invName == "" {
+		invName = filepath.Base(invKeyFile)
+	}
+
+	inv, s, err := openInventory(true)
+	if err != nil {
+		return err
+	}
+	inv.Keys[invName] = string(buf)
+	if err := inv.Save(inventoryFile, s); err != nil {
+		return err
+	}
+	log.Printf("[I] Add key %s, hosts refer to it with --key %s [%s]", invName, invName, color.BlueString("OK"))
+	return nil
+}
+
+func apiInventoryEdit() error {
+	inv, s, err := openInventory(false)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile("", "inventory-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(inv.Plain()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	var editor = os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	var c = exec.Command("sh", "-c", fmt.Sprintf("%s %s", editor, installer.Quote(tmp.Name())))
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("run editor[%s] failure, nest error: %v", editor, err)
+	}
+
+	plain, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(plain, inv.Plain()) {
+		log.Printf("[I] Inventory is unchanged")
+		return nil
+	}
+	edited, err := inventory.Parse(plain)
+	if err != nil {
+		return fmt.Errorf("inventory is unchanged, nest error: %v", err)
+	}
+	if err := edited.Save(inventoryFile, s); err != nil {
+		return err
+	}
+	log.Printf("[I] Save inventory: %s [%s]", inventoryFile, color.BlueString("OK"))
+	return nil
+}
+
+func apiInventoryList() error {
+	inv, _, err := openInventory(false)
+	if err != nil {
+		return err
+	}
+	hosts, err := inv.Select(target)
+	if err != nil {
+		return err
+	}
+
+	groups := tablewriter.NewWriter(os.Stdout)
+	groups.SetHeader([]string{"Group", "Hosts", "Vars"})
+	for _, name := range inv.GroupNames() {
+		var count int
+		for _, h := range hosts {
+			if h.Group == name {
+				count++
+			}
+		}
+		if count == 0 && target != "all" {
+			continue
+		}
+		groups.Append([]string{name, strconv.Itoa(count), formatVars(inv.Groups[name].Vars)})
+	}
+	groups.Render()
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Inner IP", "Outer IP", "Port", "Username", "Auth", "Group", "Vars"})
+	for _, h := range hosts {
+		var auth = "password"
+		if h.Key != "" {
+			auth = "key: " + h.Key
+		}
+		table.Append([]string{h.Name, h.InnerIP, h.OuterIP, strconv.Itoa(h.Port), h.Username, auth, h.Group, formatVars(h.Vars)})
+	}
+	table.Render()
+
+	var keys = make([]string, 0, len(inv.Keys))
+	for name := range inv.Keys {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	log.Printf("[I] %d hosts, keys: [%s]", len(hosts), strings.Join(keys, ", "))
+	return nil
+}
+
+func apiInventoryImport() error {
+	file, err := os.Open(invResource)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	inv, s, err := openInventory(true)
+	if err != nil {
+		return err
+	}
+	n, err := inv.Import(file)
+	if err != nil {
+		return err
+	}
+	if err := inv.Save(inventoryFile, s); err != nil {
+		return err
+	}
+	log.Printf("[I] Import %d hosts into %s [%s]", n, inventoryFile, color.BlueString("OK"))
+	log.Printf("[W] %s has passwords in plaintext, delete it once the inventory is checked: omega-ctl inventory list", invResource)
+	return nil
+}
+
+func formatVars(vars map[string]string) string {
+	var pairs = make([]string, 0, len(vars))
+	for k, v := range vars {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// inventoryResources returns resources of hosts of target in inventory
+func inventoryResources() ([]*resource, error) {
+	inv, _, err := openInventory(false)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := inv.Select(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources = make([]*resource, 0, len(hosts))
+	for _, h := range hosts {
+		key, err := inv.PrivateKey(h)
+		if err != nil {
+			return nil, fmt.Errorf("private key of host[%s] failure, nest error: %v", h.Name, err)
+		}
+		var (
+			vars = inv.Vars(h)
+			r    = &resource{
+				OuterIP:    h.OuterIP,
+				InnerIP:    h.InnerIP,
+				Port:       h.Port,
+				Username:   h.Username,
+				Password:   h.Password,
+				HomeDir:    vars[inventory.VarHomeDir],
+				Endpoints:  vars[inventory.VarEndpoints],
+				GroupName:  h.Group,
+				Config:     inventory.ConfigVars(vars),
+				PrivateKey: key,
+			}
+		)
+		if keys := vars[inventory.VarTrustedKeys]; keys != "" {
+			r.TrustedKeys = strings.Split(keys, ",")
+		}
+		if r.Port == 0 {
+			r.Port = 22
+		}
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
@@ -105,23 +105,23 @@ func init() {
 	omega_ping.Flags().StringVar(&addr, "addr", "", "omega'service addr")
 	omega_ping.MarkFlagRequired("addr")
 
-	// upload
-	omega_root.AddCommand(file_upload)
-	file_upload.Flags().StringVar(&addr, "addr", "", "omega'service addr")
-	file_upload.MarkFlagRequired("addr")
-	file_upload.Flags().StringVar(&local, "local", "", "local file path")
-	file_upload.MarkFlagRequired("local")
-	file_upload.Flags().StringVar(&remote, "remote", "", "remote file path")
-	file_upload.MarkFlagRequired("remote")
-
-	// download
-	omega_root.AddCommand(file_download)
-	file_download.Flags().StringVar(&addr, "addr", "", "omega'service addr")
-	file_download.MarkFlagRequired("addr")
-	file_download.Flags().StringVar(&local, "local", "", "local file path")
-	file_download.MarkFlagRequired("local")
-	file_download.Flags().StringVar(&remote, "remote", "", "remote file path")
-	file_download.MarkFlagRequired("remote")
+	// upload, deprecated
+	omega_root.AddCommand(omega_upload)
+	omega_upload.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	omega_upload.MarkFlagRequired("addr")
+	omega_upload.Flags().StringVar(&local, "local", "", "local file path")
+	omega_upload.MarkFlagRequired("local")
+	omega_upload.Flags().StringVar(&remote, "remote", "", "remote file path")
+	omega_upload.MarkFlagRequired("remote")
+
+	// download, deprecated
+	omega_root.AddCommand(omega_download)
+	omega_download.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	omega_download.MarkFlagRequired("addr")
+	omega_download.Flags().StringVar(&local, "local", "", "local file path")
+	omega_download.MarkFlagRequired("local")
+	omega_download.Flags().StringVar(&remote, "remote", "", "remote file path")
+	omega_download.MarkFlagRequired("remote")
 
 	omega_root.AddCommand(terminal_root)
 }
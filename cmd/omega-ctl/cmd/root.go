@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/eviltomorrow/omega/pkg/file"
 	"github.com/eviltomorrow/omega/pkg/self"
 	"github.com/spf13/cobra"
 )
@@ -31,10 +32,12 @@ func init() {
 	root.CompletionOptions = cobra.CompletionOptions{
 		DisableDefaultCmd: true,
 	}
+	root.PersistentFlags().StringVar(&file.Compressor, "compressor", file.Compressor, "compressor of file and image transfers: zstd, gzip or identity which disables it, zstd falls back to gzip for peers without it")
 	root.AddCommand(service_root)
 	root.AddCommand(omega_root)
 	root.AddCommand(watchdog_root)
 	root.AddCommand(hub_root)
+	root.AddCommand(fleet_root)
 }
 
 func Execute() error {
@@ -5,9 +5,18 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/eviltomorrow/omega/internal/installer"
+	"github.com/eviltomorrow/omega/internal/system"
+	"github.com/eviltomorrow/omega/pkg/crontab"
 	"github.com/eviltomorrow/omega/pkg/self"
+	"github.com/eviltomorrow/omega/pkg/systemd"
+	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -34,8 +43,171 @@ var service_list = &cobra.Command{
 	},
 }
 
+var service_install = &cobra.Command{
+	Use:   "install",
+	Short: "start service on boot with systemd or crontab",
+	Long:  "  \r\ninstall systemd unit of service with --systemd, running omega-watchdog started as a daemon is stopped and its crontab @reboot entry is removed first. Crontab @reboot entry is used without it or if systemd is absent",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiServiceInstall(); err != nil {
+			log.Printf("[E] Install service failure, nest error: %v", err)
+		}
+	},
+}
+
+var service_remove = &cobra.Command{
+	Use:   "remove",
+	Short: "remove systemd unit and crontab entry of service",
+	Long:  "  \r\nstop and remove systemd unit of service, and remove its crontab @reboot entry",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiServiceRemove(); err != nil {
+			log.Printf("[E] Remove service failure, nest error: %v", err)
+		}
+	},
+}
+
+var (
+	serviceName  string
+	serviceHome  string
+	serviceUser  string
+	useSystemd   bool
+	printUnit    bool
+	watchdogSec  time.Duration
+	serviceDescs = map[string]string{
+		"omega-watchdog":  "omega watchdog, supervises omega agent",
+		"omega-collector": "omega collector",
+		"omega-hub":       "omega hub, image server of omega",
+	}
+)
+
 func init() {
 	service_root.AddCommand(service_list)
+
+	service_root.AddCommand(service_install)
+	service_install.Flags().StringVar(&serviceName, "name", "omega-watchdog", "service name[omega-watchdog/omega-collector/omega-hub]")
+	service_install.Flags().StringVar(&serviceHome, "home", "", "home of omega, parent of bin of omega-ctl if it is empty")
+	service_install.Flags().BoolVar(&useSystemd, "systemd", false, "install systemd unit, crontab is used if systemd is absent")
+	service_install.Flags().StringVar(&serviceUser, "user", "", "user of systemd unit, current user if it is empty")
+	service_install.Flags().DurationVar(&watchdogSec, "watchdog_sec", 30*time.Second, "systemd restarts service which sends no keepalive in it, 0 disables it")
+	service_install.Flags().BoolVar(&printUnit, "print", false, "print systemd unit only")
+
+	service_root.AddCommand(service_remove)
+	service_remove.Flags().StringVar(&serviceName, "name", "omega-watchdog", "service name[omega-watchdog/omega-collector/omega-hub]")
+	service_remove.Flags().StringVar(&serviceHome, "home", "", "home of omega, parent of bin of omega-ctl if it is empty")
+}
+
+// serviceUnit returns the systemd unit of serviceName in serviceHome
+func serviceUnit() (systemd.Unit, error) {
+	desc, ok := serviceDescs[serviceName]
+	if !ok {
+		return systemd.Unit{}, fmt.Errorf("unknown service[%s], expect: omega-watchdog/omega-collector/omega-hub", serviceName)
+	}
+	if serviceHome == "" {
+		serviceHome = filepath.Join(system.RootDir, "..")
+	}
+	home, err := filepath.Abs(serviceHome)
+	if err != nil {
+		return systemd.Unit{}, err
+	}
+	if serviceUser == "" {
+		if u, err := user.Current(); err == nil {
+			serviceUser = u.Username
+		}
+	}
+
+	var bin = filepath.Join(home, "bin")
+	return systemd.Unit{
+		Name:        serviceName,
+		Description: desc,
+		Dir:         bin,
+		ExecStart:   filepath.Join(bin, serviceName),
+		User:        serviceUser,
+		WatchdogSec: watchdogSec,
+		KillProcess: serviceName == "omega-watchdog",
+	}, nil
+}
+
+func apiServiceInstall() error {
+	unit, err := serviceUnit()
+	if err != nil {
+		return err
+	}
+	if printUnit {
+		fmt.Print(string(unit.Render()))
+		return nil
+	}
+	if _, err := os.Stat(unit.ExecStart); err != nil {
+		return fmt.Errorf("service binary not found, nest error: %v", err)
+	}
+
+	if useSystemd {
+		if systemd.Available() {
+			// the crontab entry would start a second instance on boot
+			if removed, err := crontab.RemoveReboot(serviceName, unit.Dir); err != nil {
+				log.Printf("[W] Remove crontab entry failure, nest error: %v", err)
+			} else if removed {
+				log.Printf("[I] Crontab entry of %s is replaced by systemd unit", serviceName)
+			}
+			// the instance of the unit fails on the port and pid file while
+			// omega-watchdog started as a daemon is running
+			if serviceName == "omega-watchdog" {
+				running, err := stopDaemon(filepath.Dir(unit.Dir))
+				if err != nil {
+					return fmt.Errorf("stop running omega-watchdog failure, nest error: %v", err)
+				}
+				if len(running) != 0 {
+					log.Printf("[I] Stop running %v, it is started by systemd unit", running)
+				}
+			}
+			if err := systemd.Install(unit); err != nil {
+				return err
+			}
+			log.Printf("[I] Install systemd unit %s [%s]", systemd.Path(serviceName), color.BlueString("OK"))
+			return nil
+		}
+		log.Printf("[W] Systemd is absent, fall back to crontab")
+	}
+
+	if systemd.Installed(serviceName) {
+		return fmt.Errorf("systemd unit %s is installed, remove it first", systemd.Path(serviceName))
+	}
+	if err := crontab.RegisterReboot(serviceName, unit.Dir); err != nil {
+		return fmt.Errorf("register crontab failure, nest error: %v", err)
+	}
+	log.Printf("[I] Install crontab entry: %s [%s]", crontab.RebootLine(serviceName, unit.Dir), color.BlueString("OK"))
+	return nil
+}
+
+// stopDaemon stops omega-watchdog and omega in home as the installer does, it
+// returns names of those which were running
+func stopDaemon(home string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), installer.StopTimeout+installer.Timeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "sh", "-c", installer.StopScript(home)).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error: %v, output: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.Fields(string(output)), nil
+}
+
+func apiServiceRemove() error {
+	unit, err := serviceUnit()
+	if err != nil {
+		return err
+	}
+	if systemd.Installed(serviceName) {
+		if err := systemd.Remove(serviceName); err != nil {
+			return err
+		}
+		log.Printf("[I] Remove systemd unit %s [%s]", systemd.Path(serviceName), color.BlueString("OK"))
+	}
+	removed, err := crontab.RemoveReboot(serviceName, unit.Dir)
+	if err != nil {
+		return fmt.Errorf("remove crontab entry failure, nest error: %v", err)
+	}
+	if removed {
+		log.Printf("[I] Remove crontab entry of %s [%s]", serviceName, color.BlueString("OK"))
+	}
+	return nil
 }
 
 func apiServiceList(service string) error {
@@ -2,9 +2,9 @@ package cmd
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -13,17 +13,24 @@ import (
 	"sync"
 	"time"
 
+	"github.com/eviltomorrow/omega/internal/installer"
 	"github.com/eviltomorrow/omega/pkg/file"
-	"github.com/eviltomorrow/omega/pkg/tools"
 	"github.com/spf13/cobra"
-	"github.com/tidwall/gjson"
 )
 
 var omega_install = &cobra.Command{
 	Use:   "install",
 	Short: "install omega-watchdog tool",
-	Long:  "  \r\nomega-ctl install omega api support",
+	Long:  "  \r\nomega-ctl install omega api support, steps are upload, stop, unpack, config, keys, folders, start and verify, every step may be run again and a failed install is rolled back",
 	Run: func(cmd *cobra.Command, args []string) {
+		if checkOnly {
+			if path, err := apiWatchdogCheck(goroutines); err != nil {
+				log.Printf("[E] Check watchdog failure, nest error: %v", err)
+			} else {
+				log.Printf("[I] Check complete, report: cat %s", path)
+			}
+			return
+		}
 		if path, err := apiWatchdogInstall(goroutines); err != nil {
 			log.Printf("[E] Install watchdog failure, nest error: %v", err)
 		} else {
@@ -32,17 +39,9 @@ var omega_install = &cobra.Command{
 	},
 }
 
-var omega_uninstall = &cobra.Command{
-	Use:   "uninstall",
-	Short: "uninstall omega-watchdog tool",
-	Long:  "  \r\nomega-ctl uninstall omega api support",
-	Run: func(cmd *cobra.Command, args []string) {
-
-	},
-}
-
 var (
 	imageDir   string
+	checkOnly  bool
 	goroutines = 3
 )
 
@@ -50,75 +49,77 @@ func init() {
 	root.AddCommand(omega_install)
 	omega_install.Flags().StringVar(&imageDir, "image_dir", "image", "image location to install")
 	omega_install.MarkFlagRequired("image_dir")
-
-	// 未实现
-	_ = omega_uninstall
+	omega_install.Flags().BoolVar(&checkOnly, "check", false, "report drift of installed hosts from the image and resource.txt, nothing is changed")
+	omega_install.Flags().StringSliceVar(&trustedKeys, "trusted_keys", nil, "*.pub files of hub keygen put in etc/trusted-keys, trusted_keys var of inventory is preferred")
+	inventoryFlags(omega_install)
 }
 
 func apiWatchdogInstall(num int) (string, error) {
 	var (
 		resourceFile = filepath.Join(imageDir, "resource.txt")
 		imageFile    = filepath.Join(imageDir, "omega.tar.gz")
-		shellFile    = filepath.Join(imageDir, "omega-install.sh")
 	)
+	if err := checkFiles(imageFile); err != nil {
+		return "", err
+	}
+
+	return runResources("install", resourceFile, num, func(r *resource) (string, error) {
+		info, err := install(r, imageFile)
+		if err != nil {
+			return "", fmt.Errorf("install image failure, nest error: %v", err)
+		}
+		return fmt.Sprintf("install image success, info: %v", info), nil
+	})
+}
 
-	for _, path := range []string{imageFile, resourceFile, shellFile} {
+func checkFiles(paths ...string) error {
+	for _, path := range paths {
 		fi, err := os.Stat(path)
 		if err != nil {
-			return "", err
+			return err
 		}
 		if fi.IsDir() {
-			return "", fmt.Errorf("path is a dir, nest path: %v", path)
+			return fmt.Errorf("path is a dir, nest path: %v", path)
 		}
 	}
+	return nil
+}
 
-	f, err := os.Open(resourceFile)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-
+// runResources runs f on resources of resourceFile, or hosts of inventory if
+// it is set, with num goroutines, and writes results to
+// <name>-report-<time>.log which is returned.
+func runResources(name string, resourceFile string, num int, f func(r *resource) (string, error)) (string, error) {
 	var (
 		now     = time.Now()
-		logPath = fmt.Sprintf("install-report-%s.log", now.Format("2006-01-02 15:04:05"))
+		logPath = fmt.Sprintf("%s-report-%s.log", name, now.Format("2006-01-02 15:04:05"))
 	)
+
 	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
 	if err != nil {
 		return "", err
 	}
 	defer logFile.Close()
 
-	var scanner = bufio.NewScanner(f)
-	scanner.Split(bufio.ScanLines)
-
-	var resources = make([]*resource, 0, 128)
-loop:
-	for scanner.Scan() {
-		var line = strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
+	var resources []*resource
+	if inventoryFile != "" {
+		resources, err = inventoryResources()
+	} else {
+		resources, err = loadResources(resourceFile, logFile)
+	}
+	if err != nil {
+		return "", err
+	}
 
-		var r = &resource{}
-		if err := json.Unmarshal([]byte(line), r); err != nil {
-			log.Printf("[E] Unmarshal line to resource failure, nest error: %v", err)
-			logFile.WriteString(fmt.Sprintf("[E] Unmarshal line to resource failure, nest error: %v\r\n", err))
-			continue
-		}
-		for _, data := range []string{r.InnerIP, r.Username, r.HomeDir, r.Endpoints, r.GroupName} {
-			if data == "" {
-				log.Printf("[E] Invalid resource, nest resource: %v", r.String())
-				logFile.WriteString(fmt.Sprintf("[E] Invalid resource, nest resource: %v\r\n", r.String()))
-				continue loop
-			}
-		}
-		if r.Password == "" && r.PrivateKeyPath == "" {
+	var valid = resources[:0]
+	for _, r := range resources {
+		if !r.valid() {
 			log.Printf("[E] Invalid resource, nest resource: %v", r.String())
 			logFile.WriteString(fmt.Sprintf("[E] Invalid resource, nest resource: %v\r\n", r.String()))
 			continue
 		}
-		resources = append(resources, r)
+		valid = append(valid, r)
 	}
+	resources = valid
 
 	var (
 		p = make(chan *resource, 32)
@@ -134,7 +135,7 @@ loop:
 	var signal = make(chan struct{}, 1)
 	go func() {
 		for r := range s {
-			logFile.WriteString(r)
+			logFile.WriteString(r + "\r\n")
 		}
 		signal <- struct{}{}
 	}()
@@ -144,13 +145,13 @@ loop:
 		wait.Add(1)
 		go func() {
 			for r := range p {
-				info, err := install(r, imageFile, shellFile)
+				info, err := f(r)
 				if err != nil {
-					var msg = fmt.Sprintf("[E] Install image failure, resource: %v, nest error: %v", r.InnerIP, err)
+					var msg = fmt.Sprintf("[E] Resource: %v, nest error: %v", r.InnerIP, err)
 					s <- msg
 					log.Print(msg)
 				} else {
-					var msg = fmt.Sprintf("[I] Install image success, resource: %v, info: %v", r.InnerIP, info)
+					var msg = fmt.Sprintf("[I] Resource: %v, %v", r.InnerIP, info)
 					s <- msg
 					log.Print(msg)
 				}
@@ -165,56 +166,86 @@ loop:
 	return logPath, nil
 }
 
-func install(r *resource, imageFile string, shellFile string) (string, error) {
+// loadResources reads resources of resourceFile in json lines, a line which
+// isn't json is logged to report and skipped
+func loadResources(resourceFile string, report io.Writer) ([]*resource, error) {
+	file, err := os.Open(resourceFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var scanner = bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+
+	var resources = make([]*resource, 0, 128)
+	for scanner.Scan() {
+		var line = strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var r = &resource{}
+		if err := json.Unmarshal([]byte(line), r); err != nil {
+			log.Printf("[E] Unmarshal line to resource failure, nest error: %v", err)
+			fmt.Fprintf(report, "[E] Unmarshal line to resource failure, nest error: %v\r\n", err)
+			continue
+		}
+		resources = append(resources, r)
+	}
+	return resources, scanner.Err()
+}
+
+// dial connects to the host of r with ssh
+func dial(r *resource) (*file.SCP, error) {
 	var host = r.InnerIP
 	if r.OuterIP != "" {
 		host = r.OuterIP
 	}
 
-	var pk []byte
-	if r.PrivateKeyPath != "" {
+	var pk = r.PrivateKey
+	if pk == nil && r.PrivateKeyPath != "" {
 		buf, err := ioutil.ReadFile(r.PrivateKeyPath)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		pk = buf
 	}
-	scp, err := file.NewSCP(r.Username, r.Password, host, r.Port, pk, timeout)
+	return file.NewSCP(r.Username, r.Password, host, r.Port, pk, timeout)
+}
+
+// install installs imageFile on the host of r step by step, a failed install
+// is rolled back
+func install(r *resource, imageFile string) (string, error) {
+	scp, err := dial(r)
 	if err != nil {
 		return "", err
 	}
 	defer scp.Close()
 
-	var (
-		imageName = filepath.Base(imageFile)
-		shellName = filepath.Base(shellFile)
-		imagePath = filepath.Join(r.HomeDir, imageName)
-		shellPath = filepath.Join(r.HomeDir, shellName)
-	)
-
-	if err := scp.Upload(imageFile, imagePath); err != nil {
-		return "", err
-	}
-	if err := scp.Upload(shellFile, shellPath); err != nil {
-		return "", err
-	}
-
-	var c = fmt.Sprintf("cd %s; chmod a+x %s; ./%s -i %s -o %s -e %s -g %s", r.HomeDir, shellPath, shellName, r.InnerIP, r.OuterIP, r.Endpoints, r.GroupName)
-	stdout, stderr, err := scp.Run(c, timeout)
-	var buf bytes.Buffer
-	buf.WriteString(tools.BytesToStringSlow(stdout))
-	buf.WriteString(tools.BytesToStringSlow(stderr))
-	if err != nil {
-		return "", fmt.Errorf("error: %v, output: %v", err, buf.String())
-	}
-	if len(buf.Bytes()) != 0 {
-		isJson := gjson.Valid(buf.String())
-		if isJson {
-			return buf.String(), nil
-		}
-		return "", fmt.Errorf("%s", buf.String())
+	var i = &installer.Installer{
+		Remote: scp,
+		Target: r.target(),
+		Image:  imageFile,
+		Registered: func() (bool, error) {
+			services, err := registered(strings.Split(r.Endpoints, ","), r.GroupName, r.InnerIP)
+			if err != nil {
+				return false, err
+			}
+			return services["omega-watchdog"] && services["omega"], nil
+		},
+		Progress: func(step, state, info string) {
+			switch state {
+			case installer.StateFailed, installer.StateRollbackFailed:
+				log.Printf("[E] Resource: %v, %s %s, nest error: %s", r.InnerIP, step, state, info)
+			case installer.StateRolledBack:
+				log.Printf("[W] Resource: %v, %s %s", r.InnerIP, step, state)
+			default:
+				log.Printf("[I] Resource: %v, %s %s %s", r.InnerIP, step, state, info)
+			}
+		},
 	}
-	return "", fmt.Errorf("[panic] stdout: nil")
+	return i.Install()
 }
 
 type resource struct {
@@ -227,9 +258,45 @@ type resource struct {
 	HomeDir        string `json:"home_dir"`
 	Endpoints      string `json:"endpoints"`
 	GroupName      string `json:"group_name"`
+	// Config overrides omega.conf, it is resolved from inventory
+	Config map[string]string `json:"-"`
+	// PrivateKey is resolved from inventory, it is used instead of PrivateKeyPath
+	PrivateKey []byte `json:"-"`
+	// TrustedKeys are resolved from inventory, or --trusted_keys
+	TrustedKeys []string `json:"-"`
+}
+
+func (r *resource) target() installer.Target {
+	var keys = r.TrustedKeys
+	if len(keys) == 0 {
+		keys = trustedKeys
+	}
+	return installer.Target{
+		InnerIP:     r.InnerIP,
+		OuterIP:     r.OuterIP,
+		HomeDir:     r.HomeDir,
+		Endpoints:   r.Endpoints,
+		Group:       r.GroupName,
+		Config:      r.Config,
+		TrustedKeys: keys,
+	}
 }
 
+func (r *resource) valid() bool {
+	for _, data := range []string{r.InnerIP, r.Username, r.HomeDir, r.Endpoints, r.GroupName} {
+		if data == "" {
+			return false
+		}
+	}
+	return r.Password != "" || r.PrivateKeyPath != "" || len(r.PrivateKey) != 0
+}
+
+// String returns r in json, its password is masked
 func (r *resource) String() string {
-	buf, _ := json.Marshal(r)
+	var masked = *r
+	if masked.Password != "" {
+		masked.Password = "******"
+	}
+	buf, _ := json.Marshal(&masked)
 	return string(buf)
 }
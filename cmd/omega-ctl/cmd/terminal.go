@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/eviltomorrow/omega/internal/api/terminal"
@@ -20,6 +21,21 @@ var terminal_root = &cobra.Command{
 	},
 }
 
+var terminal_run = &cobra.Command{
+	Use:   "run [flags] -- program [args...]",
+	Short: "run program with omega without pty",
+	Long:  "  \r\nterminal api(Exec), stdin/stdout/stderr are piped to program",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		code, err := apiOmegaRun(args[0], args[1:])
+		if err != nil {
+			log.Printf("[E] Run program with omega failure, nest error: %v", err)
+			os.Exit(255)
+		}
+		os.Exit(code)
+	},
+}
+
 var (
 	mode string
 )
@@ -31,6 +47,11 @@ func init() {
 	terminal_root.Flags().StringVar(&addr, "addr", "", "wartchdog'service addr")
 	terminal_root.MarkFlagRequired("addr")
 
+	// run
+	omega_root.AddCommand(terminal_run)
+	terminal_run.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	terminal_run.MarkFlagRequired("addr")
+	terminal_run.Flags().StringVar(&Timeout, "timeout", "10s", "omega's api timeout")
 }
 
 func apiOmegaTerminal() error {
@@ -55,3 +76,12 @@ func apiOmegaTerminal() error {
 		return fmt.Errorf("not support mode[%s]", mode)
 	}
 }
+
+func apiOmegaRun(program string, args []string) (int, error) {
+	if addr == "" || !strings.Contains(addr, ":") {
+		return -1, fmt.Errorf("target is invalid")
+	}
+
+	var timeout = setTimeout(Timeout)
+	return terminal.RunLocal(addr, timeout, program, args, os.Stdin, os.Stdout, os.Stderr)
+}
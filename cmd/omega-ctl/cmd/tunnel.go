@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/eviltomorrow/omega/internal/api/tunnel"
+	"github.com/eviltomorrow/omega/internal/api/tunnel/pb"
+	"github.com/spf13/cobra"
+)
+
+var tunnel_root = &cobra.Command{
+	Use:   "tunnel",
+	Short: "forward tcp port through omega",
+	Long:  "  \r\ntunnel api(Connect/Listen), eg. omega-ctl tunnel -L 15432:db:5432 --addr 192.168.1.2:28501",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiTunnel(); err != nil {
+			log.Printf("[E] Tunnel failure, nest error: %v", err)
+		}
+	},
+}
+
+var (
+	localForwards, remoteForwards []string
+	via, viaPassword, viaPkFile   string
+)
+
+func init() {
+	root.AddCommand(tunnel_root)
+	tunnel_root.Flags().StringVar(&addr, "addr", "", "omega'service addr")
+	tunnel_root.MarkFlagRequired("addr")
+	tunnel_root.Flags().StringArrayVarP(&localForwards, "local", "L", nil, "local forward, [bind_address:]port:host:hostport, host is dialed by omega")
+	tunnel_root.Flags().StringArrayVarP(&remoteForwards, "remote", "R", nil, "remote forward, [bind_address:]port:host:hostport, port is listened by omega, bind_address must be loopback or in tunnel.listen-allow of omega")
+	tunnel_root.Flags().StringVar(&via, "via", "", "local forward through ssh server reachable from omega, eg. root@10.0.0.2:22")
+	tunnel_root.Flags().StringVar(&viaPassword, "via_password", "", "password of ssh server")
+	tunnel_root.Flags().StringVar(&viaPkFile, "via_pk_file", "", "private key file of ssh server")
+}
+
+func apiTunnel() error {
+	if addr == "" || !strings.Contains(addr, ":") {
+		return fmt.Errorf("addr format error")
+	}
+	if len(localForwards) == 0 && len(remoteForwards) == 0 {
+		return fmt.Errorf("no forward is specified, use -L or -R")
+	}
+
+	viaResource, err := parseVia()
+	if err != nil {
+		return err
+	}
+
+	stub, destroy, err := tunnel.NewClient(addr)
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var errs = make(chan error, len(localForwards)+len(remoteForwards))
+	for _, spec := range localForwards {
+		forward, err := tunnel.ParseForward(spec)
+		if err != nil {
+			return err
+		}
+		go func() { errs <- tunnel.Local(ctx, stub, forward, viaResource) }()
+		log.Printf("[I] Local forward: %s", forward)
+	}
+	for _, spec := range remoteForwards {
+		forward, err := tunnel.ParseForward(spec)
+		if err != nil {
+			return err
+		}
+		go func() { errs <- tunnel.Remote(ctx, stub, forward) }()
+		log.Printf("[I] Remote forward: %s", forward)
+	}
+
+	var ch = make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-ch:
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+func parseVia() (*pb.Via, error) {
+	if via == "" {
+		return nil, nil
+	}
+
+	var (
+		username = "root"
+		hostport = via
+	)
+	if idx := strings.LastIndex(via, "@"); idx != -1 {
+		username, hostport = via[:idx], via[idx+1:]
+	}
+	if !strings.Contains(hostport, ":") {
+		hostport = net.JoinHostPort(hostport, "22")
+	}
+	host, p, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, fmt.Errorf("invalid via[%s], nest error: %v", via, err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid via[%s], nest error: %v", via, err)
+	}
+
+	var pk []byte
+	if viaPkFile != "" {
+		pk, err = ioutil.ReadFile(viaPkFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if viaPassword == "" && len(pk) == 0 {
+		return nil, fmt.Errorf("via_password or via_pk_file is required with via")
+	}
+	return &pb.Via{
+		Host:     host,
+		Port:     int32(port),
+		Username: username,
+		Password: viaPassword,
+		Pk:       pk,
+		Timeout:  int32(setTimeout(Timeout).Seconds()),
+	}, nil
+}
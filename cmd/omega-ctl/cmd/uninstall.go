@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/eviltomorrow/omega/internal/installer"
+	"github.com/eviltomorrow/omega/internal/remoteconf"
+	"github.com/eviltomorrow/omega/pkg/self"
+	"github.com/spf13/cobra"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+var omega_uninstall = &cobra.Command{
+	Use:   "uninstall",
+	Short: "uninstall omega-watchdog tool",
+	Long:  "  \r\nomega-ctl uninstall omega api support, it stops omega-watchdog and omega, removes their systemd units and crontab entries, deregisters them from etcd and deletes the install dir",
+	Run: func(cmd *cobra.Command, args []string) {
+		if path, err := apiWatchdogUninstall(goroutines); err != nil {
+			log.Printf("[E] Uninstall watchdog failure, nest error: %v", err)
+		} else {
+			log.Printf("[I] Uninstall complete, report: cat %s", path)
+		}
+	},
+}
+
+var omega_reinstall = &cobra.Command{
+	Use:   "reinstall",
+	Short: "uninstall and install omega-watchdog tool",
+	Long:  "  \r\nomega-ctl reinstall omega api support",
+	Run: func(cmd *cobra.Command, args []string) {
+		if path, err := apiWatchdogReinstall(goroutines); err != nil {
+			log.Printf("[E] Reinstall watchdog failure, nest error: %v", err)
+		} else {
+			log.Printf("[I] Reinstall complete, report: cat %s", path)
+		}
+	},
+}
+
+func init() {
+	root.AddCommand(omega_uninstall)
+	omega_uninstall.Flags().StringVar(&imageDir, "image_dir", "image", "image location which has resource.txt")
+	inventoryFlags(omega_uninstall)
+
+	root.AddCommand(omega_reinstall)
+	omega_reinstall.Flags().StringVar(&imageDir, "image_dir", "image", "image location to install")
+	omega_reinstall.MarkFlagRequired("image_dir")
+	omega_reinstall.Flags().StringSliceVar(&trustedKeys, "trusted_keys", nil, "*.pub files of hub keygen put in etc/trusted-keys, trusted_keys var of inventory is preferred")
+	inventoryFlags(omega_reinstall)
+}
+
+func apiWatchdogUninstall(num int) (string, error) {
+	var resourceFile = filepath.Join(imageDir, "resource.txt")
+	return runResources("uninstall", resourceFile, num, func(r *resource) (string, error) {
+		info, err := uninstall(r)
+		if err != nil {
+			return "", fmt.Errorf("uninstall failure, done: [%s], nest error: %v", info, err)
+		}
+		return fmt.Sprintf("uninstall success, info: %s", info), nil
+	})
+}
+
+func apiWatchdogReinstall(num int) (string, error) {
+	var (
+		resourceFile = filepath.Join(imageDir, "resource.txt")
+		imageFile    = filepath.Join(imageDir, "omega.tar.gz")
+	)
+	if err := checkFiles(imageFile); err != nil {
+		return "", err
+	}
+
+	return runResources("reinstall", resourceFile, num, func(r *resource) (string, error) {
+		if info, err := uninstall(r); err != nil {
+			return "", fmt.Errorf("uninstall failure, done: [%s], nest error: %v", info, err)
+		}
+		info, err := install(r, imageFile)
+		if err != nil {
+			return "", fmt.Errorf("install image failure, nest error: %v", err)
+		}
+		return fmt.Sprintf("reinstall success, info: %v", info), nil
+	})
+}
+
+// uninstall removes omega installed in home_dir of r, every step may be run
+// again after it fails. It returns steps which are done.
+func uninstall(r *resource) (string, error) {
+	if !filepath.IsAbs(r.HomeDir) {
+		return "", fmt.Errorf("home_dir[%s] must be absolute", r.HomeDir)
+	}
+	scp, err := dial(r)
+	if err != nil {
+		return "", err
+	}
+	defer scp.Close()
+
+	var (
+		home = filepath.Join(r.HomeDir, "omega")
+		bin  = filepath.Join(home, "bin")
+		done = make([]string, 0, 5)
+	)
+
+	// units and crontab entries are removed first, so omega-watchdog isn't
+	// started again after it is stopped
+	units, err := installer.Run(scp, fmt.Sprintf(`for name in omega-watchdog omega-collector omega-hub; do
+    unit=/etc/systemd/system/${name}.service
+    if [ -e ${unit} ] && grep -qxF %s ${unit}; then
+        systemctl disable --now ${name} > /dev/null || exit 1
+        rm -f ${unit} || exit 1
+        systemctl daemon-reload
+        echo ${name}
+    fi
+done`, installer.Quote("WorkingDirectory="+bin)), timeout)
+	if err != nil {
+		return strings.Join(done, ", "), fmt.Errorf("remove systemd units failure, nest error: %v", err)
+	}
+	done = append(done, fmt.Sprintf("systemd: [%s]", strings.Join(strings.Fields(units), " ")))
+
+	entries, err := installer.Run(scp, fmt.Sprintf(`if crontab -l > /dev/null 2>&1; then
+    n=$(crontab -l | grep -cF %[1]s)
+    if [ "${n}" != "0" ]; then
+        crontab -l | grep -vF %[1]s | crontab - || exit 1
+    fi
+    echo ${n}
+else
+    echo 0
+fi`, installer.Quote("cd "+bin+";")), timeout)
+	if err != nil {
+		return strings.Join(done, ", "), fmt.Errorf("remove crontab entries failure, nest error: %v", err)
+	}
+	done = append(done, fmt.Sprintf("crontab: %s entries", strings.TrimSpace(entries)))
+
+	running, err := installer.Stop(scp, home)
+	if err != nil {
+		return strings.Join(done, ", "), fmt.Errorf("stop omega failure, nest error: %v", err)
+	}
+	done = append(done, fmt.Sprintf("stop: [%s]", strings.Join(running, " ")))
+
+	n, err := deregister(strings.Split(r.Endpoints, ","), r.GroupName, r.InnerIP)
+	if err != nil {
+		return strings.Join(done, ", "), fmt.Errorf("deregister from etcd failure, nest error: %v", err)
+	}
+	done = append(done, fmt.Sprintf("etcd: %d keys", n))
+
+	// omega-install.sh is left by installs of former omega-ctl
+	var files = []string{installer.Quote(home)}
+	for _, name := range []string{"omega.bak", ".omega-upload", ".omega-unpack", "omega.tar.gz", "omega-install.sh"} {
+		files = append(files, installer.Quote(filepath.Join(r.HomeDir, name)))
+	}
+	if _, err := installer.Run(scp, fmt.Sprintf("rm -rf %s", strings.Join(files, " ")), timeout); err != nil {
+		return strings.Join(done, ", "), fmt.Errorf("delete install dir failure, nest error: %v", err)
+	}
+	done = append(done, fmt.Sprintf("dir: %s", home))
+	return strings.Join(done, ", "), nil
+}
+
+func newEtcdClient(endpoints []string) (*clientv3.Client, error) {
+	return clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: timeout,
+		LogConfig: &zap.Config{
+			Level:            zap.NewAtomicLevelAt(zap.ErrorLevel),
+			Development:      false,
+			Encoding:         "json",
+			EncoderConfig:    zap.NewProductionEncoderConfig(),
+			OutputPaths:      []string{"stderr"},
+			ErrorOutputPaths: []string{"stderr"},
+		},
+	})
+}
+
+// registeredKey returns the key prefix of service registered by ip in group
+func registeredKey(service, group, ip string) string {
+	return fmt.Sprintf("/%s/%s/%s/%s:", self.EtcdKeyPrefix, service, group, ip)
+}
+
+// deregister deletes omega-watchdog and omega registered by ip in group
+func deregister(endpoints []string, group, ip string) (int64, error) {
+	client, err := newEtcdClient(endpoints)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	var deleted int64
+	for _, service := range []string{"omega-watchdog", "omega"} {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		resp, err := client.Delete(ctx, registeredKey(service, group, ip), clientv3.WithPrefix())
+		cancel()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += resp.Deleted
+	}
+
+	// status of config applied by omega
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := client.Delete(ctx, remoteconf.StatusKey(group, ip)); err != nil {
+		return deleted, err
+	}
+	return deleted, nil
+}
@@ -4,11 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/watchdog"
 	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
+	"github.com/eviltomorrow/omega/internal/fleet"
+	"github.com/eviltomorrow/omega/pkg/self"
+	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -49,6 +56,54 @@ var watchdog_pull = &cobra.Command{
 	},
 }
 
+var watchdog_upgrade = &cobra.Command{
+	Use:   "upgrade",
+	Short: "show health check and rollback of the last pulled image",
+	Long:  "  \r\nwatchdog api(last-upgrade)",
+	Run: func(cmd *cobra.Command, args []string) {
+		upgrade, err := apiWatchdogLastUpgrade()
+		if err != nil {
+			log.Printf("[E] Get last upgrade failure, nest error: %v", err)
+			return
+		}
+		if upgrade.State == pb.Upgrade_NONE {
+			log.Printf("[I] No image is pulled since watchdog started")
+			return
+		}
+		log.Printf("[I] Tag: %s, md5: %s, previous md5: %s, state: %s", upgrade.Tag, upgrade.Md5, upgrade.PreviousMd5, upgrade.State)
+		if upgrade.Reason != "" {
+			log.Printf("[W] Reason: %s", upgrade.Reason)
+		}
+	},
+}
+
+var watchdog_status = &cobra.Command{
+	Use:   "status",
+	Short: "show omega supervised by one watchdog or watchdogs of a group",
+	Long:  "  \r\nwatchdog api(status), watchdogs are found in etcd without --addr",
+	Run: func(cmd *cobra.Command, args []string) {
+		var hosts = []*fleet.Host{{Watchdog: addr}}
+		if addr == "" {
+			destroy, err := self.RegisterEtcd(EtcdEndpoints)
+			if err != nil {
+				log.Printf("[E] Register etcd failure, nest error: %v", err)
+				return
+			}
+			defer destroy()
+
+			if hosts, err = fleet.Discover(EtcdEndpoints, group); err != nil {
+				log.Printf("[E] Discover watchdogs failure, nest error: %v", err)
+				return
+			}
+			if len(hosts) == 0 {
+				log.Printf("[E] No watchdog is found in group[%s]", group)
+				return
+			}
+		}
+		apiWatchdogStatus(hosts)
+	},
+}
+
 var (
 	sig, tag string
 )
@@ -68,6 +123,17 @@ func init() {
 	watchdog_pull.MarkFlagRequired("addr")
 	watchdog_pull.Flags().StringVar(&tag, "tag", "", "pull image with specify tag")
 	watchdog_pull.MarkFlagRequired("tag")
+
+	// upgrade
+	watchdog_root.AddCommand(watchdog_upgrade)
+	watchdog_upgrade.Flags().StringVar(&addr, "addr", "", "wartchdog'service addr")
+	watchdog_upgrade.MarkFlagRequired("addr")
+
+	// status
+	watchdog_root.AddCommand(watchdog_status)
+	watchdog_status.Flags().StringVar(&addr, "addr", "", "wartchdog'service addr, watchdogs of --group if it is empty")
+	watchdog_status.Flags().StringVar(&group, "group", "", "group of watchdogs, all groups if it is empty")
+	watchdog_status.Flags().StringVar(&Timeout, "timeout", "10s", "watchdog's api timeout")
 }
 
 func apiWatchdogNotify() (int32, error) {
@@ -113,3 +179,92 @@ func apiWatchdogPull() (string, error) {
 	}
 	return resp.Value, nil
 }
+
+func apiWatchdogLastUpgrade() (*pb.Upgrade, error) {
+	client, destroy, err := watchdog.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer destroy()
+
+	return client.LastUpgrade(context.Background(), &emptypb.Empty{})
+}
+
+func apiWatchdogStatus(hosts []*fleet.Host) {
+	var (
+		timeout  = setTimeout(Timeout)
+		statuses = make([]*pb.WatchdogStatus, len(hosts))
+		errs     = make([]error, len(hosts))
+		wg       sync.WaitGroup
+	)
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h *fleet.Host) {
+			defer wg.Done()
+
+			client, destroy, err := watchdog.NewClient(h.Watchdog)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer destroy()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			statuses[i], errs[i] = client.Status(ctx, &emptypb.Empty{})
+		}(i, h)
+	}
+	wg.Wait()
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Watchdog", "Group", "State", "Pid", "Uptime", "Tag", "Digest", "Restarts", "Last Exit", "RSS", "CPU"})
+	for i, h := range hosts {
+		if errs[i] != nil {
+			table.Append([]string{h.Watchdog, h.Group, "UNKNOWN", "", "", "", "", "", errs[i].Error(), "", ""})
+			continue
+		}
+		var (
+			s    = statuses[i]
+			pid  string
+			up   string
+			last string
+			rss  string
+			cpu  string
+		)
+		if s.Pid != 0 {
+			pid, up = fmt.Sprintf("%d", s.Pid), (time.Duration(s.Uptime) * time.Second).String()
+			rss, cpu = fmt.Sprintf("%.1fMiB", float64(s.Rss)/1024/1024), fmt.Sprintf("%.1f%%", s.CpuPercent)
+		}
+		if s.LastExit != nil {
+			last = fmt.Sprintf("%d, %s", s.LastExit.Code, s.LastExit.Reason)
+		}
+		var digest = s.Digest
+		if len(digest) > 12 {
+			digest = digest[:12]
+		}
+		table.Append([]string{h.Watchdog, h.Group, s.State.String(), pid, up, s.Tag, digest, fmt.Sprintf("%d", s.Restarts), last, rss, cpu})
+	}
+	table.Render()
+
+	// exits are listed for one watchdog only
+	if len(hosts) != 1 || statuses[0] == nil || len(statuses[0].History) == 0 {
+		return
+	}
+	table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Pid", "Start", "Exit", "Code", "Reason", "Backoff"})
+	for _, exit := range statuses[0].History {
+		var start string
+		if exit.StartTime != 0 {
+			start = time.Unix(exit.StartTime, 0).Format("2006-01-02 15:04:05")
+		}
+		table.Append([]string{
+			fmt.Sprintf("%d", exit.Pid),
+			start,
+			time.Unix(exit.ExitTime, 0).Format("2006-01-02 15:04:05"),
+			fmt.Sprintf("%d", exit.Code),
+			exit.Reason,
+			(time.Duration(exit.Backoff) * time.Millisecond).String(),
+		})
+	}
+	table.Render()
+}
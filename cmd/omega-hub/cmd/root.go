@@ -14,6 +14,7 @@ import (
 	"github.com/eviltomorrow/omega/internal/system"
 	"github.com/eviltomorrow/omega/pkg/lock"
 	"github.com/eviltomorrow/omega/pkg/self"
+	"github.com/eviltomorrow/omega/pkg/systemd"
 	"github.com/spf13/cobra"
 )
 
@@ -52,6 +53,10 @@ var root = &cobra.Command{
 		}
 		setupVars()
 
+		if err := hub.Migrate(); err != nil {
+			log.Fatalf("[F] Migrate images to blobs failure, nest error: %v\r\n", err)
+		}
+
 		if err := server.StartupGRPC(); err != nil {
 			code = 1
 			log.Printf("[F] Startup grpc server failure, nest error: %v\r\n", err)
@@ -60,6 +65,18 @@ var root = &cobra.Command{
 		registerCleanFuncs(server.ShutdownGRPC)
 		registerCleanFuncs(server.RevokeEtcdConn)
 
+		var stop = make(chan struct{})
+		registerCleanFuncs(func() error {
+			close(stop)
+			return nil
+		})
+		if hub.Primary != "" {
+			// replicas follow deletions of the primary
+			go hub.Replicate(stop)
+		} else if hub.KeepVersions > 0 {
+			go hub.CollectGarbage(stop)
+		}
+
 		var pidFile = filepath.Join(system.RootDir, "../var/run/omega-hub.pid")
 		plock, err := lock.CreateFileLock(pidFile)
 		if err != nil {
@@ -67,6 +84,13 @@ var root = &cobra.Command{
 		}
 		registerCleanFuncs(func() error { return lock.DestroyFileLock(plock) })
 
+		// readiness and keepalives are sent if it is started by systemd
+		if err := systemd.Ready(); err != nil {
+			log.Printf("[W] Notify systemd failure, nest error: %v\r\n", err)
+		}
+		registerCleanFuncs(systemd.Stopping)
+		go systemd.Keepalive(stop)
+
 		blockingUntilTermination()
 	},
 }
@@ -120,6 +144,21 @@ func setupVars() {
 	server.Port = DefaultGlobal.Global.GrpcServerPort
 	server.Endpoints = DefaultGlobal.Global.EtcdEndpoints
 	server.Key = fmt.Sprintf("%s/omega-hub", self.EtcdKeyPrefix)
+	hub.Primary = DefaultGlobal.Replication.Primary
+	if hub.Primary == "" {
+		// clients push to the primary, and pull from any hub
+		server.Key = fmt.Sprintf("%s/omega-hub/primary", self.EtcdKeyPrefix)
+	}
+	if DefaultGlobal.Replication.Period.Duration > 0 {
+		hub.ReplicaPeriod = DefaultGlobal.Replication.Period.Duration
+	}
+	hub.KeepVersions = DefaultGlobal.Retention.KeepVersions
+	if DefaultGlobal.Retention.RunningTTL.Duration > 0 {
+		hub.RunningTTL = DefaultGlobal.Retention.RunningTTL.Duration
+	}
+	if DefaultGlobal.Retention.Period.Duration > 0 {
+		hub.GCPeriod = DefaultGlobal.Retention.Period.Duration
+	}
 	hub.BinDir = filepath.Join(system.RootDir, hub.BinDir)
 	hub.ImageDir = filepath.Join(system.RootDir, hub.ImageDir)
 	hub.ImageLockFile = filepath.Join(system.RootDir, hub.ImageLockFile)
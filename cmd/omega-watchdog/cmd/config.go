@@ -3,6 +3,7 @@ package cmd
 import (
 	"bytes"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
@@ -15,7 +16,19 @@ var config_root = &cobra.Command{
 	Short: "Print version about omega-watchdog",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println(apiWatchdogConfig())
+		var overrides = make(map[string]string, len(sets))
+		for _, set := range sets {
+			var idx = strings.Index(set, "=")
+			if idx <= 0 {
+				log.Fatalf("[F] Invalid set[%s], expect: <section>.<key>=<value>\r\n", set)
+			}
+			overrides[set[:idx]] = set[idx+1:]
+		}
+		text, err := conf.Override(apiWatchdogConfig(), overrides)
+		if err != nil {
+			log.Fatalf("[F] Generate config failure, nest error: %v\r\n", err)
+		}
+		fmt.Println(text)
 	},
 }
 
@@ -23,6 +36,7 @@ var (
 	inner_ip, outer_ip string
 	endpoints          string
 	group              string
+	sets               []string
 )
 
 func init() {
@@ -31,6 +45,7 @@ func init() {
 	config_root.Flags().StringVar(&outer_ip, "outer_ip", "", "outer_ip propertites")
 	config_root.Flags().StringVar(&endpoints, "endpoints", "127.0.0.1:2379", "endpoints propertites")
 	config_root.Flags().StringVar(&group, "group", "omega-default", "group propertites")
+	config_root.Flags().StringArrayVar(&sets, "set", nil, "override config, <section>.<key>=<value>, eg. watchdog.memory-limit=512MB")
 }
 
 func apiWatchdogConfig() string {
@@ -95,11 +110,32 @@ func apiWatchdogConfig() string {
 	buf.WriteString("]\n")
 	buf.WriteString(fmt.Sprintf("group-name = \"%s\"\n", group))
 
-	buf.WriteString("\n[watchdog]\n")
+	buf.WriteString("\n# images pulled from hub must be signed by one of trusted-keys, unless allow-unsigned is true\n")
+	buf.WriteString("# omega-watchdog refuses to start without trusted-keys while allow-unsigned is false\n")
+	buf.WriteString("[watchdog]\n")
 	buf.WriteString("grpc-server-port = 28500\n")
+	buf.WriteString("trusted-keys = [\"../etc/trusted-keys\"]\n")
+	buf.WriteString("allow-unsigned = false\n")
+	buf.WriteString("# release channel of hub which omega follows, empty to upgrade by omega-ctl only\n")
+	buf.WriteString("channel = \"\"\n")
+	buf.WriteString("channel-check-period = \"5m\"\n")
+	buf.WriteString("# upgraded omega is rolled back if it fails Agent.Ping in the window, \"0s\" to disable\n")
+	buf.WriteString("health-window = \"30s\"\n")
+	buf.WriteString("# failed omega is restarted with backoff, it is degraded after failures in a row\n")
+	buf.WriteString("restart-backoff = \"1s\"\n")
+	buf.WriteString("restart-max-backoff = \"1m\"\n")
+	buf.WriteString("crash-loop-threshold = 5\n")
+	buf.WriteString("# limits of omega, 0 is unlimited. memory and cpu(cores) are limited with cgroup v2\n")
+	buf.WriteString("# in cgroup-dir if it is writable, otherwise they aren't limited\n")
+	buf.WriteString("memory-limit = \"0\"\n")
+	buf.WriteString("cpu-limit = 0.0\n")
+	buf.WriteString("nofile-limit = 0\n")
+	buf.WriteString("cgroup-dir = \"/sys/fs/cgroup/omega\"\n")
 
 	buf.WriteString("\n[agent]\n")
 	buf.WriteString("grpc-server-port = 28501\n")
 	buf.WriteString("period = \"60s\"\n")
+	buf.WriteString("# group of omega-collector which metrics are pushed to, group-name if it is empty\n")
+	buf.WriteString("collector-group = \"\"\n")
 	return buf.String()
 }
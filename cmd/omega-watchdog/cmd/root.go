@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"os"
@@ -10,7 +9,6 @@ import (
 	"path/filepath"
 	"sync"
 	"syscall"
-	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/hub"
 	"github.com/eviltomorrow/omega/internal/api/watchdog"
@@ -20,6 +18,7 @@ import (
 
 	"github.com/eviltomorrow/omega/pkg/lock"
 	"github.com/eviltomorrow/omega/pkg/self"
+	"github.com/eviltomorrow/omega/pkg/systemd"
 
 	"github.com/spf13/cobra"
 )
@@ -47,6 +46,7 @@ var root = &cobra.Command{
 		for _, dir := range []string{
 			filepath.Join(system.RootDir, "../var/run"),
 			filepath.Join(system.RootDir, "../var/images"),
+			filepath.Join(system.RootDir, "../etc/trusted-keys"),
 			filepath.Join(system.RootDir, "../log"),
 		} {
 			if err := initFolder(dir); err != nil {
@@ -78,128 +78,36 @@ var root = &cobra.Command{
 		registerCleanFuncs(server.ShutdownGRPC)
 		registerCleanFuncs(server.RevokeEtcdConn)
 
+		var stop = make(chan struct{})
+		registerCleanFuncs(func() error {
+			close(stop)
+			return nil
+		})
+		go watchdog.ReportRunning(fmt.Sprintf("%s:%d", server.InnerIP, server.Port), stop)
+		watchdog.AgentAddr = fmt.Sprintf("%s:%d", server.InnerIP, DefaultGlobal.Agent.GrpcServerPort)
+		if watchdog.Channel != "" {
+			go watchdog.FollowChannel(stop)
+		}
+
 		go func() {
-			var pidFile = "../var/run/omega.pid"
+			var (
+				pidFile = "../var/run/omega.pid"
+				adopted *os.Process
+			)
 			alock, err := lock.CreateFileLock(pidFile)
 			if err != nil {
-				p, err := self.LoadChild(pidFile)
+				adopted, err = self.LoadChild(pidFile)
 				if err != nil {
 					log.Fatalf("[F] Run omega-wathdog failure, nest error: load child process failure, nest error: %v\r\n", err)
 				}
-
-				var (
-					stop = make(chan struct{}, 1)
-				)
-				registerCleanFuncs(func() error {
-					stop <- struct{}{}
-					return nil
-				})
-				watchdog.Reload <- struct{}{}
-
-			loop:
-				for {
-					select {
-					case s := <-watchdog.Stop:
-						if s == 1 {
-							if err := p.Signal(syscall.SIGQUIT); err != nil {
-								log.Printf("[Panic] [Load]Process.Signal(SIGQUIT) failure, nest error: %v\r\n", err)
-								p.Kill()
-							}
-						}
-						watchdog.Pid <- watchdog.PS{Pid: p.Pid}
-						watchdog.Stop <- 0
-						break loop
-
-					case <-stop:
-						return
-					}
-				}
-				<-watchdog.Reload
-
 			} else {
 				lock.DestroyFileLock(alock)
-				watchdog.Reload <- struct{}{}
 			}
+			watchdog.Reload <- struct{}{}
 
-			for range watchdog.Reload {
-				watchdog.Reload <- struct{}{}
-				select {
-				case <-watchdog.Stop:
-				default:
-				}
-
-				cmd, err := self.RunChild("omega", []string{"-c", "omega.conf", "-p", pidFile}, logWriter)
-				if err != nil {
-					log.Printf("[Panic] [Reload] Run omega failure, nest error: %v\r\n", err)
-					watchdog.Pid <- watchdog.PS{Err: err}
-				} else {
-					var (
-						stop = make(chan struct{}, 1)
-						sig  = make(chan error, 1)
-					)
-
-					// stop
-					go func(c *exec.Cmd) {
-						if c == nil || c.Process == nil {
-							return
-						}
-
-						select {
-						case s := <-watchdog.Stop:
-							if s == 1 {
-								if err := c.Process.Signal(syscall.SIGQUIT); err != nil {
-									log.Printf("[Panic] [Reload]Process.Signal(SIGQUIT) failure, nest error: %v\r\n", err)
-									c.Process.Kill()
-								}
-							}
-
-							ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-							select {
-							case <-ctx.Done():
-								cancel()
-								watchdog.Pid <- watchdog.PS{Pid: c.Process.Pid, Err: fmt.Errorf("Process.Signal(quit) Cost is more than 2s")}
-							case err := <-sig:
-								cancel()
-								watchdog.Pid <- watchdog.PS{Pid: c.Process.Pid, Err: err}
-							}
-
-						case <-stop:
-
-						}
-					}(cmd)
-
-					// start
-					ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-					go func(c *exec.Cmd) {
-						if c == nil || c.Process == nil {
-							return
-						}
-						select {
-						case <-ctx.Done():
-							cancel()
-							watchdog.Pid <- watchdog.PS{Pid: c.Process.Pid}
-							// if err := crontab.RegisterRebootWatchdog(); err != nil {
-							// 	log.Printf("[W] Register watchdog to crontab failure, nest error: %v\r\n", err)
-							// }
-
-						case err := <-sig:
-							cancel()
-							if err != nil {
-								stop <- struct{}{}
-								close(stop)
-								watchdog.Pid <- watchdog.PS{Err: err}
-							} else {
-								log.Printf("[Panic] [Reload] Cmd.Wait's Cost is more than 2s")
-							}
-						}
-					}(cmd)
-					sig <- cmd.Wait()
-					close(sig)
-					watchdog.Stop <- 0
-				}
-
-				<-watchdog.Reload
-			}
+			watchdog.Supervise(func() (*exec.Cmd, error) {
+				return self.RunChild("omega", []string{"-c", "omega.conf", "-p", pidFile}, logWriter)
+			}, adopted, stop)
 		}()
 
 		plock, err := lock.CreateFileLock(pidFile)
@@ -208,6 +116,13 @@ var root = &cobra.Command{
 		}
 		registerCleanFuncs(func() error { return lock.DestroyFileLock(plock) })
 
+		// readiness and keepalives are sent if it is started by systemd
+		if err := systemd.Ready(); err != nil {
+			log.Printf("[W] Notify systemd failure, nest error: %v\r\n", err)
+		}
+		registerCleanFuncs(systemd.Stopping)
+		go systemd.Keepalive(stop)
+
 		blockingUntilTermination()
 	},
 }
@@ -263,6 +178,49 @@ func setupVars() {
 	server.Port = DefaultGlobal.Watchdog.GrpcServerPort
 	server.Endpoints = DefaultGlobal.Global.EtcdEndpoints
 	server.Key = fmt.Sprintf("%s/omega-watchdog/%s", self.EtcdKeyPrefix, DefaultGlobal.Global.GroupName)
+
+	hub.AllowUnsigned = DefaultGlobal.Watchdog.AllowUnsigned
+	var paths = make([]string, 0, len(DefaultGlobal.Watchdog.TrustedKeys))
+	for _, path := range DefaultGlobal.Watchdog.TrustedKeys {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(system.RootDir, path)
+		}
+		paths = append(paths, path)
+	}
+	keys, err := hub.LoadPublicKeys(paths)
+	if err == nil && len(keys) == 0 {
+		err = fmt.Errorf("no *.pub found in %v", paths)
+	}
+	if err != nil {
+		if !hub.AllowUnsigned {
+			log.Fatalf("[F] Load trusted keys failure, put *.pub of omega-ctl hub keygen in etc/trusted-keys(trusted_keys var of inventory or --trusted_keys of omega-ctl omega install) or set allow-unsigned = true of [watchdog], nest error: %v\r\n", err)
+		}
+		log.Printf("[W] Load trusted keys failure, images can't be verified, nest error: %v\r\n", err)
+	}
+	hub.TrustedKeys = keys
+
+	watchdog.Channel = DefaultGlobal.Watchdog.Channel
+	if DefaultGlobal.Watchdog.ChannelCheckPeriod.Duration > 0 {
+		watchdog.ChannelCheckPeriod = DefaultGlobal.Watchdog.ChannelCheckPeriod.Duration
+	}
+	watchdog.HealthWindow = DefaultGlobal.Watchdog.HealthWindow.Duration
+	if DefaultGlobal.Watchdog.RestartBackoff.Duration > 0 {
+		watchdog.RestartBackoff = DefaultGlobal.Watchdog.RestartBackoff.Duration
+	}
+	if DefaultGlobal.Watchdog.RestartMaxBackoff.Duration > 0 {
+		watchdog.RestartMaxBackoff = DefaultGlobal.Watchdog.RestartMaxBackoff.Duration
+	}
+	if DefaultGlobal.Watchdog.CrashLoopThreshold > 0 {
+		watchdog.CrashLoopThreshold = DefaultGlobal.Watchdog.CrashLoopThreshold
+	}
+	watchdog.Limit = watchdog.Limits{
+		Memory: int64(DefaultGlobal.Watchdog.MemoryLimit),
+		CPU:    DefaultGlobal.Watchdog.CPULimit,
+		Nofile: DefaultGlobal.Watchdog.NofileLimit,
+	}
+	if DefaultGlobal.Watchdog.CgroupDir != "" {
+		watchdog.CgroupDir = DefaultGlobal.Watchdog.CgroupDir
+	}
 }
 
 var mut sync.Mutex
@@ -273,7 +231,11 @@ func pullImageLatest() error {
 		if !os.IsNotExist(err) {
 			return err
 		} else {
-			if err := hub.Pull(server.BinFile, "latest"); err != nil {
+			var tag = "latest"
+			if watchdog.Channel != "" {
+				tag = watchdog.Channel
+			}
+			if err := hub.Pull(server.BinFile, tag); err != nil {
 				return err
 			}
 		}
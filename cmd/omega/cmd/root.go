@@ -8,14 +8,20 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/eviltomorrow/omega/internal/agent"
+	"github.com/eviltomorrow/omega/internal/api/file"
+	"github.com/eviltomorrow/omega/internal/api/tunnel"
 	"github.com/eviltomorrow/omega/internal/conf"
+	"github.com/eviltomorrow/omega/internal/remoteconf"
 	server "github.com/eviltomorrow/omega/internal/server/omega"
 	"github.com/eviltomorrow/omega/internal/system"
 	"github.com/eviltomorrow/omega/pkg/lock"
 	"github.com/eviltomorrow/omega/pkg/self"
 	"github.com/spf13/cobra"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
 )
 
 var root = &cobra.Command{
@@ -80,6 +86,14 @@ var root = &cobra.Command{
 		registerCleanFuncs(server.ShutdownGRPC)
 		registerCleanFuncs(server.RevokeEtcdConn)
 
+		closeWatcher, err := watchConfig(instance)
+		if err != nil {
+			code = 1
+			log.Printf("[F] Watch config in etcd failure, nest error: %v\r\n", err)
+			return
+		}
+		registerCleanFuncs(closeWatcher)
+
 		plock, err := lock.CreateFileLock(pidFile)
 		if err != nil {
 			code = 1
@@ -141,6 +155,54 @@ func setupVars() {
 	server.Port = DefaultGlobal.Agent.GrpcServerPort
 	server.Endpoints = DefaultGlobal.Global.EtcdEndpoints
 	server.Key = fmt.Sprintf("%s/omega/%s", self.EtcdKeyPrefix, DefaultGlobal.Global.GroupName)
+
+	file.Roots = make([]file.Root, 0, len(DefaultGlobal.File.Roots))
+	for _, root := range DefaultGlobal.File.Roots {
+		var path = root.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(system.RootDir, path)
+		}
+		// anything but "rw" is read-only
+		file.Roots = append(file.Roots, file.Root{Path: path, ReadOnly: root.Mode != "rw"})
+	}
+	file.MaxReadSize = int64(DefaultGlobal.File.MaxReadSize)
+	file.MaxWriteSize = int64(DefaultGlobal.File.MaxWriteSize)
+	file.UploadQuota = int64(DefaultGlobal.File.UploadQuota)
+	tunnel.ListenAllow = DefaultGlobal.Tunnel.ListenAllow
+}
+
+// watchConfig applies config of the group and host in etcd to instance whenever
+// it changes
+func watchConfig(instance *agent.Agent) (func() error, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   DefaultGlobal.Global.EtcdEndpoints,
+		DialTimeout: 5 * time.Second,
+		LogConfig: &zap.Config{
+			Level:            zap.NewAtomicLevelAt(zap.ErrorLevel),
+			Development:      false,
+			Encoding:         "json",
+			EncoderConfig:    zap.NewProductionEncoderConfig(),
+			OutputPaths:      []string{"stderr"},
+			ErrorOutputPaths: []string{"stderr"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create etcd client failure, nest error: %v", err)
+	}
+
+	var watcher = &remoteconf.Watcher{
+		Client: client,
+		Group:  DefaultGlobal.Global.GroupName,
+		IP:     server.InnerIP,
+		Base:   DefaultGlobal,
+		Apply:  instance.Reload,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go watcher.Run(ctx)
+	return func() error {
+		cancel()
+		return client.Close()
+	}, nil
 }
 
 func registerCleanFuncs(f func() error) {
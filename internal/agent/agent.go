@@ -26,9 +26,20 @@ import (
 )
 
 type Agent struct {
+	mut    sync.Mutex
 	config *conf.Config
+
+	output      omega.Output
+	clearOutput func()
+
+	// stop stops gather loops of plugins
+	stop chan struct{}
+	wg   sync.WaitGroup
 }
 
+// NewOutput creates the output of metrics to omega-collector of group
+var NewOutput = output.NewGrpcClient
+
 func NewAgent(config *conf.Config) (*Agent, error) {
 	return &Agent{config: config}, nil
 }
@@ -38,85 +49,191 @@ func (a *Agent) Run(ctx context.Context, signal chan struct{}) error {
 		return fmt.Errorf("config plugins failure, nest error: %v", err)
 	}
 
-	var wg sync.WaitGroup
-
-	ou, err := output.NewGrpcClient(a.config.Global.GroupName, a.config.Global.EtcdEndpoints)
+	ou, err := NewOutput(collectorGroup(a.config), a.config.Global.EtcdEndpoints)
 	if err != nil {
 		return err
 	}
-	defer ou.Close()
-
 	clearFunc, err := RunningOutputPool.RegisterOutput(ou)
 	if err != nil {
+		ou.Close()
 		return err
 	}
-	defer clearFunc()
+	a.mut.Lock()
+	a.output, a.clearOutput = ou, clearFunc
+	a.mut.Unlock()
+	defer func() {
+		a.mut.Lock()
+		defer a.mut.Unlock()
+		a.clearOutput()
+		a.output.Close()
+	}()
 
 	if err := RunningOutputPool.Start(); err != nil {
 		return fmt.Errorf("start output failure, nest error: %v", err)
 	}
+	a.mut.Lock()
+	a.startGather(a.config.Agent.Period.Duration)
+	a.mut.Unlock()
+
+	signal <- struct{}{}
+
+	<-ctx.Done()
+	a.mut.Lock()
+	a.stopGather()
+	a.mut.Unlock()
+
+	return nil
+}
+
+// Reload applies c without restart. Plugins are configured again and their
+// gather loops are restarted with the period of c, the output is replaced if
+// the group of omega-collector is changed. Nothing is changed if it fails.
+func (a *Agent) Reload(c *conf.Config) error {
+	if c.Agent.Period.Duration <= 0 {
+		return fmt.Errorf("invalid period[%v]", c.Agent.Period.Duration)
+	}
+	if err := validatePlugins(c); err != nil {
+		return err
+	}
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	if a.stop == nil {
+		return fmt.Errorf("agent isn't running")
+	}
+
+	// the new output is connected before anything is changed
+	var ou omega.Output
+	if group := collectorGroup(c); group != collectorGroup(a.config) {
+		var err error
+		if ou, err = NewOutput(group, c.Global.EtcdEndpoints); err != nil {
+			return err
+		}
+		if err := ou.Connect(); err != nil {
+			ou.Close()
+			return fmt.Errorf("connect to omega-collector of group[%s] failure, nest error: %v", group, err)
+		}
+		if running, ok := ou.(omega.Running); ok {
+			running.Start()
+		}
+	}
+
+	a.stopGather()
+	if err := ConfigPlugins(c); err != nil {
+		ConfigPlugins(a.config)
+		a.startGather(a.config.Agent.Period.Duration)
+		if ou != nil {
+			ou.Close()
+		}
+		return fmt.Errorf("config plugins failure, nest error: %v", err)
+	}
+	if ou != nil {
+		clearFunc, err := RunningOutputPool.RegisterOutput(ou)
+		if err == nil {
+			// the former output is removed after metrics are written to it
+			a.clearOutput()
+			if running, ok := a.output.(omega.Running); ok {
+				running.Stop()
+			}
+			a.output.Close()
+			a.output, a.clearOutput = ou, clearFunc
+		} else {
+			ou.Close()
+			zlog.Error("Register output failure", zap.Error(err))
+		}
+	}
+	a.config = c
+	a.startGather(c.Agent.Period.Duration)
+	return nil
+}
+
+func (a *Agent) startGather(period time.Duration) {
+	a.stop = make(chan struct{})
 	for name, plugin := range plugins.Repository {
 		var (
 			ac     = NewAccumulator(name, RunningOutputPool.Buffer())
-			ticker = ticker.NewAlignedTicker(time.Now(), a.config.Agent.Period.Duration, 0, 0)
+			ticker = ticker.NewAlignedTicker(time.Now(), period, 0, 0)
 		)
 
-		wg.Add(1)
-		go func(ticker omega.Ticker, ac omega.Accumulator, plugin plugins.Collector) {
-			gatherLoop(ticker, ac, plugin)
-			wg.Done()
-		}(ticker, ac, plugin)
-		registerClearFunc(ticker.Stop)
+		a.wg.Add(1)
+		go func(ticker omega.Ticker, ac omega.Accumulator, plugin plugins.Collector, stop chan struct{}) {
+			gatherLoop(ticker, ac, plugin, stop)
+			ticker.Stop()
+			a.wg.Done()
+		}(ticker, ac, plugin, a.stop)
 	}
+}
 
-	signal <- struct{}{}
-
-	for range ctx.Done() {
-		runClearFuncs()
+// stopGather stops gather loops and waits until they exit
+func (a *Agent) stopGather() {
+	if a.stop == nil {
+		return
 	}
-	wg.Wait()
-	resetClearFuncRepo()
+	close(a.stop)
+	a.wg.Wait()
+	a.stop = nil
+}
 
-	return nil
+func collectorGroup(config *conf.Config) string {
+	if config.Agent.CollectorGroup != "" {
+		return config.Agent.CollectorGroup
+	}
+	return config.Global.GroupName
 }
 
+// ConfigPlugins registers new plugins with config, a plugin absent from
+// config, or a field absent from config of a plugin, has its default value
 func ConfigPlugins(config *conf.Config) error {
-	for name, plugin := range plugins.Repository {
-		cp, ok := config.Plugins[name]
-		if !ok {
-			continue
-		}
-		if err := json.Unmarshal(cp.Byte(), plugin); err != nil {
+	var configured = make(map[string]plugins.Collector, len(plugins.Repository))
+	for name := range plugins.Repository {
+		plugin, err := newPlugin(name, config)
+		if err != nil {
 			return err
 		}
+		configured[name] = plugin
+	}
+	for name, plugin := range configured {
 		plugins.Register(name, plugin)
 	}
 	return nil
 }
 
-func gatherLoop(ticker omega.Ticker, ac omega.Accumulator, plugin plugins.Collector) {
-	for range ticker.Elapsed() {
-		metrics, err := plugin.Gather()
-		if err != nil {
-			zlog.Error("Gather metric failure", zap.String("name", ac.Name()), zap.Error(err))
-		} else {
-			ac.AddMetric(metrics)
+// validatePlugins checks config of plugins with new plugins, so that running
+// plugins are unchanged
+func validatePlugins(config *conf.Config) error {
+	for name := range plugins.Repository {
+		if _, err := newPlugin(name, config); err != nil {
+			return fmt.Errorf("invalid config of plugin[%s], nest error: %v", name, err)
 		}
 	}
+	return nil
 }
 
-var clearFuncRepo []func() = make([]func(), 0, 8)
-
-func registerClearFunc(f func()) {
-	clearFuncRepo = append(clearFuncRepo, f)
-}
-
-func runClearFuncs() {
-	for _, f := range clearFuncRepo {
-		f()
+func newPlugin(name string, config *conf.Config) (plugins.Collector, error) {
+	plugin, ok := plugins.New(name)
+	if !ok {
+		return nil, fmt.Errorf("not found plugin[%s]", name)
+	}
+	if cp, ok := config.Plugins[name]; ok {
+		if err := json.Unmarshal(cp.Byte(), plugin); err != nil {
+			return nil, err
+		}
 	}
+	return plugin, nil
 }
 
-func resetClearFuncRepo() {
-	clearFuncRepo = clearFuncRepo[:0]
+func gatherLoop(ticker omega.Ticker, ac omega.Accumulator, plugin plugins.Collector, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.Elapsed():
+		}
+		metrics, err := plugin.Gather()
+		if err != nil {
+			zlog.Error("Gather metric failure", zap.String("name", ac.Name()), zap.Error(err))
+		} else {
+			ac.AddMetric(metrics)
+		}
+	}
 }
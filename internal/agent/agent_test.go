@@ -2,10 +2,15 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/eviltomorrow/omega"
 	"github.com/eviltomorrow/omega/internal/conf"
-	_ "github.com/eviltomorrow/omega/pkg/plugins/cpu"
+	"github.com/eviltomorrow/omega/internal/output"
+	"github.com/eviltomorrow/omega/pkg/plugins"
+	"github.com/eviltomorrow/omega/pkg/plugins/cpu"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -34,3 +39,92 @@ func TestAgentRun(t *testing.T) {
 	err = agent.Run(context.Background(), nil)
 	judge.Nil(err)
 }
+
+type fakeOutput struct {
+	group   string
+	fail    bool
+	closed  bool
+	metrics int
+}
+
+func (o *fakeOutput) Connect() error {
+	if o.fail {
+		return fmt.Errorf("no omega-collector in group[%s]", o.group)
+	}
+	return nil
+}
+
+func (o *fakeOutput) Close() error {
+	o.closed = true
+	return nil
+}
+
+func (o *fakeOutput) WriteMetric(metrics []omega.Metric) error {
+	o.metrics++
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	judge := assert.New(t)
+
+	var outputs = map[string]*fakeOutput{}
+	NewOutput = func(group string, endpoints []string) (omega.Output, error) {
+		var o = &fakeOutput{group: group, fail: group == "collector-03"}
+		outputs[group] = o
+		return o, nil
+	}
+	defer func() { NewOutput = output.NewGrpcClient }()
+
+	var c = &conf.Config{
+		Global:  conf.Global{GroupName: "omega-01"},
+		Agent:   conf.Agent{Period: conf.Duration{Duration: time.Minute}},
+		Plugins: map[string]conf.Plugin{"cpu": {"percpu": false}},
+	}
+	agent, err := NewAgent(c)
+	judge.Nil(err)
+	judge.NotNil(agent.Reload(c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		signal = make(chan struct{}, 1)
+		done   = make(chan error, 1)
+	)
+	go func() { done <- agent.Run(ctx, signal) }()
+	<-signal
+	judge.Contains(outputs, "omega-01")
+
+	// period, plugins and output are changed
+	var reloaded = *c
+	reloaded.Agent = conf.Agent{Period: conf.Duration{Duration: time.Second}, CollectorGroup: "collector-02"}
+	reloaded.Plugins = map[string]conf.Plugin{"cpu": {"percpu": true}}
+	judge.Nil(agent.Reload(&reloaded))
+	judge.True(plugins.Repository["cpu"].(*cpu.CPUStats).PerCPU)
+	judge.True(outputs["omega-01"].closed)
+	judge.False(outputs["collector-02"].closed)
+	judge.Equal(&reloaded, agent.config)
+
+	// nothing is changed if config is invalid or the output fails
+	var invalid = reloaded
+	invalid.Plugins = map[string]conf.Plugin{"cpu": {"percpu": "yes"}}
+	judge.NotNil(agent.Reload(&invalid))
+	invalid = reloaded
+	invalid.Agent.CollectorGroup = "collector-03"
+	judge.NotNil(agent.Reload(&invalid))
+	judge.True(outputs["collector-03"].closed)
+	judge.False(outputs["collector-02"].closed)
+	judge.Equal(&reloaded, agent.config)
+
+	// removed fields and plugins are back to their defaults
+	var removed = reloaded
+	removed.Plugins = map[string]conf.Plugin{"cpu": {"totalcpu": false}}
+	judge.Nil(agent.Reload(&removed))
+	judge.False(plugins.Repository["cpu"].(*cpu.CPUStats).PerCPU)
+	judge.False(plugins.Repository["cpu"].(*cpu.CPUStats).TotalCPU)
+	removed.Plugins = map[string]conf.Plugin{}
+	judge.Nil(agent.Reload(&removed))
+	judge.True(plugins.Repository["cpu"].(*cpu.CPUStats).TotalCPU)
+
+	cancel()
+	judge.Nil(<-done)
+	judge.True(outputs["collector-02"].closed)
+}
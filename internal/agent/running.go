@@ -17,6 +17,9 @@ var RunningOutputPool = &RunningOutput{
 type RunningOutput struct {
 	mut     sync.Mutex
 	outputs map[string]omega.Output
+	// write is held while metrics are written, so that an output isn't used
+	// after it is removed
+	write sync.RWMutex
 
 	buffer chan []omega.Metric
 }
@@ -32,6 +35,8 @@ func (ro *RunningOutput) RegisterOutput(output omega.Output) (func(), error) {
 	var id = uid.String()
 	ro.outputs[id] = output
 	return func() {
+		ro.write.Lock()
+		defer ro.write.Unlock()
 		ro.mut.Lock()
 		defer ro.mut.Unlock()
 
@@ -58,12 +63,14 @@ func (ro *RunningOutput) Start() error {
 
 	go func() {
 		for metrics := range ro.buffer {
+			ro.write.RLock()
 			var outputs = ro.Range()
 			for _, output := range outputs {
 				if err := output.WriteMetric(metrics); err != nil {
 					zlog.Error("Write metrics failure", zap.Error(err), zap.Any("metrics", metrics))
 				}
 			}
+			ro.write.RUnlock()
 		}
 	}()
 	return nil
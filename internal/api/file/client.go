@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/file/pb"
+	"github.com/eviltomorrow/omega/pkg/archive"
 	"github.com/eviltomorrow/omega/pkg/bar"
 	"github.com/eviltomorrow/omega/pkg/file"
 	"golang.org/x/time/rate"
@@ -39,7 +40,7 @@ func Upload(target string, local string, remote string) error {
 	if localFi.IsDir() {
 		return fmt.Errorf("local: %s has same name folder", local)
 	}
-	localMD5, err := file.CalculateMD5(local)
+	localSHA256, err := file.CalculateSHA256(local)
 	if err != nil {
 		return err
 	}
@@ -50,7 +51,11 @@ func Upload(target string, local string, remote string) error {
 	}
 	defer destroy()
 
-	remoteFi, err := stub.GetInfo(context.Background(), &wrapperspb.StringValue{Value: remote})
+	var remoteFi *pb.Info
+	opts, err := file.Negotiate(func(opts ...grpc.CallOption) (err error) {
+		remoteFi, err = stub.GetInfo(context.Background(), &wrapperspb.StringValue{Value: remote}, opts...)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -64,32 +69,50 @@ func Upload(target string, local string, remote string) error {
 			return fmt.Errorf("one folder with the same name exists, name: %v", remote)
 		}
 	}
-	if remoteFi.Md5 == localMD5 {
+	if remoteFi.Sha256 == localSHA256 {
 		return nil
 	}
 
+	bar, counter := bar.NewProgressbar(int(localFi.Size()), "Upload", remote)
+	defer bar.Close()
+	defer close(counter)
+
+	var transfer = &pb.Transfer{Path: remote, TransferId: file.TransferID(remote, localSHA256)}
+	return file.Retry(func() error {
+		return upload(stub, local, transfer, localSHA256, localFi.Mode(), file.Progress(counter), opts...)
+	})
+}
+
+func upload(stub pb.FileClient, local string, transfer *pb.Transfer, sha256 string, mode fs.FileMode, report func(int64), opts ...grpc.CallOption) error {
+	offset, err := stub.Offset(context.Background(), transfer)
+	if err != nil {
+		return err
+	}
+
 	localF, err := os.OpenFile(local, os.O_RDONLY, 0644)
 	if err != nil {
 		return err
 	}
 	defer localF.Close()
 
-	writer, err := stub.Write(context.Background())
-	if err != nil {
+	if _, err := localF.Seek(offset.Value, io.SeekStart); err != nil {
 		return err
 	}
+	report(offset.Value)
 
-	if err := writer.Send(&pb.Buffer{Path: remote}); err != nil {
+	writer, err := stub.Write(context.Background(), opts...)
+	if err != nil {
 		return err
 	}
 
-	bar, counter := bar.NewProgressbar(int(localFi.Size()), "Upload", remote)
-	defer bar.Close()
-	defer close(counter)
+	if err := writer.Send(&pb.Buffer{Path: transfer.Path, TransferId: transfer.TransferId, Offset: offset.Value, Sha256: sha256, Mode: int32(mode)}); err != nil {
+		return err
+	}
 
 	var (
 		buf     [1024 * 8]byte
 		limiter = rate.NewLimiter(rate.Every(time.Second/1000), 1)
+		pos     = offset.Value
 	)
 
 	for {
@@ -102,20 +125,16 @@ func Upload(target string, local string, remote string) error {
 		}
 		limiter.WaitN(context.Background(), 1)
 
-		if err := writer.Send(&pb.Buffer{Buf: buf[:n]}); err != nil {
-			return err
+		if err := writer.Send(&pb.Buffer{Buf: buf[:n], Offset: pos, Crc: file.CRC(buf[:n])}); err != nil {
+			break
 		}
+		pos += int64(n)
 
-		counter <- n
+		report(pos)
 	}
 	if _, err := writer.CloseAndRecv(); err != nil && err != io.EOF {
 		return err
 	}
-
-	if _, err := stub.SetMode(context.Background(), &pb.Mode{Path: remote, Mode: int32(localFi.Mode())}); err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -126,12 +145,19 @@ func Download(target string, local string, remote string) error {
 	}
 	defer destroy()
 
-	remoteFi, err := stub.GetInfo(context.Background(), &wrapperspb.StringValue{Value: remote})
+	var remoteFi *pb.Info
+	opts, err := file.Negotiate(func(opts ...grpc.CallOption) (err error) {
+		remoteFi, err = stub.GetInfo(context.Background(), &wrapperspb.StringValue{Value: remote}, opts...)
+		return err
+	})
 	if err != nil {
 		return err
 	}
+	if !remoteFi.Exist {
+		return fmt.Errorf("remote path is not exist")
+	}
 	if remoteFi.IsDir {
-		return fmt.Errorf("remote path is a folder")
+		return downloadDir(stub, local, remote)
 	}
 
 	localFi, err := os.Stat(local)
@@ -152,50 +178,110 @@ func Download(target string, local string, remote string) error {
 				}
 			}
 		}
-		localMD5, err := file.CalculateMD5(local)
+		if err == nil {
+			localSHA256, err := file.CalculateSHA256(local)
+			if err != nil {
+				return err
+			}
+
+			if localSHA256 == remoteFi.Sha256 {
+				return nil
+			}
+		}
+	}
+
+	bar, counter := bar.NewProgressbar(int(remoteFi.Size), "Download", remote)
+	defer bar.Close()
+	defer close(counter)
+
+	var name = file.PartName(local, file.TransferID(remote, remoteFi.Sha256))
+	return file.Retry(func() error {
+		return download(stub, remote, name, file.Progress(counter), func(part *file.Part) error {
+			return part.Commit(local, remoteFi.Sha256, fs.FileMode(remoteFi.Mode))
+		}, opts...)
+	})
+}
+
+func download(stub pb.FileClient, remote string, name string, report func(int64), commit func(*file.Part) error, opts ...grpc.CallOption) error {
+	part, err := file.OpenPart(name)
+	if err != nil {
+		return err
+	}
+	report(part.Offset())
+
+	reader, err := stub.Read(context.Background(), &pb.ReadRequest{Path: remote, Offset: part.Offset()}, opts...)
+	if err != nil {
+		part.Close()
+		return err
+	}
+
+	for {
+		data, err := reader.Recv()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
+			part.Close()
 			return err
 		}
-
-		if localMD5 == remoteFi.Md5 {
-			return nil
+		if err := file.CheckCRC(data.Buf, data.Crc); err != nil {
+			part.Close()
+			return err
+		}
+		if err := part.Write(data.Offset, data.Buf); err != nil {
+			part.Close()
+			return err
 		}
+		report(part.Offset())
 	}
+	return commit(part)
+}
 
-	reader, err := stub.Read(context.Background(), &wrapperspb.StringValue{Value: remote})
-	if err != nil {
+// downloadDir fetches remote folder as tar.gz stream and extracts it into
+// local, the folder is created as local/<base of remote>.
+func downloadDir(stub pb.FileClient, local string, remote string) error {
+	localFi, err := os.Stat(local)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && !localFi.IsDir() {
+		return fmt.Errorf("local: %s is not a folder", local)
+	}
+	if err := os.MkdirAll(local, 0755); err != nil {
 		return err
 	}
 
-	var (
-		pipe   = make(chan []byte, 128)
-		signal = make(chan error, 1)
-	)
+	reader, err := stub.Archive(context.Background(), &pb.ReadRequest{Path: remote})
+	if err != nil {
+		return err
+	}
 
+	pr, pw := io.Pipe()
 	go func() {
-		bar, counter := bar.NewProgressbar(int(remoteFi.Size), "Download", remote)
-		defer bar.Close()
-		defer close(counter)
-
+		var offset int64
 		for {
 			data, err := reader.Recv()
 			if err == io.EOF {
-				break
+				pw.Close()
+				return
+			}
+			if err == nil && data.Offset != offset {
+				err = fmt.Errorf("%w, expect: %d, actual: %d", file.ErrUnexpectedOffset, offset, data.Offset)
+			}
+			if err == nil {
+				err = file.CheckCRC(data.Buf, data.Crc)
+			}
+			if err == nil {
+				_, err = pw.Write(data.Buf)
 			}
 			if err != nil {
-				signal <- err
+				pw.CloseWithError(err)
 				return
 			}
-
-			pipe <- data.Buf
-			counter <- len(data.Buf)
+			offset += int64(len(data.Buf))
 		}
-		close(pipe)
 	}()
+	defer pr.Close()
 
-	if err := file.Write(local, fs.FileMode(remoteFi.Mode), pipe, signal); err != nil {
-		return err
-	}
-
-	return nil
+	return archive.Uncompress(pr, local)
 }
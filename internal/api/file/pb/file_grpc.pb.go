@@ -25,9 +25,21 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type FileClient interface {
 	Write(ctx context.Context, opts ...grpc.CallOption) (File_WriteClient, error)
-	Read(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (File_ReadClient, error)
+	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (File_ReadClient, error)
 	GetInfo(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (*Info, error)
 	SetMode(ctx context.Context, in *Mode, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*Entries, error)
+	Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Chown(ctx context.Context, in *Owner, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Symlink(ctx context.Context, in *Link, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Offset(ctx context.Context, in *Transfer, opts ...grpc.CallOption) (*wrapperspb.Int64Value, error)
+	// Manifest sends entries of a folder one by one, files are summed by blocks
+	Manifest(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (File_ManifestClient, error)
+	Patch(ctx context.Context, opts ...grpc.CallOption) (File_PatchClient, error)
+	// Archive sends a folder as a tar.gz stream
+	Archive(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (File_ArchiveClient, error)
 }
 
 type fileClient struct {
@@ -72,7 +84,7 @@ func (x *fileWriteClient) CloseAndRecv() (*emptypb.Empty, error) {
 	return m, nil
 }
 
-func (c *fileClient) Read(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (File_ReadClient, error) {
+func (c *fileClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (File_ReadClient, error) {
 	stream, err := c.cc.NewStream(ctx, &File_ServiceDesc.Streams[1], "/omega.File/Read", opts...)
 	if err != nil {
 		return nil, err
@@ -122,14 +134,187 @@ func (c *fileClient) SetMode(ctx context.Context, in *Mode, opts ...grpc.CallOpt
 	return out, nil
 }
 
+func (c *fileClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*Entries, error) {
+	out := new(Entries)
+	err := c.cc.Invoke(ctx, "/omega.File/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileClient) Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/omega.File/Mkdir", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/omega.File/Remove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileClient) Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/omega.File/Rename", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileClient) Chown(ctx context.Context, in *Owner, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/omega.File/Chown", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileClient) Symlink(ctx context.Context, in *Link, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/omega.File/Symlink", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileClient) Offset(ctx context.Context, in *Transfer, opts ...grpc.CallOption) (*wrapperspb.Int64Value, error) {
+	out := new(wrapperspb.Int64Value)
+	err := c.cc.Invoke(ctx, "/omega.File/Offset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileClient) Manifest(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (File_ManifestClient, error) {
+	stream, err := c.cc.NewStream(ctx, &File_ServiceDesc.Streams[2], "/omega.File/Manifest", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileManifestClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type File_ManifestClient interface {
+	Recv() (*Entry, error)
+	grpc.ClientStream
+}
+
+type fileManifestClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileManifestClient) Recv() (*Entry, error) {
+	m := new(Entry)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileClient) Patch(ctx context.Context, opts ...grpc.CallOption) (File_PatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &File_ServiceDesc.Streams[3], "/omega.File/Patch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &filePatchClient{stream}
+	return x, nil
+}
+
+type File_PatchClient interface {
+	Send(*PatchChunk) error
+	CloseAndRecv() (*emptypb.Empty, error)
+	grpc.ClientStream
+}
+
+type filePatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *filePatchClient) Send(m *PatchChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *filePatchClient) CloseAndRecv() (*emptypb.Empty, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(emptypb.Empty)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileClient) Archive(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (File_ArchiveClient, error) {
+	stream, err := c.cc.NewStream(ctx, &File_ServiceDesc.Streams[4], "/omega.File/Archive", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileArchiveClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type File_ArchiveClient interface {
+	Recv() (*Buffer, error)
+	grpc.ClientStream
+}
+
+type fileArchiveClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileArchiveClient) Recv() (*Buffer, error) {
+	m := new(Buffer)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // FileServer is the server API for File service.
 // All implementations must embed UnimplementedFileServer
 // for forward compatibility
 type FileServer interface {
 	Write(File_WriteServer) error
-	Read(*wrapperspb.StringValue, File_ReadServer) error
+	Read(*ReadRequest, File_ReadServer) error
 	GetInfo(context.Context, *wrapperspb.StringValue) (*Info, error)
 	SetMode(context.Context, *Mode) (*emptypb.Empty, error)
+	List(context.Context, *ListRequest) (*Entries, error)
+	Mkdir(context.Context, *MkdirRequest) (*emptypb.Empty, error)
+	Remove(context.Context, *RemoveRequest) (*emptypb.Empty, error)
+	Rename(context.Context, *RenameRequest) (*emptypb.Empty, error)
+	Chown(context.Context, *Owner) (*emptypb.Empty, error)
+	Symlink(context.Context, *Link) (*emptypb.Empty, error)
+	Offset(context.Context, *Transfer) (*wrapperspb.Int64Value, error)
+	// Manifest sends entries of a folder one by one, files are summed by blocks
+	Manifest(*SyncRequest, File_ManifestServer) error
+	Patch(File_PatchServer) error
+	// Archive sends a folder as a tar.gz stream
+	Archive(*ReadRequest, File_ArchiveServer) error
 	mustEmbedUnimplementedFileServer()
 }
 
@@ -140,7 +325,7 @@ type UnimplementedFileServer struct {
 func (UnimplementedFileServer) Write(File_WriteServer) error {
 	return status.Errorf(codes.Unimplemented, "method Write not implemented")
 }
-func (UnimplementedFileServer) Read(*wrapperspb.StringValue, File_ReadServer) error {
+func (UnimplementedFileServer) Read(*ReadRequest, File_ReadServer) error {
 	return status.Errorf(codes.Unimplemented, "method Read not implemented")
 }
 func (UnimplementedFileServer) GetInfo(context.Context, *wrapperspb.StringValue) (*Info, error) {
@@ -149,6 +334,36 @@ func (UnimplementedFileServer) GetInfo(context.Context, *wrapperspb.StringValue)
 func (UnimplementedFileServer) SetMode(context.Context, *Mode) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetMode not implemented")
 }
+func (UnimplementedFileServer) List(context.Context, *ListRequest) (*Entries, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedFileServer) Mkdir(context.Context, *MkdirRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Mkdir not implemented")
+}
+func (UnimplementedFileServer) Remove(context.Context, *RemoveRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedFileServer) Rename(context.Context, *RenameRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rename not implemented")
+}
+func (UnimplementedFileServer) Chown(context.Context, *Owner) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Chown not implemented")
+}
+func (UnimplementedFileServer) Symlink(context.Context, *Link) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Symlink not implemented")
+}
+func (UnimplementedFileServer) Offset(context.Context, *Transfer) (*wrapperspb.Int64Value, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Offset not implemented")
+}
+func (UnimplementedFileServer) Manifest(*SyncRequest, File_ManifestServer) error {
+	return status.Errorf(codes.Unimplemented, "method Manifest not implemented")
+}
+func (UnimplementedFileServer) Patch(File_PatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Patch not implemented")
+}
+func (UnimplementedFileServer) Archive(*ReadRequest, File_ArchiveServer) error {
+	return status.Errorf(codes.Unimplemented, "method Archive not implemented")
+}
 func (UnimplementedFileServer) mustEmbedUnimplementedFileServer() {}
 
 // UnsafeFileServer may be embedded to opt out of forward compatibility for this service.
@@ -189,7 +404,7 @@ func (x *fileWriteServer) Recv() (*Buffer, error) {
 }
 
 func _File_Read_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(wrapperspb.StringValue)
+	m := new(ReadRequest)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
@@ -245,6 +460,200 @@ func _File_SetMode_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _File_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.File/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _File_Mkdir_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MkdirRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServer).Mkdir(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.File/Mkdir",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServer).Mkdir(ctx, req.(*MkdirRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _File_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.File/Remove",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServer).Remove(ctx, req.(*RemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _File_Rename_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServer).Rename(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.File/Rename",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServer).Rename(ctx, req.(*RenameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _File_Chown_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Owner)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServer).Chown(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.File/Chown",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServer).Chown(ctx, req.(*Owner))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _File_Symlink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Link)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServer).Symlink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.File/Symlink",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServer).Symlink(ctx, req.(*Link))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _File_Offset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Transfer)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServer).Offset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.File/Offset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServer).Offset(ctx, req.(*Transfer))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _File_Manifest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SyncRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServer).Manifest(m, &fileManifestServer{stream})
+}
+
+type File_ManifestServer interface {
+	Send(*Entry) error
+	grpc.ServerStream
+}
+
+type fileManifestServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileManifestServer) Send(m *Entry) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _File_Patch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileServer).Patch(&filePatchServer{stream})
+}
+
+type File_PatchServer interface {
+	SendAndClose(*emptypb.Empty) error
+	Recv() (*PatchChunk, error)
+	grpc.ServerStream
+}
+
+type filePatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *filePatchServer) SendAndClose(m *emptypb.Empty) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *filePatchServer) Recv() (*PatchChunk, error) {
+	m := new(PatchChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _File_Archive_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServer).Archive(m, &fileArchiveServer{stream})
+}
+
+type File_ArchiveServer interface {
+	Send(*Buffer) error
+	grpc.ServerStream
+}
+
+type fileArchiveServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileArchiveServer) Send(m *Buffer) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // File_ServiceDesc is the grpc.ServiceDesc for File service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -260,6 +669,34 @@ var File_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SetMode",
 			Handler:    _File_SetMode_Handler,
 		},
+		{
+			MethodName: "List",
+			Handler:    _File_List_Handler,
+		},
+		{
+			MethodName: "Mkdir",
+			Handler:    _File_Mkdir_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _File_Remove_Handler,
+		},
+		{
+			MethodName: "Rename",
+			Handler:    _File_Rename_Handler,
+		},
+		{
+			MethodName: "Chown",
+			Handler:    _File_Chown_Handler,
+		},
+		{
+			MethodName: "Symlink",
+			Handler:    _File_Symlink_Handler,
+		},
+		{
+			MethodName: "Offset",
+			Handler:    _File_Offset_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -272,6 +709,21 @@ var File_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _File_Read_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Manifest",
+			Handler:       _File_Manifest_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Patch",
+			Handler:       _File_Patch_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Archive",
+			Handler:       _File_Archive_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "file.proto",
 }
@@ -0,0 +1,177 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Root is a folder which File service can access, the most specific root
+// which contains a path decides whether the path is writable.
+type Root struct {
+	Path     string
+	ReadOnly bool
+}
+
+var (
+	// Roots is unrestricted if empty
+	Roots []Root
+	// MaxReadSize, MaxWriteSize and UploadQuota are unlimited if 0
+	MaxReadSize  int64
+	MaxWriteSize int64
+	// UploadQuota is bytes accepted by Write and Patch per day
+	UploadQuota int64
+)
+
+type access int
+
+const (
+	read access = iota
+	write
+)
+
+// guard checks whether path can be accessed, symlinks in path are resolved
+// so that a link inside a root can't escape from it. The last element is
+// not resolved if follow is false, eg. Remove works on the link itself.
+func guard(ctx context.Context, op string, path string, acc access, follow bool) error {
+	if len(Roots) == 0 {
+		return nil
+	}
+
+	resolved, err := resolve(path, follow)
+	if err != nil {
+		return statusError(err)
+	}
+
+	var (
+		matched *Root
+		length  = -1
+	)
+	for i := range Roots {
+		var root = &Roots[i]
+		dir, err := resolve(root.Path, true)
+		if err != nil {
+			continue
+		}
+		if within(resolved, dir) && len(dir) > length {
+			matched, length = root, len(dir)
+		}
+	}
+
+	switch {
+	case matched == nil:
+		return violate(ctx, op, path, resolved, "path is not in allowed roots")
+	case acc == write && matched.ReadOnly:
+		return violate(ctx, op, path, resolved, fmt.Sprintf("root[%s] is read-only", matched.Path))
+	default:
+		return nil
+	}
+}
+
+// resolve returns absolute path with symlinks evaluated, elements which don't
+// exist yet are kept as they are.
+func resolve(path string, follow bool) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if !follow && path != "/" {
+		dir, err := resolve(filepath.Dir(path), true)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, filepath.Base(path)), nil
+	}
+
+	var rest string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		var parent = filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+func within(path, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func violate(ctx context.Context, op, path, resolved, reason string) error {
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	zlog.Warn("File sandbox violation", zap.String("op", op), zap.String("path", path), zap.String("resolved", resolved), zap.String("reason", reason), zap.String("peer", addr))
+	return status.Errorf(codes.PermissionDenied, "%s [%s] is denied, %s", op, path, reason)
+}
+
+// checkReadSize rejects files larger than MaxReadSize
+func checkReadSize(ctx context.Context, path string, size int64) error {
+	if MaxReadSize <= 0 || size <= MaxReadSize {
+		return nil
+	}
+	zlog.Warn("File read size exceeds limit", zap.String("path", path), zap.Int64("size", size), zap.Int64("limit", MaxReadSize))
+	return status.Errorf(codes.ResourceExhausted, "size of [%s] is %d, exceeds limit %d", path, size, MaxReadSize)
+}
+
+// limiter counts size of the file written by one Write or Patch
+type limiter struct {
+	path string
+	size int64
+}
+
+// take adds n bytes to the file, transferred bytes of them are taken from quota
+func (l *limiter) take(n, transferred int) error {
+	l.size += int64(n)
+	if MaxWriteSize > 0 && l.size > MaxWriteSize {
+		zlog.Warn("File write size exceeds limit", zap.String("path", l.path), zap.Int64("limit", MaxWriteSize))
+		return status.Errorf(codes.ResourceExhausted, "size of [%s] exceeds limit %d", l.path, MaxWriteSize)
+	}
+	return quota.take(l.path, int64(transferred))
+}
+
+var quota = &dailyQuota{}
+
+type dailyQuota struct {
+	sync.Mutex
+	day  string
+	used int64
+}
+
+func (q *dailyQuota) take(path string, n int64) error {
+	if UploadQuota <= 0 {
+		return nil
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	if day := time.Now().Format("2006-01-02"); day != q.day {
+		q.day, q.used = day, 0
+	}
+	if q.used+n > UploadQuota {
+		zlog.Warn("File upload quota is exhausted", zap.String("path", path), zap.Int64("used", q.used), zap.Int64("quota", UploadQuota))
+		return status.Errorf(codes.ResourceExhausted, "upload quota %d of today is exhausted", UploadQuota)
+	}
+	q.used += n
+	return nil
+}
@@ -2,13 +2,22 @@ package file
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/file/pb"
+	"github.com/eviltomorrow/omega/pkg/archive"
 	"github.com/eviltomorrow/omega/pkg/file"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
@@ -18,9 +27,19 @@ type Server struct {
 }
 
 // Write(File_WriteServer) error
-// Read(*wrapperspb.StringValue, File_ReadServer) error
+// Read(*ReadRequest, File_ReadServer) error
 // GetInfo(context.Context, *wrapperspb.StringValue) (*Info, error)
 // SetMode(context.Context, *Mode) (*emptypb.Empty, error)
+// List(context.Context, *ListRequest) (*Entries, error)
+// Mkdir(context.Context, *MkdirRequest) (*emptypb.Empty, error)
+// Remove(context.Context, *RemoveRequest) (*emptypb.Empty, error)
+// Rename(context.Context, *RenameRequest) (*emptypb.Empty, error)
+// Chown(context.Context, *Owner) (*emptypb.Empty, error)
+// Symlink(context.Context, *Link) (*emptypb.Empty, error)
+// Offset(context.Context, *Transfer) (*wrapperspb.Int64Value, error)
+// Manifest(*SyncRequest, File_ManifestServer) error
+// Patch(File_PatchServer) error
+// Archive(*ReadRequest, File_ArchiveServer) error
 
 func (s *Server) Write(ws pb.File_WriteServer) error {
 	req, err := ws.Recv()
@@ -34,10 +53,21 @@ func (s *Server) Write(ws pb.File_WriteServer) error {
 	if req.Path == "" {
 		return fmt.Errorf("invalid path")
 	}
+	if err := guard(ws.Context(), "write", req.Path, write, true); err != nil {
+		return err
+	}
+	if req.TransferId != "" {
+		// part file is committed only if it's verified
+		if req.Sha256 == "" {
+			return status.Error(codes.InvalidArgument, "sha256 is required with transfer-id")
+		}
+		return writePart(ws, req)
+	}
 
 	var (
-		data = make(chan []byte, 128)
-		sig  = make(chan error)
+		data    = make(chan []byte, 128)
+		sig     = make(chan error)
+		limiter = &limiter{path: req.Path}
 	)
 	go func() {
 		for {
@@ -49,6 +79,10 @@ func (s *Server) Write(ws pb.File_WriteServer) error {
 				sig <- err
 				break
 			}
+			if err := limiter.take(len(req.Buf), len(req.Buf)); err != nil {
+				sig <- err
+				break
+			}
 			if len(req.Buf) != 0 {
 				data <- req.Buf
 			}
@@ -58,12 +92,75 @@ func (s *Server) Write(ws pb.File_WriteServer) error {
 	return file.Write(req.Path, 0644, data, sig)
 }
 
-func (s *Server) Read(req *wrapperspb.StringValue, rs pb.File_ReadServer) error {
-	_, pipe, signal, err := file.Read(req.Value)
+// writePart writes chunks into part file of req.Path from req.Offset, the part
+// file is kept if stream is broken, and committed when stream is closed by client.
+func writePart(ws pb.File_WriteServer, req *pb.Buffer) error {
+	part, err := file.OpenPart(file.PartName(req.Path, req.TransferId))
+	if err != nil {
+		return statusError(err)
+	}
+	if err := part.Truncate(req.Offset); err != nil {
+		part.Close()
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	var limiter = &limiter{path: req.Path, size: req.Offset}
+	for {
+		chunk, err := ws.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			part.Close()
+			return err
+		}
+		if err := file.CheckCRC(chunk.Buf, chunk.Crc); err != nil {
+			part.Close()
+			return status.Error(codes.DataLoss, err.Error())
+		}
+		if err := limiter.take(len(chunk.Buf), len(chunk.Buf)); err != nil {
+			part.Close()
+			return err
+		}
+		if err := part.Write(chunk.Offset, chunk.Buf); err != nil {
+			part.Close()
+			if errors.Is(err, file.ErrUnexpectedOffset) {
+				return status.Error(codes.Aborted, err.Error())
+			}
+			return statusError(err)
+		}
+	}
+
+	var mode = fs.FileMode(req.Mode)
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := part.Commit(req.Path, req.Sha256, mode); err != nil {
+		if errors.Is(err, file.ErrSHA256Mismatch) {
+			return status.Error(codes.DataLoss, err.Error())
+		}
+		return statusError(err)
+	}
+	return ws.SendAndClose(&emptypb.Empty{})
+}
+
+func (s *Server) Read(req *pb.ReadRequest, rs pb.File_ReadServer) error {
+	if err := guard(rs.Context(), "read", req.Path, read, true); err != nil {
+		return err
+	}
+	fi, err := os.Stat(req.Path)
+	if err != nil {
+		return statusError(err)
+	}
+	if err := checkReadSize(rs.Context(), req.Path, fi.Size()); err != nil {
+		return err
+	}
+	_, pipe, signal, err := file.ReadFrom(req.Path, req.Offset)
 	if err != nil {
 		return err
 	}
 
+	var offset = req.Offset
 loop:
 	for {
 		select {
@@ -72,9 +169,10 @@ loop:
 				break loop
 			}
 
-			if err := rs.Send(&pb.Buffer{Buf: buf}); err != nil {
+			if err := rs.Send(&pb.Buffer{Buf: buf, Offset: offset, Crc: file.CRC(buf)}); err != nil {
 				return err
 			}
+			offset += int64(len(buf))
 		case err := <-signal:
 			return err
 		}
@@ -83,15 +181,21 @@ loop:
 }
 
 func (s *Server) GetInfo(ctx context.Context, req *wrapperspb.StringValue) (*pb.Info, error) {
+	if err := guard(ctx, "stat", req.Value, read, true); err != nil {
+		return nil, err
+	}
 	fi, err := os.Stat(req.Value)
-	if err != nil && os.IsNotExist(err) {
-		return &pb.Info{Exist: false}, nil
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &pb.Info{Exist: false}, nil
+		}
+		return nil, statusError(err)
 	}
 
-	var md5 string
+	var md5, sha256 string
 	if !fi.IsDir() {
 		var err error
-		md5, err = file.CalculateMD5(req.Value)
+		md5, sha256, err = file.CalculateDigests(req.Value)
 		if err != nil {
 			return nil, err
 		}
@@ -104,13 +208,489 @@ func (s *Server) GetInfo(ctx context.Context, req *wrapperspb.StringValue) (*pb.
 		ModTime: fi.ModTime().Unix(),
 		IsDir:   fi.IsDir(),
 		Md5:     md5,
+		Exist:   true,
+		Sha256:  sha256,
 	}
 	return info, nil
 }
 
 func (s *Server) SetMode(ctx context.Context, req *pb.Mode) (*emptypb.Empty, error) {
+	if err := guard(ctx, "chmod", req.Path, write, true); err != nil {
+		return nil, err
+	}
 	if err := os.Chmod(req.Path, fs.FileMode(req.Mode)); err != nil {
 		return nil, err
 	}
+	if req.ModTime != 0 {
+		var mtime = time.Unix(req.ModTime, 0)
+		if err := os.Chtimes(req.Path, mtime, mtime); err != nil {
+			return nil, statusError(err)
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) List(ctx context.Context, req *pb.ListRequest) (*pb.Entries, error) {
+	if req.Path == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid path")
+	}
+	if err := guard(ctx, "list", req.Path, read, true); err != nil {
+		return nil, err
+	}
+	var depth = int(req.Depth)
+	if depth <= 0 {
+		depth = 1
+	}
+
+	fi, err := os.Stat(req.Path)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if !fi.IsDir() {
+		entry, err := newEntry(req.Path, req.Path)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		return &pb.Entries{Entries: []*pb.Entry{entry}}, nil
+	}
+
+	var (
+		root    = filepath.Clean(req.Path)
+		entries = &pb.Entries{}
+	)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entry, err := newEntry(path, rel)
+		if err != nil {
+			return nil
+		}
+		entries.Entries = append(entries.Entries, entry)
+
+		if d.IsDir() && depthOf(rel) >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return entries, nil
+}
+
+func (s *Server) Mkdir(ctx context.Context, req *pb.MkdirRequest) (*emptypb.Empty, error) {
+	if req.Path == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid path")
+	}
+	if err := guard(ctx, "mkdir", req.Path, write, true); err != nil {
+		return nil, err
+	}
+	var mode = fs.FileMode(req.Mode) & fs.ModePerm
+	if mode == 0 {
+		mode = 0755
+	}
+
+	var err error
+	if req.Parents {
+		err = os.MkdirAll(req.Path, mode)
+	} else {
+		err = os.Mkdir(req.Path, mode)
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) Remove(ctx context.Context, req *pb.RemoveRequest) (*emptypb.Empty, error) {
+	var path = filepath.Clean(req.Path)
+	if req.Path == "" || path == "/" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid path[%s]", req.Path)
+	}
+	if err := guard(ctx, "remove", path, write, false); err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return nil, statusError(err)
+	}
+
+	var err error
+	if req.Recursive {
+		err = os.RemoveAll(path)
+	} else {
+		err = os.Remove(path)
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) Rename(ctx context.Context, req *pb.RenameRequest) (*emptypb.Empty, error) {
+	if req.From == "" || req.To == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid path")
+	}
+	// both paths are guarded before they are stat, so that paths out of roots
+	// can't be probed
+	for _, path := range []string{req.From, req.To} {
+		if err := guard(ctx, "rename", path, write, false); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := os.Lstat(req.From); err != nil {
+		return nil, statusError(err)
+	}
+
+	var to = req.To
+	if fi, err := os.Stat(to); err == nil && fi.IsDir() {
+		to = filepath.Join(to, filepath.Base(req.From))
+		if err := guard(ctx, "rename", to, write, false); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return nil, status.Errorf(codes.AlreadyExists, "%s already exists", to)
+	}
+	if err := os.Rename(req.From, to); err != nil {
+		return nil, statusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) Chown(ctx context.Context, req *pb.Owner) (*emptypb.Empty, error) {
+	if req.Path == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid path")
+	}
+	if err := guard(ctx, "chown", req.Path, write, false); err != nil {
+		return nil, err
+	}
+	uid, err := lookupId(req.User, func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "lookup user[%s] failure, nest error: %v", req.User, err)
+	}
+	gid, err := lookupId(req.Group, func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "lookup group[%s] failure, nest error: %v", req.Group, err)
+	}
+
+	if !req.Recursive {
+		if err := os.Lchown(req.Path, uid, gid); err != nil {
+			return nil, statusError(err)
+		}
+		return &emptypb.Empty{}, nil
+	}
+	err = filepath.WalkDir(req.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) Symlink(ctx context.Context, req *pb.Link) (*emptypb.Empty, error) {
+	if req.Target == "" || req.Path == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid target or path")
+	}
+	if err := guard(ctx, "symlink", req.Path, write, false); err != nil {
+		return nil, err
+	}
+	if err := os.Symlink(req.Target, req.Path); err != nil {
+		return nil, statusError(err)
+	}
 	return &emptypb.Empty{}, nil
 }
+
+func (s *Server) Offset(ctx context.Context, req *pb.Transfer) (*wrapperspb.Int64Value, error) {
+	if req.Path == "" || req.TransferId == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid path or transfer-id")
+	}
+	if err := guard(ctx, "write", req.Path, write, true); err != nil {
+		return nil, err
+	}
+	offset, err := file.PartOffset(file.PartName(req.Path, req.TransferId))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &wrapperspb.Int64Value{Value: offset}, nil
+}
+
+// Manifest sends entries one by one, so that the manifest of a large folder
+// isn't limited by the max message size
+func (s *Server) Manifest(req *pb.SyncRequest, ms pb.File_ManifestServer) error {
+	if req.Path == "" {
+		return status.Error(codes.InvalidArgument, "invalid path")
+	}
+	if err := guard(ms.Context(), "read", req.Path, read, true); err != nil {
+		return err
+	}
+	var blockSize = int(req.BlockSize)
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	return statusError(walkManifest(ms.Context(), req.Path, blockSize, ms.Send))
+}
+
+func (s *Server) Patch(ps pb.File_PatchServer) error {
+	req, err := ps.Recv()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if req.Path == "" || req.Sha256 == "" {
+		return status.Error(codes.InvalidArgument, "invalid path or sha256")
+	}
+	if err := guard(ps.Context(), "write", req.Path, write, true); err != nil {
+		return err
+	}
+
+	old, err := os.Open(req.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return statusError(err)
+	}
+	if old != nil {
+		defer old.Close()
+	}
+
+	part, err := file.OpenPart(file.PartName(req.Path, file.TransferID(req.Path, req.Sha256)))
+	if err != nil {
+		return statusError(err)
+	}
+	if err := part.Truncate(0); err != nil {
+		part.Close()
+		return statusError(err)
+	}
+
+	var limiter = &limiter{path: req.Path}
+	for {
+		chunk, err := ps.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			part.Close()
+			return err
+		}
+
+		if chunk.CopyLength != 0 {
+			if err := limiter.take(int(chunk.CopyLength), 0); err != nil {
+				part.Close()
+				return err
+			}
+			if err := copyPart(part, old, chunk.Offset, chunk.CopyLength); err != nil {
+				part.Close()
+				return err
+			}
+			continue
+		}
+
+		if err := file.CheckCRC(chunk.Buf, chunk.Crc); err != nil {
+			part.Close()
+			return status.Error(codes.DataLoss, err.Error())
+		}
+		if err := limiter.take(len(chunk.Buf), len(chunk.Buf)); err != nil {
+			part.Close()
+			return err
+		}
+		if err := part.Write(chunk.Offset, chunk.Buf); err != nil {
+			part.Close()
+			return status.Error(codes.Aborted, err.Error())
+		}
+	}
+
+	var mode = fs.FileMode(req.Mode)
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := part.Commit(req.Path, req.Sha256, mode); err != nil {
+		if errors.Is(err, file.ErrSHA256Mismatch) {
+			return status.Error(codes.DataLoss, err.Error())
+		}
+		return statusError(err)
+	}
+	if req.ModTime != 0 {
+		var mtime = time.Unix(req.ModTime, 0)
+		if err := os.Chtimes(req.Path, mtime, mtime); err != nil {
+			return statusError(err)
+		}
+	}
+	return ps.SendAndClose(&emptypb.Empty{})
+}
+
+// Archive streams folder as tar.gz, it is compressed already, so the stream
+// should not be compressed again by client.
+func (s *Server) Archive(req *pb.ReadRequest, as pb.File_ArchiveServer) error {
+	if err := guard(as.Context(), "read", req.Path, read, true); err != nil {
+		return err
+	}
+	fi, err := os.Stat(req.Path)
+	if err != nil {
+		return statusError(err)
+	}
+	if !fi.IsDir() {
+		return status.Errorf(codes.InvalidArgument, "%s is not a folder", req.Path)
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(archive.Compress(req.Path, pw))
+	}()
+
+	var (
+		buf    = make([]byte, 32*1024)
+		offset int64
+	)
+	for {
+		n, err := pr.Read(buf)
+		if n > 0 {
+			if err := checkReadSize(as.Context(), req.Path, offset+int64(n)); err != nil {
+				return err
+			}
+			if err := as.Send(&pb.Buffer{Buf: buf[:n], Offset: offset, Crc: file.CRC(buf[:n])}); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return statusError(err)
+		}
+	}
+}
+
+// copyPart copies length bytes at offset of old file to part
+func copyPart(part *file.Part, old *os.File, offset, length int64) error {
+	if old == nil {
+		return status.Error(codes.FailedPrecondition, "old file is not exist")
+	}
+
+	var (
+		buf    = make([]byte, 64*1024)
+		reader = io.NewSectionReader(old, offset, length)
+	)
+	for length > 0 {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if err := part.Write(offset, buf[:n]); err != nil {
+				return status.Error(codes.Aborted, err.Error())
+			}
+			offset += int64(n)
+			length -= int64(n)
+		}
+		if err == io.EOF && length > 0 {
+			return status.Error(codes.FailedPrecondition, "copy from old file failure, nest error: old file is shorter than expected")
+		}
+		if err != nil && err != io.EOF {
+			return statusError(err)
+		}
+	}
+	return nil
+}
+
+func newEntry(path, name string) (*pb.Entry, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry = &pb.Entry{
+		Path:    name,
+		Size:    fi.Size(),
+		Mode:    int32(fi.Mode()),
+		ModTime: fi.ModTime().Unix(),
+		IsDir:   fi.IsDir(),
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		entry.Link, _ = os.Readlink(path)
+	}
+	return entry, nil
+}
+
+func depthOf(rel string) int {
+	var depth = 1
+	for _, c := range rel {
+		if c == filepath.Separator {
+			depth++
+		}
+	}
+	return depth
+}
+
+// lookupId resolves name or numeric id, -1 is returned when name is empty
+func lookupId(name string, lookup func(string) (string, error)) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(id)
+}
+
+// statusError converts error of os to grpc status
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var code = codes.Internal
+	switch {
+	case errors.Is(err, syscall.ENOTEMPTY), errors.Is(err, syscall.ENOTDIR), errors.Is(err, syscall.EISDIR):
+		code = codes.FailedPrecondition
+	case errors.Is(err, fs.ErrNotExist):
+		code = codes.NotFound
+	case errors.Is(err, fs.ErrExist):
+		code = codes.AlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		code = codes.PermissionDenied
+	case errors.Is(err, fs.ErrInvalid):
+		code = codes.InvalidArgument
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
@@ -1,16 +1,27 @@
 package file
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/file/pb"
 	"github.com/eviltomorrow/omega/internal/middleware"
+	"github.com/eviltomorrow/omega/pkg/file"
 	"github.com/eviltomorrow/omega/pkg/zlog"
+	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 var (
@@ -61,3 +72,327 @@ func TestRunServer(t *testing.T) {
 	startupGRPC()
 	select {}
 }
+
+func TestDirOperations(t *testing.T) {
+	_assert := assert.New(t)
+	var (
+		s   = &Server{}
+		ctx = context.Background()
+		dir = t.TempDir()
+	)
+
+	_, err := s.Mkdir(ctx, &pb.MkdirRequest{Path: filepath.Join(dir, "a/b"), Parents: true})
+	_assert.Nil(err)
+	_, err = s.Mkdir(ctx, &pb.MkdirRequest{Path: filepath.Join(dir, "a")})
+	_assert.Equal(codes.AlreadyExists, status.Code(err))
+	_assert.Nil(os.WriteFile(filepath.Join(dir, "a/b/c.log"), []byte("omega"), 0644))
+
+	_, err = s.Symlink(ctx, &pb.Link{Target: "b/c.log", Path: filepath.Join(dir, "a/link")})
+	_assert.Nil(err)
+
+	entries, err := s.List(ctx, &pb.ListRequest{Path: dir})
+	_assert.Nil(err)
+	_assert.Len(entries.Entries, 1)
+
+	entries, err = s.List(ctx, &pb.ListRequest{Path: dir, Depth: 3})
+	_assert.Nil(err)
+	var names = make(map[string]*pb.Entry)
+	for _, entry := range entries.Entries {
+		names[entry.Path] = entry
+	}
+	_assert.Len(names, 4)
+	_assert.Equal(int64(5), names["a/b/c.log"].Size)
+	_assert.Equal("b/c.log", names["a/link"].Link)
+
+	_, err = s.Rename(ctx, &pb.RenameRequest{From: filepath.Join(dir, "a/b/c.log"), To: filepath.Join(dir, "a")})
+	_assert.Nil(err)
+	info, err := s.GetInfo(ctx, &wrapperspb.StringValue{Value: filepath.Join(dir, "a/c.log")})
+	_assert.Nil(err)
+	_assert.True(info.Exist)
+	_assert.Equal("c6d6bd7ebf806f43c76acc3681703b81", info.Md5)
+	_assert.Equal("304b4a90a76a1cbe4c112e074b30e75181f54df43d60f883597457844293b341", info.Sha256)
+
+	_, err = s.Remove(ctx, &pb.RemoveRequest{Path: filepath.Join(dir, "a")})
+	_assert.Equal(codes.FailedPrecondition, status.Code(err))
+	_, err = s.Remove(ctx, &pb.RemoveRequest{Path: filepath.Join(dir, "a"), Recursive: true})
+	_assert.Nil(err)
+	_, err = s.List(ctx, &pb.ListRequest{Path: filepath.Join(dir, "a")})
+	_assert.Equal(codes.NotFound, status.Code(err))
+}
+
+// serveTest serves File on a random port of localhost
+func serveTest(t *testing.T) string {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s = grpc.NewServer()
+	pb.RegisterFileServer(s, &Server{})
+	go s.Serve(listen)
+	t.Cleanup(s.Stop)
+	return listen.Addr().String()
+}
+
+func TestResumableTransfer(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		target  = serveTest(t)
+		dir     = t.TempDir()
+		local   = filepath.Join(dir, "local.bin")
+		remote  = filepath.Join(dir, "remote.bin")
+		fetched = filepath.Join(dir, "fetched.bin")
+		data    = make([]byte, 100*1024)
+	)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	_assert.Nil(os.WriteFile(local, data, 0640))
+	sha256, err := file.CalculateSHA256(local)
+	_assert.Nil(err)
+
+	// an interrupted upload left the first half on remote
+	var part = file.PartName(remote, file.TransferID(remote, sha256))
+	_assert.Nil(os.WriteFile(part, data[:len(data)/2], 0600))
+
+	_assert.Nil(Upload(target, local, remote))
+	buf, err := os.ReadFile(remote)
+	_assert.Nil(err)
+	_assert.Equal(data, buf)
+	_, err = os.Stat(part)
+	_assert.True(os.IsNotExist(err))
+	fi, err := os.Stat(remote)
+	_assert.Nil(err)
+	_assert.Equal(os.FileMode(0640), fi.Mode())
+
+	// an interrupted download left the first 10KB on local
+	part = file.PartName(fetched, file.TransferID(remote, sha256))
+	_assert.Nil(os.WriteFile(part, data[:10*1024], 0600))
+
+	_assert.Nil(Download(target, fetched, remote))
+	buf, err = os.ReadFile(fetched)
+	_assert.Nil(err)
+	_assert.Equal(data, buf)
+
+	// a corrupted part is rejected when committing, then upload is retried from scratch
+	file.RetryInterval = 10 * time.Millisecond
+	_assert.Nil(os.Remove(remote))
+	part = file.PartName(remote, file.TransferID(remote, sha256))
+	_assert.Nil(os.WriteFile(part, make([]byte, len(data)/2), 0600))
+	_assert.Nil(Upload(target, local, remote))
+	buf, err = os.ReadFile(remote)
+	_assert.Nil(err)
+	_assert.Equal(data, buf)
+	_, err = os.Stat(part)
+	_assert.True(os.IsNotExist(err))
+
+	// a part without sha256 can't be committed
+	stub, destroy, err := NewClient(target)
+	_assert.Nil(err)
+	defer destroy()
+	writer, err := stub.Write(context.Background())
+	_assert.Nil(err)
+	_assert.Nil(writer.Send(&pb.Buffer{Path: remote, TransferId: "unverified", Buf: data}))
+	_, err = writer.CloseAndRecv()
+	_assert.Equal(codes.InvalidArgument, status.Code(err))
+	_, err = os.Stat(file.PartName(remote, "unverified"))
+	_assert.True(os.IsNotExist(err))
+}
+
+func TestSync(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		target = serveTest(t)
+		local  = t.TempDir()
+		remote = filepath.Join(t.TempDir(), "conf")
+		big    = make([]byte, DefaultBlockSize*4+100)
+		mtime  = time.Unix(1600000000, 0)
+	)
+	for i := range big {
+		big[i] = byte(i * 13)
+	}
+	_assert.Nil(os.MkdirAll(filepath.Join(local, "a/b"), 0750))
+	_assert.Nil(os.WriteFile(filepath.Join(local, "a/b/big.bin"), big, 0600))
+	_assert.Nil(os.WriteFile(filepath.Join(local, "omega.conf"), []byte("[log]\n"), 0644))
+	_assert.Nil(os.Chtimes(filepath.Join(local, "omega.conf"), mtime, mtime))
+	_assert.Nil(os.Symlink("omega.conf", filepath.Join(local, "current.conf")))
+
+	var opts = &SyncOptions{Delete: true, Preserve: true}
+	_, err := Sync(target, local, remote, opts)
+	_assert.Nil(err)
+	buf, err := os.ReadFile(filepath.Join(remote, "a/b/big.bin"))
+	_assert.Nil(err)
+	_assert.Equal(big, buf)
+	link, err := os.Readlink(filepath.Join(remote, "current.conf"))
+	_assert.Nil(err)
+	_assert.Equal("omega.conf", link)
+	fi, err := os.Stat(filepath.Join(remote, "omega.conf"))
+	_assert.Nil(err)
+	_assert.Equal(mtime.Unix(), fi.ModTime().Unix())
+	fi, err = os.Stat(filepath.Join(remote, "a"))
+	_assert.Nil(err)
+	_assert.Equal(os.FileMode(0750), fi.Mode().Perm())
+
+	// entries of manifest are sent one by one
+	stub, destroy, err := NewClient(target)
+	_assert.Nil(err)
+	defer destroy()
+	reader, err := stub.Manifest(context.Background(), &pb.SyncRequest{Path: remote})
+	_assert.Nil(err)
+	var n int
+	for {
+		entry, err := reader.Recv()
+		if err == io.EOF {
+			break
+		}
+		_assert.Nil(err)
+		_assert.NotEmpty(entry.Path)
+		n++
+	}
+	manifest, err := buildManifest(context.Background(), local, DefaultBlockSize)
+	_assert.Nil(err)
+	_assert.Equal(len(manifest.Entries), n)
+
+	// nothing to do once synced
+	actions, err := Sync(target, local, remote, opts)
+	_assert.Nil(err)
+	_assert.Empty(actions)
+
+	// only the changed block is sent, extras are deleted
+	big[DefaultBlockSize*2] ^= 0xff
+	_assert.Nil(os.WriteFile(filepath.Join(local, "a/b/big.bin"), big, 0600))
+	_assert.Nil(os.MkdirAll(filepath.Join(remote, "extra/x"), 0755))
+
+	actions, err = Sync(target, local, remote, &SyncOptions{Delete: true, DryRun: true})
+	_assert.Nil(err)
+	_assert.Equal(2, len(actions))
+	_assert.Equal(OpPatch, actions[0].Op)
+	_assert.Equal(int64(DefaultBlockSize), actions[0].Size)
+	_assert.Equal(OpRemove, actions[1].Op)
+	_assert.Equal("extra", actions[1].Path)
+	_, err = os.Stat(filepath.Join(remote, "extra"))
+	_assert.Nil(err)
+
+	_, err = Sync(target, local, remote, &SyncOptions{Delete: true})
+	_assert.Nil(err)
+	buf, err = os.ReadFile(filepath.Join(remote, "a/b/big.bin"))
+	_assert.Nil(err)
+	_assert.Equal(big, buf)
+	_, err = os.Stat(filepath.Join(remote, "extra"))
+	_assert.True(os.IsNotExist(err))
+
+	// modes are kept only with preserve
+	remote = filepath.Join(t.TempDir(), "conf")
+	_, err = Sync(target, local, remote, &SyncOptions{})
+	_assert.Nil(err)
+	fi, err = os.Stat(filepath.Join(remote, "a/b/big.bin"))
+	_assert.Nil(err)
+	_assert.Equal(os.FileMode(0644), fi.Mode().Perm())
+	fi, err = os.Stat(filepath.Join(remote, "a"))
+	_assert.Nil(err)
+	_assert.Equal(os.FileMode(0755), fi.Mode().Perm())
+}
+
+func TestSandbox(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		s       = &Server{}
+		ctx     = context.Background()
+		rw      = t.TempDir()
+		ro      = t.TempDir()
+		outside = t.TempDir()
+	)
+	_assert.Nil(os.MkdirAll(filepath.Join(ro, "logs"), 0755))
+	_assert.Nil(os.Symlink(outside, filepath.Join(rw, "escape")))
+	_assert.Nil(os.Symlink(filepath.Join(rw, "escape"), filepath.Join(rw, "escape2")))
+
+	Roots = []Root{{Path: ro, ReadOnly: true}, {Path: rw}, {Path: filepath.Join(ro, "logs")}}
+	MaxWriteSize, UploadQuota = 10, 15
+	t.Cleanup(func() {
+		Roots = nil
+		MaxWriteSize, UploadQuota = 0, 0
+	})
+
+	_, err := s.Mkdir(ctx, &pb.MkdirRequest{Path: filepath.Join(rw, "a/b"), Parents: true})
+	_assert.Nil(err)
+	_, err = s.Mkdir(ctx, &pb.MkdirRequest{Path: filepath.Join(ro, "logs/today")})
+	_assert.Nil(err)
+
+	// read-only root
+	_, err = s.Mkdir(ctx, &pb.MkdirRequest{Path: filepath.Join(ro, "a")})
+	_assert.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = s.List(ctx, &pb.ListRequest{Path: ro})
+	_assert.Nil(err)
+
+	// not in roots
+	_, err = s.GetInfo(ctx, &wrapperspb.StringValue{Value: outside})
+	_assert.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = s.Rename(ctx, &pb.RenameRequest{From: filepath.Join(rw, "a"), To: filepath.Join(outside, "a")})
+	_assert.Equal(codes.PermissionDenied, status.Code(err))
+	// existence of paths out of roots can't be probed
+	_, err = s.Rename(ctx, &pb.RenameRequest{From: filepath.Join(outside, "missing"), To: filepath.Join(rw, "b")})
+	_assert.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = s.Rename(ctx, &pb.RenameRequest{From: filepath.Join(rw, "a"), To: filepath.Dir(outside)})
+	_assert.Equal(codes.PermissionDenied, status.Code(err))
+
+	// symlinks can't escape, but links themselves can be removed
+	_, err = s.Mkdir(ctx, &pb.MkdirRequest{Path: filepath.Join(rw, "escape/x")})
+	_assert.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = s.Mkdir(ctx, &pb.MkdirRequest{Path: filepath.Join(rw, "escape2/x/y"), Parents: true})
+	_assert.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = s.Remove(ctx, &pb.RemoveRequest{Path: filepath.Join(rw, "escape2")})
+	_assert.Nil(err)
+	_, err = os.Stat(outside)
+	_assert.Nil(err)
+
+	// size limit and quota
+	var l = &limiter{path: "x"}
+	_assert.Nil(l.take(8, 8))
+	_assert.Equal(codes.ResourceExhausted, status.Code(l.take(8, 8)))
+	l = &limiter{path: "y"}
+	_assert.Nil(l.take(5, 0))
+	_assert.Nil(l.take(4, 4))
+	l = &limiter{path: "z"}
+	_assert.Equal(codes.ResourceExhausted, status.Code(l.take(4, 4)))
+}
+
+func TestCompressedTransfer(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		target = serveTest(t)
+		dir    = t.TempDir()
+		src    = filepath.Join(dir, "logs")
+		data   = bytes.Repeat([]byte("2022-04-01 [I] omega is running\n"), 4096)
+	)
+	_assert.Nil(os.MkdirAll(filepath.Join(src, "sub"), 0755))
+	_assert.Nil(os.WriteFile(filepath.Join(src, "a.log"), data, 0644))
+	_assert.Nil(os.WriteFile(filepath.Join(src, "sub/b.log"), data[:100], 0600))
+	_assert.Nil(os.Symlink("a.log", filepath.Join(src, "current.log")))
+
+	for _, compressor := range []string{"zstd", "gzip", "identity"} {
+		file.Compressor = compressor
+		var remote = filepath.Join(dir, compressor+".log")
+		_assert.Nil(Upload(target, filepath.Join(src, "a.log"), remote))
+		_assert.Nil(Download(target, filepath.Join(dir, compressor+".fetched"), remote))
+		buf, err := os.ReadFile(filepath.Join(dir, compressor+".fetched"))
+		_assert.Nil(err)
+		_assert.Equal(data, buf)
+	}
+	file.Compressor = "zstd"
+
+	// folders are downloaded as tar.gz stream
+	var local = filepath.Join(dir, "fetched")
+	_assert.Nil(Download(target, local, src))
+	buf, err := os.ReadFile(filepath.Join(local, "logs/a.log"))
+	_assert.Nil(err)
+	_assert.Equal(data, buf)
+	fi, err := os.Stat(filepath.Join(local, "logs/sub/b.log"))
+	_assert.Nil(err)
+	_assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+	link, err := os.Readlink(filepath.Join(local, "logs/current.log"))
+	_assert.Nil(err)
+	_assert.Equal("a.log", link)
+}
@@ -0,0 +1,446 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eviltomorrow/omega/internal/api/file/pb"
+	"github.com/eviltomorrow/omega/pkg/file"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var DefaultBlockSize = 64 * 1024
+
+// SyncOptions controls how Sync makes remote the same as local
+type SyncOptions struct {
+	// Delete removes remote entries which don't exist in local
+	Delete bool
+	// Preserve keeps modes and mtimes the same as local
+	Preserve bool
+	// DryRun only plans actions
+	DryRun bool
+}
+
+const (
+	OpMkdir   = "mkdir"
+	OpPatch   = "patch"
+	OpSymlink = "symlink"
+	OpRemove  = "remove"
+	OpChmod   = "chmod"
+)
+
+// Action is one step of Sync, Size is the number of bytes to be transferred
+type Action struct {
+	Op   string
+	Path string
+	Size int64
+
+	local  *pb.Entry
+	remote *pb.Entry
+}
+
+func (a *Action) String() string {
+	if a.Op == OpPatch {
+		return fmt.Sprintf("%-7s %s (%d bytes)", a.Op, a.Path, a.Size)
+	}
+	return fmt.Sprintf("%-7s %s", a.Op, a.Path)
+}
+
+// Sync makes remote directory the same as local directory, only changed blocks
+// of files are transferred. The actions are returned even if DryRun is set.
+func Sync(target string, local string, remote string, opts *SyncOptions) ([]*Action, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	fi, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("local: %s is not a folder", local)
+	}
+
+	stub, destroy, err := NewClient(target)
+	if err != nil {
+		return nil, err
+	}
+	defer destroy()
+
+	var remoteFi *pb.Info
+	callOpts, err := file.Negotiate(func(opts ...grpc.CallOption) (err error) {
+		remoteFi, err = stub.GetInfo(context.Background(), &wrapperspb.StringValue{Value: remote}, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if remoteFi.Exist && !remoteFi.IsDir {
+		return nil, fmt.Errorf("remote: %s is not a folder", remote)
+	}
+
+	var remoteEntries = &pb.Entries{BlockSize: int32(DefaultBlockSize)}
+	if remoteFi.Exist {
+		if remoteEntries.Entries, err = recvManifest(stub, remote, callOpts...); err != nil {
+			return nil, err
+		}
+	}
+	localEntries, err := buildManifest(context.Background(), local, int(remoteEntries.BlockSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var actions = planSync(localEntries, remoteEntries, opts)
+	if opts.DryRun {
+		return actions, nil
+	}
+
+	if !remoteFi.Exist {
+		var req = &pb.MkdirRequest{Path: remote, Parents: true}
+		if opts.Preserve {
+			req.Mode = int32(fi.Mode().Perm())
+		}
+		if _, err := stub.Mkdir(context.Background(), req); err != nil {
+			return nil, err
+		}
+	}
+	for _, action := range actions {
+		if err := applyAction(stub, local, remote, int(remoteEntries.BlockSize), action, opts, callOpts...); err != nil {
+			return actions, fmt.Errorf("%s failure, nest error: %v", action, err)
+		}
+	}
+	return actions, nil
+}
+
+// planSync compares manifests, entries of local are walked parents first, so
+// folders are made before their children.
+func planSync(local, remote *pb.Entries, opts *SyncOptions) []*Action {
+	var (
+		actions   = make([]*Action, 0, len(local.Entries))
+		remoteMap = make(map[string]*pb.Entry, len(remote.Entries))
+		localMap  = make(map[string]*pb.Entry, len(local.Entries))
+		replaced  = make(map[string]bool)
+	)
+	for _, entry := range remote.Entries {
+		remoteMap[entry.Path] = entry
+	}
+
+	for _, l := range local.Entries {
+		localMap[l.Path] = l
+		var r = remoteMap[l.Path]
+		if r != nil && kindOf(r) != kindOf(l) {
+			actions = append(actions, &Action{Op: OpRemove, Path: l.Path, remote: r})
+			replaced[l.Path] = true
+			r = nil
+		}
+
+		switch {
+		case l.IsDir:
+			if r == nil {
+				actions = append(actions, &Action{Op: OpMkdir, Path: l.Path, local: l})
+			}
+
+		case fs.FileMode(l.Mode)&fs.ModeSymlink != 0:
+			if r != nil && r.Link == l.Link {
+				continue
+			}
+			if r != nil {
+				actions = append(actions, &Action{Op: OpRemove, Path: l.Path, remote: r})
+			}
+			actions = append(actions, &Action{Op: OpSymlink, Path: l.Path, local: l})
+			continue
+
+		case r == nil || r.Sha256 != l.Sha256:
+			actions = append(actions, &Action{Op: OpPatch, Path: l.Path, Size: patchSize(l, r, local.BlockSize), local: l, remote: r})
+			continue
+		}
+
+		if r != nil && opts.Preserve && !l.IsDir && (r.Mode != l.Mode || r.ModTime != l.ModTime) {
+			actions = append(actions, &Action{Op: OpChmod, Path: l.Path, local: l})
+		}
+	}
+
+	if opts.Delete {
+		var removed = make([]string, 0, 8)
+	loop:
+		for _, r := range remote.Entries {
+			if _, ok := localMap[r.Path]; ok {
+				continue
+			}
+			for _, dir := range removed {
+				if strings.HasPrefix(r.Path, dir+"/") {
+					continue loop
+				}
+			}
+			if r.IsDir {
+				removed = append(removed, r.Path)
+			}
+			actions = append(actions, &Action{Op: OpRemove, Path: r.Path, remote: r})
+		}
+	}
+
+	// modes and mtimes of folders are set at last, they are changed by their children
+	if opts.Preserve {
+		for i := len(local.Entries) - 1; i >= 0; i-- {
+			var l = local.Entries[i]
+			if !l.IsDir {
+				continue
+			}
+			if r, ok := remoteMap[l.Path]; ok && !replaced[l.Path] && r.Mode == l.Mode && r.ModTime == l.ModTime && !changedUnder(actions, l.Path) {
+				continue
+			}
+			actions = append(actions, &Action{Op: OpChmod, Path: l.Path, local: l})
+		}
+	}
+	return actions
+}
+
+func applyAction(stub pb.FileClient, local, remote string, blockSize int, action *Action, opts *SyncOptions, callOpts ...grpc.CallOption) error {
+	var (
+		ctx = context.Background()
+		dst = filepath.Join(remote, filepath.FromSlash(action.Path))
+		src = filepath.Join(local, filepath.FromSlash(action.Path))
+	)
+	switch action.Op {
+	case OpMkdir:
+		var req = &pb.MkdirRequest{Path: dst}
+		if opts.Preserve {
+			req.Mode = action.local.Mode & int32(fs.ModePerm)
+		}
+		_, err := stub.Mkdir(ctx, req)
+		return err
+
+	case OpRemove:
+		_, err := stub.Remove(ctx, &pb.RemoveRequest{Path: dst, Recursive: action.remote.IsDir})
+		return err
+
+	case OpSymlink:
+		_, err := stub.Symlink(ctx, &pb.Link{Target: action.local.Link, Path: dst})
+		return err
+
+	case OpChmod:
+		_, err := stub.SetMode(ctx, &pb.Mode{Path: dst, Mode: action.local.Mode & int32(fs.ModePerm), ModTime: action.local.ModTime})
+		return err
+
+	case OpPatch:
+		return patch(stub, src, dst, blockSize, action, opts, callOpts...)
+
+	default:
+		return fmt.Errorf("not implement op[%s]", action.Op)
+	}
+}
+
+// patch sends blocks of src which are different from remote, the others are
+// copied from the old file by agent.
+func patch(stub pb.FileClient, src, dst string, blockSize int, action *Action, opts *SyncOptions, callOpts ...grpc.CallOption) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the stream is canceled if patch returns before CloseAndRecv
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writer, err := stub.Patch(ctx, callOpts...)
+	if err != nil {
+		return err
+	}
+	var head = &pb.PatchChunk{Path: dst, Sha256: action.local.Sha256}
+	if opts.Preserve {
+		head.Mode, head.ModTime = action.local.Mode&int32(fs.ModePerm), action.local.ModTime
+	}
+	if err := writer.Send(head); err != nil {
+		// io.EOF of Send hides the status which is returned by CloseAndRecv
+		if _, rerr := writer.CloseAndRecv(); rerr != nil && rerr != io.EOF {
+			return rerr
+		}
+		return err
+	}
+
+	var (
+		blocks  [][]byte
+		buf     = make([]byte, blockSize)
+		offset  int64
+		copying *pb.PatchChunk
+	)
+	if action.remote != nil {
+		blocks = action.remote.Blocks
+	}
+
+	// a failed Send is reported by CloseAndRecv
+loop:
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(f, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		var sum = sha256.Sum256(buf[:n])
+		if i < len(blocks) && bytes.Equal(blocks[i], sum[:]) {
+			if copying == nil {
+				copying = &pb.PatchChunk{Offset: offset}
+			}
+			copying.CopyLength += int64(n)
+		} else {
+			if copying != nil {
+				if err := writer.Send(copying); err != nil {
+					break loop
+				}
+				copying = nil
+			}
+			if err := writer.Send(&pb.PatchChunk{Offset: offset, Buf: buf[:n], Crc: file.CRC(buf[:n])}); err != nil {
+				break loop
+			}
+		}
+		offset += int64(n)
+	}
+	if copying != nil {
+		writer.Send(copying)
+	}
+
+	if _, err := writer.CloseAndRecv(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// recvManifest receives entries of remote folder summed by DefaultBlockSize
+func recvManifest(stub pb.FileClient, remote string, callOpts ...grpc.CallOption) ([]*pb.Entry, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader, err := stub.Manifest(ctx, &pb.SyncRequest{Path: remote, BlockSize: int32(DefaultBlockSize)}, callOpts...)
+	if err != nil {
+		return nil, err
+	}
+	var entries = make([]*pb.Entry, 0, 64)
+	for {
+		entry, err := reader.Recv()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// buildManifest walks root in lexical order and returns all entries with paths
+// relative to root, regular files are summed by blocks.
+func buildManifest(ctx context.Context, root string, blockSize int) (*pb.Entries, error) {
+	var entries = &pb.Entries{BlockSize: int32(blockSize)}
+	err := walkManifest(ctx, root, blockSize, func(entry *pb.Entry) error {
+		entries.Entries = append(entries.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// walkManifest calls fn with entries of buildManifest one by one
+func walkManifest(ctx context.Context, root string, blockSize int, fn func(*pb.Entry) error) error {
+	root = filepath.Clean(root)
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entry, err := newEntry(path, filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			entry.Sha256, entry.Blocks, err = blockSums(path, blockSize)
+			if err != nil {
+				return err
+			}
+		}
+		return fn(entry)
+	})
+}
+
+// blockSums returns sha256 of the whole file and of every block
+func blockSums(path string, blockSize int) (string, [][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	var (
+		whole  = sha256.New()
+		blocks = make([][]byte, 0, 16)
+		buf    = make([]byte, blockSize)
+	)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return "", nil, err
+		}
+		whole.Write(buf[:n])
+		var sum = sha256.Sum256(buf[:n])
+		blocks = append(blocks, sum[:])
+	}
+	return fmt.Sprintf("%x", whole.Sum(nil)), blocks, nil
+}
+
+// patchSize estimates bytes to be sent by patch
+func patchSize(local, remote *pb.Entry, blockSize int32) int64 {
+	if remote == nil {
+		return local.Size
+	}
+	var size int64
+	for i, sum := range local.Blocks {
+		if i < len(remote.Blocks) && bytes.Equal(sum, remote.Blocks[i]) {
+			continue
+		}
+		var n = int64(blockSize)
+		if rest := local.Size - int64(i)*int64(blockSize); rest < n {
+			n = rest
+		}
+		size += n
+	}
+	return size
+}
+
+func kindOf(entry *pb.Entry) fs.FileMode {
+	return fs.FileMode(entry.Mode).Type()
+}
+
+// changedUnder reports whether any action changes children of dir
+func changedUnder(actions []*Action, dir string) bool {
+	for _, action := range actions {
+		if action.Op != OpChmod && strings.HasPrefix(action.Path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/eviltomorrow/omega/pkg/file"
+	"github.com/eviltomorrow/omega/pkg/lock"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"go.uber.org/zap"
+)
+
+// BlobDir keeps artifacts of all images by their sha256, ImageDir/blobs/sha256/<sum>
+const BlobDir = "blobs"
+
+func blobPath(sha256 string) string {
+	return filepath.Join(ImageDir, BlobDir, "sha256", sha256)
+}
+
+// saveBlob moves a verified file to the blob of sha256, the file is dropped if
+// the blob exists already.
+func saveBlob(path string, sha256 string) error {
+	var blob = blobPath(sha256)
+	if _, err := os.Stat(blob); err == nil {
+		return os.Remove(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(blob), 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path, blob)
+}
+
+// referencedBlobs returns sha256 of blobs which are referenced by manifests
+func referencedBlobs() (map[string]bool, error) {
+	versions, err := listVersions()
+	if err != nil {
+		// an empty repository references nothing
+		versions = nil
+	}
+
+	var blobs = make(map[string]bool, 4*len(versions))
+	for _, version := range versions {
+		m, err := loadManifest(version.Original())
+		if err != nil {
+			return nil, fmt.Errorf("load manifest of [%s] failure, nest error: %v", version.Original(), err)
+		}
+		for _, a := range m.Artifacts {
+			blobs[a.Sha256] = true
+		}
+	}
+	return blobs, nil
+}
+
+// pruneBlobs removes blobs which are referenced by no manifest, the caller
+// holds ImageLockFile. Patches of removed blobs are removed too. It returns
+// the size of removed blobs.
+func pruneBlobs() (int64, error) {
+	referenced, err := referencedBlobs()
+	if err != nil {
+		return 0, err
+	}
+	fis, err := ioutil.ReadDir(filepath.Join(ImageDir, BlobDir, "sha256"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var freed int64
+	for _, fi := range fis {
+		if fi.IsDir() || referenced[fi.Name()] {
+			continue
+		}
+		if err := os.Remove(blobPath(fi.Name())); err != nil {
+			return freed, err
+		}
+		freed += fi.Size()
+	}
+	return freed, pruneDeltas(referenced)
+}
+
+// Migrate moves artifacts which are saved in tag folders into blobs, and
+// converts release.md of images pushed before manifests. Images which are
+// migrated already are skipped, so it runs on every start of hub.
+func Migrate() error {
+	fl, err := lock.CreateFileLock(ImageLockFile)
+	if err != nil {
+		return err
+	}
+	defer lock.DestroyFileLock(fl)
+
+	versions, err := listVersions()
+	if err != nil {
+		// nothing to migrate in an empty repository
+		return nil
+	}
+	for _, version := range versions {
+		if err := migrateImage(version.Original()); err != nil {
+			zlog.Error("Migrate image failure", zap.String("tag", version.Original()), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func migrateImage(tag string) error {
+	m, err := loadManifest(tag)
+	if errors.Is(err, ErrImageNotExist) {
+		if m, err = legacyManifest(tag); err != nil {
+			return err
+		}
+		// the manifest is saved first, so that a broken migration is resumed
+		if err := m.save(); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var moved int
+	for _, a := range m.Artifacts {
+		var legacy = a.legacyPath(tag)
+		if _, err := os.Stat(legacy); os.IsNotExist(err) {
+			continue
+		}
+		sha256, err := file.CalculateSHA256(legacy)
+		if err != nil {
+			return err
+		}
+		if sha256 != a.Sha256 {
+			return fmt.Errorf("%w, artifact: %s, platform: %s, expect: %s, actual: %s", file.ErrSHA256Mismatch, a.Name, a.Platform, a.Sha256, sha256)
+		}
+		if err := saveBlob(legacy, sha256); err != nil {
+			return err
+		}
+		moved++
+	}
+	if moved == 0 {
+		return nil
+	}
+
+	// platform folders are empty now
+	fis, err := ioutil.ReadDir(filepath.Join(ImageDir, tag))
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() {
+			os.Remove(filepath.Join(ImageDir, tag, fi.Name()))
+		}
+	}
+	zlog.Info("Image is migrated to blobs", zap.String("tag", tag), zap.Int("artifacts", moved))
+	return nil
+}
@@ -0,0 +1,156 @@
+package hub
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/eviltomorrow/omega/internal/api/hub/pb"
+)
+
+const (
+	// ChannelFile keeps the last move of every channel
+	ChannelFile = "channels.json"
+	// ChannelHistoryFile appends every move of channels, one json per line
+	ChannelHistoryFile = "channels.log"
+)
+
+type channelMove struct {
+	Channel  string `json:"channel"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Time     int64  `json:"time"`
+	Operator string `json:"operator"`
+	Peer     string `json:"peer"`
+	Rollback bool   `json:"rollback,omitempty"`
+}
+
+func (m *channelMove) toPB() *pb.ChannelMove {
+	return &pb.ChannelMove{Channel: m.Channel, From: m.From, To: m.To, Time: m.Time, Operator: m.Operator, Peer: m.Peer, Rollback: m.Rollback}
+}
+
+// loadChannels returns the last move of every channel
+func loadChannels() (map[string]*channelMove, error) {
+	var channels = make(map[string]*channelMove)
+	buf, err := ioutil.ReadFile(filepath.Join(ImageDir, ChannelFile))
+	if os.IsNotExist(err) {
+		return channels, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &channels); err != nil {
+		return nil, fmt.Errorf("parse %s failure, nest error: %v", ChannelFile, err)
+	}
+	return channels, nil
+}
+
+// saveMove appends move to history before the channel is moved, so that
+// every move of channels can be audited.
+func saveMove(channels map[string]*channelMove, move *channelMove) error {
+	f, err := os.OpenFile(filepath.Join(ImageDir, ChannelHistoryFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	line, _ := json.Marshal(move)
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	channels[move.Channel] = move
+	buf, err := json.MarshalIndent(channels, "", "  ")
+	if err != nil {
+		return err
+	}
+	var (
+		name = filepath.Join(ImageDir, ChannelFile)
+		tmp  = name + ".tmp"
+	)
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// loadHistory returns moves of channel from old to new, all channels if it is empty
+func loadHistory(channel string) ([]*channelMove, error) {
+	f, err := os.Open(filepath.Join(ImageDir, ChannelHistoryFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		history = make([]*channelMove, 0, 32)
+		scanner = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		var move = &channelMove{}
+		if err := json.Unmarshal(scanner.Bytes(), move); err != nil {
+			continue
+		}
+		if channel == "" || move.Channel == channel {
+			history = append(history, move)
+		}
+	}
+	return history, scanner.Err()
+}
+
+// previousTag returns the tag which a rollback of channel moves to, history
+// is replayed so that rollbacks undo promotions one by one.
+func previousTag(history []*channelMove) string {
+	var promoted = make([]string, 0, len(history))
+	for _, move := range history {
+		if move.Rollback {
+			if len(promoted) != 0 {
+				promoted = promoted[:len(promoted)-1]
+			}
+			continue
+		}
+		promoted = append(promoted, move.To)
+	}
+	if len(promoted) < 2 {
+		return ""
+	}
+	return promoted[len(promoted)-2]
+}
+
+// channelTags returns tags which are referenced by channels
+func channelTags(channels map[string]*channelMove) map[string][]string {
+	var tags = make(map[string][]string, len(channels))
+	for name, move := range channels {
+		tags[move.To] = append(tags[move.To], name)
+	}
+	for _, names := range tags {
+		sort.Strings(names)
+	}
+	return tags
+}
+
+// IsChannel reports whether name can be a channel, channels are named in
+// lower case and are different from tags and "latest".
+func IsChannel(name string) bool {
+	if name == "" || name == "latest" || len(name) > 64 || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+	if name[0] == 'v' && len(name) > 1 && name[1] >= '0' && name[1] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -3,15 +3,21 @@ package hub
 import (
 	"bufio"
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"io/fs"
+	"io/ioutil"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/hub/pb"
 	"github.com/eviltomorrow/omega/pkg/bar"
+	"github.com/eviltomorrow/omega/pkg/delta"
 	"github.com/eviltomorrow/omega/pkg/exec"
 	"github.com/eviltomorrow/omega/pkg/file"
 	"github.com/eviltomorrow/omega/pkg/self"
@@ -19,6 +25,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/balancer/roundrobin"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -26,11 +33,11 @@ var (
 	DefaultDialTimeout = 5 * time.Second
 )
 
-func newHubConn() (*grpc.ClientConn, error) {
+func newHubConn(service string) (*grpc.ClientConn, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultDialTimeout)
 	defer cancel()
 
-	target := fmt.Sprintf("etcd:///%s/omega-hub", self.EtcdKeyPrefix)
+	target := fmt.Sprintf("etcd:///%s/%s", self.EtcdKeyPrefix, service)
 	conn, err := grpc.DialContext(
 		ctx,
 		target,
@@ -44,8 +51,9 @@ func newHubConn() (*grpc.ClientConn, error) {
 	return conn, nil
 }
 
+// NewClient connects to any hub, replicas serve pulls as the primary does
 func NewClient() (pb.HubClient, func(), error) {
-	conn, err := newHubConn()
+	conn, err := newHubConn("omega-hub")
 	if err != nil {
 		return nil, nil, err
 	}
@@ -53,45 +61,140 @@ func NewClient() (pb.HubClient, func(), error) {
 	return pb.NewHubClient(conn), func() { conn.Close() }, nil
 }
 
-func Push(local string, releaseNote string) (string, error) {
-	tag, created, err := verifyOmega(local)
+// NewPrimaryClient connects to the primary hub, images are changed there only
+func NewPrimaryClient() (pb.HubClient, func(), error) {
+	conn, err := newHubConn("omega-hub/primary")
 	if err != nil {
+		return nil, nil, err
+	}
+
+	return pb.NewHubClient(conn), func() { conn.Close() }, nil
+}
+
+// Push creates image with local omega binary, or adds the binary to the image
+// for its platform. Binaries of other platforms can't be run to get their tag,
+// so tag is required for them. It returns the tag and md5 of the binary.
+func Push(local string, tag string, releaseNote string) (string, string, error) {
+	platform, err := DetectPlatform(local)
+	if err != nil {
+		return "", "", err
+	}
+
+	var created string
+	if platform == Platform {
+		version, buildTime, err := VerifyOmega(local)
+		if err != nil {
+			return "", "", err
+		}
+		if tag != "" && tag != version {
+			return "", "", fmt.Errorf("tag of omega is %s, not %s", version, tag)
+		}
+		tag, created = version, buildTime
+	} else if tag == "" {
+		return "", "", fmt.Errorf("tag is required for omega of platform[%s]", platform)
+	}
+
+	md5, err := pushArtifact(local, &pb.Image{ReleaseNotes: releaseNote, Tag: tag, CreateTime: created, Artifact: BinaryArtifact, Kind: KindBinary, Platform: platform})
+	return tag, md5, err
+}
+
+// PushArtifact adds local file to the existing image tag, name is the base
+// name of local if it is empty. A pushed artifact with the same name and
+// platform is replaced, binaries are pushed for the platform they are built for.
+func PushArtifact(tag string, local string, name string, kind string) (string, error) {
+	if name == "" {
+		name = filepath.Base(local)
+	}
+	if err := checkArtifact(name, kind); err != nil {
 		return "", err
 	}
+	var image = &pb.Image{Tag: tag, Artifact: name, Kind: kind}
+	if kind == KindBinary {
+		platform, err := DetectPlatform(local)
+		if err != nil {
+			return "", err
+		}
+		image.Platform = platform
+	}
+	return pushArtifact(local, image)
+}
 
-	stub, destroy, err := NewClient()
+func pushArtifact(local string, image *pb.Image) (string, error) {
+	localFI, err := os.Stat(local)
+	if err != nil {
+		return "", err
+	}
+	if localFI.IsDir() {
+		return "", fmt.Errorf("panic: local file is a dir")
+	}
+	image.Sha256, err = file.CalculateSHA256(local)
+	if err != nil {
+		return "", err
+	}
+	image.Mode = int32(localFI.Mode().Perm())
+
+	stub, destroy, err := NewPrimaryClient()
 	if err != nil {
 		return "", err
 	}
 	defer destroy()
 
-	localF, err := os.OpenFile(local, os.O_RDONLY, 0644)
+	var title = fmt.Sprintf("image [omega-%s] %s", image.Tag, image.Artifact)
+	if image.Platform != "" {
+		title = fmt.Sprintf("%s (%s)", title, image.Platform)
+	}
+	p, counter := bar.NewProgressbar(int(localFI.Size()), "Push", title)
+	defer p.Close()
+	defer close(counter)
+
+	var (
+		report = file.Progress(counter)
+		md5    string
+	)
+	opts, err := file.Negotiate(func(opts ...grpc.CallOption) error {
+		_, err := stub.Offset(context.Background(), image, opts...)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
-	defer localF.Close()
+	err = file.Retry(func() error {
+		md5, err = push(stub, local, image, report, opts...)
+		return err
+	})
+	return md5, err
+}
 
-	localFI, err := localF.Stat()
+func push(stub pb.HubClient, local string, image *pb.Image, report func(int64), opts ...grpc.CallOption) (string, error) {
+	offset, err := stub.Offset(context.Background(), image)
 	if err != nil {
 		return "", err
 	}
 
-	writer, err := stub.Push(context.Background())
+	localF, err := os.OpenFile(local, os.O_RDONLY, 0644)
 	if err != nil {
 		return "", err
 	}
+	defer localF.Close()
 
-	if err := writer.Send(&pb.Image{ReleaseNotes: releaseNote, Tag: tag, CreateTime: created}); err != nil {
+	if _, err := localF.Seek(offset.Value, io.SeekStart); err != nil {
 		return "", err
 	}
+	report(offset.Value)
 
-	p, counter := bar.NewProgressbar(int(localFI.Size()), "Push", fmt.Sprintf("image [omega-%s]", tag))
-	defer p.Close()
-	defer close(counter)
+	writer, err := stub.Push(context.Background(), opts...)
+	if err != nil {
+		return "", err
+	}
+
+	if err := writer.Send(&pb.Image{ReleaseNotes: image.ReleaseNotes, Tag: image.Tag, CreateTime: image.CreateTime, Sha256: image.Sha256, Offset: offset.Value, Artifact: image.Artifact, Kind: image.Kind, Mode: image.Mode, Platform: image.Platform}); err != nil {
+		return "", err
+	}
 
 	var (
 		buf     [1024 * 8]byte
 		limiter = rate.NewLimiter(rate.Every(time.Second/1000), 1)
+		pos     = offset.Value
 	)
 
 	for {
@@ -104,14 +207,11 @@ func Push(local string, releaseNote string) (string, error) {
 		}
 		limiter.WaitN(context.Background(), 1)
 
-		if err := writer.Send(&pb.Image{Buf: buf[:n]}); err != nil {
-			return "", err
+		if err := writer.Send(&pb.Image{Buf: buf[:n], Offset: pos, Crc: file.CRC(buf[:n])}); err != nil {
+			break
 		}
-		counter <- n
-	}
-
-	if err := writer.CloseSend(); err != nil {
-		return "", err
+		pos += int64(n)
+		report(pos)
 	}
 
 	resp, err := writer.CloseAndRecv()
@@ -121,57 +221,373 @@ func Push(local string, releaseNote string) (string, error) {
 	return resp.Value, nil
 }
 
-func Pull(local string, tag string) error {
+// Resolve returns the image which tag, "latest" or a channel refers to
+func Resolve(tag string) (*pb.Image, error) {
 	stub, destroy, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+	defer destroy()
+
+	return findImage(stub, tag)
+}
+
+// Promote moves channel to tag, or back to its previous tag if rollback is set
+func Promote(channel string, tag string, rollback bool) (*pb.ChannelMove, error) {
+	stub, destroy, err := NewPrimaryClient()
+	if err != nil {
+		return nil, err
+	}
+	defer destroy()
+
+	var operator string
+	if u, err := user.Current(); err == nil {
+		operator = u.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		operator = operator + "@" + hostname
+	}
+	return stub.Promote(context.Background(), &pb.PromoteRequest{Channel: channel, Tag: tag, Rollback: rollback, Operator: operator})
+}
+
+// Report tells the primary hub that host runs binary with sha256, so that
+// its image is kept by GC.
+func Report(host string, sha256 string) error {
+	stub, destroy, err := NewPrimaryClient()
 	if err != nil {
 		return err
 	}
 	defer destroy()
 
+	_, err = stub.Report(context.Background(), &pb.RunningReport{Host: host, Sha256: sha256, Platform: Platform})
+	return err
+}
+
+// Sign signs manifest of image tag with key, the signature is kept by hub
+// until artifacts of the image are changed.
+func Sign(tag string, key ed25519.PrivateKey) error {
+	stub, destroy, err := NewPrimaryClient()
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	image, err := findImage(stub, tag)
+	if err != nil {
+		return err
+	}
+	_, err = stub.Sign(context.Background(), &pb.SignRequest{Tag: image.Tag, Signature: SignImage(image, key)})
+	return err
+}
+
+// Pull fetches omega binary of image tag for Platform into local file
+func Pull(local string, tag string) error {
+	return PullArtifact(local, tag, BinaryArtifact, Platform)
+}
+
+// PullArtifact fetches artifact name of image tag into local file, artifacts
+// built for platform are preferred to the ones which run anywhere. The image
+// is verified with TrustedKeys before anything is pulled.
+func PullArtifact(local string, tag string, name string, platform string) error {
 	localFi, err := os.Stat(local)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-
 	if err == nil && localFi.IsDir() {
 		return fmt.Errorf("panic: local file is a dir")
 	}
 
-	reader, err := stub.Pull(context.Background(), &wrapperspb.StringValue{Value: tag})
+	stub, destroy, err := NewClient()
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	var image *pb.Image
+	opts, err := file.Negotiate(func(opts ...grpc.CallOption) (err error) {
+		image, err = findImage(stub, tag, opts...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := verifyPulled(image); err != nil {
+		return err
+	}
+	artifact, err := findArtifact(image, name, platform)
+	if err != nil {
+		return err
+	}
+	return pullArtifact(stub, local, image, artifact, opts...)
+}
+
+// PullImage fetches artifacts of image tag for platform into dir, artifacts
+// which are not built for platform are skipped. It returns the pulled image
+// with the pulled artifacts.
+func PullImage(dir string, tag string, platform string) (*pb.Image, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	stub, destroy, err := NewClient()
 	if err != nil {
+		return nil, err
+	}
+	defer destroy()
+
+	var image *pb.Image
+	opts, err := file.Negotiate(func(opts ...grpc.CallOption) (err error) {
+		image, err = findImage(stub, tag, opts...)
 		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyPulled(image); err != nil {
+		return nil, err
 	}
 
 	var (
-		pipe   = make(chan []byte, 128)
-		signal = make(chan error, 1)
+		names     = []string{BinaryArtifact}
+		artifacts = make([]*pb.Artifact, 0, len(image.Artifacts)+1)
 	)
+	for _, a := range image.Artifacts {
+		if a.Name != names[len(names)-1] {
+			names = append(names, a.Name)
+		}
+	}
+	for _, name := range names {
+		artifact, err := findArtifact(image, name, platform)
+		if err != nil && name == BinaryArtifact {
+			return nil, err
+		}
+		if err != nil {
+			continue
+		}
+		if err := pullArtifact(stub, filepath.Join(dir, artifact.Name), image, artifact, opts...); err != nil {
+			return nil, fmt.Errorf("pull artifact[%s] failure, nest error: %v", artifact.Name, err)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	image.Artifacts = artifacts
+	return image, nil
+}
 
-	go func() {
-		for {
-			data, err := reader.Recv()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				signal <- err
-				return
-			}
+func pullArtifact(stub pb.HubClient, local string, image *pb.Image, artifact *pb.Artifact, opts ...grpc.CallOption) error {
+	var mode = fs.FileMode(artifact.Mode).Perm()
+	if artifact.Kind == KindBinary {
+		mode = 0755
+	}
+	if mode == 0 {
+		mode = 0644
+	}
 
-			pipe <- data.Buf
+	var name = file.PartName(local, file.TransferID(transferKey(image.Tag, artifact.Name, artifact.Platform), artifact.Sha256))
+	return file.Retry(func() error {
+		return pull(stub, &pb.PullRequest{Tag: image.Tag, Artifact: artifact.Name, Platform: artifact.Platform}, name, func(part *file.Part) error {
+			return part.Commit(local, artifact.Sha256, mode)
+		}, opts...)
+	})
+}
+
+func pull(stub pb.HubClient, req *pb.PullRequest, name string, commit func(*file.Part) error, opts ...grpc.CallOption) error {
+	part, err := file.OpenPart(name)
+	if err != nil {
+		return err
+	}
 
+	reader, err := stub.Pull(context.Background(), &pb.PullRequest{Tag: req.Tag, Offset: part.Offset(), Artifact: req.Artifact, Platform: req.Platform}, opts...)
+	if err != nil {
+		part.Close()
+		return err
+	}
+	if err := receive(part, reader.Recv); err != nil {
+		part.Close()
+		return err
+	}
+	return commit(part)
+}
+
+// receive writes a stream of Pull or Delta into part until it ends
+func receive(part *file.Part, recv func() (*pb.Image, error)) error {
+	for {
+		data, err := recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := file.CheckCRC(data.Buf, data.Crc); err != nil {
+			return err
 		}
-		close(pipe)
-	}()
+		if err := part.Write(data.Offset, data.Buf); err != nil {
+			return err
+		}
+	}
+}
+
+// PullDelta fetches omega binary of image tag for Platform into local file by
+// patching base, which is the binary running now. Only the patch between them
+// is transferred, and the patched binary is verified with its sha256, so the
+// full binary should be pulled with Pull if it fails.
+func PullDelta(local string, base string, tag string) error {
+	old, err := ioutil.ReadFile(base)
+	if err != nil {
+		return err
+	}
 
-	if err := file.Write(local, 0755, pipe, signal); err != nil {
-		os.Remove(local)
+	stub, destroy, err := NewClient()
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	var image *pb.Image
+	opts, err := file.Negotiate(func(opts ...grpc.CallOption) (err error) {
+		image, err = findImage(stub, tag, opts...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := verifyPulled(image); err != nil {
+		return err
+	}
+	artifact, err := findArtifact(image, BinaryArtifact, Platform)
+	if err != nil {
 		return err
 	}
-	return nil
+
+	new, err := pullDelta(stub, local, old, image.Tag, artifact, opts...)
+	if err != nil {
+		return err
+	}
+
+	var tmp = local + ".tmp"
+	if err := ioutil.WriteFile(tmp, new, 0755); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp, local)
+}
+
+// pullDelta pulls the patch from old to artifact of image tag, and returns the
+// patched binary which is verified with sha256 of artifact.
+func pullDelta(stub pb.HubClient, local string, old []byte, tag string, artifact *pb.Artifact, opts ...grpc.CallOption) ([]byte, error) {
+	var from = fmt.Sprintf("%x", sha256.Sum256(old))
+	if artifact.Sha256 == from {
+		return old, nil
+	}
+
+	var (
+		req       = &pb.DeltaRequest{Tag: tag, Platform: artifact.Platform, FromSha256: from}
+		name      = file.PartName(local, file.TransferID("delta:"+from, artifact.Sha256))
+		patchFile = local + ".delta"
+	)
+	err := file.Retry(func() error {
+		part, err := file.OpenPart(name)
+		if err != nil {
+			return err
+		}
+		req.Offset = part.Offset()
+		reader, err := stub.Delta(context.Background(), req, opts...)
+		if err != nil {
+			part.Close()
+			return err
+		}
+		if err := receive(part, reader.Recv); err != nil {
+			part.Close()
+			return err
+		}
+		return part.Commit(patchFile, "", 0600)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pull delta from [%s] failure, nest error: %v", from, err)
+	}
+
+	patch, err := os.Open(patchFile)
+	if err != nil {
+		return nil, err
+	}
+	new, err := delta.Patch(old, bufio.NewReader(patch))
+	patch.Close()
+	os.Remove(patchFile)
+	if err != nil {
+		return nil, err
+	}
+	if actual := fmt.Sprintf("%x", sha256.Sum256(new)); actual != artifact.Sha256 {
+		return nil, fmt.Errorf("%w, patched binary, expect: %s, actual: %s", file.ErrSHA256Mismatch, artifact.Sha256, actual)
+	}
+	return new, nil
+}
+
+// findImage resolves tag with List, "latest" is the highest version, and a
+// channel is the tag it points to.
+func findImage(stub pb.HubClient, tag string, opts ...grpc.CallOption) (*pb.Image, error) {
+	if IsChannel(tag) {
+		channels, err := stub.Channels(context.Background(), &wrapperspb.StringValue{Value: tag}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		var found bool
+		for _, move := range channels.Channels {
+			if move.Channel == tag {
+				tag, found = move.To, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("channel[%s] not exist", tag)
+		}
+	}
+
+	desc, err := stub.List(context.Background(), &emptypb.Empty{}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(desc.Images) == 0 {
+		return nil, fmt.Errorf("image repository is empty")
+	}
+	if tag == "latest" {
+		return desc.Images[len(desc.Images)-1], nil
+	}
+
+	version, err := genVersion(tag)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range desc.Images {
+		if image.Tag == version.Original() {
+			return image, nil
+		}
+	}
+	return nil, fmt.Errorf("image[%s] not exist", tag)
+}
+
+// findArtifact returns artifact name of image for platform, images listed
+// by hubs before manifests only have the omega binary.
+func findArtifact(image *pb.Image, name string, platform string) (*pb.Artifact, error) {
+	if len(image.Artifacts) == 0 && name == BinaryArtifact {
+		return &pb.Artifact{Name: BinaryArtifact, Kind: KindBinary, Sha256: image.Sha256, Md5: image.Md5}, nil
+	}
+	if artifact := matchArtifact(image.Artifacts, name, platform); artifact != nil {
+		return artifact, nil
+	}
+	if platforms := platformsOf(image.Artifacts, name); len(platforms) != 0 {
+		return nil, fmt.Errorf("artifact[%s] of image[%s] is not built for platform[%s], available: %v", name, image.Tag, platform, platforms)
+	}
+	return nil, fmt.Errorf("artifact[%s] not exist in image[%s]", name, image.Tag)
+}
+
+// BinaryOf returns the omega binary of image which Pull fetches
+func BinaryOf(image *pb.Image) (*pb.Artifact, error) {
+	return findArtifact(image, BinaryArtifact, Platform)
 }
 
-func verifyOmega(local string) (string, string, error) {
+// VerifyOmega runs local omega binary, and returns its tag and build time
+func VerifyOmega(local string) (string, string, error) {
 	localFi, err := os.Stat(local)
 	if err != nil {
 		return "", "", err
@@ -0,0 +1,196 @@
+package hub
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/eviltomorrow/omega/internal/api/hub/pb"
+	"github.com/eviltomorrow/omega/pkg/delta"
+	"github.com/eviltomorrow/omega/pkg/file"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeltaDir caches patches between blobs, ImageDir/deltas/<from>-<to>
+const DeltaDir = "deltas"
+
+// PrecomputeDeltas computes the patch from the previous version when an omega
+// binary is pushed, so that the first watchdog doesn't wait for it.
+var PrecomputeDeltas = true
+
+// deltaMut serializes computing of patches, it takes memory of several times
+// of the binary.
+var deltaMut sync.Mutex
+
+func deltaPath(from, to string) string {
+	return filepath.Join(ImageDir, DeltaDir, from+"-"+to)
+}
+
+// makeDelta returns the cached patch which turns blob from into blob to, it is
+// computed if it is not cached.
+func makeDelta(from, to string) (string, error) {
+	var path = deltaPath(from, to)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	deltaMut.Lock()
+	defer deltaMut.Unlock()
+	// the patch may be computed while waiting for the lock
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	old, err := ioutil.ReadFile(blobPath(from))
+	if err != nil {
+		return "", err
+	}
+	new, err := ioutil.ReadFile(blobPath(to))
+	if err != nil {
+		return "", err
+	}
+	var patch bytes.Buffer
+	if err := delta.Diff(old, new, &patch); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	var tmp = path + ".tmp"
+	if err := ioutil.WriteFile(tmp, patch.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	zlog.Info("Delta is computed", zap.String("from", from), zap.String("to", to), zap.Int("size", patch.Len()), zap.Int("target", len(new)))
+	return path, nil
+}
+
+// precomputeDelta computes the patch from omega of the version before tag to
+// the pushed one, a failure is logged only as patches are computed on demand.
+func precomputeDelta(tag string, pushed *artifact) {
+	versions, err := listVersions()
+	if err != nil {
+		return
+	}
+	for i, version := range versions {
+		if version.Original() != tag || i == 0 {
+			continue
+		}
+		var previous = versions[i-1].Original()
+		m, err := loadManifest(previous)
+		if err != nil {
+			return
+		}
+		for _, a := range m.Artifacts {
+			if a.Name == BinaryArtifact && a.Platform == pushed.Platform && a.Sha256 != pushed.Sha256 {
+				if _, err := makeDelta(a.Sha256, pushed.Sha256); err != nil {
+					zlog.Error("Precompute delta failure", zap.String("from", previous), zap.String("to", tag), zap.String("platform", pushed.Platform), zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// pruneDeltas removes patches of which either blob is not referenced
+func pruneDeltas(referenced map[string]bool) error {
+	fis, err := ioutil.ReadDir(filepath.Join(ImageDir, DeltaDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		var pair = strings.SplitN(strings.TrimSuffix(fi.Name(), ".tmp"), "-", 2)
+		if len(pair) == 2 && referenced[pair[0]] && referenced[pair[1]] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(ImageDir, DeltaDir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) Delta(req *pb.DeltaRequest, ps pb.Hub_DeltaServer) error {
+	tag, err := resolveTag(req.Tag)
+	if err != nil {
+		return err
+	}
+	if !isSHA256(req.FromSha256) {
+		return status.Errorf(codes.InvalidArgument, "invalid sha256[%s]", req.FromSha256)
+	}
+
+	m, err := loadManifest(tag)
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	var a = m.match(BinaryArtifact, req.Platform)
+	if a == nil {
+		return status.Errorf(codes.NotFound, "artifact[%s] for platform[%s] not exist in image[%s], available: %v", BinaryArtifact, req.Platform, tag, platformsOf(m.toImage().Artifacts, BinaryArtifact))
+	}
+	if a.Sha256 == req.FromSha256 {
+		return status.Errorf(codes.FailedPrecondition, "binary is %s of image[%s] already", BinaryArtifact, tag)
+	}
+	if _, err := os.Stat(blobPath(req.FromSha256)); err != nil {
+		return status.Errorf(codes.NotFound, "blob[%s] not exist, pull the full binary", req.FromSha256)
+	}
+
+	path, err := makeDelta(req.FromSha256, a.Sha256)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Size() >= a.Size {
+		return status.Errorf(codes.FailedPrecondition, "delta[%d] is not smaller than binary[%d], pull the full binary", fi.Size(), a.Size)
+	}
+
+	_, pipe, signal, err := file.ReadFrom(path, req.Offset)
+	if err != nil {
+		return err
+	}
+
+	var offset = req.Offset
+loop:
+	for {
+		select {
+		case buf, ok := <-pipe:
+			if !ok {
+				break loop
+			}
+
+			if err := ps.Send(&pb.Image{Buf: buf, Offset: offset, Crc: file.CRC(buf), Sha256: a.Sha256}); err != nil {
+				return err
+			}
+			offset += int64(len(buf))
+		case err := <-signal:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isSHA256(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
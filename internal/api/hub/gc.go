@@ -0,0 +1,227 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/hub/pb"
+	"github.com/eviltomorrow/omega/pkg/lock"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"go.uber.org/zap"
+)
+
+// RunningFile keeps the last report of every watchdog
+const RunningFile = "running.json"
+
+var (
+	// KeepVersions is how many of the highest versions are kept by GC, GC is
+	// disabled if it is 0.
+	KeepVersions = 0
+	// RunningTTL is how long a report of watchdog keeps its image
+	RunningTTL = time.Hour
+	GCPeriod   = time.Hour
+)
+
+var ErrRetentionDisabled = errors.New("retention is disabled")
+
+var runningMut sync.Mutex
+
+// saveReport records binary which host runs
+func saveReport(report *pb.RunningReport) error {
+	runningMut.Lock()
+	defer runningMut.Unlock()
+
+	reports, err := loadReports()
+	if err != nil {
+		return err
+	}
+	reports[report.Host] = report
+
+	buf, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	var (
+		name = filepath.Join(ImageDir, RunningFile)
+		tmp  = name + ".tmp"
+	)
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func loadReports() (map[string]*pb.RunningReport, error) {
+	var reports = make(map[string]*pb.RunningReport)
+	buf, err := ioutil.ReadFile(filepath.Join(ImageDir, RunningFile))
+	if os.IsNotExist(err) {
+		return reports, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &reports); err != nil {
+		return nil, fmt.Errorf("parse %s failure, nest error: %v", RunningFile, err)
+	}
+	return reports, nil
+}
+
+// planGC decides which images are kept, an image is kept if it is one of the
+// KeepVersions highest versions, referenced by a channel, or runs on a host
+// which reported in RunningTTL. Manifests of images are returned by tag.
+func planGC() ([]*pb.GCImage, map[string]*manifest, error) {
+	if KeepVersions <= 0 {
+		return nil, nil, fmt.Errorf("%w, keep-versions is %d", ErrRetentionDisabled, KeepVersions)
+	}
+
+	versions, err := listVersions()
+	if err != nil {
+		return nil, nil, err
+	}
+	channels, err := loadChannels()
+	if err != nil {
+		return nil, nil, err
+	}
+	var referenced = channelTags(channels)
+
+	runningMut.Lock()
+	reports, err := loadReports()
+	runningMut.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		running  = make(map[string][]string, len(reports))
+		deadline = time.Now().Add(-RunningTTL).Unix()
+	)
+	for _, report := range reports {
+		if report.Time >= deadline {
+			running[report.Sha256] = append(running[report.Sha256], report.Host)
+		}
+	}
+
+	var (
+		images    = make([]*pb.GCImage, 0, len(versions))
+		manifests = make(map[string]*manifest, len(versions))
+	)
+	for i, version := range versions {
+		var image = &pb.GCImage{Tag: version.Original()}
+		if len(versions)-i <= KeepVersions {
+			image.KeptBy = append(image.KeptBy, fmt.Sprintf("last %d versions", KeepVersions))
+		}
+		for _, name := range referenced[image.Tag] {
+			image.KeptBy = append(image.KeptBy, "channel "+name)
+		}
+		m, err := loadManifest(image.Tag)
+		if err != nil {
+			zlog.Error("Load manifest failure", zap.String("tag", image.Tag), zap.Error(err))
+			image.KeptBy = append(image.KeptBy, "invalid manifest")
+			images = append(images, image)
+			continue
+		}
+		var hosts = make([]string, 0, 4)
+		for _, a := range m.Artifacts {
+			hosts = append(hosts, running[a.Sha256]...)
+		}
+		sort.Strings(hosts)
+		for _, host := range hosts {
+			image.KeptBy = append(image.KeptBy, "running on "+host)
+		}
+		image.Size = blobSize(m)
+		manifests[image.Tag] = m
+		images = append(images, image)
+	}
+	return images, manifests, nil
+}
+
+// collect deletes images which are not kept, nothing is deleted if dryRun is
+// set. Blobs shared with kept images are not freed.
+func collect(dryRun bool) (*pb.GCResult, error) {
+	fl, err := lock.CreateFileLock(ImageLockFile)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.DestroyFileLock(fl)
+
+	images, manifests, err := planGC()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		result = &pb.GCResult{Images: images, DryRun: dryRun}
+		kept   = make(map[string]bool)
+		freed  = make(map[string]int64)
+	)
+	for _, image := range images {
+		if m, ok := manifests[image.Tag]; ok && len(image.KeptBy) != 0 {
+			for _, a := range m.Artifacts {
+				kept[a.Sha256] = true
+			}
+		}
+	}
+	for _, image := range images {
+		if len(image.KeptBy) != 0 {
+			continue
+		}
+		for _, a := range manifests[image.Tag].Artifacts {
+			if !kept[a.Sha256] {
+				freed[a.Sha256] = a.Size
+			}
+		}
+		if !dryRun {
+			if err := os.RemoveAll(filepath.Join(ImageDir, image.Tag)); err != nil {
+				return nil, err
+			}
+			zlog.Info("GC deletes image", zap.String("tag", image.Tag), zap.Int64("size", image.Size))
+		}
+	}
+	for _, size := range freed {
+		result.Freed += size
+	}
+	if !dryRun {
+		if _, err := pruneBlobs(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// CollectGarbage deletes images which are not kept every GCPeriod until stop is closed
+func CollectGarbage(stop <-chan struct{}) {
+	var ticker = time.NewTicker(GCPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := collect(false); err != nil {
+				zlog.Error("Collect garbage failure", zap.Error(err))
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// blobSize is the size of blobs which image references
+func blobSize(m *manifest) int64 {
+	var (
+		size int64
+		seen = make(map[string]bool, len(m.Artifacts))
+	)
+	for _, a := range m.Artifacts {
+		if !seen[a.Sha256] {
+			seen[a.Sha256] = true
+			size += a.Size
+		}
+	}
+	return size
+}
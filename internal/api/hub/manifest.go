@@ -0,0 +1,325 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/eviltomorrow/omega/internal/api/hub/pb"
+	"github.com/eviltomorrow/omega/pkg/file"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"github.com/hashicorp/go-version"
+	"go.uber.org/zap"
+)
+
+const (
+	ManifestFile = "manifest.json"
+	// BinaryArtifact is the omega binary, every image has it
+	BinaryArtifact = "omega"
+)
+
+var ErrImageNotExist = errors.New("image not exist")
+
+const (
+	KindBinary = "binary"
+	KindConfig = "config"
+	KindScript = "script"
+	KindPlugin = "plugin"
+)
+
+// manifest lists artifacts of an image, it is saved as ImageDir/<tag>/manifest.json.
+// Artifacts are saved as blobs by their sha256, so that identical artifacts of
+// different images are saved once.
+type manifest struct {
+	Tag         string      `json:"tag"`
+	ReleaseNote string      `json:"release_note"`
+	CreateTime  string      `json:"create_time"`
+	Artifacts   []*artifact `json:"artifacts"`
+	// Signatures are cleared when artifacts are changed
+	Signatures []*signature `json:"signatures,omitempty"`
+}
+
+type artifact struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Sha256 string `json:"sha256"`
+	Md5    string `json:"md5"`
+	Size   int64  `json:"size"`
+	Mode   uint32 `json:"mode"`
+	// Platform is GOOS/GOARCH, empty if the artifact runs anywhere
+	Platform string `json:"platform,omitempty"`
+}
+
+// path returns the blob of artifact
+func (a *artifact) path() string {
+	return blobPath(a.Sha256)
+}
+
+// legacyPath returns where artifact of tag was saved before blobs, beside the
+// manifest by its name, or in <os>-<arch> folder if it is built for a platform.
+func (a *artifact) legacyPath(tag string) string {
+	if a.Platform == "" {
+		return filepath.Join(ImageDir, tag, a.Name)
+	}
+	return filepath.Join(ImageDir, tag, strings.Replace(a.Platform, "/", "-", 1), a.Name)
+}
+
+// loadManifest reads manifest of tag
+func loadManifest(tag string) (*manifest, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(ImageDir, tag, ManifestFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w, tag: %s", ErrImageNotExist, tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m = &manifest{}
+	if err := json.Unmarshal(buf, m); err != nil {
+		return nil, fmt.Errorf("parse manifest of [%s] failure, nest error: %v", tag, err)
+	}
+	return m, nil
+}
+
+// legacyManifest describes images pushed before manifests by release.md,
+// which only have the omega binary.
+func legacyManifest(tag string) (*manifest, error) {
+	var base = filepath.Join(ImageDir, tag)
+
+	fi, err := os.Stat(filepath.Join(base, BinaryArtifact))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w, tag: %s", ErrImageNotExist, tag)
+		}
+		return nil, err
+	}
+
+	buf, _ := ioutil.ReadFile(filepath.Join(base, "release.md"))
+	var d = &desc{}
+	_ = json.Unmarshal(buf, d)
+	if d.Sha256 == "" {
+		d.Sha256, _ = file.CalculateSHA256(filepath.Join(base, BinaryArtifact))
+	}
+	return &manifest{
+		Tag:         tag,
+		ReleaseNote: d.ReleaseNote,
+		CreateTime:  d.CreateTime,
+		Artifacts: []*artifact{
+			{Name: BinaryArtifact, Kind: KindBinary, Sha256: d.Sha256, Md5: d.Md5, Size: fi.Size(), Mode: uint32(fi.Mode().Perm())},
+		},
+	}, nil
+}
+
+// save writes manifest into a temporary file first, so that readers never
+// see a partial manifest.
+func (m *manifest) save() error {
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var (
+		name = filepath.Join(ImageDir, m.Tag, ManifestFile)
+		tmp  = name + ".tmp"
+	)
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	os.Remove(filepath.Join(ImageDir, m.Tag, "release.md"))
+	return nil
+}
+
+// match returns artifact name for platform, see matchArtifact
+func (m *manifest) match(name, platform string) *artifact {
+	var a = matchArtifact(m.toImage().Artifacts, name, platform)
+	if a == nil {
+		return nil
+	}
+	for _, found := range m.Artifacts {
+		if found.Name == a.Name && found.Platform == a.Platform {
+			return found
+		}
+	}
+	return nil
+}
+
+// put adds or replaces artifact with the same name and platform, artifacts
+// are kept sorted by name and platform with the omega binary at first.
+func (m *manifest) put(a *artifact) {
+	var artifacts = make([]*artifact, 0, len(m.Artifacts)+1)
+	for _, old := range m.Artifacts {
+		if old.Name != a.Name || old.Platform != a.Platform {
+			artifacts = append(artifacts, old)
+		}
+	}
+	artifacts = append(artifacts, a)
+	m.Signatures = nil
+	sort.Slice(artifacts, func(i, j int) bool {
+		if artifacts[i].Name != artifacts[j].Name {
+			if artifacts[i].Name == BinaryArtifact || artifacts[j].Name == BinaryArtifact {
+				return artifacts[i].Name == BinaryArtifact
+			}
+			return artifacts[i].Name < artifacts[j].Name
+		}
+		return artifacts[i].Platform < artifacts[j].Platform
+	})
+	m.Artifacts = artifacts
+}
+
+// toImage describes the image by its omega binary, with all artifacts attached
+func (m *manifest) toImage() *pb.Image {
+	var image = &pb.Image{
+		ReleaseNotes: m.ReleaseNote,
+		Tag:          m.Tag,
+		CreateTime:   m.CreateTime,
+		Artifacts:    make([]*pb.Artifact, 0, len(m.Artifacts)),
+	}
+	for _, a := range m.Artifacts {
+		image.Artifacts = append(image.Artifacts, &pb.Artifact{Name: a.Name, Kind: a.Kind, Sha256: a.Sha256, Md5: a.Md5, Size: a.Size, Mode: int32(a.Mode), Platform: a.Platform})
+	}
+	for _, sig := range m.Signatures {
+		image.Signatures = append(image.Signatures, &pb.Signature{PublicKey: sig.PublicKey, Sig: sig.Sig})
+	}
+	// clients before platforms pull omega without platform
+	if binary := matchArtifact(image.Artifacts, BinaryArtifact, ""); binary != nil {
+		image.Md5, image.Sha256 = binary.Md5, binary.Sha256
+	}
+	return image
+}
+
+// matchArtifact returns artifact name built for platform, or the one which
+// runs anywhere. If platform is empty, the only variant of name is returned.
+func matchArtifact(artifacts []*pb.Artifact, name, platform string) *pb.Artifact {
+	var (
+		anywhere, exact *pb.Artifact
+		variants        int
+	)
+	for _, a := range artifacts {
+		if a.Name != name {
+			continue
+		}
+		switch a.Platform {
+		case "":
+			anywhere = a
+		case platform:
+			exact = a
+		default:
+			variants++
+			if platform == "" {
+				exact = a
+			}
+		}
+	}
+	switch {
+	case platform != "" && exact != nil:
+		return exact
+	case anywhere != nil:
+		return anywhere
+	case platform == "" && variants == 1:
+		return exact
+	default:
+		return nil
+	}
+}
+
+// platformsOf returns platforms which artifact name is built for
+func platformsOf(artifacts []*pb.Artifact, name string) []string {
+	var platforms = make([]string, 0, 4)
+	for _, a := range artifacts {
+		if a.Name == name {
+			var platform = a.Platform
+			if platform == "" {
+				platform = "any"
+			}
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms
+}
+
+// PlatformsOf returns platforms which omega binary of image is built for
+func PlatformsOf(image *pb.Image) []string {
+	if len(image.Artifacts) == 0 {
+		return []string{"any"}
+	}
+	return platformsOf(image.Artifacts, BinaryArtifact)
+}
+
+// checkPlatform verifies platform is GOOS/GOARCH or empty
+func checkPlatform(platform string) error {
+	if platform == "" {
+		return nil
+	}
+	var attr = strings.Split(platform, "/")
+	if len(attr) != 2 || !isIdent(attr[0]) || !isIdent(attr[1]) {
+		return fmt.Errorf("invalid platform[%s], expect: os/arch", platform)
+	}
+	return nil
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkArtifact verifies name and kind of an artifact, names are plain file
+// names since artifacts are saved in the tag folder.
+func checkArtifact(name, kind string) error {
+	if name == "" || name == "." || name == ".." || name == ManifestFile || name == "release.md" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid artifact name[%s]", name)
+	}
+	switch kind {
+	case KindBinary, KindConfig, KindScript, KindPlugin:
+	default:
+		return fmt.Errorf("invalid artifact kind[%s], expect: %s/%s/%s/%s", kind, KindBinary, KindConfig, KindScript, KindPlugin)
+	}
+	if name == BinaryArtifact && kind != KindBinary {
+		return fmt.Errorf("artifact[%s] must be %s", BinaryArtifact, KindBinary)
+	}
+	return nil
+}
+
+// listVersions returns tags in ImageDir from low to high
+func listVersions() ([]*version.Version, error) {
+	fis, err := ioutil.ReadDir(ImageDir)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*version.Version, 0, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+
+		name := fi.Name()
+		if strings.HasPrefix(name, "v") {
+			version, err := version.NewVersion(name)
+			if err != nil {
+				zlog.Error("Load version from dir failure", zap.String("name", name), zap.Error(err))
+			} else {
+				versions = append(versions, version)
+			}
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("image repository is empty")
+	}
+	sort.Sort(version.Collection(versions))
+	return versions, nil
+}
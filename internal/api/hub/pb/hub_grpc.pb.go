@@ -24,10 +24,22 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type HubClient interface {
-	Pull(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (Hub_PullClient, error)
+	Pull(ctx context.Context, in *PullRequest, opts ...grpc.CallOption) (Hub_PullClient, error)
 	Push(ctx context.Context, opts ...grpc.CallOption) (Hub_PushClient, error)
 	List(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ImageDesc, error)
 	Del(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (*wrapperspb.StringValue, error)
+	Offset(ctx context.Context, in *Image, opts ...grpc.CallOption) (*wrapperspb.Int64Value, error)
+	Sign(ctx context.Context, in *SignRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Promote(ctx context.Context, in *PromoteRequest, opts ...grpc.CallOption) (*ChannelMove, error)
+	// Channels returns current channels and history of moves, history is
+	// filtered by channel if it is not empty
+	Channels(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (*ChannelDesc, error)
+	// Report records the binary which a watchdog runs, retention keeps its image
+	Report(ctx context.Context, in *RunningReport, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GC(ctx context.Context, in *GCRequest, opts ...grpc.CallOption) (*GCResult, error)
+	// Delta streams the patch which turns the omega binary with from_sha256
+	// into the one of tag, patches are computed once and cached by hub
+	Delta(ctx context.Context, in *DeltaRequest, opts ...grpc.CallOption) (Hub_DeltaClient, error)
 }
 
 type hubClient struct {
@@ -38,7 +50,7 @@ func NewHubClient(cc grpc.ClientConnInterface) HubClient {
 	return &hubClient{cc}
 }
 
-func (c *hubClient) Pull(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (Hub_PullClient, error) {
+func (c *hubClient) Pull(ctx context.Context, in *PullRequest, opts ...grpc.CallOption) (Hub_PullClient, error) {
 	stream, err := c.cc.NewStream(ctx, &Hub_ServiceDesc.Streams[0], "/omega.Hub/Pull", opts...)
 	if err != nil {
 		return nil, err
@@ -122,14 +134,112 @@ func (c *hubClient) Del(ctx context.Context, in *wrapperspb.StringValue, opts ..
 	return out, nil
 }
 
+func (c *hubClient) Offset(ctx context.Context, in *Image, opts ...grpc.CallOption) (*wrapperspb.Int64Value, error) {
+	out := new(wrapperspb.Int64Value)
+	err := c.cc.Invoke(ctx, "/omega.Hub/Offset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hubClient) Sign(ctx context.Context, in *SignRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/omega.Hub/Sign", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hubClient) Promote(ctx context.Context, in *PromoteRequest, opts ...grpc.CallOption) (*ChannelMove, error) {
+	out := new(ChannelMove)
+	err := c.cc.Invoke(ctx, "/omega.Hub/Promote", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hubClient) Channels(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (*ChannelDesc, error) {
+	out := new(ChannelDesc)
+	err := c.cc.Invoke(ctx, "/omega.Hub/Channels", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hubClient) Report(ctx context.Context, in *RunningReport, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/omega.Hub/Report", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hubClient) GC(ctx context.Context, in *GCRequest, opts ...grpc.CallOption) (*GCResult, error) {
+	out := new(GCResult)
+	err := c.cc.Invoke(ctx, "/omega.Hub/GC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hubClient) Delta(ctx context.Context, in *DeltaRequest, opts ...grpc.CallOption) (Hub_DeltaClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Hub_ServiceDesc.Streams[2], "/omega.Hub/Delta", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &hubDeltaClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Hub_DeltaClient interface {
+	Recv() (*Image, error)
+	grpc.ClientStream
+}
+
+type hubDeltaClient struct {
+	grpc.ClientStream
+}
+
+func (x *hubDeltaClient) Recv() (*Image, error) {
+	m := new(Image)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // HubServer is the server API for Hub service.
 // All implementations must embed UnimplementedHubServer
 // for forward compatibility
 type HubServer interface {
-	Pull(*wrapperspb.StringValue, Hub_PullServer) error
+	Pull(*PullRequest, Hub_PullServer) error
 	Push(Hub_PushServer) error
 	List(context.Context, *emptypb.Empty) (*ImageDesc, error)
 	Del(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+	Offset(context.Context, *Image) (*wrapperspb.Int64Value, error)
+	Sign(context.Context, *SignRequest) (*emptypb.Empty, error)
+	Promote(context.Context, *PromoteRequest) (*ChannelMove, error)
+	// Channels returns current channels and history of moves, history is
+	// filtered by channel if it is not empty
+	Channels(context.Context, *wrapperspb.StringValue) (*ChannelDesc, error)
+	// Report records the binary which a watchdog runs, retention keeps its image
+	Report(context.Context, *RunningReport) (*emptypb.Empty, error)
+	GC(context.Context, *GCRequest) (*GCResult, error)
+	// Delta streams the patch which turns the omega binary with from_sha256
+	// into the one of tag, patches are computed once and cached by hub
+	Delta(*DeltaRequest, Hub_DeltaServer) error
 	mustEmbedUnimplementedHubServer()
 }
 
@@ -137,7 +247,7 @@ type HubServer interface {
 type UnimplementedHubServer struct {
 }
 
-func (UnimplementedHubServer) Pull(*wrapperspb.StringValue, Hub_PullServer) error {
+func (UnimplementedHubServer) Pull(*PullRequest, Hub_PullServer) error {
 	return status.Errorf(codes.Unimplemented, "method Pull not implemented")
 }
 func (UnimplementedHubServer) Push(Hub_PushServer) error {
@@ -149,6 +259,27 @@ func (UnimplementedHubServer) List(context.Context, *emptypb.Empty) (*ImageDesc,
 func (UnimplementedHubServer) Del(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Del not implemented")
 }
+func (UnimplementedHubServer) Offset(context.Context, *Image) (*wrapperspb.Int64Value, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Offset not implemented")
+}
+func (UnimplementedHubServer) Sign(context.Context, *SignRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sign not implemented")
+}
+func (UnimplementedHubServer) Promote(context.Context, *PromoteRequest) (*ChannelMove, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Promote not implemented")
+}
+func (UnimplementedHubServer) Channels(context.Context, *wrapperspb.StringValue) (*ChannelDesc, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Channels not implemented")
+}
+func (UnimplementedHubServer) Report(context.Context, *RunningReport) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Report not implemented")
+}
+func (UnimplementedHubServer) GC(context.Context, *GCRequest) (*GCResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GC not implemented")
+}
+func (UnimplementedHubServer) Delta(*DeltaRequest, Hub_DeltaServer) error {
+	return status.Errorf(codes.Unimplemented, "method Delta not implemented")
+}
 func (UnimplementedHubServer) mustEmbedUnimplementedHubServer() {}
 
 // UnsafeHubServer may be embedded to opt out of forward compatibility for this service.
@@ -163,7 +294,7 @@ func RegisterHubServer(s grpc.ServiceRegistrar, srv HubServer) {
 }
 
 func _Hub_Pull_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(wrapperspb.StringValue)
+	m := new(PullRequest)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
@@ -245,6 +376,135 @@ func _Hub_Del_Handler(srv interface{}, ctx context.Context, dec func(interface{}
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Hub_Offset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Image)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HubServer).Offset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.Hub/Offset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HubServer).Offset(ctx, req.(*Image))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Hub_Sign_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HubServer).Sign(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.Hub/Sign",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HubServer).Sign(ctx, req.(*SignRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Hub_Promote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PromoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HubServer).Promote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.Hub/Promote",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HubServer).Promote(ctx, req.(*PromoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Hub_Channels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HubServer).Channels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.Hub/Channels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HubServer).Channels(ctx, req.(*wrapperspb.StringValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Hub_Report_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunningReport)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HubServer).Report(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.Hub/Report",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HubServer).Report(ctx, req.(*RunningReport))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Hub_GC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GCRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HubServer).GC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.Hub/GC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HubServer).GC(ctx, req.(*GCRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Hub_Delta_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DeltaRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(HubServer).Delta(m, &hubDeltaServer{stream})
+}
+
+type Hub_DeltaServer interface {
+	Send(*Image) error
+	grpc.ServerStream
+}
+
+type hubDeltaServer struct {
+	grpc.ServerStream
+}
+
+func (x *hubDeltaServer) Send(m *Image) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Hub_ServiceDesc is the grpc.ServiceDesc for Hub service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -260,6 +520,30 @@ var Hub_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Del",
 			Handler:    _Hub_Del_Handler,
 		},
+		{
+			MethodName: "Offset",
+			Handler:    _Hub_Offset_Handler,
+		},
+		{
+			MethodName: "Sign",
+			Handler:    _Hub_Sign_Handler,
+		},
+		{
+			MethodName: "Promote",
+			Handler:    _Hub_Promote_Handler,
+		},
+		{
+			MethodName: "Channels",
+			Handler:    _Hub_Channels_Handler,
+		},
+		{
+			MethodName: "Report",
+			Handler:    _Hub_Report_Handler,
+		},
+		{
+			MethodName: "GC",
+			Handler:    _Hub_GC_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -272,6 +556,11 @@ var Hub_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Hub_Push_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Delta",
+			Handler:       _Hub_Delta_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "hub.proto",
 }
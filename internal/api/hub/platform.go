@@ -0,0 +1,79 @@
+package hub
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/eviltomorrow/omega/internal/system"
+)
+
+// Platform is GOOS/GOARCH of binaries pulled by Pull
+var Platform = system.OS + "/" + system.Arch
+
+// DetectPlatform reads GOOS/GOARCH from the header of an executable
+func DetectPlatform(path string) (string, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+
+		var goos = "linux"
+		switch f.OSABI {
+		case elf.ELFOSABI_FREEBSD:
+			goos = "freebsd"
+		case elf.ELFOSABI_NETBSD:
+			goos = "netbsd"
+		case elf.ELFOSABI_OPENBSD:
+			goos = "openbsd"
+		}
+		switch f.Machine {
+		case elf.EM_X86_64:
+			return goos + "/amd64", nil
+		case elf.EM_AARCH64:
+			return goos + "/arm64", nil
+		case elf.EM_386:
+			return goos + "/386", nil
+		case elf.EM_ARM:
+			return goos + "/arm", nil
+		case elf.EM_RISCV:
+			return goos + "/riscv64", nil
+		case elf.EM_S390:
+			return goos + "/s390x", nil
+		case elf.EM_PPC64:
+			if f.ByteOrder == binary.LittleEndian {
+				return goos + "/ppc64le", nil
+			}
+			return goos + "/ppc64", nil
+		}
+		return "", fmt.Errorf("unknown elf machine[%v]", f.Machine)
+	}
+
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+
+		switch f.Cpu {
+		case macho.CpuAmd64:
+			return "darwin/amd64", nil
+		case macho.CpuArm64:
+			return "darwin/arm64", nil
+		}
+		return "", fmt.Errorf("unknown mach-o cpu[%v]", f.Cpu)
+	}
+
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+
+		switch f.Machine {
+		case pe.IMAGE_FILE_MACHINE_AMD64:
+			return "windows/amd64", nil
+		case pe.IMAGE_FILE_MACHINE_ARM64:
+			return "windows/arm64", nil
+		case pe.IMAGE_FILE_MACHINE_I386:
+			return "windows/386", nil
+		}
+		return "", fmt.Errorf("unknown pe machine[%v]", f.Machine)
+	}
+
+	return "", fmt.Errorf("%s is not an executable", path)
+}
@@ -0,0 +1,250 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/hub/pb"
+	"github.com/eviltomorrow/omega/pkg/file"
+	"github.com/eviltomorrow/omega/pkg/lock"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var (
+	// Primary is the address of the hub which this hub replicates, empty if
+	// this hub is the primary. Replicas serve pulls only.
+	Primary       = ""
+	ReplicaPeriod = 30 * time.Second
+)
+
+// replicaDir keeps blobs which are pulled from primary but not committed
+const replicaDir = ".replica"
+
+// checkPrimary rejects changes of images on replicas
+func checkPrimary() error {
+	if Primary != "" {
+		return status.Errorf(codes.FailedPrecondition, "hub is a replica of %s, push to the primary hub", Primary)
+	}
+	return nil
+}
+
+// Replicate copies images and channels from Primary every ReplicaPeriod until
+// stop is closed.
+func Replicate(stop <-chan struct{}) {
+	conn, err := grpc.Dial(Primary, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		zlog.Error("Dial primary hub failure", zap.String("primary", Primary), zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	var (
+		stub   = pb.NewHubClient(conn)
+		ticker = time.NewTicker(ReplicaPeriod)
+	)
+	defer ticker.Stop()
+
+	for {
+		if err := replicate(stub); err != nil {
+			zlog.Error("Replicate images failure", zap.String("primary", Primary), zap.Error(err))
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// replicate makes images and channels the same as the ones of primary.
+// Artifacts are verified with sha256 of primary's manifest before they are
+// committed, and the manifest is saved after all its artifacts.
+func replicate(stub pb.HubClient) error {
+	desc, err := stub.List(context.Background(), &emptypb.Empty{})
+	if err != nil {
+		return fmt.Errorf("list images of primary failure, nest error: %v", err)
+	}
+	channels, err := stub.Channels(context.Background(), &wrapperspb.StringValue{})
+	if err != nil {
+		return fmt.Errorf("list channels of primary failure, nest error: %v", err)
+	}
+
+	// images whose manifests fail to load on primary aren't deleted
+	var tags = make(map[string]bool, len(desc.Images)+len(desc.Unloaded))
+	for _, tag := range desc.Unloaded {
+		tags[tag] = true
+		zlog.Warn("Primary fails to load manifest, image isn't replicated", zap.String("tag", tag))
+	}
+	for _, image := range desc.Images {
+		tags[image.Tag] = true
+		if err := replicateImage(stub, image); err != nil {
+			return fmt.Errorf("replicate image[%s] failure, nest error: %v", image.Tag, err)
+		}
+	}
+
+	fl, err := lock.CreateFileLock(ImageLockFile)
+	if err != nil {
+		return err
+	}
+	defer lock.DestroyFileLock(fl)
+
+	if err := saveChannels(channels); err != nil {
+		return fmt.Errorf("save channels failure, nest error: %v", err)
+	}
+
+	// images deleted from primary are deleted after channels moved away from
+	// them, an image is deleted only if primary doesn't have it
+	versions, _ := listVersions()
+	for _, version := range versions {
+		if tag := version.Original(); !tags[tag] {
+			if err := os.RemoveAll(filepath.Join(ImageDir, tag)); err != nil {
+				return err
+			}
+			zlog.Info("Replica deletes image", zap.String("tag", tag))
+		}
+	}
+	_, err = pruneBlobs()
+	return err
+}
+
+func replicateImage(stub pb.HubClient, image *pb.Image) error {
+	if len(image.Artifacts) == 0 {
+		return fmt.Errorf("primary hub lists no manifest, upgrade it first")
+	}
+	var remote = manifestOf(image)
+	local, err := loadManifest(image.Tag)
+	if err == nil && sameManifest(local, remote) {
+		return nil
+	}
+
+	// blobs which exist are shared with other images, they are not pulled again
+	var (
+		staging = filepath.Join(ImageDir, replicaDir)
+		pulled  = make(map[string]bool, len(remote.Artifacts))
+	)
+	if err := os.MkdirAll(staging, 0700); err != nil {
+		return err
+	}
+	for _, a := range remote.Artifacts {
+		if _, err := os.Stat(a.path()); err == nil || pulled[a.Sha256] {
+			continue
+		}
+
+		var target = filepath.Join(staging, a.Sha256)
+		err := pull(stub, &pb.PullRequest{Tag: image.Tag, Artifact: a.Name, Platform: a.Platform}, file.PartName(target, file.TransferID(transferKey(image.Tag, a.Name, a.Platform), a.Sha256)), func(part *file.Part) error {
+			return part.Commit(target, a.Sha256, 0644)
+		})
+		if err != nil {
+			return fmt.Errorf("pull artifact[%s] for platform[%s] failure, nest error: %v", a.Name, a.Platform, err)
+		}
+		pulled[a.Sha256] = true
+	}
+
+	fl, err := lock.CreateFileLock(ImageLockFile)
+	if err != nil {
+		return err
+	}
+	defer lock.DestroyFileLock(fl)
+
+	for _, a := range remote.Artifacts {
+		if pulled[a.Sha256] {
+			if err := saveBlob(filepath.Join(staging, a.Sha256), a.Sha256); err != nil {
+				return err
+			}
+			delete(pulled, a.Sha256)
+		}
+		// blobs may be pruned before the lock is held
+		if _, err := os.Stat(a.path()); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(ImageDir, image.Tag), 0700); err != nil {
+		return err
+	}
+	if err := remote.save(); err != nil {
+		return err
+	}
+	zlog.Info("Replica saves image", zap.String("tag", image.Tag))
+	return nil
+}
+
+// manifestOf converts an image listed by a hub back to its manifest
+func manifestOf(image *pb.Image) *manifest {
+	var m = &manifest{
+		Tag:         image.Tag,
+		ReleaseNote: image.ReleaseNotes,
+		CreateTime:  image.CreateTime,
+		Artifacts:   make([]*artifact, 0, len(image.Artifacts)),
+	}
+	for _, a := range image.Artifacts {
+		m.Artifacts = append(m.Artifacts, &artifact{Name: a.Name, Kind: a.Kind, Sha256: a.Sha256, Md5: a.Md5, Size: a.Size, Mode: uint32(a.Mode), Platform: a.Platform})
+	}
+	for _, sig := range image.Signatures {
+		m.Signatures = append(m.Signatures, &signature{PublicKey: sig.PublicKey, Sig: sig.Sig})
+	}
+	return m
+}
+
+func sameManifest(a, b *manifest) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(x, y)
+}
+
+// saveChannels replaces channels and their history with the ones of primary
+func saveChannels(desc *pb.ChannelDesc) error {
+	var channels = make(map[string]*channelMove, len(desc.Channels))
+	for _, move := range desc.Channels {
+		channels[move.Channel] = moveOf(move)
+	}
+	buf, err := json.MarshalIndent(channels, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var history bytes.Buffer
+	for _, move := range desc.History {
+		line, err := json.Marshal(moveOf(move))
+		if err != nil {
+			return err
+		}
+		history.Write(append(line, '\n'))
+	}
+
+	for name, data := range map[string][]byte{ChannelHistoryFile: history.Bytes(), ChannelFile: buf} {
+		var (
+			path = filepath.Join(ImageDir, name)
+			tmp  = path + ".tmp"
+		)
+		if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func moveOf(move *pb.ChannelMove) *channelMove {
+	return &channelMove{Channel: move.Channel, From: move.From, To: move.To, Time: move.Time, Operator: move.Operator, Peer: move.Peer, Rollback: move.Rollback}
+}
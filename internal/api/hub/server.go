@@ -1,15 +1,18 @@
 package hub
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/hub/pb"
 	"github.com/eviltomorrow/omega/pkg/file"
@@ -17,6 +20,9 @@ import (
 	"github.com/eviltomorrow/omega/pkg/zlog"
 	"github.com/hashicorp/go-version"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
@@ -31,53 +37,43 @@ type Server struct {
 	pb.UnimplementedHubServer
 }
 
-// Pull(*wrapperspb.StringValue, Hub_PullServer) error
+// Pull(*PullRequest, Hub_PullServer) error
 // List(context.Context, *emptypb.Empty) (*ImageDesc, error)
 // Del(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
-// Add(Hub_AddServer) error
-
-func (s *Server) Pull(req *wrapperspb.StringValue, ps pb.Hub_PullServer) error {
-	var path string
-	if req.Value == "latest" {
-		fis, err := ioutil.ReadDir(ImageDir)
-		if err != nil {
-			return err
-		}
-
-		versions := make([]*version.Version, 0, len(fis))
-		for _, fi := range fis {
-			if !fi.IsDir() {
-				continue
-			}
-
-			name := fi.Name()
-			if strings.HasPrefix(name, "v") {
-				version, err := version.NewVersion(name)
-				if err != nil {
-					zlog.Error("Load version from dir failure", zap.String("name", name), zap.Error(err))
-				} else {
-					versions = append(versions, version)
-				}
-			}
-		}
-		if len(versions) == 0 {
-			return fmt.Errorf("image repository is empty")
-		}
+// Push(Hub_PushServer) error
+// Offset(context.Context, *Image) (*wrapperspb.Int64Value, error)
+// Sign(context.Context, *SignRequest) (*emptypb.Empty, error)
+// Promote(context.Context, *PromoteRequest) (*ChannelMove, error)
+// Channels(context.Context, *wrapperspb.StringValue) (*ChannelDesc, error)
+// Report(context.Context, *RunningReport) (*emptypb.Empty, error)
+// GC(context.Context, *GCRequest) (*GCResult, error)
+// Delta(*DeltaRequest, Hub_DeltaServer) error
+
+func (s *Server) Pull(req *pb.PullRequest, ps pb.Hub_PullServer) error {
+	tag, err := resolveTag(req.Tag)
+	if err != nil {
+		return err
+	}
+	var name = req.Artifact
+	if name == "" {
+		name = BinaryArtifact
+	}
 
-		sort.Sort(version.Collection(versions))
-		path = filepath.Join(ImageDir, versions[len(versions)-1].Original(), "omega")
-	} else {
-		version, err := genVersion(req.Value)
-		if err != nil {
-			return err
-		}
-		path = filepath.Join(ImageDir, version.Original(), "omega")
+	m, err := loadManifest(tag)
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	var a = m.match(name, req.Platform)
+	if a == nil {
+		return status.Errorf(codes.NotFound, "artifact[%s] for platform[%s] not exist in image[%s], available: %v", name, req.Platform, tag, platformsOf(m.toImage().Artifacts, name))
 	}
 
-	_, pipe, signal, err := file.Read(path)
+	_, pipe, signal, err := file.ReadFrom(a.path(), req.Offset)
 	if err != nil {
 		return err
 	}
+
+	var offset = req.Offset
 loop:
 	for {
 		select {
@@ -86,9 +82,10 @@ loop:
 				break loop
 			}
 
-			if err := ps.Send(&pb.Image{Buf: buf}); err != nil {
+			if err := ps.Send(&pb.Image{Buf: buf, Offset: offset, Crc: file.CRC(buf)}); err != nil {
 				return err
 			}
+			offset += int64(len(buf))
 		case err := <-signal:
 			return err
 		}
@@ -104,52 +101,30 @@ func (s *Server) List(ctx context.Context, _ *emptypb.Empty) (*pb.ImageDesc, err
 	}
 	defer lock.DestroyFileLock(fl)
 
-	fis, err := ioutil.ReadDir(ImageDir)
+	versions, err := listVersions()
 	if err != nil {
 		return nil, err
 	}
 
-	versions := make([]*version.Version, 0, len(fis))
-	for _, fi := range fis {
-		if !fi.IsDir() {
-			continue
-		}
-
-		name := fi.Name()
-		if strings.HasPrefix(name, "v") {
-			version, err := version.NewVersion(name)
-			if err != nil {
-				zlog.Error("Load version from dir failure", zap.String("name", name), zap.Error(err))
-			} else {
-				versions = append(versions, version)
-			}
-		}
-	}
-	if len(versions) == 0 {
-		return nil, fmt.Errorf("image repository is empty")
-	}
-	sort.Sort(version.Collection(versions))
-
 	var id = &pb.ImageDesc{
 		Images: make([]*pb.Image, 0, len(versions)),
 	}
 	for _, version := range versions {
-		buf, _ := ioutil.ReadFile(filepath.Join(ImageDir, version.Original(), "release.md"))
-		var d = &desc{}
-		_ = json.Unmarshal(buf, d)
-
-		var image = &pb.Image{
-			ReleaseNotes: d.ReleaseNote,
-			Tag:          version.Original(),
-			Md5:          d.Md5,
-			CreateTime:   d.CreateTime,
+		m, err := loadManifest(version.Original())
+		if err != nil {
+			zlog.Error("Load manifest failure", zap.String("tag", version.Original()), zap.Error(err))
+			id.Unloaded = append(id.Unloaded, version.Original())
+			continue
 		}
-		id.Images = append(id.Images, image)
+		id.Images = append(id.Images, m.toImage())
 	}
 	return id, nil
 }
 
 func (s *Server) Del(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	if err := checkPrimary(); err != nil {
+		return nil, err
+	}
 	version, err := genVersion(req.Value)
 	if err != nil {
 		return nil, err
@@ -161,6 +136,14 @@ func (s *Server) Del(ctx context.Context, req *wrapperspb.StringValue) (*wrapper
 	}
 	defer lock.DestroyFileLock(fl)
 
+	channels, err := loadChannels()
+	if err != nil {
+		return nil, err
+	}
+	if names, ok := channelTags(channels)[version.Original()]; ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "image[%s] is referenced by channel %v", version.Original(), names)
+	}
+
 	path := filepath.Join(ImageDir, version.Original())
 	_, err = os.Stat(path)
 	if err != nil {
@@ -170,17 +153,24 @@ func (s *Server) Del(ctx context.Context, req *wrapperspb.StringValue) (*wrapper
 		return nil, err
 	}
 
-	buf, _ := ioutil.ReadFile(filepath.Join(path, "release.md"))
-	var d = &desc{}
-	_ = json.Unmarshal(buf, d)
+	var md5 string
+	if m, err := loadManifest(version.Original()); err == nil {
+		md5 = m.toImage().Md5
+	}
 
 	if err := os.RemoveAll(path); err != nil {
 		return nil, err
 	}
-	return &wrapperspb.StringValue{Value: d.Md5}, nil
+	if _, err := pruneBlobs(); err != nil {
+		zlog.Error("Prune blobs failure", zap.Error(err))
+	}
+	return &wrapperspb.StringValue{Value: md5}, nil
 }
 
 func (s *Server) Push(as pb.Hub_PushServer) error {
+	if err := checkPrimary(); err != nil {
+		return err
+	}
 	fi, err := os.Stat(ImageDir)
 	if err != nil {
 		return err
@@ -209,62 +199,387 @@ func (s *Server) Push(as pb.Hub_PushServer) error {
 		createTime  = image.CreateTime
 		tag         = version.Original()
 		base        = filepath.Join(ImageDir, tag)
-		name        = filepath.Join(base, "omega")
-		ok          bool
+		name, kind  = artifactOf(image)
+		pushed      = &artifact{Name: name, Kind: kind, Platform: image.Platform}
+		resumable   = image.Sha256 != ""
+		partFile    = partName(tag, pushed, image.Sha256)
+		// the part is committed to target first, and saved as a blob once its sha256 is known
+		target = partFile + ".commit"
 	)
+	if err := checkArtifact(name, kind); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := checkPlatform(image.Platform); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	// artifacts are added to an existing image, which is created by its omega binary
+	m, err := loadManifest(tag)
+	if err != nil {
+		if name != BinaryArtifact || !errors.Is(err, ErrImageNotExist) {
+			return status.Errorf(codes.FailedPrecondition, "push %s of image[%s] first, nest error: %v", BinaryArtifact, tag, err)
+		}
+		m = &manifest{Tag: tag}
+	}
+	if !resumable {
+		partFile = filepath.Join(ImageDir, fmt.Sprintf(".%s.part", tag))
+		os.Remove(partFile)
+	}
 
-	if err := os.MkdirAll(base, 0700); err != nil {
+	part, err := file.OpenPart(partFile)
+	if err != nil {
 		return err
 	}
-	defer func() {
-		if !ok {
+	if err := part.Truncate(image.Offset); err != nil {
+		part.Close()
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	for {
+		req, err := as.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			part.Close()
+			return err
+		}
+		if len(req.Buf) == 0 {
+			continue
+		}
+		if !resumable {
+			req.Offset = part.Offset()
+		} else if err := file.CheckCRC(req.Buf, req.Crc); err != nil {
+			part.Close()
+			return status.Error(codes.DataLoss, err.Error())
+		}
+		if err := part.Write(req.Offset, req.Buf); err != nil {
+			part.Close()
+			if errors.Is(err, file.ErrUnexpectedOffset) {
+				return status.Error(codes.Aborted, err.Error())
+			}
+			return err
+		}
+	}
+
+	// the tag folder is removed on failure only if it is created by this push
+	var created bool
+	if _, err := os.Stat(base); os.IsNotExist(err) {
+		created = true
+	}
+	var rollback = func() {
+		if created {
 			os.RemoveAll(base)
 		}
-	}()
+	}
+	if err := os.MkdirAll(base, 0700); err != nil {
+		part.Close()
+		rollback()
+		return err
+	}
 
-	var (
-		data = make(chan []byte, 128)
-		sig  = make(chan error)
-	)
-	go func() {
-		for {
-			req, err := as.Recv()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				sig <- err
-				break
-			}
-			if len(req.Buf) != 0 {
-				data <- req.Buf
-			}
+	var mode = fs.FileMode(image.Mode).Perm()
+	if mode == 0 {
+		mode = 0644
+		if kind == KindBinary {
+			mode = 0744
+		}
+	}
+	if err := part.Commit(target, image.Sha256, 0644); err != nil {
+		rollback()
+		if errors.Is(err, file.ErrSHA256Mismatch) {
+			return status.Error(codes.DataLoss, err.Error())
 		}
-		close(data)
-	}()
-	if err := file.Write(name, 0744, data, sig); err != nil {
 		return err
 	}
+	defer os.Remove(target)
 
-	md5, err := file.CalculateMD5(name)
+	md5, err := file.CalculateMD5(target)
 	if err != nil {
+		rollback()
 		return err
 	}
-	var (
-		d      = &desc{ReleaseNote: releaseNote, Md5: md5, CreateTime: createTime}
-		buf, _ = json.Marshal(d)
-	)
-	if err := ioutil.WriteFile(filepath.Join(base, "release.md"), buf, 0644); err != nil {
+	sha256, err := file.CalculateSHA256(target)
+	if err != nil {
+		rollback()
+		return err
+	}
+	fi, err = os.Stat(target)
+	if err != nil {
+		rollback()
+		return err
+	}
+	if err := saveBlob(target, sha256); err != nil {
+		rollback()
+		return err
+	}
+
+	// binaries of other platforms are pushed without release note and create time
+	if name == BinaryArtifact && releaseNote != "" {
+		m.ReleaseNote = releaseNote
+	}
+	if name == BinaryArtifact && createTime != "" {
+		m.CreateTime = createTime
+	}
+	pushed.Sha256, pushed.Md5, pushed.Size, pushed.Mode = sha256, md5, fi.Size(), uint32(mode)
+	var replaced bool
+	for _, old := range m.Artifacts {
+		if old.Name == pushed.Name && old.Platform == pushed.Platform && old.Sha256 != pushed.Sha256 {
+			replaced = true
+		}
+	}
+	m.put(pushed)
+	if err := m.save(); err != nil {
+		rollback()
 		return err
 	}
+	if replaced {
+		if _, err := pruneBlobs(); err != nil {
+			zlog.Error("Prune blobs failure", zap.Error(err))
+		}
+	}
+	if name == BinaryArtifact && PrecomputeDeltas {
+		go precomputeDelta(tag, pushed)
+	}
 
-	ok = true
 	return as.SendAndClose(&wrapperspb.StringValue{Value: md5})
 }
 
+func (s *Server) Offset(ctx context.Context, req *pb.Image) (*wrapperspb.Int64Value, error) {
+	if err := checkPrimary(); err != nil {
+		return nil, err
+	}
+	version, err := genVersion(req.Tag)
+	if err != nil {
+		return nil, err
+	}
+	if req.Sha256 == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid sha256")
+	}
+	name, kind := artifactOf(req)
+	if err := checkArtifact(name, kind); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := checkPlatform(req.Platform); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	offset, err := file.PartOffset(partName(version.Original(), &artifact{Name: name, Platform: req.Platform}, req.Sha256))
+	if err != nil {
+		return nil, err
+	}
+	return &wrapperspb.Int64Value{Value: offset}, nil
+}
+
+func (s *Server) Sign(ctx context.Context, req *pb.SignRequest) (*emptypb.Empty, error) {
+	if err := checkPrimary(); err != nil {
+		return nil, err
+	}
+	version, err := genVersion(req.Tag)
+	if err != nil {
+		return nil, err
+	}
+	var sig = req.Signature
+	if sig == nil || len(sig.PublicKey) != ed25519.PublicKeySize || len(sig.Sig) != ed25519.SignatureSize {
+		return nil, status.Error(codes.InvalidArgument, "invalid signature")
+	}
+
+	fl, err := lock.CreateFileLock(ImageLockFile)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.DestroyFileLock(fl)
+
+	m, err := loadManifest(version.Original())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	// the manifest may be changed after client signed it
+	if !ed25519.Verify(sig.PublicKey, signingPayload(m.toImage()), sig.Sig) {
+		return nil, status.Errorf(codes.FailedPrecondition, "signature of key[%s] doesn't match manifest of image[%s]", KeyID(sig.PublicKey), m.Tag)
+	}
+
+	var signatures = make([]*signature, 0, len(m.Signatures)+1)
+	for _, old := range m.Signatures {
+		if !bytes.Equal(old.PublicKey, sig.PublicKey) {
+			signatures = append(signatures, old)
+		}
+	}
+	m.Signatures = append(signatures, &signature{PublicKey: sig.PublicKey, Sig: sig.Sig})
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) Promote(ctx context.Context, req *pb.PromoteRequest) (*pb.ChannelMove, error) {
+	if err := checkPrimary(); err != nil {
+		return nil, err
+	}
+	if !IsChannel(req.Channel) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid channel[%s]", req.Channel)
+	}
+
+	fl, err := lock.CreateFileLock(ImageLockFile)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.DestroyFileLock(fl)
+
+	channels, err := loadChannels()
+	if err != nil {
+		return nil, err
+	}
+	var move = &channelMove{Channel: req.Channel, Time: time.Now().Unix(), Operator: req.Operator, Rollback: req.Rollback}
+	if p, ok := peer.FromContext(ctx); ok {
+		move.Peer = p.Addr.String()
+	}
+	if last, ok := channels[req.Channel]; ok {
+		move.From = last.To
+	}
+
+	if req.Rollback {
+		history, err := loadHistory(req.Channel)
+		if err != nil {
+			return nil, err
+		}
+		if move.To = previousTag(history); move.To == "" {
+			return nil, status.Errorf(codes.FailedPrecondition, "channel[%s] has no previous image", req.Channel)
+		}
+	} else {
+		if IsChannel(req.Tag) {
+			return nil, status.Errorf(codes.InvalidArgument, "promote to channel[%s] is not supported, use its tag", req.Tag)
+		}
+		if move.To, err = resolveTag(req.Tag); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if _, err := loadManifest(move.To); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	if err := saveMove(channels, move); err != nil {
+		return nil, err
+	}
+	zlog.Info("Channel is moved", zap.String("channel", move.Channel), zap.String("from", move.From), zap.String("to", move.To), zap.String("operator", move.Operator), zap.String("peer", move.Peer), zap.Bool("rollback", move.Rollback))
+	return move.toPB(), nil
+}
+
+func (s *Server) Channels(ctx context.Context, req *wrapperspb.StringValue) (*pb.ChannelDesc, error) {
+	channels, err := loadChannels()
+	if err != nil {
+		return nil, err
+	}
+	history, err := loadHistory(req.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var desc = &pb.ChannelDesc{
+		Channels: make([]*pb.ChannelMove, 0, len(channels)),
+		History:  make([]*pb.ChannelMove, 0, len(history)),
+	}
+	for _, move := range channels {
+		desc.Channels = append(desc.Channels, move.toPB())
+	}
+	sort.Slice(desc.Channels, func(i, j int) bool { return desc.Channels[i].Channel < desc.Channels[j].Channel })
+	for _, move := range history {
+		desc.History = append(desc.History, move.toPB())
+	}
+	return desc, nil
+}
+
+func (s *Server) Report(ctx context.Context, req *pb.RunningReport) (*emptypb.Empty, error) {
+	if err := checkPrimary(); err != nil {
+		return nil, err
+	}
+	if req.Host == "" || req.Sha256 == "" {
+		return nil, status.Error(codes.InvalidArgument, "host and sha256 are required")
+	}
+	req.Time = time.Now().Unix()
+	if err := saveReport(req); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) GC(ctx context.Context, req *pb.GCRequest) (*pb.GCResult, error) {
+	if err := checkPrimary(); err != nil {
+		return nil, err
+	}
+	result, err := collect(req.DryRun)
+	if errors.Is(err, ErrRetentionDisabled) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// partName returns the part file of a pushing artifact, it is kept in ImageDir
+// so that the tag folder only exists after the image is committed.
+func partName(tag string, a *artifact, sha256 string) string {
+	return file.PartName(filepath.Join(ImageDir, tag), file.TransferID(transferKey(tag, a.Name, a.Platform), sha256))
+}
+
+// transferKey identifies an artifact in transfer ids, it is the tag for the
+// omega binary which runs anywhere, as it was before manifests.
+func transferKey(tag, name, platform string) string {
+	var key = tag
+	if name != BinaryArtifact {
+		key = tag + "/" + name
+	}
+	if platform != "" {
+		key = key + "@" + platform
+	}
+	return key
+}
+
+// artifactOf returns name and kind of the artifact in Push, clients before
+// manifests only push the omega binary.
+func artifactOf(image *pb.Image) (string, string) {
+	var name, kind = image.Artifact, image.Kind
+	if name == "" {
+		name = BinaryArtifact
+	}
+	if kind == "" && name == BinaryArtifact {
+		kind = KindBinary
+	}
+	return name, kind
+}
+
+// resolveTag returns the highest tag for "latest", and the tag which channel points to
+func resolveTag(tag string) (string, error) {
+	if IsChannel(tag) {
+		channels, err := loadChannels()
+		if err != nil {
+			return "", err
+		}
+		move, ok := channels[tag]
+		if !ok {
+			return "", status.Errorf(codes.NotFound, "channel[%s] not exist", tag)
+		}
+		return move.To, nil
+	}
+	if tag == "latest" {
+		versions, err := listVersions()
+		if err != nil {
+			return "", err
+		}
+		return versions[len(versions)-1].Original(), nil
+	}
+	version, err := genVersion(tag)
+	if err != nil {
+		return "", err
+	}
+	return version.Original(), nil
+}
+
+// desc is release.md of images pushed before manifests
 type desc struct {
 	ReleaseNote string `json:"release_note"`
 	Md5         string `json:"md5"`
+	Sha256      string `json:"sha256"`
 	CreateTime  string `json:"create_time"`
 }
 
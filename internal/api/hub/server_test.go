@@ -0,0 +1,532 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/hub/pb"
+	"github.com/eviltomorrow/omega/pkg/file"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// serveTest starts a hub with images in a temporary folder
+func serveTest(t *testing.T) pb.HubClient {
+	var dir = t.TempDir()
+	ImageDir, ImageLockFile = dir, filepath.Join(dir, ".lock")
+	// patches are computed on demand, not after the temporary folder is removed
+	PrecomputeDeltas = false
+
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s = grpc.NewServer()
+	pb.RegisterHubServer(s, &Server{})
+	go s.Serve(listen)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial(listen.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewHubClient(conn)
+}
+
+func pushTest(t *testing.T, stub pb.HubClient, image *pb.Image, data []byte) error {
+	var local = filepath.Join(t.TempDir(), "artifact")
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sha256, err := file.CalculateSHA256(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image.Sha256 = sha256
+	_, err = push(stub, local, image, func(int64) {})
+	return err
+}
+
+func pullTest(t *testing.T, stub pb.HubClient, req *pb.PullRequest) ([]byte, error) {
+	var local = filepath.Join(t.TempDir(), "pulled")
+	err := pull(stub, req, local+".part", func(part *file.Part) error {
+		return part.Commit(local, "", 0644)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(local)
+}
+
+func TestManifest(t *testing.T) {
+	_assert := assert.New(t)
+
+	var stub = serveTest(t)
+
+	// artifacts are added to existing images only
+	err := pushTest(t, stub, &pb.Image{Tag: "v3.1.0", Artifact: "omega.conf", Kind: KindConfig}, []byte("[log]"))
+	_assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", ReleaseNotes: "first", Artifact: BinaryArtifact, Kind: KindBinary}, []byte("binary")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", Artifact: "omega.conf", Kind: KindConfig}, []byte("[log]")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", Artifact: "start.sh", Kind: KindScript}, []byte("#!/bin/sh")))
+	err = pushTest(t, stub, &pb.Image{Tag: "v3.1.0", Artifact: "../omega.conf", Kind: KindConfig}, []byte("[log]"))
+	_assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	// pushing omega again keeps the other artifacts
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", ReleaseNotes: "second"}, []byte("binary2")))
+
+	desc, err := stub.List(context.Background(), &emptypb.Empty{})
+	_assert.Nil(err)
+	_assert.Equal(1, len(desc.Images))
+	var image = desc.Images[0]
+	_assert.Equal("second", image.ReleaseNotes)
+	_assert.Equal(3, len(image.Artifacts))
+	_assert.Equal([]string{BinaryArtifact, "omega.conf", "start.sh"}, []string{image.Artifacts[0].Name, image.Artifacts[1].Name, image.Artifacts[2].Name})
+	_assert.Equal(image.Sha256, image.Artifacts[0].Sha256)
+
+	buf, err := pullTest(t, stub, &pb.PullRequest{Tag: "latest"})
+	_assert.Nil(err)
+	_assert.Equal("binary2", string(buf))
+	buf, err = pullTest(t, stub, &pb.PullRequest{Tag: "v3.1.0", Artifact: "omega.conf"})
+	_assert.Nil(err)
+	_assert.Equal("[log]", string(buf))
+	_, err = pullTest(t, stub, &pb.PullRequest{Tag: "v3.1.0", Artifact: "missing.conf"})
+	_assert.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestLegacyImage(t *testing.T) {
+	_assert := assert.New(t)
+
+	var stub = serveTest(t)
+	// images before manifests
+	_assert.Nil(os.MkdirAll(filepath.Join(ImageDir, "v3.0.0"), 0700))
+	_assert.Nil(os.WriteFile(filepath.Join(ImageDir, "v3.0.0", "omega"), []byte("legacy"), 0744))
+	_assert.Nil(os.WriteFile(filepath.Join(ImageDir, "v3.0.0", "release.md"), []byte(`{"release_note":"old","md5":"x"}`), 0644))
+	// images before blobs, omega.conf is the same as the one of v3.2.0
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", Platform: "linux/amd64"}, []byte("amd64")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", Artifact: "omega.conf", Kind: KindConfig}, []byte("[log]")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.2.0", Platform: "linux/amd64"}, []byte("v3.2.0")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.2.0", Artifact: "omega.conf", Kind: KindConfig}, []byte("[log]")))
+	for _, tag := range []string{"v3.1.0", "v3.2.0"} {
+		m, err := loadManifest(tag)
+		_assert.Nil(err)
+		for _, a := range m.Artifacts {
+			_assert.Nil(os.MkdirAll(filepath.Dir(a.legacyPath(tag)), 0700))
+			_assert.Nil(os.Link(a.path(), a.legacyPath(tag)))
+		}
+	}
+	_assert.Nil(os.RemoveAll(filepath.Join(ImageDir, BlobDir)))
+
+	_assert.Nil(Migrate())
+	// migrating again changes nothing
+	_assert.Nil(Migrate())
+
+	desc, err := stub.List(context.Background(), &emptypb.Empty{})
+	_assert.Nil(err)
+	_assert.Equal(3, len(desc.Images))
+	_assert.Equal("old", desc.Images[0].ReleaseNotes)
+	_assert.Equal(1, len(desc.Images[0].Artifacts))
+	_, err = os.Stat(filepath.Join(ImageDir, "v3.0.0", "release.md"))
+	_assert.True(os.IsNotExist(err))
+
+	buf, err := pullTest(t, stub, &pb.PullRequest{Tag: "v3.0.0"})
+	_assert.Nil(err)
+	_assert.Equal("legacy", string(buf))
+	buf, err = pullTest(t, stub, &pb.PullRequest{Tag: "v3.1.0", Platform: "linux/amd64"})
+	_assert.Nil(err)
+	_assert.Equal("amd64", string(buf))
+
+	// tag folders only have manifests, and identical artifacts are saved once
+	for _, tag := range []string{"v3.0.0", "v3.1.0", "v3.2.0"} {
+		entries, err := os.ReadDir(filepath.Join(ImageDir, tag))
+		_assert.Nil(err)
+		_assert.Equal(1, len(entries))
+		_assert.Equal(ManifestFile, entries[0].Name())
+	}
+	blobs, err := os.ReadDir(filepath.Join(ImageDir, BlobDir, "sha256"))
+	_assert.Nil(err)
+	_assert.Equal(4, len(blobs))
+
+	// blobs are removed with the last image which references them
+	_, err = stub.Del(context.Background(), &wrapperspb.StringValue{Value: "v3.1.0"})
+	_assert.Nil(err)
+	blobs, err = os.ReadDir(filepath.Join(ImageDir, BlobDir, "sha256"))
+	_assert.Nil(err)
+	_assert.Equal(3, len(blobs))
+	buf, err = pullTest(t, stub, &pb.PullRequest{Tag: "v3.2.0", Artifact: "omega.conf"})
+	_assert.Nil(err)
+	_assert.Equal("[log]", string(buf))
+}
+
+func TestPlatforms(t *testing.T) {
+	_assert := assert.New(t)
+
+	var stub = serveTest(t)
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.2.0", ReleaseNotes: "multi", Platform: "linux/amd64"}, []byte("amd64")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.2.0", Platform: "linux/arm64"}, []byte("arm64")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.2.0", Artifact: "omega.conf", Kind: KindConfig}, []byte("[log]")))
+	err := pushTest(t, stub, &pb.Image{Tag: "v3.2.0", Platform: "linux/../arm64"}, []byte("arm64"))
+	_assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	desc, err := stub.List(context.Background(), &emptypb.Empty{})
+	_assert.Nil(err)
+	_assert.Equal("multi", desc.Images[0].ReleaseNotes)
+	_assert.Equal([]string{"linux/amd64", "linux/arm64"}, PlatformsOf(desc.Images[0]))
+
+	for _, platform := range []string{"amd64", "arm64"} {
+		buf, err := pullTest(t, stub, &pb.PullRequest{Tag: "v3.2.0", Platform: "linux/" + platform})
+		_assert.Nil(err)
+		_assert.Equal(platform, string(buf))
+	}
+	_, err = pullTest(t, stub, &pb.PullRequest{Tag: "v3.2.0", Platform: "darwin/arm64"})
+	_assert.Equal(codes.NotFound, status.Code(err))
+	// the platform of clients before platforms is unknown
+	_, err = pullTest(t, stub, &pb.PullRequest{Tag: "v3.2.0"})
+	_assert.Equal(codes.NotFound, status.Code(err))
+
+	// artifacts which run anywhere match every platform
+	buf, err := pullTest(t, stub, &pb.PullRequest{Tag: "v3.2.0", Artifact: "omega.conf", Platform: "linux/arm64"})
+	_assert.Nil(err)
+	_assert.Equal("[log]", string(buf))
+}
+
+func TestDetectPlatform(t *testing.T) {
+	_assert := assert.New(t)
+
+	self, err := os.Executable()
+	_assert.Nil(err)
+	platform, err := DetectPlatform(self)
+	_assert.Nil(err)
+	_assert.Equal(Platform, platform)
+
+	_, err = DetectPlatform("server_test.go")
+	_assert.NotNil(err)
+}
+
+func TestSign(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		stub = serveTest(t)
+		dir  = t.TempDir()
+		list = func() *pb.Image {
+			image, err := findImage(stub, "v3.3.0")
+			_assert.Nil(err)
+			return image
+		}
+	)
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.3.0", Platform: "linux/amd64"}, []byte("amd64")))
+
+	public, err := GenerateKey(filepath.Join(dir, "release"))
+	_assert.Nil(err)
+	_, err = GenerateKey(filepath.Join(dir, "release"))
+	_assert.NotNil(err)
+	other, err := GenerateKey(filepath.Join(dir, "other"))
+	_assert.Nil(err)
+	private, err := LoadPrivateKey(filepath.Join(dir, "release"))
+	_assert.Nil(err)
+	keys, err := LoadPublicKeys([]string{dir})
+	_assert.Nil(err)
+	_assert.Equal(2, len(keys))
+
+	_assert.True(errors.Is(VerifyImage(list(), []ed25519.PublicKey{public}), ErrUnsigned))
+
+	_, err = stub.Sign(context.Background(), &pb.SignRequest{Tag: "v3.3.0", Signature: SignImage(list(), private)})
+	_assert.Nil(err)
+	_assert.Nil(VerifyImage(list(), []ed25519.PublicKey{public}))
+	_assert.Nil(VerifyImage(list(), keys))
+	_assert.True(errors.Is(VerifyImage(list(), []ed25519.PublicKey{other}), ErrUntrusted))
+
+	// the signed manifest is different from the one of hub
+	var image = list()
+	image.Artifacts[0].Sha256 = "tampered"
+	_, err = stub.Sign(context.Background(), &pb.SignRequest{Tag: "v3.3.0", Signature: SignImage(image, private)})
+	_assert.Equal(codes.FailedPrecondition, status.Code(err))
+	_assert.True(errors.Is(VerifyImage(image, []ed25519.PublicKey{public}), ErrUntrusted))
+
+	// changing artifacts drops signatures
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.3.0", Platform: "linux/arm64"}, []byte("arm64")))
+	_assert.True(errors.Is(VerifyImage(list(), []ed25519.PublicKey{public}), ErrUnsigned))
+
+	// images are verified unless unsigned ones are allowed
+	TrustedKeys = nil
+	_assert.True(errors.Is(verifyPulled(list()), ErrUntrusted))
+	AllowUnsigned = true
+	defer func() { AllowUnsigned = false }()
+	_assert.Nil(verifyPulled(list()))
+}
+
+func TestChannels(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		stub    = serveTest(t)
+		promote = func(channel, tag string, rollback bool) (*pb.ChannelMove, error) {
+			return stub.Promote(context.Background(), &pb.PromoteRequest{Channel: channel, Tag: tag, Rollback: rollback, Operator: "tester"})
+		}
+	)
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0"}, []byte("v3.1.0")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.2.0"}, []byte("v3.2.0")))
+
+	_, err := promote("Stable", "v3.1.0", false)
+	_assert.Equal(codes.InvalidArgument, status.Code(err))
+	_, err = promote("stable", "v3.9.0", false)
+	_assert.Equal(codes.NotFound, status.Code(err))
+	_, err = promote("stable", "", true)
+	_assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	_, err = promote("stable", "v3.1.0", false)
+	_assert.Nil(err)
+	move, err := promote("stable", "v3.2.0", false)
+	_assert.Nil(err)
+	_assert.Equal("v3.1.0", move.From)
+	_assert.Equal("v3.2.0", move.To)
+	_assert.Equal("tester", move.Operator)
+	_assert.NotEqual("", move.Peer)
+
+	buf, err := pullTest(t, stub, &pb.PullRequest{Tag: "stable"})
+	_assert.Nil(err)
+	_assert.Equal("v3.2.0", string(buf))
+	image, err := findImage(stub, "stable")
+	_assert.Nil(err)
+	_assert.Equal("v3.2.0", image.Tag)
+	_, err = pullTest(t, stub, &pb.PullRequest{Tag: "canary"})
+	_assert.Equal(codes.NotFound, status.Code(err))
+
+	// tags referenced by channels can't be deleted
+	_, err = stub.Del(context.Background(), &wrapperspb.StringValue{Value: "v3.2.0"})
+	_assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	move, err = promote("stable", "", true)
+	_assert.Nil(err)
+	_assert.Equal("v3.1.0", move.To)
+	_assert.True(move.Rollback)
+	_, err = promote("stable", "", true)
+	_assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	desc, err := stub.Channels(context.Background(), &wrapperspb.StringValue{Value: "stable"})
+	_assert.Nil(err)
+	_assert.Equal(1, len(desc.Channels))
+	_assert.Equal("v3.1.0", desc.Channels[0].To)
+	_assert.Equal(3, len(desc.History))
+	_assert.Equal([]string{"v3.1.0", "v3.2.0", "v3.1.0"}, []string{desc.History[0].To, desc.History[1].To, desc.History[2].To})
+}
+
+// memoryHub serves images and channels which are listed by another hub
+type memoryHub struct {
+	pb.UnimplementedHubServer
+	images   *pb.ImageDesc
+	channels *pb.ChannelDesc
+	data     map[string][]byte
+}
+
+func (h *memoryHub) List(context.Context, *emptypb.Empty) (*pb.ImageDesc, error) {
+	return h.images, nil
+}
+
+func (h *memoryHub) Channels(context.Context, *wrapperspb.StringValue) (*pb.ChannelDesc, error) {
+	return h.channels, nil
+}
+
+func (h *memoryHub) Pull(req *pb.PullRequest, ps pb.Hub_PullServer) error {
+	var buf = h.data[req.Tag+"/"+req.Artifact+"@"+req.Platform]
+	return ps.Send(&pb.Image{Buf: buf, Crc: file.CRC(buf)})
+}
+
+func TestReplicate(t *testing.T) {
+	_assert := assert.New(t)
+
+	// snapshot of the primary
+	var stub = serveTest(t)
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", ReleaseNotes: "first", Platform: "linux/amd64"}, []byte("amd64")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", Platform: "linux/arm64"}, []byte("arm64")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", Artifact: "omega.conf", Kind: KindConfig}, []byte("[log]")))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.2.0", Platform: "linux/amd64"}, []byte("v3.2.0")))
+	_, err := stub.Promote(context.Background(), &pb.PromoteRequest{Channel: "stable", Tag: "v3.1.0"})
+	_assert.Nil(err)
+
+	var primary = &memoryHub{data: map[string][]byte{
+		"v3.1.0/omega@linux/amd64": []byte("amd64"),
+		"v3.1.0/omega@linux/arm64": []byte("arm64"),
+		"v3.1.0/omega.conf@":       []byte("[log]"),
+		"v3.2.0/omega@linux/amd64": []byte("v3.2.0"),
+	}}
+	primary.images, err = stub.List(context.Background(), &emptypb.Empty{})
+	_assert.Nil(err)
+	primary.channels, err = stub.Channels(context.Background(), &wrapperspb.StringValue{})
+	_assert.Nil(err)
+
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert.Nil(err)
+	var s = grpc.NewServer()
+	pb.RegisterHubServer(s, primary)
+	go s.Serve(listen)
+	defer s.Stop()
+	conn, err := grpc.Dial(listen.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	_assert.Nil(err)
+	defer conn.Close()
+
+	// the replica starts with a different folder
+	var replica = serveTest(t)
+	Primary = listen.Addr().String()
+	defer func() { Primary = "" }()
+	_assert.Nil(replicate(pb.NewHubClient(conn)))
+
+	desc, err := replica.List(context.Background(), &emptypb.Empty{})
+	_assert.Nil(err)
+	_assert.True(proto.Equal(primary.images, desc))
+	buf, err := pullTest(t, replica, &pb.PullRequest{Tag: "stable", Platform: "linux/arm64"})
+	_assert.Nil(err)
+	_assert.Equal("arm64", string(buf))
+
+	// images are changed on the primary only
+	err = pushTest(t, replica, &pb.Image{Tag: "v3.3.0", Platform: "linux/amd64"}, []byte("v3.3.0"))
+	_assert.Equal(codes.FailedPrecondition, status.Code(err))
+	_, err = replica.Promote(context.Background(), &pb.PromoteRequest{Channel: "stable", Tag: "v3.2.0"})
+	_assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	// artifacts which don't match digests of manifest are not committed
+	primary.images.Images = primary.images.Images[:1]
+	primary.images.Images[0].Artifacts[0].Sha256 = "tampered"
+	_assert.NotNil(replicate(pb.NewHubClient(conn)))
+	buf, err = pullTest(t, replica, &pb.PullRequest{Tag: "v3.1.0", Platform: "linux/amd64"})
+	_assert.Nil(err)
+	_assert.Equal("amd64", string(buf))
+
+	// images whose manifests fail to load on the primary are kept
+	primary.images.Images, primary.images.Unloaded = primary.images.Images[:0], []string{"v3.1.0", "v3.2.0"}
+	_assert.Nil(replicate(pb.NewHubClient(conn)))
+	_, err = loadManifest("v3.2.0")
+	_assert.Nil(err)
+	_assert.Nil(os.WriteFile(filepath.Join(ImageDir, "v3.2.0", ManifestFile), []byte("{"), 0644))
+	desc, err = replica.List(context.Background(), &emptypb.Empty{})
+	_assert.Nil(err)
+	_assert.Equal([]string{"v3.2.0"}, desc.Unloaded)
+
+	// images deleted from the primary are deleted
+	primary.images.Unloaded = nil
+	_assert.Nil(replicate(pb.NewHubClient(conn)))
+	_, err = loadManifest("v3.2.0")
+	_assert.True(errors.Is(err, ErrImageNotExist))
+}
+
+func TestGC(t *testing.T) {
+	_assert := assert.New(t)
+
+	var stub = serveTest(t)
+	for _, tag := range []string{"v3.1.0", "v3.2.0", "v3.3.0", "v3.4.0"} {
+		_assert.Nil(pushTest(t, stub, &pb.Image{Tag: tag, Platform: "linux/amd64"}, []byte(tag)))
+	}
+	_, err := stub.GC(context.Background(), &pb.GCRequest{DryRun: true})
+	_assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	KeepVersions = 1
+	defer func() { KeepVersions, RunningTTL = 0, time.Hour }()
+	_, err = stub.Promote(context.Background(), &pb.PromoteRequest{Channel: "stable", Tag: "v3.1.0"})
+	_assert.Nil(err)
+	image, err := findImage(stub, "v3.2.0")
+	_assert.Nil(err)
+	_, err = stub.Report(context.Background(), &pb.RunningReport{Host: "127.0.0.1:28500", Sha256: image.Artifacts[0].Sha256})
+	_assert.Nil(err)
+
+	var kept = func(result *pb.GCResult) []string {
+		var tags = make([]string, 0, len(result.Images))
+		for _, image := range result.Images {
+			if len(image.KeptBy) != 0 {
+				tags = append(tags, image.Tag+": "+strings.Join(image.KeptBy, ", "))
+			}
+		}
+		return tags
+	}
+	result, err := stub.GC(context.Background(), &pb.GCRequest{DryRun: true})
+	_assert.Nil(err)
+	_assert.True(result.DryRun)
+	_assert.Equal([]string{"v3.1.0: channel stable", "v3.2.0: running on 127.0.0.1:28500", "v3.4.0: last 1 versions"}, kept(result))
+	_assert.Equal(int64(len("v3.3.0")), result.Freed)
+	_, err = loadManifest("v3.3.0")
+	_assert.Nil(err)
+
+	_, err = stub.GC(context.Background(), &pb.GCRequest{})
+	_assert.Nil(err)
+	_, err = loadManifest("v3.3.0")
+	_assert.True(errors.Is(err, ErrImageNotExist))
+
+	// hosts which stopped reporting don't keep images
+	RunningTTL = -time.Minute
+	result, err = stub.GC(context.Background(), &pb.GCRequest{})
+	_assert.Nil(err)
+	_assert.Equal([]string{"v3.1.0: channel stable", "v3.4.0: last 1 versions"}, kept(result))
+	_, err = loadManifest("v3.2.0")
+	_assert.True(errors.Is(err, ErrImageNotExist))
+}
+
+func TestDelta(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		stub   = serveTest(t)
+		random = rand.New(rand.NewSource(1))
+		v1     = make([]byte, 256*1024)
+	)
+	random.Read(v1)
+	var v2 = append(append([]byte{}, v1[:1000]...), []byte("omega v3.2.0")...)
+	v2 = append(v2, v1[1000:]...)
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.1.0", Platform: Platform}, v1))
+	_assert.Nil(pushTest(t, stub, &pb.Image{Tag: "v3.2.0", Platform: Platform}, v2))
+
+	desc, err := stub.List(context.Background(), &emptypb.Empty{})
+	_assert.Nil(err)
+	binary, err := BinaryOf(desc.Images[1])
+	_assert.Nil(err)
+
+	var local = filepath.Join(t.TempDir(), "omega")
+	buf, err := pullDelta(stub, local, v1, "v3.2.0", binary)
+	_assert.Nil(err)
+	_assert.True(bytes.Equal(v2, buf))
+	var (
+		from  = fmt.Sprintf("%x", sha256.Sum256(v1))
+		cache = deltaPath(from, binary.Sha256)
+	)
+	fi, err := os.Stat(cache)
+	_assert.Nil(err)
+	_assert.Less(fi.Size(), int64(len(v2)/10))
+
+	// the running binary is unknown to hub
+	_, err = pullDelta(stub, local, []byte("omega"), "v3.2.0", binary)
+	_assert.NotNil(err)
+	reader, err := stub.Delta(context.Background(), &pb.DeltaRequest{Tag: "v3.2.0", Platform: Platform, FromSha256: fmt.Sprintf("%x", sha256.Sum256([]byte("omega")))})
+	_assert.Nil(err)
+	_, err = reader.Recv()
+	_assert.Equal(codes.NotFound, status.Code(err))
+
+	// the patch from the previous version is computed after push
+	_assert.Nil(os.Remove(cache))
+	precomputeDelta("v3.2.0", &artifact{Name: BinaryArtifact, Platform: Platform, Sha256: binary.Sha256})
+	_, err = os.Stat(cache)
+	_assert.Nil(err)
+
+	// patches of deleted images are pruned
+	_, err = stub.Del(context.Background(), &wrapperspb.StringValue{Value: "v3.1.0"})
+	_assert.Nil(err)
+	_, err = os.Stat(cache)
+	_assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,216 @@
+package hub
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/eviltomorrow/omega/internal/api/hub/pb"
+)
+
+var (
+	ErrUnsigned  = errors.New("image is unsigned")
+	ErrUntrusted = errors.New("image is not signed by trusted keys")
+)
+
+var (
+	// TrustedKeys verify images before they are pulled
+	TrustedKeys []ed25519.PublicKey
+	// AllowUnsigned pulls images without verifying their signatures, images
+	// which aren't signed by TrustedKeys are refused unless it is set
+	AllowUnsigned = false
+)
+
+// signature is saved in manifest
+type signature struct {
+	PublicKey []byte `json:"public_key"`
+	Sig       []byte `json:"sig"`
+}
+
+// signingPayload is the canonical form of a manifest which is signed, it
+// covers the tag and every artifact with its digest.
+func signingPayload(image *pb.Image) []byte {
+	var artifacts = make([]*pb.Artifact, len(image.Artifacts))
+	copy(artifacts, image.Artifacts)
+	sort.Slice(artifacts, func(i, j int) bool {
+		if artifacts[i].Name != artifacts[j].Name {
+			return artifacts[i].Name < artifacts[j].Name
+		}
+		return artifacts[i].Platform < artifacts[j].Platform
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString("omega-image-manifest-v1\n")
+	fmt.Fprintf(&buf, "tag %s\n", image.Tag)
+	for _, a := range artifacts {
+		var platform = a.Platform
+		if platform == "" {
+			platform = "-"
+		}
+		fmt.Fprintf(&buf, "artifact %s %s %s %d %s\n", a.Name, a.Kind, platform, a.Size, a.Sha256)
+	}
+	return buf.Bytes()
+}
+
+// KeyID is a short fingerprint of public key
+func KeyID(key ed25519.PublicKey) string {
+	var sum = sha256.Sum256(key)
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// SignImage signs manifest of image with key
+func SignImage(image *pb.Image, key ed25519.PrivateKey) *pb.Signature {
+	return &pb.Signature{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Sig:       ed25519.Sign(key, signingPayload(image)),
+	}
+}
+
+// VerifyImage checks that image is signed by one of keys
+func VerifyImage(image *pb.Image, keys []ed25519.PublicKey) error {
+	if len(image.Signatures) == 0 {
+		return fmt.Errorf("%w, tag: %s", ErrUnsigned, image.Tag)
+	}
+
+	var payload = signingPayload(image)
+	for _, sig := range image.Signatures {
+		for _, key := range keys {
+			if bytes.Equal(sig.PublicKey, key) && ed25519.Verify(key, payload, sig.Sig) {
+				return nil
+			}
+		}
+	}
+
+	var ids = make([]string, 0, len(image.Signatures))
+	for _, sig := range image.Signatures {
+		ids = append(ids, KeyID(sig.PublicKey))
+	}
+	return fmt.Errorf("%w, tag: %s, signed by: %v", ErrUntrusted, image.Tag, ids)
+}
+
+// verifyPulled verifies image with TrustedKeys unless AllowUnsigned is set
+func verifyPulled(image *pb.Image) error {
+	if AllowUnsigned {
+		return nil
+	}
+	if len(TrustedKeys) == 0 {
+		return fmt.Errorf("%w, tag: %s, no trusted key is configured", ErrUntrusted, image.Tag)
+	}
+	return VerifyImage(image, TrustedKeys)
+}
+
+// GenerateKey writes a new ed25519 key pair, the private key to path and the
+// public key to path.pub, both in PEM.
+func GenerateKey(path string) (ed25519.PublicKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeNew(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		return nil, err
+	}
+	if err := writeNew(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		return nil, err
+	}
+	return public, nil
+}
+
+func writeNew(path string, buf []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadPrivateKey reads an ed25519 private key in PKCS8 PEM
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block in %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key %s failure, nest error: %v", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 private key", path)
+	}
+	return private, nil
+}
+
+// LoadPublicKeys reads ed25519 public keys in PKIX PEM, a folder in paths is
+// read for all *.pub files in it.
+func LoadPublicKeys(paths []string) ([]ed25519.PublicKey, error) {
+	var keys = make([]ed25519.PublicKey, 0, len(paths))
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var names = []string{path}
+		if fi.IsDir() {
+			if names, err = filepath.Glob(filepath.Join(path, "*.pub")); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range names {
+			key, err := loadPublicKey(name)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil || !strings.Contains(block.Type, "PUBLIC KEY") {
+		return nil, fmt.Errorf("no public key in %s", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key %s failure, nest error: %v", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", path)
+	}
+	return public, nil
+}
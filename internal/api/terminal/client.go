@@ -3,6 +3,7 @@ package terminal
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -172,3 +173,104 @@ func newTerminal(name, target string, timeout time.Duration, connection *pb.Conn
 	}
 	return nil
 }
+
+// RunLocal runs program with args on target without pty, stdin is piped to the
+// program and its stdout/stderr are written apart, returns the exit code.
+func RunLocal(target string, timeout time.Duration, program string, args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	return runCommand(target, timeout, &pb.Connection{
+		Mode:    pb.Connection_LOCAL,
+		Command: &pb.Command{Program: program, Args: args},
+	}, stdin, stdout, stderr)
+}
+
+func RunSSH(target string, timeout time.Duration, resource *Resource, program string, args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	var pk []byte
+	if resource.PrivateKeyPath != "" {
+		buf, err := ioutil.ReadFile(resource.PrivateKeyPath)
+		if err != nil {
+			return -1, err
+		}
+		pk = buf
+	}
+	return runCommand(target, timeout, &pb.Connection{
+		Mode: pb.Connection_SSH,
+		Resource: &pb.Resource{
+			Username: resource.Username,
+			Password: resource.Password,
+			Host:     resource.Host,
+			Pk:       pk,
+			Port:     int32(resource.Port),
+			Timeout:  int32(resource.Timeout.Duration / time.Second),
+		},
+		Command: &pb.Command{Program: program, Args: args},
+	}, stdin, stdout, stderr)
+}
+
+func runCommand(target string, timeout time.Duration, connection *pb.Connection, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	stub, close, err := NewClient(target)
+	if err != nil {
+		return -1, err
+	}
+	defer close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resp, err := stub.Create(ctx, connection)
+	if err != nil {
+		return -1, err
+	}
+	var sessionId = resp.Value
+
+	pipe, err := stub.Exec(context.Background())
+	if err != nil {
+		return -1, err
+	}
+	if err := pipe.Send(&pb.Data{SessionId: sessionId}); err != nil {
+		return -1, err
+	}
+
+	go func() {
+		defer pipe.CloseSend()
+		if stdin == nil {
+			return
+		}
+
+		var buf [4096]byte
+		for {
+			n, err := stdin.Read(buf[0:])
+			if n > 0 {
+				if err := pipe.Send(&pb.Data{SessionId: sessionId, Buf: buf[:n]}); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		data, err := pipe.Recv()
+		if err == io.EOF {
+			return -1, fmt.Errorf("panic: command exited without exit code")
+		}
+		if err != nil {
+			return -1, err
+		}
+		if data.Exited {
+			return int(data.ExitCode), nil
+		}
+
+		var writer = stdout
+		if data.Stream == pb.Data_STDERR {
+			writer = stderr
+		}
+		if writer == nil {
+			continue
+		}
+		if _, err := writer.Write(data.Buf); err != nil {
+			return -1, err
+		}
+	}
+}
@@ -2,6 +2,7 @@ package terminal
 
 import (
 	"strings"
+	"sync"
 
 	"context"
 	"fmt"
@@ -32,6 +33,18 @@ func (s *Server) Create(ctx context.Context, req *pb.Connection) (*wrapperspb.St
 		return nil, fmt.Errorf("generate terminal session-id failure, nest error: %v", err)
 	}
 
+	if req.Command != nil {
+		command, err := createCommand(req)
+		if err != nil {
+			return nil, err
+		}
+		remote.SetTerminal(sessionId, command)
+		return &wrapperspb.StringValue{Value: sessionId}, nil
+	}
+	if req.Ws == nil {
+		return nil, fmt.Errorf("win size is nil")
+	}
+
 	switch req.Mode {
 	case pb.Connection_LOCAL:
 		terminal, err := local.New("bash", &remote.WinSize{
@@ -63,6 +76,31 @@ func (s *Server) Create(ctx context.Context, req *pb.Connection) (*wrapperspb.St
 	return &wrapperspb.StringValue{Value: sessionId}, nil
 }
 
+func createCommand(req *pb.Connection) (remote.Command, error) {
+	if req.Command.Program == "" {
+		return nil, fmt.Errorf("program is nil")
+	}
+
+	switch req.Mode {
+	case pb.Connection_LOCAL:
+		command, err := local.NewCommand(req.Command.Program, req.Command.Args)
+		if err != nil {
+			return nil, fmt.Errorf("create local command failure, nest error: %v", err)
+		}
+		return command, nil
+
+	case pb.Connection_SSH:
+		if req.Resource == nil {
+			return nil, fmt.Errorf("resource is nil")
+		}
+		var resource = req.Resource
+		return ssh.NewCommand(resource.Host, int(resource.Port), resource.Username, resource.Password, resource.Pk, req.Command.Program, req.Command.Args, time.Duration(resource.Timeout)*time.Second)
+
+	default:
+		return nil, fmt.Errorf("not support mode[%s]", req.Mode)
+	}
+}
+
 func (s *Server) Exec(ts pb.Terminal_ExecServer) error {
 	var (
 		terminal       remote.Terminal
@@ -84,6 +122,13 @@ func (s *Server) Exec(ts pb.Terminal_ExecServer) error {
 	if terminal == nil {
 		return fmt.Errorf("not found terminal with session-id[%s]", data.SessionId)
 	}
+	if command, ok := terminal.(remote.Command); ok {
+		defer func() {
+			remote.DelTerminal(data.SessionId)
+			command.Close()
+		}()
+		return execCommand(command, ts)
+	}
 	terminal.SetSignal(signal)
 
 	defer func() {
@@ -128,6 +173,69 @@ func (s *Server) ChangeWindow(ctx context.Context, req *pb.WinSize) (*emptypb.Em
 	return &emptypb.Empty{}, nil
 }
 
+// execCommand pipes stdin/stdout/stderr of command until it exits, the last data
+// sent to client carries the exit code.
+func execCommand(command remote.Command, ts pb.Terminal_ExecServer) error {
+	stdin, err := command.Stdin()
+	if err != nil {
+		return err
+	}
+	stdout, err := command.Stdout()
+	if err != nil {
+		return err
+	}
+	stderr, err := command.Stderr()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer stdin.Close()
+		for {
+			data, err := ts.Recv()
+			if err != nil {
+				return
+			}
+			if _, err := stdin.Write(data.Buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	var (
+		wg  sync.WaitGroup
+		mut sync.Mutex
+	)
+	for stream, reader := range map[pb.Data_Stream]io.Reader{pb.Data_STDOUT: stdout, pb.Data_STDERR: stderr} {
+		wg.Add(1)
+		go func(stream pb.Data_Stream, reader io.Reader) {
+			defer wg.Done()
+
+			var buf [4096]byte
+			for {
+				n, err := reader.Read(buf[0:])
+				if n > 0 {
+					mut.Lock()
+					err := ts.Send(&pb.Data{Buf: buf[:n], Stream: stream})
+					mut.Unlock()
+					if err != nil {
+						return
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(stream, reader)
+	}
+	wg.Wait()
+
+	if err := command.Wait(); err != nil && command.ExitCode() == -1 {
+		return err
+	}
+	return ts.Send(&pb.Data{Exited: true, ExitCode: int32(command.ExitCode())})
+}
+
 func write(writer io.WriteCloser, ts pb.Terminal_ExecServer, signal chan error) {
 	for {
 		data, err := ts.Recv()
@@ -1,10 +1,13 @@
 package terminal
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/terminal/pb"
 	"github.com/eviltomorrow/omega/internal/middleware"
@@ -82,3 +85,32 @@ func TestNew(t *testing.T) {
 	}
 	t.Logf("session-id: %v\r\n", resp.Value)
 }
+
+func TestRunLocal(t *testing.T) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterTerminalServer(s, &Server{})
+	go s.Serve(listen)
+	defer s.Stop()
+
+	var (
+		stdin          = strings.NewReader("hello\x00world")
+		stdout, stderr bytes.Buffer
+	)
+	code, err := RunLocal(listen.Addr().String(), 5*time.Second, "sh", []string{"-c", "cat; echo oops >&2; exit 3"}, stdin, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 3 {
+		t.Fatalf("exit code: expect 3, actual: %d", code)
+	}
+	if stdout.String() != "hello\x00world" {
+		t.Fatalf("stdout: %q", stdout.String())
+	}
+	if stderr.String() != "oops\n" {
+		t.Fatalf("stderr: %q", stderr.String())
+	}
+}
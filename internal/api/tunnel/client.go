@@ -0,0 +1,162 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/eviltomorrow/omega/internal/api/tunnel/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func NewClient(target string) (pb.TunnelClient, func(), error) {
+	conn, err := grpc.DialContext(
+		context.Background(),
+		target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dial %s failure, nest error: %v", target, err)
+	}
+
+	return pb.NewTunnelClient(conn), func() { conn.Close() }, nil
+}
+
+// Forward is a forwarding spec like ssh: [bind_address:]port:host:hostport
+type Forward struct {
+	Bind   string
+	Target string
+}
+
+func ParseForward(spec string) (*Forward, error) {
+	var attrs = strings.Split(spec, ":")
+	switch len(attrs) {
+	case 3:
+		attrs = append([]string{"127.0.0.1"}, attrs...)
+	case 4:
+	default:
+		return nil, fmt.Errorf("invalid forward[%s], expect: [bind_address:]port:host:hostport", spec)
+	}
+	for _, port := range []string{attrs[1], attrs[3]} {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid port[%s] in forward[%s]", port, spec)
+		}
+	}
+	if attrs[2] == "" {
+		return nil, fmt.Errorf("invalid host in forward[%s]", spec)
+	}
+	return &Forward{
+		Bind:   net.JoinHostPort(attrs[0], attrs[1]),
+		Target: net.JoinHostPort(attrs[2], attrs[3]),
+	}, nil
+}
+
+func (f *Forward) String() string {
+	return fmt.Sprintf("%s => %s", f.Bind, f.Target)
+}
+
+// Local listens forward.Bind on local, every connection is forwarded to
+// forward.Target which is dialed by agent, or via ssh server if via is not nil.
+func Local(ctx context.Context, stub pb.TunnelClient, forward *Forward, via *pb.Via) error {
+	listener, err := net.Listen("tcp", forward.Bind)
+	if err != nil {
+		return fmt.Errorf("listen [%s] failure, nest error: %v", forward.Bind, err)
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			if err := pipe(ctx, stub, conn, &pb.Packet{Target: &pb.Target{Addr: forward.Target, Via: via}}); err != nil {
+				log.Printf("[E] Forward [%s] failure, nest error: %v", forward, err)
+			}
+		}(conn)
+	}
+}
+
+// Remote listens forward.Bind on agent, every connection is forwarded to
+// forward.Target which is dialed by local.
+func Remote(ctx context.Context, stub pb.TunnelClient, forward *Forward) error {
+	accepted, err := stub.Listen(ctx, &pb.Bind{Addr: forward.Bind})
+	if err != nil {
+		return err
+	}
+
+	for {
+		id, err := accepted.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go func(id string) {
+			conn, err := net.Dial("tcp", forward.Target)
+			if err != nil {
+				log.Printf("[E] Forward [%s] failure, nest error: %v", forward, err)
+				return
+			}
+			defer conn.Close()
+			if err := pipe(ctx, stub, conn, &pb.Packet{ConnId: id}); err != nil {
+				log.Printf("[E] Forward [%s] failure, nest error: %v", forward, err)
+			}
+		}(id.Value)
+	}
+}
+
+func pipe(ctx context.Context, stub pb.TunnelClient, conn net.Conn, first *pb.Packet) error {
+	stream, err := stub.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(first); err != nil {
+		return err
+	}
+
+	go func() {
+		var buf [1024 * 32]byte
+		for {
+			n, err := conn.Read(buf[0:])
+			if n > 0 {
+				if err := stream.Send(&pb.Packet{Buf: buf[:n]}); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				stream.CloseSend()
+				return
+			}
+		}
+	}()
+
+	for {
+		packet, err := stream.Recv()
+		if err == io.EOF {
+			closeWrite(conn)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Write(packet.Buf); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/tunnel/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseForward(t *testing.T) {
+	_assert := assert.New(t)
+
+	forward, err := ParseForward("15432:db:5432")
+	_assert.Nil(err)
+	_assert.Equal("127.0.0.1:15432", forward.Bind)
+	_assert.Equal("db:5432", forward.Target)
+
+	forward, err = ParseForward("0.0.0.0:8080:localhost:80")
+	_assert.Nil(err)
+	_assert.Equal("0.0.0.0:8080", forward.Bind)
+	_assert.Equal("localhost:80", forward.Target)
+
+	for _, spec := range []string{"", "8080", "8080:db", "x:db:5432", "8080::5432", "8080:db:99999"} {
+		_, err = ParseForward(spec)
+		_assert.NotNil(err, spec)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterTunnelServer(s, &Server{})
+	go s.Serve(listen)
+	defer s.Stop()
+
+	stub, destroy, err := NewClient(listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer destroy()
+
+	bind, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bind.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var forward = &Forward{Bind: bind.Addr().String(), Target: echo.Addr().String()}
+	go Local(ctx, stub, forward, nil)
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		conn, err = net.Dial("tcp", forward.Bind)
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+
+	buf, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestCheckBind(t *testing.T) {
+	_assert := assert.New(t)
+
+	var ctx = context.Background()
+	for _, addr := range []string{"127.0.0.1:8080", "localhost:8080", "[::1]:8080"} {
+		_assert.Nil(checkBind(ctx, addr), addr)
+	}
+	for _, addr := range []string{"0.0.0.0:8080", ":8080", "10.0.0.1:8080"} {
+		_assert.Equal(codes.PermissionDenied, status.Code(checkBind(ctx, addr)), addr)
+	}
+	_assert.Equal(codes.InvalidArgument, status.Code(checkBind(ctx, "8080")))
+
+	ListenAllow = []string{"10.0.0.1"}
+	defer func() { ListenAllow = nil }()
+	_assert.Nil(checkBind(ctx, "10.0.0.1:8080"))
+	_assert.Equal(codes.PermissionDenied, status.Code(checkBind(ctx, "10.0.0.2:8080")))
+}
@@ -0,0 +1,221 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/tunnel/pb"
+	"github.com/eviltomorrow/omega/pkg/remote/ssh"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var (
+	DialTimeout   = 10 * time.Second
+	AttachTimeout = 30 * time.Second
+	// ListenAllow is hosts which Listen may bind besides loopback, "0.0.0.0"
+	// allows all interfaces
+	ListenAllow []string
+)
+
+type Server struct {
+	pb.UnimplementedTunnelServer
+}
+
+// Connect(Tunnel_ConnectServer) error
+// Listen(*Bind, Tunnel_ListenServer) error
+
+// accepted holds connections accepted by Listen until Connect attaches them
+var accepted sync.Map
+
+func (s *Server) Connect(cs pb.Tunnel_ConnectServer) error {
+	packet, err := cs.Recv()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+	switch {
+	case packet.ConnId != "":
+		val, ok := accepted.LoadAndDelete(packet.ConnId)
+		if !ok {
+			return fmt.Errorf("not found connection with conn-id[%s]", packet.ConnId)
+		}
+		conn = val.(net.Conn)
+
+	case packet.Target != nil:
+		conn, err = dial(packet.Target)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("target or conn-id is nil")
+	}
+	defer conn.Close()
+
+	if len(packet.Buf) != 0 {
+		if _, err := conn.Write(packet.Buf); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		for {
+			packet, err := cs.Recv()
+			if err != nil {
+				closeWrite(conn)
+				return
+			}
+			if _, err := conn.Write(packet.Buf); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	var buf [1024 * 32]byte
+	for {
+		n, err := conn.Read(buf[0:])
+		if n > 0 {
+			if err := cs.Send(&pb.Packet{Buf: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) Listen(req *pb.Bind, ls pb.Tunnel_ListenServer) error {
+	if err := checkBind(ls.Context(), req.Addr); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", req.Addr)
+	if err != nil {
+		return fmt.Errorf("listen [%s] failure, nest error: %v", req.Addr, err)
+	}
+	go func() {
+		<-ls.Context().Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ls.Context().Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var id = uuid.New().String()
+		accepted.Store(id, conn)
+		time.AfterFunc(AttachTimeout, func() {
+			if val, ok := accepted.LoadAndDelete(id); ok {
+				zlog.Warn("Accepted connection is not attached, it will be closed", zap.String("conn-id", id), zap.String("remote", conn.RemoteAddr().String()))
+				val.(net.Conn).Close()
+			}
+		})
+
+		if err := ls.Send(&wrapperspb.StringValue{Value: id}); err != nil {
+			return err
+		}
+	}
+}
+
+// checkBind rejects addr unless its host is loopback or in ListenAllow
+func checkBind(ctx context.Context, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid bind address[%s], nest error: %v", addr, err)
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	if host == "localhost" {
+		return nil
+	}
+	var ip = net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	for _, allow := range ListenAllow {
+		if allow == host || (ip != nil && ip.Equal(net.ParseIP(allow))) {
+			return nil
+		}
+	}
+
+	var remote string
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	zlog.Warn("Tunnel listen violation", zap.String("addr", addr), zap.String("peer", remote))
+	return status.Errorf(codes.PermissionDenied, "listen [%s] is denied, %s is not loopback or in listen-allow", addr, host)
+}
+
+func dial(target *pb.Target) (net.Conn, error) {
+	if target.Via == nil {
+		conn, err := net.DialTimeout("tcp", target.Addr, DialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("dial [%s] failure, nest error: %v", target.Addr, err)
+		}
+		return conn, nil
+	}
+
+	var (
+		via     = target.Via
+		timeout = time.Duration(via.Timeout) * time.Second
+	)
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+	client, err := ssh.Dial(via.Host, int(via.Port), via.Username, via.Password, via.Pk, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("tcp", target.Addr)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("dial [%s] via [%s] failure, nest error: %v", target.Addr, via.Host, err)
+	}
+	return &viaConn{Conn: conn, close: client.Close}, nil
+}
+
+type viaConn struct {
+	net.Conn
+	close func() error
+}
+
+func (c *viaConn) Close() error {
+	err := c.Conn.Close()
+	c.close()
+	return err
+}
+
+func (c *viaConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+func closeWrite(conn net.Conn) error {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return conn.Close()
+}
@@ -0,0 +1,74 @@
+package watchdog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/hub"
+	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
+	"github.com/eviltomorrow/omega/pkg/file"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"go.uber.org/zap"
+)
+
+var (
+	// Channel is the release channel of hub which omega follows, empty to
+	// install images by Pull only.
+	Channel            = ""
+	ChannelCheckPeriod = 5 * time.Minute
+)
+
+// FollowChannel checks Channel every ChannelCheckPeriod until stop is closed,
+// omega is installed and restarted once the channel points to another binary.
+func FollowChannel(stop <-chan struct{}) {
+	var ticker = time.NewTicker(ChannelCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := followChannel(); err != nil {
+				zlog.Error("Follow channel failure", zap.String("channel", Channel), zap.Error(err))
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func followChannel() error {
+	image, err := hub.Resolve(Channel)
+	if err != nil {
+		return err
+	}
+	binary, err := hub.BinaryOf(image)
+	if err != nil {
+		return err
+	}
+	sha256, err := file.CalculateSHA256(BinFile)
+	if err != nil {
+		return err
+	}
+	if sha256 == binary.Sha256 {
+		return nil
+	}
+	// the binary is not installed again after it was rolled back
+	upgradeMut.Lock()
+	var rolledBack = upgrade.State == pb.Upgrade_ROLLED_BACK && upgrade.Md5 == binary.Md5
+	upgradeMut.Unlock()
+	if rolledBack {
+		return fmt.Errorf("omega of image[%s] was rolled back, waiting for channel to move", image.Tag)
+	}
+
+	zlog.Info("Channel is moved, install omega", zap.String("channel", Channel), zap.String("tag", image.Tag))
+	if _, err := install(image.Tag); err != nil {
+		return err
+	}
+
+	// omega may be stopped already, it is started with the new binary anyway
+	if _, err := notifyWait(pb.Signal_QUIT); err != nil {
+		zlog.Warn("Stop omega failure", zap.Error(err))
+	}
+	_, err = notifyWait(pb.Signal_UP)
+	return err
+}
@@ -0,0 +1,149 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/agent"
+	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var (
+	// HealthWindow is how long omega is probed with Agent.Ping after it is
+	// started with an installed binary, the previous binary is restored if it
+	// fails. 0 disables the check.
+	HealthWindow   = 30 * time.Second
+	HealthInterval = 2 * time.Second
+	// AgentAddr is the address of Agent service of omega
+	AgentAddr = "127.0.0.1:28501"
+)
+
+var (
+	upgradeMut sync.Mutex
+	upgrade    = &pb.Upgrade{}
+	// installMut serializes install, and keeps the upgrade from being checked
+	// while a binary is being installed
+	installMut sync.Mutex
+)
+
+// backupFile keeps the binary which runs before install
+func backupFile() string {
+	return BinFile + ".prev"
+}
+
+// LastUpgrade returns the state of the last installed binary
+func (s *Server) LastUpgrade(ctx context.Context, _ *emptypb.Empty) (*pb.Upgrade, error) {
+	upgradeMut.Lock()
+	defer upgradeMut.Unlock()
+
+	return proto.Clone(upgrade).(*pb.Upgrade), nil
+}
+
+// startUpgrade checks the pending upgrade after omega is started by UP, err
+// is the failure of UP.
+func startUpgrade(err error) {
+	installMut.Lock()
+	defer installMut.Unlock()
+	upgradeMut.Lock()
+	defer upgradeMut.Unlock()
+
+	if upgrade.State != pb.Upgrade_PENDING {
+		return
+	}
+	if err == nil && HealthWindow <= 0 {
+		upgrade.State, upgrade.FinishTime = pb.Upgrade_HEALTHY, time.Now().Unix()
+		return
+	}
+	upgrade.State = pb.Upgrade_CHECKING
+	go checkUpgrade(upgrade.Tag, err)
+}
+
+// checkUpgrade probes omega of tag in HealthWindow, and rolls it back if it
+// is unhealthy or failed to start.
+func checkUpgrade(tag string, startErr error) {
+	var err = startErr
+	if err == nil {
+		err = probe(HealthWindow)
+	}
+	if err == nil {
+		finishUpgrade(pb.Upgrade_HEALTHY, "")
+		zlog.Info("Upgraded omega is healthy", zap.String("tag", tag))
+		return
+	}
+
+	zlog.Error("Upgraded omega is unhealthy, roll back to the previous binary", zap.String("tag", tag), zap.Error(err))
+	if rerr := rollback(); rerr != nil {
+		finishUpgrade(pb.Upgrade_ROLLBACK_FAILED, fmt.Sprintf("%v, rollback failure, nest error: %v", err, rerr))
+		zlog.Error("Roll back omega failure", zap.String("tag", tag), zap.Error(rerr))
+		return
+	}
+	finishUpgrade(pb.Upgrade_ROLLED_BACK, err.Error())
+}
+
+func finishUpgrade(state pb.Upgrade_State, reason string) {
+	upgradeMut.Lock()
+	defer upgradeMut.Unlock()
+
+	upgrade.State, upgrade.Reason, upgrade.FinishTime = state, reason, time.Now().Unix()
+}
+
+// probe pings omega every HealthInterval in window, omega is healthy if it
+// answers and never fails after its first answer.
+func probe(window time.Duration) error {
+	client, destroy, err := agent.NewClient(AgentAddr)
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	var (
+		deadline = time.Now().Add(window)
+		answered bool
+		lastErr  error
+	)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), HealthInterval)
+		_, err := client.Ping(ctx, &emptypb.Empty{})
+		cancel()
+
+		switch {
+		case err == nil:
+			answered = true
+		case answered:
+			return fmt.Errorf("ping omega failure after it started, nest error: %v", err)
+		default:
+			lastErr = err
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(HealthInterval)
+	}
+	if !answered {
+		return fmt.Errorf("omega doesn't answer ping in %v, nest error: %v", window, lastErr)
+	}
+	return nil
+}
+
+// rollback stops omega, restores the previous binary and starts it again
+func rollback() error {
+	if _, err := os.Stat(backupFile()); err != nil {
+		return fmt.Errorf("previous binary not exist, nest error: %v", err)
+	}
+	// omega may be stopped already after it crashed
+	if _, err := notifyWait(pb.Signal_QUIT); err != nil {
+		zlog.Warn("Stop omega failure", zap.Error(err))
+	}
+	if err := os.Rename(backupFile(), BinFile); err != nil {
+		return err
+	}
+	_, err := notifyWait(pb.Signal_UP)
+	return err
+}
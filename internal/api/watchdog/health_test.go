@@ -0,0 +1,127 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/agent"
+	pb_agent "github.com/eviltomorrow/omega/internal/api/agent/pb"
+	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// fakeOmega answers signals as the loop of omega-watchdog does, omega fails
+// to start if failUp returns an error
+func fakeOmega(t *testing.T, failUp func() error) {
+	var done = make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		for {
+			select {
+			case <-Stop:
+				Pid <- PS{Pid: 1}
+			case <-Reload:
+				if err := failUp(); err != nil {
+					Pid <- PS{Err: err}
+				} else {
+					Pid <- PS{Pid: 2}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func waitUpgrade(t *testing.T) *pb.Upgrade {
+	for i := 0; i < 100; i++ {
+		last, _ := (&Server{}).LastUpgrade(context.Background(), &emptypb.Empty{})
+		if last.State != pb.Upgrade_CHECKING {
+			return last
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("health check doesn't finish")
+	return nil
+}
+
+func TestRollback(t *testing.T) {
+	_assert := assert.New(t)
+
+	var dir = t.TempDir()
+	BinFile = filepath.Join(dir, "omega")
+	HealthWindow, HealthInterval = 200*time.Millisecond, 50*time.Millisecond
+	var upErr error
+	fakeOmega(t, func() error {
+		err := upErr
+		upErr = nil
+		return err
+	})
+
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert.Nil(err)
+	AgentAddr = listen.Addr().String()
+	var s = grpc.NewServer()
+	pb_agent.RegisterAgentServer(s, &agent.Server{})
+	go s.Serve(listen)
+	defer s.Stop()
+
+	// a healthy binary is kept
+	_assert.Nil(os.WriteFile(BinFile, []byte("v3.2.0"), 0755))
+	_assert.Nil(os.WriteFile(backupFile(), []byte("v3.1.0"), 0755))
+	upgrade = &pb.Upgrade{State: pb.Upgrade_PENDING, Tag: "v3.2.0"}
+	_, err = notify(pb.Signal_UP)
+	_assert.Nil(err)
+	_assert.Equal(pb.Upgrade_HEALTHY, waitUpgrade(t).State)
+	buf, _ := os.ReadFile(BinFile)
+	_assert.Equal("v3.2.0", string(buf))
+
+	// omega doesn't answer ping, the previous binary is restored
+	s.Stop()
+	upgrade = &pb.Upgrade{State: pb.Upgrade_PENDING, Tag: "v3.3.0"}
+	_, err = notify(pb.Signal_UP)
+	_assert.Nil(err)
+	var last = waitUpgrade(t)
+	_assert.Equal(pb.Upgrade_ROLLED_BACK, last.State)
+	_assert.Contains(last.Reason, "doesn't answer ping")
+	buf, _ = os.ReadFile(BinFile)
+	_assert.Equal("v3.1.0", string(buf))
+
+	// omega fails to start, the previous binary is restored and started
+	_assert.Nil(os.WriteFile(BinFile, []byte("v3.5.0"), 0755))
+	_assert.Nil(os.WriteFile(backupFile(), []byte("v3.1.0"), 0755))
+	upgrade = &pb.Upgrade{State: pb.Upgrade_PENDING, Tag: "v3.5.0"}
+	upErr = fmt.Errorf("exec format error")
+	_, err = notify(pb.Signal_UP)
+	_assert.NotNil(err)
+	last = waitUpgrade(t)
+	_assert.Equal(pb.Upgrade_ROLLED_BACK, last.State)
+	_assert.Contains(last.Reason, "exec format error")
+	buf, _ = os.ReadFile(BinFile)
+	_assert.Equal("v3.1.0", string(buf))
+
+	// the rollback waits for a Notify in flight instead of failing busy
+	_assert.Nil(os.WriteFile(BinFile, []byte("v3.6.0"), 0755))
+	_assert.Nil(os.WriteFile(backupFile(), []byte("v3.1.0"), 0755))
+	upgrade = &pb.Upgrade{State: pb.Upgrade_PENDING, Tag: "v3.6.0"}
+	inFlightSem <- struct{}{}
+	startUpgrade(fmt.Errorf("exec format error"))
+	time.Sleep(100 * time.Millisecond)
+	<-inFlightSem
+	_assert.Equal(pb.Upgrade_ROLLED_BACK, waitUpgrade(t).State)
+	buf, _ = os.ReadFile(BinFile)
+	_assert.Equal("v3.1.0", string(buf))
+
+	// nothing to restore
+	upgrade = &pb.Upgrade{State: pb.Upgrade_PENDING, Tag: "v3.4.0"}
+	_, err = notify(pb.Signal_UP)
+	_assert.Nil(err)
+	_assert.Equal(pb.Upgrade_ROLLBACK_FAILED, waitUpgrade(t).State)
+}
@@ -0,0 +1,27 @@
+package watchdog
+
+// Limits are resources omega may use, zero is unlimited
+type Limits struct {
+	// Memory is bytes
+	Memory int64
+	// CPU is cores, eg. 0.5
+	CPU    float64
+	Nofile uint64
+}
+
+// Limit is applied to omega every time it is started. Memory and CPU are
+// applied with cgroup v2 in CgroupDir if it is writable, otherwise they are
+// not limited. Nofile is applied with RLIMIT_NOFILE.
+var (
+	Limit     Limits
+	CgroupDir = "/sys/fs/cgroup/omega"
+)
+
+// reasons of exits by limits
+const (
+	LimitMemory = "memory"
+)
+
+func (l Limits) empty() bool {
+	return l.Memory <= 0 && l.CPU <= 0 && l.Nofile == 0
+}
@@ -0,0 +1,138 @@
+package watchdog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// cpuPeriod is the period of cpu.max in microseconds
+const cpuPeriod = 100000
+
+// limiter is Limit applied to one omega process
+type limiter struct {
+	// cgroup is empty if memory and cpu aren't limited
+	cgroup   string
+	oomKills int64
+}
+
+// applyLimits applies Limit to omega of pid, omega runs without limits
+// which fail to be applied. Limits are applied after omega is started, so it
+// runs without them for a moment.
+func applyLimits(pid int) *limiter {
+	if Limit.empty() {
+		return nil
+	}
+
+	var l = &limiter{}
+	if Limit.Memory > 0 || Limit.CPU > 0 {
+		if err := setupCgroup(CgroupDir); err != nil {
+			// RLIMIT_AS limits address space which go reserves much more of
+			// than it uses, so memory isn't limited without cgroup
+			zlog.Warn("Limit omega with cgroup failure, memory and cpu of omega aren't limited", zap.String("cgroup", CgroupDir),
+				zap.Int64("memory", Limit.Memory), zap.Float64("cpu", Limit.CPU), zap.Error(err))
+		} else {
+			l.cgroup, l.oomKills = CgroupDir, oomKillsOf(CgroupDir)
+			if err := os.WriteFile(filepath.Join(CgroupDir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+				zlog.Error("Move omega to cgroup failure", zap.Int("pid", pid), zap.String("cgroup", CgroupDir), zap.Error(err))
+				l.cgroup = ""
+			}
+		}
+	}
+
+	if Limit.Nofile > 0 {
+		var rlimit = &unix.Rlimit{Cur: Limit.Nofile, Max: Limit.Nofile}
+		if err := unix.Prlimit(pid, unix.RLIMIT_NOFILE, rlimit, nil); err != nil {
+			zlog.Error("Limit open files of omega failure", zap.Int("pid", pid), zap.Error(err))
+		}
+	}
+	return l
+}
+
+// setupCgroup creates cgroup dir with memory.max and cpu.max of Limit
+func setupCgroup(dir string) error {
+	var parent = filepath.Dir(dir)
+	if _, err := os.Stat(filepath.Join(parent, "cgroup.controllers")); err != nil {
+		return fmt.Errorf("cgroup v2 isn't mounted at %s", parent)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var controllers = make([]string, 0, 2)
+	if Limit.Memory > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if Limit.CPU > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	// controllers may be enabled already, writing them fails if parent has processes
+	if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte(strings.Join(controllers, " ")), 0644); err != nil {
+		zlog.Warn("Enable cgroup controllers failure", zap.String("cgroup", parent), zap.Error(err))
+	}
+
+	var memory, cpu = "max", "max"
+	if Limit.Memory > 0 {
+		memory = strconv.FormatInt(Limit.Memory, 10)
+	}
+	if Limit.CPU > 0 {
+		cpu = strconv.FormatInt(int64(Limit.CPU*cpuPeriod), 10)
+	}
+	for name, value := range map[string]string{
+		"memory.max": memory,
+		"cpu.max":    fmt.Sprintf("%s %d", cpu, cpuPeriod),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+			return fmt.Errorf("write %s failure, nest error: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// oomKillsOf returns oom_kill in memory.events of cgroup dir
+func oomKillsOf(dir string) int64 {
+	buf, err := os.ReadFile(filepath.Join(dir, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	var scanner = bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		var fields = strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.ParseInt(fields[1], 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// killedBy returns the limit which killed omega with err of its exit, it is
+// empty if omega isn't killed by a limit.
+func (l *limiter) killedBy(err error) string {
+	if l == nil || l.cgroup == "" {
+		return ""
+	}
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		return ""
+	}
+	ws, ok := ee.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() || ws.Signal() != syscall.SIGKILL {
+		return ""
+	}
+	if oomKillsOf(l.cgroup) > l.oomKills {
+		return LimitMemory
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package watchdog
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestApplyLimits(t *testing.T) {
+	_assert := assert.New(t)
+	defer func() { Limit = Limits{} }()
+
+	// cgroup v2 isn't mounted in dir, open files are limited with rlimit and
+	// memory isn't limited
+	Limit, CgroupDir = Limits{Memory: 64 << 20, Nofile: 64}, filepath.Join(t.TempDir(), "omega")
+	var cmd = exec.Command("sleep", "10")
+	_assert.Nil(cmd.Start())
+	defer cmd.Process.Kill()
+
+	var l = applyLimits(cmd.Process.Pid)
+	_assert.NotNil(l)
+	_assert.Equal("", l.cgroup)
+	buf, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(cmd.Process.Pid), "limits"))
+	_assert.Nil(err)
+	_assert.Regexp(`Max open files\s+64\s+64`, string(buf))
+	_assert.Regexp(`Max address space\s+unlimited\s+unlimited`, string(buf))
+}
+
+func TestSetupCgroup(t *testing.T) {
+	_assert := assert.New(t)
+	defer func() { Limit = Limits{} }()
+
+	var parent = t.TempDir()
+	_assert.NotNil(setupCgroup(filepath.Join(parent, "omega")))
+
+	_assert.Nil(os.WriteFile(filepath.Join(parent, "cgroup.controllers"), []byte("cpu memory"), 0644))
+	Limit = Limits{Memory: 64 << 20, CPU: 0.5}
+	_assert.Nil(setupCgroup(filepath.Join(parent, "omega")))
+	buf, _ := os.ReadFile(filepath.Join(parent, "omega", "memory.max"))
+	_assert.Equal("67108864", string(buf))
+	buf, _ = os.ReadFile(filepath.Join(parent, "omega", "cpu.max"))
+	_assert.Equal("50000 100000", string(buf))
+	buf, _ = os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	_assert.Equal("+memory +cpu", string(buf))
+}
+
+func TestKilledBy(t *testing.T) {
+	_assert := assert.New(t)
+
+	var dir = t.TempDir()
+	_assert.Nil(os.WriteFile(filepath.Join(dir, "memory.events"), []byte("low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n"), 0644))
+	var l = &limiter{cgroup: dir, oomKills: oomKillsOf(dir)}
+	_assert.Equal(int64(1), l.oomKills)
+
+	var cmd = exec.Command("sleep", "10")
+	_assert.Nil(cmd.Start())
+	cmd.Process.Kill()
+	var err = cmd.Wait()
+	_assert.Equal("", l.killedBy(err))
+
+	// omega is killed by oom killer of cgroup
+	_assert.Nil(os.WriteFile(filepath.Join(dir, "memory.events"), []byte("oom_kill 2\n"), 0644))
+	_assert.Equal(LimitMemory, l.killedBy(err))
+	_assert.Equal("", l.killedBy(exec.Command("false").Run()))
+	_assert.Equal("", (*limiter)(nil).killedBy(err))
+}
+
+func TestSuperviseLimitKill(t *testing.T) {
+	_assert := assert.New(t)
+	defer func() { Limit = Limits{} }()
+
+	var parent = t.TempDir()
+	_assert.Nil(os.WriteFile(filepath.Join(parent, "cgroup.controllers"), []byte("cpu memory"), 0644))
+	Limit, CgroupDir = Limits{Memory: 64 << 20}, filepath.Join(parent, "omega")
+	var events = filepath.Join(CgroupDir, "memory.events")
+
+	// omega is killed by the oom killer of cgroup more times than the crash
+	// loop threshold, it is never degraded
+	superviseTest(t, "sleep 0.2; echo \"oom_kill $(date +%s%N)\" > "+events+"; kill -9 $$")
+	_, err := notify(pb.Signal_UP)
+	_assert.Nil(err)
+	for i := 0; i < 200; i++ {
+		if s, _ := (&Server{}).Status(context.Background(), &emptypb.Empty{}); s.LimitKills > int32(CrashLoopThreshold) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	s, _ := (&Server{}).Status(context.Background(), &emptypb.Empty{})
+	_assert.Greater(s.LimitKills, int32(CrashLoopThreshold))
+	_assert.Equal(int32(0), s.Failures)
+	_assert.NotEqual(pb.WatchdogStatus_DEGRADED, s.State)
+	_assert.Equal(LimitMemory, s.History[0].Limit)
+	_assert.Contains(s.History[0].Reason, "killed by memory limit")
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package watchdog
+
+// limiter is Limit applied to one omega process
+type limiter struct{}
+
+// applyLimits applies Limit on linux only
+func applyLimits(pid int) *limiter {
+	return nil
+}
+
+// killedBy returns the limit which killed omega, it is always empty
+func (l *limiter) killedBy(err error) string {
+	return ""
+}
@@ -9,6 +9,7 @@ package pb
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
 	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
 	reflect "reflect"
 	sync "sync"
@@ -67,6 +68,121 @@ func (Signal_Sig) EnumDescriptor() ([]byte, []int) {
 	return file_watchdog_proto_rawDescGZIP(), []int{0, 0}
 }
 
+type Upgrade_State int32
+
+const (
+	Upgrade_NONE Upgrade_State = 0
+	// PENDING is installed but not started by UP yet
+	Upgrade_PENDING     Upgrade_State = 1
+	Upgrade_CHECKING    Upgrade_State = 2
+	Upgrade_HEALTHY     Upgrade_State = 3
+	Upgrade_ROLLED_BACK Upgrade_State = 4
+	// ROLLBACK_FAILED leaves omega stopped or running the unhealthy binary
+	Upgrade_ROLLBACK_FAILED Upgrade_State = 5
+)
+
+// Enum value maps for Upgrade_State.
+var (
+	Upgrade_State_name = map[int32]string{
+		0: "NONE",
+		1: "PENDING",
+		2: "CHECKING",
+		3: "HEALTHY",
+		4: "ROLLED_BACK",
+		5: "ROLLBACK_FAILED",
+	}
+	Upgrade_State_value = map[string]int32{
+		"NONE":            0,
+		"PENDING":         1,
+		"CHECKING":        2,
+		"HEALTHY":         3,
+		"ROLLED_BACK":     4,
+		"ROLLBACK_FAILED": 5,
+	}
+)
+
+func (x Upgrade_State) Enum() *Upgrade_State {
+	p := new(Upgrade_State)
+	*p = x
+	return p
+}
+
+func (x Upgrade_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Upgrade_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_watchdog_proto_enumTypes[1].Descriptor()
+}
+
+func (Upgrade_State) Type() protoreflect.EnumType {
+	return &file_watchdog_proto_enumTypes[1]
+}
+
+func (x Upgrade_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Upgrade_State.Descriptor instead.
+func (Upgrade_State) EnumDescriptor() ([]byte, []int) {
+	return file_watchdog_proto_rawDescGZIP(), []int{1, 0}
+}
+
+type WatchdogStatus_State int32
+
+const (
+	WatchdogStatus_STOPPED WatchdogStatus_State = 0
+	WatchdogStatus_RUNNING WatchdogStatus_State = 1
+	// BACKOFF waits to restart omega after it failed
+	WatchdogStatus_BACKOFF WatchdogStatus_State = 2
+	// DEGRADED gives up restarting after omega failed crash-loop-threshold
+	// times in a row, it is started again by UP only
+	WatchdogStatus_DEGRADED WatchdogStatus_State = 3
+)
+
+// Enum value maps for WatchdogStatus_State.
+var (
+	WatchdogStatus_State_name = map[int32]string{
+		0: "STOPPED",
+		1: "RUNNING",
+		2: "BACKOFF",
+		3: "DEGRADED",
+	}
+	WatchdogStatus_State_value = map[string]int32{
+		"STOPPED":  0,
+		"RUNNING":  1,
+		"BACKOFF":  2,
+		"DEGRADED": 3,
+	}
+)
+
+func (x WatchdogStatus_State) Enum() *WatchdogStatus_State {
+	p := new(WatchdogStatus_State)
+	*p = x
+	return p
+}
+
+func (x WatchdogStatus_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (WatchdogStatus_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_watchdog_proto_enumTypes[2].Descriptor()
+}
+
+func (WatchdogStatus_State) Type() protoreflect.EnumType {
+	return &file_watchdog_proto_enumTypes[2]
+}
+
+func (x WatchdogStatus_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use WatchdogStatus_State.Descriptor instead.
+func (WatchdogStatus_State) EnumDescriptor() ([]byte, []int) {
+	return file_watchdog_proto_rawDescGZIP(), []int{2, 0}
+}
+
 type Signal struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -114,28 +230,454 @@ func (x *Signal) GetSignal() Signal_Sig {
 	return Signal_QUIT
 }
 
+type Upgrade struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	State Upgrade_State `protobuf:"varint,1,opt,name=state,proto3,enum=omega.Upgrade_State" json:"state,omitempty"`
+	Tag   string        `protobuf:"bytes,2,opt,name=tag,proto3" json:"tag,omitempty"`
+	Md5   string        `protobuf:"bytes,3,opt,name=md5,proto3" json:"md5,omitempty"`
+	// previous_md5 is md5 of the binary which is restored on rollback
+	PreviousMd5 string `protobuf:"bytes,4,opt,name=previous_md5,json=previousMd5,proto3" json:"previous_md5,omitempty"`
+	Reason      string `protobuf:"bytes,5,opt,name=reason,proto3" json:"reason,omitempty"`
+	InstallTime int64  `protobuf:"varint,6,opt,name=install_time,json=installTime,proto3" json:"install_time,omitempty"`
+	FinishTime  int64  `protobuf:"varint,7,opt,name=finish_time,json=finishTime,proto3" json:"finish_time,omitempty"`
+}
+
+func (x *Upgrade) Reset() {
+	*x = Upgrade{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_watchdog_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Upgrade) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Upgrade) ProtoMessage() {}
+
+func (x *Upgrade) ProtoReflect() protoreflect.Message {
+	mi := &file_watchdog_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Upgrade.ProtoReflect.Descriptor instead.
+func (*Upgrade) Descriptor() ([]byte, []int) {
+	return file_watchdog_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Upgrade) GetState() Upgrade_State {
+	if x != nil {
+		return x.State
+	}
+	return Upgrade_NONE
+}
+
+func (x *Upgrade) GetTag() string {
+	if x != nil {
+		return x.Tag
+	}
+	return ""
+}
+
+func (x *Upgrade) GetMd5() string {
+	if x != nil {
+		return x.Md5
+	}
+	return ""
+}
+
+func (x *Upgrade) GetPreviousMd5() string {
+	if x != nil {
+		return x.PreviousMd5
+	}
+	return ""
+}
+
+func (x *Upgrade) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Upgrade) GetInstallTime() int64 {
+	if x != nil {
+		return x.InstallTime
+	}
+	return 0
+}
+
+func (x *Upgrade) GetFinishTime() int64 {
+	if x != nil {
+		return x.FinishTime
+	}
+	return 0
+}
+
+type WatchdogStatus struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	State     WatchdogStatus_State `protobuf:"varint,1,opt,name=state,proto3,enum=omega.WatchdogStatus_State" json:"state,omitempty"`
+	Pid       int32                `protobuf:"varint,2,opt,name=pid,proto3" json:"pid,omitempty"`
+	StartTime int64                `protobuf:"varint,3,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	// restarts counts restarts after failures since watchdog started
+	Restarts int32 `protobuf:"varint,4,opt,name=restarts,proto3" json:"restarts,omitempty"`
+	// failures counts failures in a row
+	Failures int32 `protobuf:"varint,5,opt,name=failures,proto3" json:"failures,omitempty"`
+	// history keeps the last exits of omega, from old to new
+	History []*Exit `protobuf:"bytes,6,rep,name=history,proto3" json:"history,omitempty"`
+	// uptime is seconds since omega started
+	Uptime int64 `protobuf:"varint,7,opt,name=uptime,proto3" json:"uptime,omitempty"`
+	// tag and digest(sha256) are of the binary omega is started from, tag is
+	// empty if the binary isn't pulled by watchdog
+	Tag      string `protobuf:"bytes,8,opt,name=tag,proto3" json:"tag,omitempty"`
+	Digest   string `protobuf:"bytes,9,opt,name=digest,proto3" json:"digest,omitempty"`
+	LastExit *Exit  `protobuf:"bytes,10,opt,name=last_exit,json=lastExit,proto3" json:"last_exit,omitempty"`
+	// rss is bytes, cpu_percent is since the last Status or since omega
+	// started for the first Status
+	Rss        uint64  `protobuf:"varint,11,opt,name=rss,proto3" json:"rss,omitempty"`
+	CpuPercent float64 `protobuf:"fixed64,12,opt,name=cpu_percent,json=cpuPercent,proto3" json:"cpu_percent,omitempty"`
+	CpuSeconds float64 `protobuf:"fixed64,13,opt,name=cpu_seconds,json=cpuSeconds,proto3" json:"cpu_seconds,omitempty"`
+	// limit_kills counts kills by limits in a row, they are restarted with
+	// backoff and don't make omega degraded
+	LimitKills int32 `protobuf:"varint,14,opt,name=limit_kills,json=limitKills,proto3" json:"limit_kills,omitempty"`
+}
+
+func (x *WatchdogStatus) Reset() {
+	*x = WatchdogStatus{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_watchdog_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WatchdogStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchdogStatus) ProtoMessage() {}
+
+func (x *WatchdogStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_watchdog_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchdogStatus.ProtoReflect.Descriptor instead.
+func (*WatchdogStatus) Descriptor() ([]byte, []int) {
+	return file_watchdog_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *WatchdogStatus) GetState() WatchdogStatus_State {
+	if x != nil {
+		return x.State
+	}
+	return WatchdogStatus_STOPPED
+}
+
+func (x *WatchdogStatus) GetPid() int32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *WatchdogStatus) GetStartTime() int64 {
+	if x != nil {
+		return x.StartTime
+	}
+	return 0
+}
+
+func (x *WatchdogStatus) GetRestarts() int32 {
+	if x != nil {
+		return x.Restarts
+	}
+	return 0
+}
+
+func (x *WatchdogStatus) GetFailures() int32 {
+	if x != nil {
+		return x.Failures
+	}
+	return 0
+}
+
+func (x *WatchdogStatus) GetHistory() []*Exit {
+	if x != nil {
+		return x.History
+	}
+	return nil
+}
+
+func (x *WatchdogStatus) GetUptime() int64 {
+	if x != nil {
+		return x.Uptime
+	}
+	return 0
+}
+
+func (x *WatchdogStatus) GetTag() string {
+	if x != nil {
+		return x.Tag
+	}
+	return ""
+}
+
+func (x *WatchdogStatus) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+func (x *WatchdogStatus) GetLastExit() *Exit {
+	if x != nil {
+		return x.LastExit
+	}
+	return nil
+}
+
+func (x *WatchdogStatus) GetRss() uint64 {
+	if x != nil {
+		return x.Rss
+	}
+	return 0
+}
+
+func (x *WatchdogStatus) GetCpuPercent() float64 {
+	if x != nil {
+		return x.CpuPercent
+	}
+	return 0
+}
+
+func (x *WatchdogStatus) GetCpuSeconds() float64 {
+	if x != nil {
+		return x.CpuSeconds
+	}
+	return 0
+}
+
+func (x *WatchdogStatus) GetLimitKills() int32 {
+	if x != nil {
+		return x.LimitKills
+	}
+	return 0
+}
+
+type Exit struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Pid       int32 `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
+	StartTime int64 `protobuf:"varint,2,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	ExitTime  int64 `protobuf:"varint,3,opt,name=exit_time,json=exitTime,proto3" json:"exit_time,omitempty"`
+	// code is -1 if omega is killed by a signal or its exit is unknown
+	Code   int32  `protobuf:"varint,4,opt,name=code,proto3" json:"code,omitempty"`
+	Reason string `protobuf:"bytes,5,opt,name=reason,proto3" json:"reason,omitempty"`
+	// backoff is milliseconds waited before omega is restarted, 0 if it is not restarted
+	Backoff int64 `protobuf:"varint,6,opt,name=backoff,proto3" json:"backoff,omitempty"`
+	// limit is the resource limit which killed omega, such as memory
+	Limit string `protobuf:"bytes,7,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (x *Exit) Reset() {
+	*x = Exit{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_watchdog_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Exit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Exit) ProtoMessage() {}
+
+func (x *Exit) ProtoReflect() protoreflect.Message {
+	mi := &file_watchdog_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Exit.ProtoReflect.Descriptor instead.
+func (*Exit) Descriptor() ([]byte, []int) {
+	return file_watchdog_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Exit) GetPid() int32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *Exit) GetStartTime() int64 {
+	if x != nil {
+		return x.StartTime
+	}
+	return 0
+}
+
+func (x *Exit) GetExitTime() int64 {
+	if x != nil {
+		return x.ExitTime
+	}
+	return 0
+}
+
+func (x *Exit) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *Exit) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Exit) GetBackoff() int64 {
+	if x != nil {
+		return x.Backoff
+	}
+	return 0
+}
+
+func (x *Exit) GetLimit() string {
+	if x != nil {
+		return x.Limit
+	}
+	return ""
+}
+
 var File_watchdog_proto protoreflect.FileDescriptor
 
 var file_watchdog_proto_rawDesc = []byte{
 	0x0a, 0x0e, 0x77, 0x61, 0x74, 0x63, 0x68, 0x64, 0x6f, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
 	0x12, 0x05, 0x6f, 0x6d, 0x65, 0x67, 0x61, 0x1a, 0x1e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f,
 	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x77, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72,
-	0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x4c, 0x0a, 0x06, 0x53, 0x69, 0x67, 0x6e, 0x61,
-	0x6c, 0x12, 0x29, 0x0a, 0x06, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0e, 0x32, 0x11, 0x2e, 0x6f, 0x6d, 0x65, 0x67, 0x61, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c,
-	0x2e, 0x53, 0x69, 0x67, 0x52, 0x06, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x22, 0x17, 0x0a, 0x03,
-	0x53, 0x69, 0x67, 0x12, 0x08, 0x0a, 0x04, 0x51, 0x55, 0x49, 0x54, 0x10, 0x00, 0x12, 0x06, 0x0a,
-	0x02, 0x55, 0x50, 0x10, 0x01, 0x32, 0x88, 0x01, 0x0a, 0x08, 0x57, 0x61, 0x74, 0x63, 0x68, 0x64,
-	0x6f, 0x67, 0x12, 0x36, 0x0a, 0x06, 0x4e, 0x6f, 0x74, 0x69, 0x66, 0x79, 0x12, 0x0d, 0x2e, 0x6f,
-	0x6d, 0x65, 0x67, 0x61, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x1a, 0x1b, 0x2e, 0x67, 0x6f,
-	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x49, 0x6e,
-	0x74, 0x33, 0x32, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x00, 0x12, 0x44, 0x0a, 0x04, 0x50, 0x75,
-	0x6c, 0x6c, 0x12, 0x1c, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x56, 0x61, 0x6c, 0x75, 0x65,
-	0x1a, 0x1c, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
-	0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x00,
-	0x42, 0x07, 0x5a, 0x05, 0x2e, 0x2f, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
+	0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1b, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x22, 0x4c, 0x0a, 0x06, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x12, 0x29,
+	0x0a, 0x06, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11,
+	0x2e, 0x6f, 0x6d, 0x65, 0x67, 0x61, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x2e, 0x53, 0x69,
+	0x67, 0x52, 0x06, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x22, 0x17, 0x0a, 0x03, 0x53, 0x69, 0x67,
+	0x12, 0x08, 0x0a, 0x04, 0x51, 0x55, 0x49, 0x54, 0x10, 0x00, 0x12, 0x06, 0x0a, 0x02, 0x55, 0x50,
+	0x10, 0x01, 0x22, 0xb9, 0x02, 0x0a, 0x07, 0x55, 0x70, 0x67, 0x72, 0x61, 0x64, 0x65, 0x12, 0x2a,
+	0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x14, 0x2e,
+	0x6f, 0x6d, 0x65, 0x67, 0x61, 0x2e, 0x55, 0x70, 0x67, 0x72, 0x61, 0x64, 0x65, 0x2e, 0x53, 0x74,
+	0x61, 0x74, 0x65, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x61,
+	0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x74, 0x61, 0x67, 0x12, 0x10, 0x0a, 0x03,
+	0x6d, 0x64, 0x35, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6d, 0x64, 0x35, 0x12, 0x21,
+	0x0a, 0x0c, 0x70, 0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x5f, 0x6d, 0x64, 0x35, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x70, 0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x4d, 0x64,
+	0x35, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x69, 0x6e, 0x73,
+	0x74, 0x61, 0x6c, 0x6c, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x0b, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6c, 0x6c, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x1f, 0x0a, 0x0b,
+	0x66, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x0a, 0x66, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x54, 0x69, 0x6d, 0x65, 0x22, 0x5f, 0x0a,
+	0x05, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x08, 0x0a, 0x04, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00,
+	0x12, 0x0b, 0x0a, 0x07, 0x50, 0x45, 0x4e, 0x44, 0x49, 0x4e, 0x47, 0x10, 0x01, 0x12, 0x0c, 0x0a,
+	0x08, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x49, 0x4e, 0x47, 0x10, 0x02, 0x12, 0x0b, 0x0a, 0x07, 0x48,
+	0x45, 0x41, 0x4c, 0x54, 0x48, 0x59, 0x10, 0x03, 0x12, 0x0f, 0x0a, 0x0b, 0x52, 0x4f, 0x4c, 0x4c,
+	0x45, 0x44, 0x5f, 0x42, 0x41, 0x43, 0x4b, 0x10, 0x04, 0x12, 0x13, 0x0a, 0x0f, 0x52, 0x4f, 0x4c,
+	0x4c, 0x42, 0x41, 0x43, 0x4b, 0x5f, 0x46, 0x41, 0x49, 0x4c, 0x45, 0x44, 0x10, 0x05, 0x22, 0xf2,
+	0x03, 0x0a, 0x0e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x64, 0x6f, 0x67, 0x53, 0x74, 0x61, 0x74, 0x75,
+	0x73, 0x12, 0x31, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x1b, 0x2e, 0x6f, 0x6d, 0x65, 0x67, 0x61, 0x2e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x64, 0x6f,
+	0x67, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x05, 0x73,
+	0x74, 0x61, 0x74, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x03, 0x70, 0x69, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x74, 0x61, 0x72, 0x74, 0x5f,
+	0x74, 0x69, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x73, 0x74, 0x61, 0x72,
+	0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x74, 0x61, 0x72, 0x74,
+	0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x72, 0x65, 0x73, 0x74, 0x61, 0x72, 0x74,
+	0x73, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x73, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x08, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x73, 0x12, 0x25, 0x0a,
+	0x07, 0x68, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b,
+	0x2e, 0x6f, 0x6d, 0x65, 0x67, 0x61, 0x2e, 0x45, 0x78, 0x69, 0x74, 0x52, 0x07, 0x68, 0x69, 0x73,
+	0x74, 0x6f, 0x72, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x75, 0x70, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x07,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x75, 0x70, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x10, 0x0a, 0x03,
+	0x74, 0x61, 0x67, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x74, 0x61, 0x67, 0x12, 0x16,
+	0x0a, 0x06, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x12, 0x28, 0x0a, 0x09, 0x6c, 0x61, 0x73, 0x74, 0x5f, 0x65,
+	0x78, 0x69, 0x74, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x6f, 0x6d, 0x65, 0x67,
+	0x61, 0x2e, 0x45, 0x78, 0x69, 0x74, 0x52, 0x08, 0x6c, 0x61, 0x73, 0x74, 0x45, 0x78, 0x69, 0x74,
+	0x12, 0x10, 0x0a, 0x03, 0x72, 0x73, 0x73, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x72,
+	0x73, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x63, 0x70, 0x75, 0x5f, 0x70, 0x65, 0x72, 0x63, 0x65, 0x6e,
+	0x74, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0a, 0x63, 0x70, 0x75, 0x50, 0x65, 0x72, 0x63,
+	0x65, 0x6e, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x63, 0x70, 0x75, 0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e,
+	0x64, 0x73, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0a, 0x63, 0x70, 0x75, 0x53, 0x65, 0x63,
+	0x6f, 0x6e, 0x64, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x5f, 0x6b, 0x69,
+	0x6c, 0x6c, 0x73, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x6c, 0x69, 0x6d, 0x69, 0x74,
+	0x4b, 0x69, 0x6c, 0x6c, 0x73, 0x22, 0x3c, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x0b,
+	0x0a, 0x07, 0x53, 0x54, 0x4f, 0x50, 0x50, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x52,
+	0x55, 0x4e, 0x4e, 0x49, 0x4e, 0x47, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x42, 0x41, 0x43, 0x4b,
+	0x4f, 0x46, 0x46, 0x10, 0x02, 0x12, 0x0c, 0x0a, 0x08, 0x44, 0x45, 0x47, 0x52, 0x41, 0x44, 0x45,
+	0x44, 0x10, 0x03, 0x22, 0xb0, 0x01, 0x0a, 0x04, 0x45, 0x78, 0x69, 0x74, 0x12, 0x10, 0x0a, 0x03,
+	0x70, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x03, 0x70, 0x69, 0x64, 0x12, 0x1d,
+	0x0a, 0x0a, 0x73, 0x74, 0x61, 0x72, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x09, 0x73, 0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x1b, 0x0a,
+	0x09, 0x65, 0x78, 0x69, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x08, 0x65, 0x78, 0x69, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f,
+	0x64, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x16,
+	0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x6f, 0x66,
+	0x66, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x6f, 0x66, 0x66,
+	0x12, 0x14, 0x0a, 0x05, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x32, 0xfc, 0x01, 0x0a, 0x08, 0x57, 0x61, 0x74, 0x63, 0x68,
+	0x64, 0x6f, 0x67, 0x12, 0x36, 0x0a, 0x06, 0x4e, 0x6f, 0x74, 0x69, 0x66, 0x79, 0x12, 0x0d, 0x2e,
+	0x6f, 0x6d, 0x65, 0x67, 0x61, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x1a, 0x1b, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x49,
+	0x6e, 0x74, 0x33, 0x32, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x00, 0x12, 0x44, 0x0a, 0x04, 0x50,
+	0x75, 0x6c, 0x6c, 0x12, 0x1c, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x56, 0x61, 0x6c, 0x75,
+	0x65, 0x1a, 0x1c, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x22,
+	0x00, 0x12, 0x37, 0x0a, 0x0b, 0x4c, 0x61, 0x73, 0x74, 0x55, 0x70, 0x67, 0x72, 0x61, 0x64, 0x65,
+	0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x0e, 0x2e, 0x6f, 0x6d, 0x65, 0x67, 0x61,
+	0x2e, 0x55, 0x70, 0x67, 0x72, 0x61, 0x64, 0x65, 0x22, 0x00, 0x12, 0x39, 0x0a, 0x06, 0x53, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x15, 0x2e, 0x6f,
+	0x6d, 0x65, 0x67, 0x61, 0x2e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x64, 0x6f, 0x67, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x22, 0x00, 0x42, 0x07, 0x5a, 0x05, 0x2e, 0x2f, 0x3b, 0x70, 0x62, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -150,25 +692,39 @@ func file_watchdog_proto_rawDescGZIP() []byte {
 	return file_watchdog_proto_rawDescData
 }
 
-var file_watchdog_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_watchdog_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_watchdog_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_watchdog_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
 var file_watchdog_proto_goTypes = []interface{}{
 	(Signal_Sig)(0),                // 0: omega.Signal.Sig
-	(*Signal)(nil),                 // 1: omega.Signal
-	(*wrapperspb.StringValue)(nil), // 2: google.protobuf.StringValue
-	(*wrapperspb.Int32Value)(nil),  // 3: google.protobuf.Int32Value
+	(Upgrade_State)(0),             // 1: omega.Upgrade.State
+	(WatchdogStatus_State)(0),      // 2: omega.WatchdogStatus.State
+	(*Signal)(nil),                 // 3: omega.Signal
+	(*Upgrade)(nil),                // 4: omega.Upgrade
+	(*WatchdogStatus)(nil),         // 5: omega.WatchdogStatus
+	(*Exit)(nil),                   // 6: omega.Exit
+	(*wrapperspb.StringValue)(nil), // 7: google.protobuf.StringValue
+	(*emptypb.Empty)(nil),          // 8: google.protobuf.Empty
+	(*wrapperspb.Int32Value)(nil),  // 9: google.protobuf.Int32Value
 }
 var file_watchdog_proto_depIdxs = []int32{
 	0, // 0: omega.Signal.signal:type_name -> omega.Signal.Sig
-	1, // 1: omega.Watchdog.Notify:input_type -> omega.Signal
-	2, // 2: omega.Watchdog.Pull:input_type -> google.protobuf.StringValue
-	3, // 3: omega.Watchdog.Notify:output_type -> google.protobuf.Int32Value
-	2, // 4: omega.Watchdog.Pull:output_type -> google.protobuf.StringValue
-	3, // [3:5] is the sub-list for method output_type
-	1, // [1:3] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	1, // 1: omega.Upgrade.state:type_name -> omega.Upgrade.State
+	2, // 2: omega.WatchdogStatus.state:type_name -> omega.WatchdogStatus.State
+	6, // 3: omega.WatchdogStatus.history:type_name -> omega.Exit
+	6, // 4: omega.WatchdogStatus.last_exit:type_name -> omega.Exit
+	3, // 5: omega.Watchdog.Notify:input_type -> omega.Signal
+	7, // 6: omega.Watchdog.Pull:input_type -> google.protobuf.StringValue
+	8, // 7: omega.Watchdog.LastUpgrade:input_type -> google.protobuf.Empty
+	8, // 8: omega.Watchdog.Status:input_type -> google.protobuf.Empty
+	9, // 9: omega.Watchdog.Notify:output_type -> google.protobuf.Int32Value
+	7, // 10: omega.Watchdog.Pull:output_type -> google.protobuf.StringValue
+	4, // 11: omega.Watchdog.LastUpgrade:output_type -> omega.Upgrade
+	5, // 12: omega.Watchdog.Status:output_type -> omega.WatchdogStatus
+	9, // [9:13] is the sub-list for method output_type
+	5, // [5:9] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_watchdog_proto_init() }
@@ -189,14 +745,50 @@ func file_watchdog_proto_init() {
 				return nil
 			}
 		}
+		file_watchdog_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Upgrade); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_watchdog_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WatchdogStatus); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_watchdog_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Exit); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_watchdog_proto_rawDesc,
-			NumEnums:      1,
-			NumMessages:   1,
+			NumEnums:      3,
+			NumMessages:   4,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -11,6 +11,7 @@ import (
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
 	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -25,6 +26,12 @@ const _ = grpc.SupportPackageIsVersion7
 type WatchdogClient interface {
 	Notify(ctx context.Context, in *Signal, opts ...grpc.CallOption) (*wrapperspb.Int32Value, error)
 	Pull(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (*wrapperspb.StringValue, error)
+	// LastUpgrade returns the health check of the last binary installed by
+	// Pull, and whether it was rolled back
+	LastUpgrade(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Upgrade, error)
+	// Status returns the state of omega supervised by watchdog and its
+	// history of exits and restarts
+	Status(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*WatchdogStatus, error)
 }
 
 type watchdogClient struct {
@@ -53,12 +60,36 @@ func (c *watchdogClient) Pull(ctx context.Context, in *wrapperspb.StringValue, o
 	return out, nil
 }
 
+func (c *watchdogClient) LastUpgrade(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Upgrade, error) {
+	out := new(Upgrade)
+	err := c.cc.Invoke(ctx, "/omega.Watchdog/LastUpgrade", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *watchdogClient) Status(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*WatchdogStatus, error) {
+	out := new(WatchdogStatus)
+	err := c.cc.Invoke(ctx, "/omega.Watchdog/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // WatchdogServer is the server API for Watchdog service.
 // All implementations must embed UnimplementedWatchdogServer
 // for forward compatibility
 type WatchdogServer interface {
 	Notify(context.Context, *Signal) (*wrapperspb.Int32Value, error)
 	Pull(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+	// LastUpgrade returns the health check of the last binary installed by
+	// Pull, and whether it was rolled back
+	LastUpgrade(context.Context, *emptypb.Empty) (*Upgrade, error)
+	// Status returns the state of omega supervised by watchdog and its
+	// history of exits and restarts
+	Status(context.Context, *emptypb.Empty) (*WatchdogStatus, error)
 	mustEmbedUnimplementedWatchdogServer()
 }
 
@@ -72,6 +103,12 @@ func (UnimplementedWatchdogServer) Notify(context.Context, *Signal) (*wrapperspb
 func (UnimplementedWatchdogServer) Pull(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Pull not implemented")
 }
+func (UnimplementedWatchdogServer) LastUpgrade(context.Context, *emptypb.Empty) (*Upgrade, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LastUpgrade not implemented")
+}
+func (UnimplementedWatchdogServer) Status(context.Context, *emptypb.Empty) (*WatchdogStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
 func (UnimplementedWatchdogServer) mustEmbedUnimplementedWatchdogServer() {}
 
 // UnsafeWatchdogServer may be embedded to opt out of forward compatibility for this service.
@@ -121,6 +158,42 @@ func _Watchdog_Pull_Handler(srv interface{}, ctx context.Context, dec func(inter
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Watchdog_LastUpgrade_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WatchdogServer).LastUpgrade(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.Watchdog/LastUpgrade",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WatchdogServer).LastUpgrade(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Watchdog_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WatchdogServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/omega.Watchdog/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WatchdogServer).Status(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Watchdog_ServiceDesc is the grpc.ServiceDesc for Watchdog service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -136,6 +209,14 @@ var Watchdog_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Pull",
 			Handler:    _Watchdog_Pull_Handler,
 		},
+		{
+			MethodName: "LastUpgrade",
+			Handler:    _Watchdog_LastUpgrade_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _Watchdog_Status_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "watchdog.proto",
@@ -0,0 +1,36 @@
+package watchdog
+
+import (
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/hub"
+	"github.com/eviltomorrow/omega/pkg/file"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	"go.uber.org/zap"
+)
+
+// ReportPeriod is how often the installed binary is reported to hub
+var ReportPeriod = time.Minute
+
+// ReportRunning reports sha256 of BinFile as host to hub every ReportPeriod
+// until stop is closed, hub keeps images which are reported by GC.
+func ReportRunning(host string, stop <-chan struct{}) {
+	var ticker = time.NewTicker(ReportPeriod)
+	defer ticker.Stop()
+
+	for {
+		sha256, err := file.CalculateSHA256(BinFile)
+		if err == nil {
+			err = hub.Report(host, sha256)
+		}
+		if err != nil {
+			zlog.Warn("Report running binary failure", zap.String("host", host), zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
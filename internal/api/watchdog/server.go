@@ -7,11 +7,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/eviltomorrow/omega/internal/api/hub"
 	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
 	"github.com/eviltomorrow/omega/pkg/file"
+	"github.com/eviltomorrow/omega/pkg/zlog"
 	"github.com/hashicorp/go-version"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -39,95 +43,166 @@ type PS struct {
 }
 
 func (s *Server) Notify(ctx context.Context, req *pb.Signal) (*wrapperspb.Int32Value, error) {
+	pid, err := notify(req.Signal)
+	if err != nil {
+		return nil, err
+	}
+	return &wrapperspb.Int32Value{Value: int32(pid)}, nil
+}
+
+// notify stops or starts omega and returns its pid, it fails if another
+// signal is being sent
+func notify(signal pb.Signal_Sig) (int, error) {
 	select {
 	case inFlightSem <- struct{}{}:
-		defer func() { <-inFlightSem }()
 	default:
-		return nil, fmt.Errorf("watchdog service is busy")
+		return 0, fmt.Errorf("watchdog service is busy")
 	}
+	return notifyHeld(signal)
+}
 
+// notifyWait is notify which waits for the signal being sent instead of
+// failing, the watchdog itself sends signals with it
+func notifyWait(signal pb.Signal_Sig) (int, error) {
+	inFlightSem <- struct{}{}
+	return notifyHeld(signal)
+}
+
+// notifyHeld sends signal with inFlightSem held, inFlightSem is released
+// before the upgrade is checked, which may send signals to roll it back
+func notifyHeld(signal pb.Signal_Sig) (int, error) {
+	ps, err := send(signal)
+	<-inFlightSem
+	if err != nil {
+		return 0, err
+	}
+	if signal == pb.Signal_UP {
+		startUpgrade(ps.Err)
+	}
+	return ps.Pid, ps.Err
+}
+
+// send sends signal to the loop of omega-watchdog and waits for its answer
+func send(signal pb.Signal_Sig) (PS, error) {
 	select {
 	case <-Pid:
 	default:
 	}
 
-	switch req.Signal {
+	switch signal {
 	case pb.Signal_QUIT:
 		select {
 		case Stop <- 1:
 		default:
-			return nil, fmt.Errorf("omega is stopped")
+			return PS{}, fmt.Errorf("omega is stopped")
 		}
 
 	case pb.Signal_UP:
 		select {
 		case Reload <- struct{}{}:
 		default:
-			return nil, fmt.Errorf("omega is running")
+			return PS{}, fmt.Errorf("omega is running")
 		}
 
 	default:
-		return nil, fmt.Errorf("not implement signal[%v]", req.Signal)
+		return PS{}, fmt.Errorf("not implement signal[%v]", signal)
 	}
-
-	ps := <-Pid
-	return &wrapperspb.Int32Value{Value: int32(ps.Pid)}, ps.Err
+	return <-Pid, nil
 }
 
 func (s *Server) Pull(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
-	version, err := genVersion(req.Value)
+	md5, err := install(req.Value)
 	if err != nil {
 		return nil, err
 	}
+	return &wrapperspb.StringValue{Value: md5}, nil
+}
 
-	var (
-		tag  = version.Original()
-		path = filepath.Join(ImageDir, tag)
-	)
-	if err := os.MkdirAll(path, 0700); err != nil {
-		return nil, err
+// install pulls omega of tag into ImageDir and copies it to BinFile, it
+// returns md5 of the installed binary. The running binary is kept in
+// backupFile, and it is restored if the installed one is unhealthy after UP.
+// Installs are serialized, so the backup is never replaced by a binary which
+// is installed but not started.
+func install(tag string) (string, error) {
+	version, err := genVersion(tag)
+	if err != nil {
+		return "", err
 	}
 
-	if err := hub.Pull(filepath.Join(path, "omega"), tag); err != nil {
-		return nil, err
-	}
+	installMut.Lock()
+	defer installMut.Unlock()
 
-	if err := os.Remove(BinFile); err != nil {
-		return nil, err
+	upgradeMut.Lock()
+	var last = proto.Clone(upgrade).(*pb.Upgrade)
+	upgradeMut.Unlock()
+	if last.State == pb.Upgrade_CHECKING {
+		return "", fmt.Errorf("omega of image[%s] is being checked, try later", last.Tag)
 	}
 
-	from, err := os.Open(filepath.Join(path, "omega"))
-	if err != nil {
-		return nil, err
+	tag = version.Original()
+	var path = filepath.Join(ImageDir, tag)
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return "", err
 	}
-	defer from.Close()
 
-	to, err := os.OpenFile(BinFile, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
-	if err != nil {
-		return nil, err
+	// only the delta from the running binary is pulled if hub serves it
+	var target = filepath.Join(path, "omega")
+	if err := hub.PullDelta(target, BinFile, tag); err != nil {
+		zlog.Warn("Pull delta failure, pull the full binary", zap.String("tag", tag), zap.Error(err))
+		if err := hub.Pull(target, tag); err != nil {
+			return "", err
+		}
 	}
-	defer to.Close()
 
-	buf := make([]byte, 4096)
-	for {
-		n, err := from.Read(buf)
-		if err == io.EOF {
-			break
+	// a binary installed but not started yet is replaced, the backup is kept
+	var previousMd5 = last.PreviousMd5
+	if last.State == pb.Upgrade_PENDING {
+		if err := os.Remove(BinFile); err != nil && !os.IsNotExist(err) {
+			return "", err
 		}
-		if err != nil {
-			return nil, err
+	} else {
+		if previousMd5, err = file.CalculateMD5(BinFile); err != nil && !os.IsNotExist(err) {
+			return "", err
 		}
-
-		if _, err := to.Write(buf[:n]); err != nil {
-			return nil, err
+		if err := os.Rename(BinFile, backupFile()); err != nil && !os.IsNotExist(err) {
+			return "", err
 		}
 	}
 
+	if err := copyFile(target, BinFile); err != nil {
+		os.Remove(BinFile)
+		if last.State != pb.Upgrade_PENDING {
+			os.Rename(backupFile(), BinFile)
+		}
+		return "", err
+	}
 	md5, err := file.CalculateMD5(BinFile)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return &wrapperspb.StringValue{Value: md5}, nil
+
+	upgradeMut.Lock()
+	upgrade = &pb.Upgrade{State: pb.Upgrade_PENDING, Tag: tag, Md5: md5, PreviousMd5: previousMd5, InstallTime: time.Now().Unix()}
+	upgradeMut.Unlock()
+	return md5, nil
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
 }
 
 func genVersion(v string) (*version.Version, error) {
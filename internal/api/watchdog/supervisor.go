@@ -0,0 +1,308 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	psutil "github.com/shirou/gopsutil/v3/process"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var (
+	// RestartBackoff is waited before omega is restarted after its first
+	// failure, it is doubled after every failure in a row up to RestartMaxBackoff.
+	RestartBackoff    = time.Second
+	RestartMaxBackoff = time.Minute
+	// CrashLoopThreshold is how many failures in a row make omega degraded
+	CrashLoopThreshold = 5
+	// StablePeriod resets failures in a row once omega runs that long
+	StablePeriod = 10 * time.Minute
+	// StartTimeout is how long omega runs before UP is answered
+	StartTimeout = 2 * time.Second
+	QuitTimeout  = 2 * time.Second
+)
+
+// historySize is how many exits are kept in Status
+const historySize = 32
+
+var errUnknownExit = errors.New("exit status unknown")
+
+var (
+	statusMut sync.Mutex
+	status    = &pb.WatchdogStatus{}
+)
+
+// Status returns the state of supervised omega, its binary, resource usage
+// and last exits
+func (s *Server) Status(ctx context.Context, _ *emptypb.Empty) (*pb.WatchdogStatus, error) {
+	statusMut.Lock()
+	var current = proto.Clone(status).(*pb.WatchdogStatus)
+	statusMut.Unlock()
+
+	if current.Pid != 0 && current.StartTime != 0 {
+		current.Uptime = time.Now().Unix() - current.StartTime
+	}
+	if n := len(current.History); n != 0 {
+		current.LastExit = current.History[n-1]
+	}
+	setUsage(current)
+	return current, nil
+}
+
+// process is omega started by watchdog, or adopted from the previous watchdog
+type process struct {
+	p         *os.Process
+	startTime time.Time
+	limit     *limiter
+	exited    chan error
+}
+
+// Supervise starts omega with start when UP is received by Reload, and stops
+// it when QUIT is received by Stop. Omega which fails is restarted with
+// backoff until it fails CrashLoopThreshold times in a row. adopted is omega
+// which runs before watchdog starts, it is supervised until its first exit.
+// It returns when stop is closed, omega is left running.
+func Supervise(start func() (*exec.Cmd, error), adopted *os.Process, stop <-chan struct{}) {
+	for {
+		select {
+		case <-Reload:
+		case <-stop:
+			return
+		}
+		// Reload is kept full while omega runs, and Stop while it doesn't
+		Reload <- struct{}{}
+		select {
+		case <-Stop:
+		default:
+		}
+
+		if !supervise(start, adopted, stop) {
+			return
+		}
+		adopted = nil
+		Stop <- 0
+		<-Reload
+	}
+}
+
+// supervise runs omega until it is stopped, exits normally or is degraded,
+// it returns false if stop is closed.
+func supervise(start func() (*exec.Cmd, error), adopted *os.Process, stop <-chan struct{}) bool {
+	var (
+		failures   int
+		limitKills int
+		answered   bool
+	)
+	setStatus(func(s *pb.WatchdogStatus) { s.Failures, s.LimitKills = 0, 0 })
+	for {
+		var (
+			proc *process
+			exit *pb.Exit
+			err  error
+		)
+		if adopted != nil {
+			proc, answered = adopt(adopted), true
+			adopted = nil
+		} else {
+			proc, err = run(start)
+		}
+
+		if err != nil {
+			exit = &pb.Exit{ExitTime: time.Now().Unix(), Code: -1, Reason: fmt.Sprintf("start failure, nest error: %v", err)}
+			if !answered {
+				reply(PS{Err: err})
+				recordExit(exit, pb.WatchdogStatus_STOPPED, 0)
+				return true
+			}
+		} else {
+			var tag, digest = binaryOf()
+			setStatus(func(s *pb.WatchdogStatus) {
+				s.State, s.Pid, s.StartTime = pb.WatchdogStatus_RUNNING, int32(proc.p.Pid), proc.startTime.Unix()
+				s.Tag, s.Digest = tag, digest
+			})
+
+			// UP is answered once omega runs StartTimeout, an exit before it
+			// is answered to UP and omega is not restarted.
+			if !answered {
+				answered = true
+				select {
+				case err := <-proc.exited:
+					reply(PS{Pid: proc.p.Pid, Err: fmt.Errorf("omega exits after start, nest error: %v", err)})
+					recordExit(exitOf(proc, err), pb.WatchdogStatus_STOPPED, 0)
+					return true
+				case <-time.After(StartTimeout):
+					reply(PS{Pid: proc.p.Pid})
+				case <-stop:
+					return false
+				}
+			}
+
+			select {
+			case <-Stop:
+				quit(proc)
+				return true
+			case err := <-proc.exited:
+				if exit = exitOf(proc, err); err == nil {
+					recordExit(exit, pb.WatchdogStatus_STOPPED, 0)
+					zlog.Warn("Omega exits by itself", zap.Int32("pid", exit.Pid))
+					return true
+				}
+				if time.Since(proc.startTime) >= StablePeriod {
+					failures, limitKills = 0, 0
+				}
+			case <-stop:
+				return false
+			}
+		}
+
+		// omega killed by a limit doesn't crash, it is restarted with backoff
+		// and never degraded
+		var backoff time.Duration
+		if exit.Limit != "" {
+			limitKills++
+			setStatus(func(s *pb.WatchdogStatus) { s.LimitKills = int32(limitKills) })
+			backoff = backoffOf(limitKills)
+			recordExit(exit, pb.WatchdogStatus_BACKOFF, backoff)
+			zlog.Warn("Omega is killed by limit, restart it after backoff", zap.Int32("pid", exit.Pid), zap.String("limit", exit.Limit), zap.Duration("backoff", backoff))
+		} else {
+			failures++
+			setStatus(func(s *pb.WatchdogStatus) { s.Failures = int32(failures) })
+			if failures >= CrashLoopThreshold {
+				recordExit(exit, pb.WatchdogStatus_DEGRADED, 0)
+				zlog.Error("Omega is degraded, it fails too many times in a row", zap.Int("failures", failures), zap.String("reason", exit.Reason))
+				return true
+			}
+			backoff = backoffOf(failures)
+			recordExit(exit, pb.WatchdogStatus_BACKOFF, backoff)
+			zlog.Error("Omega fails, restart it after backoff", zap.Int32("pid", exit.Pid), zap.String("reason", exit.Reason), zap.Duration("backoff", backoff))
+		}
+
+		select {
+		case <-time.After(backoff):
+			setStatus(func(s *pb.WatchdogStatus) { s.Restarts++ })
+		case <-Stop:
+			setStatus(func(s *pb.WatchdogStatus) { s.State = pb.WatchdogStatus_STOPPED })
+			reply(PS{})
+			return true
+		case <-stop:
+			return false
+		}
+	}
+}
+
+func run(start func() (*exec.Cmd, error)) (*process, error) {
+	cmd, err := start()
+	if err != nil {
+		return nil, err
+	}
+	var proc = &process{p: cmd.Process, startTime: time.Now(), limit: applyLimits(cmd.Process.Pid), exited: make(chan error, 1)}
+	go func() {
+		proc.exited <- cmd.Wait()
+	}()
+	return proc, nil
+}
+
+// adopt supervises omega which is not a child of watchdog, its exit is found
+// by polling and its exit status is unknown.
+func adopt(p *os.Process) *process {
+	var proc = &process{p: p, startTime: time.Now(), exited: make(chan error, 1)}
+	if ps, err := psutil.NewProcess(int32(p.Pid)); err == nil {
+		if ms, err := ps.CreateTime(); err == nil {
+			proc.startTime = time.Unix(0, ms*int64(time.Millisecond))
+		}
+	}
+	go func() {
+		for p.Signal(syscall.Signal(0)) == nil {
+			time.Sleep(time.Second)
+		}
+		proc.exited <- errUnknownExit
+	}()
+	return proc
+}
+
+// quit stops omega with SIGQUIT, and answers QUIT once omega exits or
+// QuitTimeout passes.
+func quit(proc *process) {
+	if err := proc.p.Signal(syscall.SIGQUIT); err != nil {
+		zlog.Error("Signal omega with SIGQUIT failure, kill it", zap.Int("pid", proc.p.Pid), zap.Error(err))
+		proc.p.Kill()
+	}
+
+	var err error
+	select {
+	case err = <-proc.exited:
+		reply(PS{Pid: proc.p.Pid})
+	case <-time.After(QuitTimeout):
+		reply(PS{Pid: proc.p.Pid, Err: fmt.Errorf("Process.Signal(quit) Cost is more than %v", QuitTimeout)})
+		err = <-proc.exited
+	}
+	var exit = exitOf(proc, err)
+	exit.Reason = "quit, " + exit.Reason
+	recordExit(exit, pb.WatchdogStatus_STOPPED, 0)
+}
+
+// reply answers the pending Notify, an answer which nobody waits for is replaced
+func reply(ps PS) {
+	select {
+	case <-Pid:
+	default:
+	}
+	Pid <- ps
+}
+
+func backoffOf(failures int) time.Duration {
+	var backoff = RestartBackoff
+	for i := 1; i < failures && backoff < RestartMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > RestartMaxBackoff {
+		backoff = RestartMaxBackoff
+	}
+	return backoff
+}
+
+func exitOf(proc *process, err error) *pb.Exit {
+	var exit = &pb.Exit{Pid: int32(proc.p.Pid), ExitTime: time.Now().Unix(), Reason: "exit status 0"}
+	if !proc.startTime.IsZero() {
+		exit.StartTime = proc.startTime.Unix()
+	}
+	if err != nil {
+		exit.Code, exit.Reason = -1, err.Error()
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		exit.Code = int32(ee.ExitCode())
+	}
+	if exit.Limit = proc.limit.killedBy(err); exit.Limit != "" {
+		exit.Reason = fmt.Sprintf("killed by %s limit, %s", exit.Limit, exit.Reason)
+	}
+	return exit
+}
+
+func recordExit(exit *pb.Exit, state pb.WatchdogStatus_State, backoff time.Duration) {
+	exit.Backoff = backoff.Milliseconds()
+	setStatus(func(s *pb.WatchdogStatus) {
+		s.State, s.Pid = state, 0
+		s.History = append(s.History, exit)
+		if len(s.History) > historySize {
+			s.History = s.History[len(s.History)-historySize:]
+		}
+	})
+}
+
+func setStatus(f func(*pb.WatchdogStatus)) {
+	statusMut.Lock()
+	defer statusMut.Unlock()
+
+	f(status)
+}
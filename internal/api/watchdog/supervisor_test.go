@@ -0,0 +1,143 @@
+package watchdog
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func superviseTest(t *testing.T, script string) {
+	RestartBackoff, RestartMaxBackoff, CrashLoopThreshold = 20*time.Millisecond, 30*time.Millisecond, 3
+	StartTimeout, QuitTimeout = 100*time.Millisecond, 2*time.Second
+	status = &pb.WatchdogStatus{}
+
+	var (
+		stop = make(chan struct{})
+		done = make(chan struct{})
+	)
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+		select {
+		case <-Reload:
+		default:
+		}
+		select {
+		case <-Stop:
+		default:
+		}
+	})
+	go func() {
+		defer close(done)
+		Supervise(func() (*exec.Cmd, error) {
+			var cmd = exec.Command("sh", "-c", script)
+			return cmd, cmd.Start()
+		}, nil, stop)
+	}()
+}
+
+func waitStatus(t *testing.T, state pb.WatchdogStatus_State) *pb.WatchdogStatus {
+	for i := 0; i < 200; i++ {
+		s, _ := (&Server{}).Status(context.Background(), &emptypb.Empty{})
+		if s.State == state {
+			return s
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("omega isn't %s", state)
+	return nil
+}
+
+func TestSuperviseCrashLoop(t *testing.T) {
+	_assert := assert.New(t)
+	superviseTest(t, "sleep 0.2; exit 3")
+
+	_, err := notify(pb.Signal_UP)
+	_assert.Nil(err)
+
+	// omega fails 3 times in a row, it is restarted twice and then degraded
+	var s = waitStatus(t, pb.WatchdogStatus_DEGRADED)
+	_assert.Equal(int32(2), s.Restarts)
+	_assert.Equal(int32(3), s.Failures)
+	_assert.Equal(3, len(s.History))
+	for _, exit := range s.History {
+		_assert.Equal(int32(3), exit.Code)
+	}
+	_assert.Equal(int64(20), s.History[0].Backoff)
+	_assert.Equal(int64(30), s.History[1].Backoff)
+	_assert.Equal(int64(0), s.History[2].Backoff)
+
+	// degraded omega is started again by UP
+	_, err = notify(pb.Signal_UP)
+	_assert.Nil(err)
+	_assert.Equal(int32(0), waitStatus(t, pb.WatchdogStatus_RUNNING).Failures)
+}
+
+func TestSuperviseQuit(t *testing.T) {
+	_assert := assert.New(t)
+	superviseTest(t, "sleep 10")
+
+	pid, err := notify(pb.Signal_UP)
+	_assert.Nil(err)
+	_assert.NotEqual(0, pid)
+	var running = waitStatus(t, pb.WatchdogStatus_RUNNING)
+	_assert.Equal(int32(pid), running.Pid)
+	_assert.NotEqual(uint64(0), running.Rss)
+	_assert.Nil(running.LastExit)
+	_, err = notify(pb.Signal_UP)
+	_assert.NotNil(err)
+
+	_, err = notify(pb.Signal_QUIT)
+	_assert.Nil(err)
+	var s = waitStatus(t, pb.WatchdogStatus_STOPPED)
+	_assert.Equal(int32(0), s.Restarts)
+	_assert.True(strings.HasPrefix(s.LastExit.Reason, "quit"))
+	_assert.Equal(uint64(0), s.Rss)
+	_, err = notify(pb.Signal_QUIT)
+	_assert.NotNil(err)
+}
+
+func TestSuperviseEarlyExit(t *testing.T) {
+	_assert := assert.New(t)
+	superviseTest(t, "exit 1")
+
+	// omega which exits before StartTimeout fails UP, and it isn't restarted
+	_, err := notify(pb.Signal_UP)
+	_assert.NotNil(err)
+	var s = waitStatus(t, pb.WatchdogStatus_STOPPED)
+	_assert.Equal(int32(0), s.Restarts)
+	_assert.Equal(int32(1), s.History[0].Code)
+}
+
+func TestBinaryOf(t *testing.T) {
+	_assert := assert.New(t)
+
+	var dir = t.TempDir()
+	BinFile, ImageDir = filepath.Join(dir, "omega"), filepath.Join(dir, "images")
+	upgrade = &pb.Upgrade{}
+	_assert.Nil(os.WriteFile(BinFile, []byte("v3.2.0"), 0755))
+	for _, tag := range []string{"v3.1.0", "v3.2.0"} {
+		_assert.Nil(os.MkdirAll(filepath.Join(ImageDir, tag), 0700))
+		_assert.Nil(os.WriteFile(filepath.Join(ImageDir, tag, "omega"), []byte(tag), 0755))
+	}
+
+	tag, digest := binaryOf()
+	_assert.Equal("v3.2.0", tag)
+	_assert.Equal(fmt.Sprintf("%x", sha256.Sum256([]byte("v3.2.0"))), digest)
+
+	// a binary which isn't pulled by watchdog has no tag
+	_assert.Nil(os.WriteFile(BinFile, []byte("v3.3.0"), 0755))
+	tag, digest = binaryOf()
+	_assert.Equal("", tag)
+	_assert.NotEqual("", digest)
+}
@@ -0,0 +1,87 @@
+package watchdog
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
+	"github.com/eviltomorrow/omega/pkg/file"
+	psutil "github.com/shirou/gopsutil/v3/process"
+)
+
+// usageProc keeps cpu times of omega between calls of Status
+var (
+	usageMut  sync.Mutex
+	usageProc *psutil.Process
+)
+
+// binaryOf returns tag and sha256 of BinFile, the tag is found in ImageDir
+// and is empty if the binary isn't pulled by watchdog.
+func binaryOf() (string, string) {
+	digest, err := file.CalculateSHA256(BinFile)
+	if err != nil {
+		return "", ""
+	}
+
+	upgradeMut.Lock()
+	var last = upgrade
+	upgradeMut.Unlock()
+	if last.Tag != "" {
+		if sha256, err := file.CalculateSHA256(filepath.Join(ImageDir, last.Tag, "omega")); err == nil && sha256 == digest {
+			return last.Tag, digest
+		}
+	}
+
+	info, err := os.Stat(BinFile)
+	if err != nil {
+		return "", digest
+	}
+	entries, err := os.ReadDir(ImageDir)
+	if err != nil {
+		return "", digest
+	}
+	for _, entry := range entries {
+		var path = filepath.Join(ImageDir, entry.Name(), "omega")
+		if fi, err := os.Stat(path); err != nil || fi.Size() != info.Size() {
+			continue
+		}
+		if sha256, err := file.CalculateSHA256(path); err == nil && sha256 == digest {
+			return entry.Name(), digest
+		}
+	}
+	return "", digest
+}
+
+// setUsage sets rss and cpu of omega which runs as pid in s, read from /proc
+func setUsage(s *pb.WatchdogStatus) {
+	usageMut.Lock()
+	defer usageMut.Unlock()
+
+	if s.Pid == 0 {
+		usageProc = nil
+		return
+	}
+	var first bool
+	if usageProc == nil || usageProc.Pid != s.Pid {
+		p, err := psutil.NewProcess(s.Pid)
+		if err != nil {
+			usageProc = nil
+			return
+		}
+		usageProc, first = p, true
+	}
+
+	if mem, err := usageProc.MemoryInfo(); err == nil {
+		s.Rss = mem.RSS
+	}
+	if times, err := usageProc.Times(); err == nil {
+		s.CpuSeconds = times.User + times.System
+	}
+	if first {
+		s.CpuPercent, _ = usageProc.CPUPercent()
+		usageProc.Percent(0)
+	} else {
+		s.CpuPercent, _ = usageProc.Percent(0)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -27,6 +29,31 @@ func (d *Duration) UnmarshalText(text []byte) error {
 	return err
 }
 
+// Size is bytes with optional unit, eg. "512KB", "100MB", "2GB"
+type Size int64
+
+func (s *Size) UnmarshalText(text []byte) error {
+	var (
+		str  = strings.ToUpper(strings.TrimSpace(string(text)))
+		unit = int64(1)
+	)
+	for _, u := range []struct {
+		suffix string
+		unit   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40}, {"B", 1}} {
+		if strings.HasSuffix(str, u.suffix) {
+			str, unit = strings.TrimSpace(strings.TrimSuffix(str, u.suffix)), u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size[%s], nest error: %v", text, err)
+	}
+	*s = Size(n * unit)
+	return nil
+}
+
 func (p Plugin) Byte() []byte {
 	buf, _ := json.Marshal(p)
 	return buf
@@ -38,6 +65,8 @@ type Config struct {
 	Log            Log               `toml:"log" json:"log"`
 	Watchdog       Watchdog          `toml:"watchdog" json:"watchdog"`
 	Agent          Agent             `toml:"agent" json:"agent"`
+	File           File              `toml:"file" json:"file"`
+	Tunnel         Tunnel            `toml:"tunnel" json:"tunnel"`
 	Plugins        map[string]Plugin `toml:"plugins" json:"plugins"`
 }
 
@@ -57,11 +86,54 @@ type Log struct {
 
 type Watchdog struct {
 	GrpcServerPort int `toml:"grpc-server-port" json:"grpc-server-port"`
+	// TrustedKeys are ed25519 public key files or folders of *.pub files
+	TrustedKeys   []string `toml:"trusted-keys" json:"trusted-keys"`
+	AllowUnsigned bool     `toml:"allow-unsigned" json:"allow-unsigned"`
+	// Channel is the hub release channel followed by omega, such as stable
+	Channel            string   `toml:"channel" json:"channel"`
+	ChannelCheckPeriod Duration `toml:"channel-check-period" json:"channel-check-period"`
+	// HealthWindow is how long upgraded omega is probed before the previous
+	// binary is restored, 0 disables rollback
+	HealthWindow Duration `toml:"health-window" json:"health-window"`
+	// RestartBackoff is doubled after every failure of omega in a row up to
+	// RestartMaxBackoff, omega is degraded after CrashLoopThreshold failures
+	RestartBackoff     Duration `toml:"restart-backoff" json:"restart-backoff"`
+	RestartMaxBackoff  Duration `toml:"restart-max-backoff" json:"restart-max-backoff"`
+	CrashLoopThreshold int      `toml:"crash-loop-threshold" json:"crash-loop-threshold"`
+	// MemoryLimit, CPULimit(cores) and NofileLimit limit omega, 0 is unlimited.
+	// Memory and CPU are limited with cgroup v2 in CgroupDir if it is writable
+	MemoryLimit Size    `toml:"memory-limit" json:"memory-limit"`
+	CPULimit    float64 `toml:"cpu-limit" json:"cpu-limit"`
+	NofileLimit uint64  `toml:"nofile-limit" json:"nofile-limit"`
+	CgroupDir   string  `toml:"cgroup-dir" json:"cgroup-dir"`
 }
 
 type Agent struct {
 	GrpcServerPort int      `toml:"grpc-server-port" json:"grpc-server-port"`
 	Period         Duration `toml:"period" json:"period"`
+	// CollectorGroup is the group of omega-collector which metrics are pushed
+	// to, Global.GroupName if it is empty
+	CollectorGroup string `toml:"collector-group" json:"collector-group"`
+}
+
+// File limits what File service can access, relative root paths are based on RootDir
+type File struct {
+	Roots        []Root `toml:"roots" json:"roots"`
+	MaxReadSize  Size   `toml:"max-read-size" json:"max-read-size"`
+	MaxWriteSize Size   `toml:"max-write-size" json:"max-write-size"`
+	UploadQuota  Size   `toml:"upload-quota" json:"upload-quota"`
+}
+
+type Root struct {
+	Path string `toml:"path" json:"path"`
+	// Mode is "ro" or "rw"
+	Mode string `toml:"mode" json:"mode"`
+}
+
+// Tunnel limits what Tunnel service can listen
+type Tunnel struct {
+	// ListenAllow is hosts which remote forwards may bind besides loopback
+	ListenAllow []string `toml:"listen-allow" json:"listen-allow"`
 }
 
 type Collector struct {
@@ -79,6 +151,21 @@ type Hub struct {
 	GrpcServerHost map[string]Addr `toml:"grpc-server-host" json:"grpc-server-host"`
 	Global         Global          `toml:"global" json:"global"`
 	Log            Log             `toml:"log" json:"log"`
+	Replication    Replication     `toml:"replication" json:"replication"`
+	Retention      Retention       `toml:"retention" json:"retention"`
+}
+
+type Replication struct {
+	// Primary is host:port of the hub which is replicated, empty on the primary hub
+	Primary string   `toml:"primary" json:"primary"`
+	Period  Duration `toml:"period" json:"period"`
+}
+
+type Retention struct {
+	// KeepVersions is how many of the highest versions are kept, 0 disables GC
+	KeepVersions int      `toml:"keep-versions" json:"keep-versions"`
+	RunningTTL   Duration `toml:"running-ttl" json:"running-ttl"`
+	Period       Duration `toml:"period" json:"period"`
 }
 
 func (h *Hub) LoadFile(path string) error {
@@ -160,6 +247,21 @@ var DefaultGlobalOmega = &Config{
 	},
 	Watchdog: Watchdog{
 		GrpcServerPort: 28500,
+		TrustedKeys:    []string{"../etc/trusted-keys"},
+		ChannelCheckPeriod: Duration{
+			Duration: 5 * time.Minute,
+		},
+		HealthWindow: Duration{
+			Duration: 30 * time.Second,
+		},
+		RestartBackoff: Duration{
+			Duration: time.Second,
+		},
+		RestartMaxBackoff: Duration{
+			Duration: time.Minute,
+		},
+		CrashLoopThreshold: 5,
+		CgroupDir:          "/sys/fs/cgroup/omega",
 	},
 	Agent: Agent{
 		GrpcServerPort: 28501,
@@ -167,6 +269,15 @@ var DefaultGlobalOmega = &Config{
 			Duration: 60 * time.Second,
 		},
 	},
+	File: File{
+		Roots: []Root{
+			{Path: "..", Mode: "rw"},
+			{Path: "/tmp", Mode: "rw"},
+		},
+		MaxReadSize:  4 << 30,
+		MaxWriteSize: 1 << 30,
+		UploadQuota:  10 << 30,
+	},
 	Plugins: map[string]Plugin{
 		"cpu": map[string]interface{}{
 			"percpu":           false,
@@ -226,4 +337,17 @@ var DefaultGlobalHub = &Hub{
 		},
 		GrpcServerPort: 30588,
 	},
+	Replication: Replication{
+		Period: Duration{
+			Duration: 30 * time.Second,
+		},
+	},
+	Retention: Retention{
+		RunningTTL: Duration{
+			Duration: time.Hour,
+		},
+		Period: Duration{
+			Duration: time.Hour,
+		},
+	},
 }
@@ -1,6 +1,12 @@
 package conf
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+)
 
 func TestLoadConfig(t *testing.T) {
 	var c = &Config{}
@@ -9,3 +15,75 @@ func TestLoadConfig(t *testing.T) {
 	}
 	t.Logf("conf: %v", c)
 }
+
+func TestOverride(t *testing.T) {
+	_assert := assert.New(t)
+
+	var text = `[global]
+etcd-endpoints = [
+    "127.0.0.1:2379",
+]
+group-name = "omega-default"
+
+[watchdog]
+# limits of omega
+memory-limit = "0"
+cpu-limit = 0.0
+`
+	result, err := Override(text, map[string]string{
+		"global.etcd-endpoints": `["10.0.0.1:2379", "10.0.0.2:2379"]`,
+		"watchdog.memory-limit": "512MB",
+		"watchdog.cpu-limit":    "2",
+	})
+	_assert.Nil(err)
+	var c = &Config{}
+	_, err = toml.Decode(result, c)
+	_assert.Nil(err)
+	_assert.Equal([]string{"10.0.0.1:2379", "10.0.0.2:2379"}, c.Global.EtcdEndpoints)
+	_assert.Equal("omega-default", c.Global.GroupName)
+	_assert.Equal(Size(512<<20), c.Watchdog.MemoryLimit)
+	_assert.Equal(2.0, c.Watchdog.CPULimit)
+
+	_, err = Override(text, map[string]string{"watchdog.memory-limt": "512MB"})
+	_assert.NotNil(err)
+	_, err = Override(text, map[string]string{"watchdog.cpu-limit": "two"})
+	_assert.NotNil(err)
+}
+
+func TestOverlay(t *testing.T) {
+	_assert := assert.New(t)
+
+	var base = &Config{
+		Global:  Global{GroupName: "omega-01"},
+		Agent:   Agent{Period: Duration{Duration: time.Minute}},
+		Plugins: map[string]Plugin{"cpu": {"percpu": true}, "mem": {}},
+	}
+	var c = *base
+	_assert.Nil(c.Overlay(`[agent]
+period = "10s"
+collector-group = "collector-02"
+
+[plugins.cpu]
+totalcpu = true
+`))
+	_assert.Equal(10*time.Second, c.Agent.Period.Duration)
+	_assert.Equal("collector-02", c.Agent.CollectorGroup)
+	_assert.Equal(Plugin{"totalcpu": true}, c.Plugins["cpu"])
+	_assert.Contains(c.Plugins, "mem")
+	// base is unchanged
+	_assert.Equal(Plugin{"percpu": true}, base.Plugins["cpu"])
+	_assert.Equal(time.Minute, base.Agent.Period.Duration)
+
+	c = *base
+	_assert.NotNil(c.Overlay(`[global]
+group-name = "omega-02"`))
+	c = *base
+	_assert.NotNil(c.Overlay(`[agent]
+grpc-server-port = 28502`))
+	c = *base
+	_assert.NotNil(c.Overlay(`[agent]
+period = "10ms"`))
+	c = *base
+	_assert.NotNil(c.Overlay(`[agent]
+perod = "10s"`))
+}
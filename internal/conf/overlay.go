@@ -0,0 +1,57 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// reloadable returns whether key of omega.conf may be changed without restart
+func reloadable(key toml.Key) bool {
+	switch key[0] {
+	case "plugins":
+		return true
+	case "agent":
+		return len(key) == 1 || key[1] == "period" || key[1] == "collector-group"
+	default:
+		return false
+	}
+}
+
+// Overlay sets keys of toml text on c, only keys which are reloaded without
+// restart are allowed: agent.period, agent.collector-group and plugins. A
+// plugin in text replaces the plugin of c as a whole.
+func (c *Config) Overlay(text string) error {
+	md, err := toml.Decode(text, &Config{})
+	if err != nil {
+		return fmt.Errorf("decode config failure, nest error: %v", err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) != 0 {
+		return fmt.Errorf("unknown config: %v", undecoded)
+	}
+	var fixed = make([]string, 0, 4)
+	for _, key := range md.Keys() {
+		if !reloadable(key) {
+			fixed = append(fixed, key.String())
+		}
+	}
+	if len(fixed) != 0 {
+		return fmt.Errorf("config can't be changed without restart: %s", strings.Join(fixed, ", "))
+	}
+
+	// plugins of c may be shared with the config which c is copied from
+	var plugins = make(map[string]Plugin, len(c.Plugins))
+	for name, plugin := range c.Plugins {
+		plugins[name] = plugin
+	}
+	c.Plugins = plugins
+	if _, err := toml.Decode(text, c); err != nil {
+		return fmt.Errorf("decode config failure, nest error: %v", err)
+	}
+	if md.IsDefined("agent", "period") && c.Agent.Period.Duration < time.Second {
+		return fmt.Errorf("agent.period[%v] must be 1s at least", c.Agent.Period.Duration)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Override sets keys of config text generated by omega-watchdog config. Keys
+// of sets are <section>.<key>, e.g. watchdog.memory-limit, and a value which
+// isn't a toml value is quoted as a string. Keys which aren't in text are
+// rejected, and the result must be a valid Config.
+func Override(text string, sets map[string]string) (string, error) {
+	if len(sets) == 0 {
+		return text, nil
+	}
+
+	var (
+		lines   = strings.Split(text, "\n")
+		result  = make([]string, 0, len(lines))
+		section string
+		done    = make(map[string]bool, len(sets))
+		skip    bool
+	)
+	for _, line := range lines {
+		var trimmed = strings.TrimSpace(line)
+		if skip {
+			skip = trimmed != "]"
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") && !strings.Contains(trimmed, "=") {
+			section = strings.Trim(trimmed, "[]")
+			result = append(result, line)
+			continue
+		}
+		var idx = strings.Index(trimmed, "=")
+		if idx <= 0 || strings.HasPrefix(trimmed, "#") {
+			result = append(result, line)
+			continue
+		}
+		var (
+			key   = strings.TrimSpace(trimmed[:idx])
+			value = strings.TrimSpace(trimmed[idx+1:])
+			name  = section + "." + key
+		)
+		v, ok := sets[name]
+		if !ok {
+			result = append(result, line)
+			continue
+		}
+		// an array of multiple lines is replaced as a whole
+		skip = strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]")
+		result = append(result, fmt.Sprintf("%s%s = %s", line[:len(line)-len(strings.TrimLeft(line, " \t"))], key, tomlValue(v)))
+		done[name] = true
+	}
+
+	var unknown = make([]string, 0, len(sets))
+	for name := range sets {
+		if !done[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		return "", fmt.Errorf("unknown config: %s", strings.Join(unknown, ", "))
+	}
+
+	text = strings.Join(result, "\n")
+	if _, err := toml.Decode(text, &Config{}); err != nil {
+		return "", fmt.Errorf("invalid config, nest error: %v", err)
+	}
+	return text, nil
+}
+
+func tomlValue(v string) string {
+	var probe map[string]interface{}
+	if _, err := toml.Decode("v = "+v, &probe); err == nil {
+		return v
+	}
+	return strconv.Quote(v)
+}
@@ -0,0 +1,218 @@
+// Package fleet upgrades omega on watchdogs registered in etcd batch by batch
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/agent"
+	"github.com/eviltomorrow/omega/internal/api/watchdog"
+	"github.com/eviltomorrow/omega/internal/api/watchdog/pb"
+	"github.com/eviltomorrow/omega/pkg/self"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var (
+	// AgentPort is used for hosts of which omega is not registered in etcd
+	AgentPort     = 28501
+	DialTimeout   = 5 * time.Second
+	NotifyTimeout = 10 * time.Second
+	// VerifyTimeout is how long a host has to run the tag and pass the health
+	// check of its watchdog after it is started
+	VerifyTimeout = 2 * time.Minute
+	VerifyPeriod  = 2 * time.Second
+)
+
+// Discover returns watchdogs of group which are registered in etcd, all
+// groups if group is empty.
+func Discover(endpoints []string, group string) ([]*Host, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: DialTimeout,
+		LogConfig: &zap.Config{
+			Level:            zap.NewAtomicLevelAt(zap.ErrorLevel),
+			Development:      false,
+			Encoding:         "json",
+			EncoderConfig:    zap.NewProductionEncoderConfig(),
+			OutputPaths:      []string{"stderr"},
+			ErrorOutputPaths: []string{"stderr"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create etcd client failure, nest error: %v", err)
+	}
+	defer client.Close()
+
+	var get = func(service string) (map[string]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), DialTimeout)
+		defer cancel()
+
+		var prefix = fmt.Sprintf("/%s/%s/", self.EtcdKeyPrefix, service)
+		if group != "" {
+			prefix += group + "/"
+		}
+		resp, err := client.Get(ctx, prefix, clientv3.WithPrefix())
+		if err != nil {
+			return nil, fmt.Errorf("get key[%s] with prefix failure, nest error: %v", prefix, err)
+		}
+		var services = make(map[string]string, len(resp.Kvs))
+		for _, kv := range resp.Kvs {
+			services[strings.TrimPrefix(string(kv.Key), fmt.Sprintf("/%s/%s/", self.EtcdKeyPrefix, service))] = string(kv.Value)
+		}
+		return services, nil
+	}
+
+	watchdogs, err := get("omega-watchdog")
+	if err != nil {
+		return nil, err
+	}
+	omegas, err := get("omega")
+	if err != nil {
+		return nil, err
+	}
+	// agents are matched with watchdogs by group and inner ip
+	var agents = make(map[string]string, len(omegas))
+	for key, value := range omegas {
+		if name, ip, ok := splitKey(key); ok {
+			agents[name+"/"+ip] = value
+		}
+	}
+
+	var hosts = make([]*Host, 0, len(watchdogs))
+	for key, value := range watchdogs {
+		name, ip, ok := splitKey(key)
+		if !ok {
+			continue
+		}
+		var h = &Host{Group: name, Watchdog: value, Agent: agents[name+"/"+ip], State: StatePending}
+		if h.Agent == "" {
+			outer, _, err := net.SplitHostPort(value)
+			if err != nil {
+				continue
+			}
+			h.Agent = net.JoinHostPort(outer, strconv.Itoa(AgentPort))
+		}
+		hosts = append(hosts, h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Watchdog < hosts[j].Watchdog })
+	return hosts, nil
+}
+
+// splitKey splits <group>/<inner ip>:<port> of a registered service
+func splitKey(key string) (string, string, bool) {
+	var idx = strings.LastIndex(key, "/")
+	if idx == -1 {
+		return "", "", false
+	}
+	ip, _, err := net.SplitHostPort(key[idx+1:])
+	if err != nil {
+		return "", "", false
+	}
+	return key[:idx], ip, true
+}
+
+// UpgradeHost installs omega of tag with the watchdog of h and restarts it,
+// then waits until the agent reports tag and the watchdog keeps it.
+func UpgradeHost(h *Host, tag string) error {
+	client, destroy, err := watchdog.NewClient(h.Watchdog)
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	if _, err := client.Pull(context.Background(), &wrapperspb.StringValue{Value: tag}); err != nil {
+		return fmt.Errorf("pull image failure, nest error: %v", err)
+	}
+
+	// omega may be stopped already
+	ctx, cancel := context.WithTimeout(context.Background(), NotifyTimeout)
+	client.Notify(ctx, &pb.Signal{Signal: pb.Signal_QUIT})
+	cancel()
+	ctx, cancel = context.WithTimeout(context.Background(), NotifyTimeout)
+	_, err = client.Notify(ctx, &pb.Signal{Signal: pb.Signal_UP})
+	cancel()
+	if err != nil {
+		return fmt.Errorf("start omega failure, nest error: %v", err)
+	}
+
+	var deadline = time.Now().Add(VerifyTimeout)
+	if err := verifyVersion(h, tag, deadline); err != nil {
+		return err
+	}
+	return verifyUpgrade(client, deadline)
+}
+
+// verifyVersion waits until omega of h reports tag with GetVersion
+func verifyVersion(h *Host, tag string, deadline time.Time) error {
+	client, destroy, err := agent.NewClient(h.Agent)
+	if err != nil {
+		return err
+	}
+	defer destroy()
+
+	var last string
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), VerifyPeriod)
+		resp, err := client.GetVersion(ctx, &emptypb.Empty{})
+		cancel()
+		if err == nil {
+			if last = versionOf(resp.Value); last == tag {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("get version of omega failure, nest error: %v", err)
+			}
+			return fmt.Errorf("omega runs %s, not %s", last, tag)
+		}
+		time.Sleep(VerifyPeriod)
+	}
+}
+
+// verifyUpgrade waits until the health check of watchdog finishes, watchdogs
+// without health checks are trusted.
+func verifyUpgrade(client pb.WatchdogClient, deadline time.Time) error {
+	for {
+		upgrade, err := client.LastUpgrade(context.Background(), &emptypb.Empty{})
+		if status.Code(err) == codes.Unimplemented {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get last upgrade failure, nest error: %v", err)
+		}
+		switch upgrade.State {
+		case pb.Upgrade_HEALTHY:
+			return nil
+		case pb.Upgrade_ROLLED_BACK, pb.Upgrade_ROLLBACK_FAILED:
+			return fmt.Errorf("watchdog %s omega, reason: %s", strings.ToLower(strings.Replace(upgrade.State.String(), "_", " ", -1)), upgrade.Reason)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("health check of watchdog doesn't finish, state: %s", upgrade.State)
+		}
+		time.Sleep(VerifyPeriod)
+	}
+}
+
+// versionOf returns the tag in GetVersion of omega, its git tag or main version
+func versionOf(version string) string {
+	var data = make(map[string]string, 7)
+	if err := json.Unmarshal([]byte(version), &data); err != nil {
+		return ""
+	}
+	if tag := data["Git Tag"]; strings.HasPrefix(tag, "v") {
+		return tag
+	}
+	return data["Current Version"]
+}
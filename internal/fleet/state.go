@@ -0,0 +1,127 @@
+package fleet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatePending  = "pending"
+	StateUpgraded = "upgraded"
+	StateFailed   = "failed"
+)
+
+// Host is a watchdog discovered in etcd and the agent of omega beside it
+type Host struct {
+	Group    string `json:"group"`
+	Watchdog string `json:"watchdog"`
+	Agent    string `json:"agent"`
+	State    string `json:"state"`
+	Error    string `json:"error,omitempty"`
+	Time     int64  `json:"time,omitempty"`
+}
+
+// State is the progress of upgrading a fleet to Tag, it is saved after every
+// host, so that an interrupted or stopped upgrade is resumed from it.
+type State struct {
+	Tag     string  `json:"tag"`
+	Group   string  `json:"group"`
+	Hosts   []*Host `json:"hosts"`
+	Stopped string  `json:"stopped,omitempty"`
+
+	path string
+	mut  sync.Mutex
+}
+
+// LoadState loads the state of upgrading group to tag from path, a new state
+// is returned if path doesn't exist.
+func LoadState(path string, tag string, group string) (*State, error) {
+	var s = &State{Tag: tag, Group: group, path: path}
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, s); err != nil {
+		return nil, fmt.Errorf("parse state file[%s] failure, nest error: %v", path, err)
+	}
+	if s.Tag != tag || s.Group != group {
+		return nil, fmt.Errorf("state file[%s] is upgrading group[%s] to %s, remove it to start another upgrade", path, s.Group, s.Tag)
+	}
+	return s, nil
+}
+
+// Merge adds hosts which are not in state yet, agents of hosts which are not
+// upgraded are updated.
+func (s *State) Merge(hosts []*Host) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var known = make(map[string]*Host, len(s.Hosts))
+	for _, h := range s.Hosts {
+		known[h.Watchdog] = h
+	}
+	for _, h := range hosts {
+		if old, ok := known[h.Watchdog]; ok {
+			if old.State != StateUpgraded {
+				old.Agent = h.Agent
+			}
+			continue
+		}
+		s.Hosts = append(s.Hosts, &Host{Group: h.Group, Watchdog: h.Watchdog, Agent: h.Agent, State: StatePending})
+	}
+	sort.SliceStable(s.Hosts, func(i, j int) bool { return s.Hosts[i].Watchdog < s.Hosts[j].Watchdog })
+}
+
+// Count returns how many hosts are in state
+func (s *State) Count(state string) int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var n int
+	for _, h := range s.Hosts {
+		if h.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *State) finish(h *Host, err error) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	h.State, h.Error, h.Time = StateUpgraded, "", time.Now().Unix()
+	if err != nil {
+		h.State, h.Error = StateFailed, err.Error()
+	}
+	return s.save()
+}
+
+func (s *State) stop(reason string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.Stopped = reason
+	return s.save()
+}
+
+// save writes state to its file, the caller holds mut
+func (s *State) save() error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	var tmp = s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
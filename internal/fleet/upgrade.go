@@ -0,0 +1,150 @@
+package fleet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options controls how a fleet is upgraded
+type Options struct {
+	// Batch is how many hosts are upgraded at the same time, "10%" of hosts or "5"
+	Batch string
+	// Pause is waited between batches
+	Pause time.Duration
+	// Threshold stops the upgrade once failed hosts pass it, "10%" of upgraded
+	// hosts or "3"
+	Threshold string
+	// Progress is called after every host is upgraded or failed
+	Progress func(batch, batches int, h *Host)
+}
+
+// Amount is a count of hosts or a percent of them
+type Amount struct {
+	Value   float64
+	Percent bool
+}
+
+// ParseAmount parses "10%" or "5"
+func ParseAmount(s string) (Amount, error) {
+	var (
+		a    Amount
+		text = strings.TrimSpace(s)
+	)
+	if strings.HasSuffix(text, "%") {
+		a.Percent, text = true, strings.TrimSuffix(text, "%")
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil || v < 0 || (a.Percent && v > 100) {
+		return a, fmt.Errorf("invalid amount[%s], expect: 10%% or 5", s)
+	}
+	a.Value = v
+	return a, nil
+}
+
+// Of returns the amount of total hosts, rounded up
+func (a Amount) Of(total int) int {
+	if !a.Percent {
+		return int(a.Value)
+	}
+	var n = int(a.Value * float64(total) / 100)
+	if float64(n)*100 < a.Value*float64(total) {
+		n++
+	}
+	return n
+}
+
+// Upgrade runs upgrade on hosts of state which are not upgraded yet, batch by
+// batch. Failed hosts of a stopped upgrade are retried. It stops after the
+// batch in which failures pass the threshold.
+func Upgrade(s *State, opts Options, upgrade func(*Host) error) error {
+	batch, err := ParseAmount(opts.Batch)
+	if err != nil {
+		return err
+	}
+	threshold, err := ParseAmount(opts.Threshold)
+	if err != nil {
+		return err
+	}
+
+	var todo = make([]*Host, 0, len(s.Hosts))
+	for _, h := range s.Hosts {
+		if h.State != StateUpgraded {
+			todo = append(todo, h)
+		}
+	}
+	var size = batch.Of(len(s.Hosts))
+	if size < 1 {
+		size = 1
+	}
+	var batches = (len(todo) + size - 1) / size
+	if err := s.stop(""); err != nil {
+		return err
+	}
+
+	var attempted, failed int
+	for i := 0; i < batches; i++ {
+		if i != 0 && opts.Pause > 0 {
+			time.Sleep(opts.Pause)
+		}
+
+		var (
+			hosts   = todo[i*size : min(len(todo), (i+1)*size)]
+			wg      sync.WaitGroup
+			mut     sync.Mutex
+			saveErr error
+		)
+		for _, h := range hosts {
+			wg.Add(1)
+			go func(h *Host) {
+				defer wg.Done()
+
+				var err = upgrade(h)
+				mut.Lock()
+				defer mut.Unlock()
+				attempted++
+				if err != nil {
+					failed++
+				}
+				if err := s.finish(h, err); err != nil {
+					saveErr = err
+				}
+				if opts.Progress != nil {
+					opts.Progress(i+1, batches, h)
+				}
+			}(h)
+		}
+		wg.Wait()
+		if saveErr != nil {
+			return fmt.Errorf("save state failure, nest error: %v", saveErr)
+		}
+
+		if passed(threshold, failed, attempted) {
+			var reason = fmt.Sprintf("%d of %d hosts failed, threshold is %s", failed, attempted, opts.Threshold)
+			if err := s.stop(reason); err != nil {
+				return err
+			}
+			return fmt.Errorf("upgrade is stopped, %s", reason)
+		}
+	}
+	return nil
+}
+
+func passed(threshold Amount, failed, attempted int) bool {
+	if failed == 0 {
+		return false
+	}
+	if threshold.Percent {
+		return float64(failed)*100 > threshold.Value*float64(attempted)
+	}
+	return float64(failed) > threshold.Value
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+package fleet
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAmount(t *testing.T) {
+	_assert := assert.New(t)
+
+	a, err := ParseAmount("10%")
+	_assert.Nil(err)
+	_assert.Equal(1, a.Of(3))
+	_assert.Equal(2, a.Of(11))
+	_assert.Equal(10, a.Of(100))
+	a, err = ParseAmount("5")
+	_assert.Nil(err)
+	_assert.Equal(5, a.Of(100))
+
+	for _, s := range []string{"", "ten", "-1", "120%"} {
+		_, err = ParseAmount(s)
+		_assert.NotNil(err, s)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		path  = filepath.Join(t.TempDir(), "fleet.json")
+		hosts = make([]*Host, 0, 10)
+	)
+	for i := 0; i < 10; i++ {
+		hosts = append(hosts, &Host{Group: "omega-default", Watchdog: fmt.Sprintf("10.0.0.%d:28500", i)})
+	}
+	s, err := LoadState(path, "v3.2.0", "omega-default")
+	_assert.Nil(err)
+	s.Merge(hosts)
+
+	// hosts after the third one fail, the upgrade stops after the batch in
+	// which 20% of upgraded hosts failed
+	var (
+		mut      sync.Mutex
+		upgraded []string
+		batches  []int
+	)
+	var opts = Options{Batch: "20%", Threshold: "20%", Progress: func(batch, total int, h *Host) {
+		batches = append(batches, batch)
+	}}
+	err = Upgrade(s, opts, func(h *Host) error {
+		mut.Lock()
+		defer mut.Unlock()
+		if h.Watchdog >= "10.0.0.3" {
+			return fmt.Errorf("omega runs v3.1.0, not v3.2.0")
+		}
+		upgraded = append(upgraded, h.Watchdog)
+		return nil
+	})
+	_assert.NotNil(err)
+	_assert.Equal([]int{1, 1, 2, 2}, batches)
+	_assert.Equal(3, s.Count(StateUpgraded))
+	_assert.Equal(1, s.Count(StateFailed))
+
+	// the upgrade is resumed from state file, failed hosts are retried
+	s, err = LoadState(path, "v3.2.0", "omega-default")
+	_assert.Nil(err)
+	_assert.Contains(s.Stopped, "1 of 4 hosts failed")
+	s.Merge(append(hosts, &Host{Group: "omega-default", Watchdog: "10.0.0.10:28500"}))
+	upgraded = upgraded[:0]
+	_assert.Nil(Upgrade(s, Options{Batch: "3", Threshold: "1"}, func(h *Host) error {
+		mut.Lock()
+		defer mut.Unlock()
+		upgraded = append(upgraded, h.Watchdog)
+		return nil
+	}))
+	_assert.Equal(8, len(upgraded))
+	_assert.NotContains(upgraded, "10.0.0.0:28500")
+	_assert.Equal(11, s.Count(StateUpgraded))
+	_assert.Equal("", s.Stopped)
+
+	_, err = LoadState(path, "v3.3.0", "omega-default")
+	_assert.NotNil(err)
+}
@@ -0,0 +1,496 @@
+// Package installer installs omega on a host over ssh step by step. Every
+// step may be run again on a host which is installed already or of which a
+// former install failed, and steps which are done are rolled back in reverse
+// order once a step fails.
+package installer
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/hub"
+	"github.com/eviltomorrow/omega/pkg/file"
+)
+
+// Remote is the ssh connection to a host, it is *file.SCP
+type Remote interface {
+	Upload(localFile, remoteFile string) error
+	Run(c string, timeout time.Duration) ([]byte, []byte, error)
+}
+
+// steps of an install
+const (
+	StepUpload  = "upload"
+	StepStop    = "stop"
+	StepUnpack  = "unpack"
+	StepConfig  = "config"
+	StepKeys    = "keys"
+	StepFolders = "folders"
+	StepStart   = "start"
+	StepVerify  = "verify"
+)
+
+// states of a step reported to Progress
+const (
+	StateDone           = "done"
+	StateSkipped        = "skipped"
+	StateFailed         = "failed"
+	StateRolledBack     = "rolled back"
+	StateRollbackFailed = "rollback failed"
+)
+
+var (
+	// Timeout is how long a command of a step has to finish
+	Timeout = 30 * time.Second
+	// StopTimeout is how long omega-watchdog and omega have to exit after SIGQUIT
+	StopTimeout = 10 * time.Second
+	// StartTimeout is how long omega-watchdog has to start omega
+	StartTimeout = 30 * time.Second
+	// VerifyTimeout is how long omega-watchdog and omega have to register in etcd
+	VerifyTimeout = 30 * time.Second
+	VerifyPeriod  = time.Second
+)
+
+// Target is where and how omega is installed
+type Target struct {
+	InnerIP string
+	// OuterIP is InnerIP if it is empty
+	OuterIP   string
+	HomeDir   string
+	Endpoints string
+	Group     string
+	// Config overrides omega.conf generated by omega-watchdog config, keys are
+	// <section>.<key>
+	Config map[string]string
+	// TrustedKeys are local *.pub files of omega-ctl hub keygen, they are put
+	// in etc/trusted-keys beside keys of the former install
+	TrustedKeys []string
+}
+
+// Installer installs image on Remote, it is used once
+type Installer struct {
+	Remote Remote
+	Target Target
+	// Image is the local omega.tar.gz
+	Image string
+	// Registered reports whether omega-watchdog and omega of Target are
+	// registered in etcd, the verify step is skipped if it is nil
+	Registered func() (bool, error)
+	// Progress is called after a step is done, skipped, failed or rolled back
+	Progress func(step, state, info string)
+
+	uploaded bool
+	stopped  bool
+	started  bool
+}
+
+type step struct {
+	name string
+	// do returns false if nothing is changed
+	do   func() (bool, string, error)
+	undo func() error
+}
+
+// Install runs steps in order, it returns info of steps. Once a step fails,
+// it and steps before it are rolled back.
+func (i *Installer) Install() (string, error) {
+	if !filepath.IsAbs(i.Target.HomeDir) {
+		return "", fmt.Errorf("home_dir[%s] must be absolute", i.Target.HomeDir)
+	}
+
+	var (
+		steps = []step{
+			{StepUpload, i.upload, i.undoUpload},
+			{StepStop, i.stop, i.undoStop},
+			{StepUnpack, i.unpack, i.undoUnpack},
+			{StepConfig, i.config, nil},
+			{StepKeys, i.keys, nil},
+			{StepFolders, i.folders, nil},
+			{StepStart, i.start, i.undoStart},
+			{StepVerify, i.verify, nil},
+		}
+		infos = make([]string, 0, len(steps))
+	)
+	for n, s := range steps {
+		changed, info, err := s.do()
+		if err != nil {
+			i.progress(s.name, StateFailed, err.Error())
+			i.rollback(steps[:n+1])
+			return strings.Join(infos, ", "), fmt.Errorf("%s failure, nest error: %v", s.name, err)
+		}
+		if changed {
+			i.progress(s.name, StateDone, info)
+		} else {
+			i.progress(s.name, StateSkipped, info)
+		}
+		if info != "" {
+			infos = append(infos, fmt.Sprintf("%s: %s", s.name, info))
+		}
+	}
+
+	// the former install is kept until now for rollback
+	if _, err := i.run(fmt.Sprintf("rm -rf %s", Quote(i.path("omega.bak"))), Timeout); err != nil {
+		infos = append(infos, fmt.Sprintf("cleanup: %v", err))
+	}
+	return strings.Join(infos, ", "), nil
+}
+
+func (i *Installer) rollback(steps []step) {
+	for n := len(steps) - 1; n >= 0; n-- {
+		var s = steps[n]
+		if s.undo == nil {
+			continue
+		}
+		if err := s.undo(); err != nil {
+			i.progress(s.name, StateRollbackFailed, err.Error())
+		} else {
+			i.progress(s.name, StateRolledBack, "")
+		}
+	}
+}
+
+func (i *Installer) progress(step, state, info string) {
+	if i.Progress != nil {
+		i.Progress(step, state, info)
+	}
+}
+
+func (i *Installer) path(name string) string {
+	return filepath.Join(i.Target.HomeDir, name)
+}
+
+// upload copies the image to home_dir/omega.tar.gz unless it is there already
+func (i *Installer) upload() (bool, string, error) {
+	local, err := file.CalculateMD5(i.Image)
+	if err != nil {
+		return false, "", err
+	}
+	var tarball = i.path("omega.tar.gz")
+	output, err := i.run(fmt.Sprintf("[ -e %[1]s ] && md5sum %[1]s | awk '{print $1}'; exit 0", Quote(tarball)), Timeout)
+	if err != nil {
+		return false, "", err
+	}
+	if strings.TrimSpace(output) == local {
+		return false, fmt.Sprintf("md5 %s", local), nil
+	}
+
+	// the image is uploaded into a temp dir, so that a broken upload never
+	// replaces omega.tar.gz
+	var tmp = i.path(".omega-upload")
+	if _, err := i.run(fmt.Sprintf("rm -rf %[1]s && mkdir -p %[1]s", Quote(tmp)), Timeout); err != nil {
+		return false, "", err
+	}
+	i.uploaded = strings.TrimSpace(output) == ""
+	if err := i.Remote.Upload(i.Image, filepath.Join(tmp, filepath.Base(i.Image))); err != nil {
+		return false, "", err
+	}
+	if _, err := i.run(fmt.Sprintf("mv -f %s %s && rm -rf %s", Quote(filepath.Join(tmp, filepath.Base(i.Image))), Quote(tarball), Quote(tmp)), Timeout); err != nil {
+		return false, "", err
+	}
+	return true, fmt.Sprintf("md5 %s", local), nil
+}
+
+func (i *Installer) undoUpload() error {
+	var files = []string{Quote(i.path(".omega-upload"))}
+	if i.uploaded {
+		files = append(files, Quote(i.path("omega.tar.gz")))
+	}
+	_, err := i.run(fmt.Sprintf("rm -rf %s", strings.Join(files, " ")), Timeout)
+	return err
+}
+
+// stop stops omega-watchdog and omega of the former install
+func (i *Installer) stop() (bool, string, error) {
+	running, err := Stop(i.Remote, i.path("omega"))
+	if err != nil {
+		return false, "", err
+	}
+	if len(running) == 0 {
+		return false, "not running", nil
+	}
+	i.stopped = true
+	return true, fmt.Sprintf("[%s]", strings.Join(running, " ")), nil
+}
+
+// Stop stops omega-watchdog and omega installed in home on remote, it returns
+// names of those which were running
+func Stop(remote Remote, home string) ([]string, error) {
+	output, err := Run(remote, StopScript(home), StopTimeout+Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+// StopScript returns the script of Stop, which sends SIGQUIT to omega-watchdog
+// and omega in home and kills them if they don't exit in StopTimeout
+func StopScript(home string) string {
+	return fmt.Sprintf(`cd %s 2> /dev/null || exit 0
+%s
+running=""
+for name in omega-watchdog omega; do
+    alive ${name} && running="${running} ${name}"
+done
+[ -z "${running}" ] && exit 0
+unit=/etc/systemd/system/omega-watchdog.service
+if [ -e ${unit} ] && grep -qxF %s ${unit}; then
+    systemctl stop omega-watchdog > /dev/null 2>&1
+fi
+for name in omega-watchdog omega; do
+    alive ${name} && kill -3 $(cat var/run/${name}.pid)
+done
+i=0
+while [ ${i} -lt %d ]; do
+    alive omega-watchdog || alive omega || { echo ${running}; exit 0; }
+    sleep 1
+    i=$((i+1))
+done
+for name in omega-watchdog omega; do
+    alive ${name} && kill -9 $(cat var/run/${name}.pid)
+done
+echo ${running}`, Quote(home), aliveFunc, Quote("WorkingDirectory="+filepath.Join(home, "bin")), int(StopTimeout/time.Second))
+}
+
+// undoStop starts the former install again, it is restored by undoUnpack
+func (i *Installer) undoStop() error {
+	if !i.stopped {
+		return nil
+	}
+	_, _, err := i.start()
+	return err
+}
+
+// unpack moves the former install to omega.bak and unpacks the image into
+// omega. Files in etc which the image doesn't have and logs are kept.
+func (i *Installer) unpack() (bool, string, error) {
+	output, err := i.run(fmt.Sprintf(`cd %s || exit 1
+if [ -e omega.bak ]; then
+    # a former install was interrupted, omega.bak is the last complete one
+    rm -rf omega || exit 1
+elif [ -e omega ]; then
+    mv omega omega.bak || exit 1
+fi
+rm -rf .omega-unpack && mkdir .omega-unpack || exit 1
+tar -xzf omega.tar.gz --no-same-owner -C .omega-unpack || exit 1
+[ -e .omega-unpack/omega/bin/omega-watchdog ] || { echo "omega/bin/omega-watchdog not exist in image"; exit 1; }
+mv .omega-unpack/omega omega && rm -rf .omega-unpack || exit 1
+chmod a+x omega/bin/* || exit 1
+if [ -d omega.bak ]; then
+    for f in omega.bak/etc/*; do
+        [ -e "${f}" ] && [ ! -e "omega/etc/${f##*/}" ] && { cp -a "${f}" omega/etc/ || exit 1; }
+    done
+    if [ -d omega.bak/log ]; then
+        rm -rf omega/log && cp -a omega.bak/log omega/log && rm -f omega/log/error.log || exit 1
+    fi
+    echo upgrade
+fi
+exit 0`, Quote(i.Target.HomeDir)), Timeout)
+	if err != nil {
+		return false, "", err
+	}
+	if strings.TrimSpace(output) == "upgrade" {
+		return true, "upgrade, former install is kept in omega.bak", nil
+	}
+	return true, "fresh install", nil
+}
+
+// undoUnpack restores the former install, or removes omega if there is none
+func (i *Installer) undoUnpack() error {
+	_, err := i.run(fmt.Sprintf(`cd %s || exit 1
+if [ -e omega.bak ]; then
+    rm -rf omega .omega-unpack && mv omega.bak omega
+else
+    rm -rf omega .omega-unpack
+fi`, Quote(i.Target.HomeDir)), Timeout)
+	return err
+}
+
+// Attrs returns arguments of omega-watchdog config for t
+func (t Target) Attrs() string {
+	var outer = t.OuterIP
+	if outer == "" {
+		outer = t.InnerIP
+	}
+	var attrs = []string{
+		"--inner_ip", Quote(t.InnerIP),
+		"--outer_ip", Quote(outer),
+		"--endpoints", Quote(t.Endpoints),
+		"--group", Quote(t.Group),
+	}
+	var keys = make([]string, 0, len(t.Config))
+	for key := range t.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attrs = append(attrs, "--set", Quote(key+"="+t.Config[key]))
+	}
+	return strings.Join(attrs, " ")
+}
+
+// config writes etc/omega.conf with omega-watchdog config
+func (i *Installer) config() (bool, string, error) {
+	output, err := i.run(fmt.Sprintf(`cd %s || exit 1
+./bin/omega-watchdog config %s > etc/omega.conf.tmp || { cat etc/omega.conf.tmp; rm -f etc/omega.conf.tmp; exit 1; }
+mv -f etc/omega.conf.tmp etc/omega.conf || exit 1
+if [ -e ../omega.bak/etc/omega.conf ] && cmp -s etc/omega.conf ../omega.bak/etc/omega.conf; then
+    echo unchanged
+fi
+exit 0`, Quote(i.path("omega")), i.Target.Attrs()), Timeout)
+	if err != nil {
+		return false, "", err
+	}
+	if strings.TrimSpace(output) == "unchanged" {
+		return false, "unchanged", nil
+	}
+	return true, "etc/omega.conf", nil
+}
+
+// keys uploads TrustedKeys into etc/trusted-keys, omega-watchdog verifies
+// images pulled from hub with them
+func (i *Installer) keys() (bool, string, error) {
+	if len(i.Target.TrustedKeys) == 0 {
+		return false, "", nil
+	}
+	for _, key := range i.Target.TrustedKeys {
+		if filepath.Ext(key) != ".pub" {
+			return false, "", fmt.Errorf("trusted key[%s] must be named *.pub", key)
+		}
+	}
+	if _, err := hub.LoadPublicKeys(i.Target.TrustedKeys); err != nil {
+		return false, "", err
+	}
+
+	var dir = i.path("omega/etc/trusted-keys")
+	if _, err := i.run(fmt.Sprintf("mkdir -p %s", Quote(dir)), Timeout); err != nil {
+		return false, "", err
+	}
+	var names = make([]string, 0, len(i.Target.TrustedKeys))
+	for _, key := range i.Target.TrustedKeys {
+		if err := i.Remote.Upload(key, filepath.Join(dir, filepath.Base(key))); err != nil {
+			return false, "", err
+		}
+		names = append(names, filepath.Base(key))
+	}
+	return true, fmt.Sprintf("[%s]", strings.Join(names, " ")), nil
+}
+
+// folders creates folders which omega-watchdog and omega write to
+func (i *Installer) folders() (bool, string, error) {
+	output, err := i.run(fmt.Sprintf(`cd %s || exit 1
+for dir in var/run var/images log; do
+    [ -d ${dir} ] && continue
+    mkdir -p ${dir} || exit 1
+    echo ${dir}
+done`, Quote(i.path("omega"))), Timeout)
+	if err != nil {
+		return false, "", err
+	}
+	var created = strings.Fields(output)
+	if len(created) == 0 {
+		return false, "", nil
+	}
+	return true, fmt.Sprintf("[%s]", strings.Join(created, " ")), nil
+}
+
+// start starts omega-watchdog with systemd if it has a unit, or as a daemon,
+// and waits until omega is started
+func (i *Installer) start() (bool, string, error) {
+	// omega-watchdog may be started even if it fails to start omega
+	i.started = true
+	output, err := i.run(fmt.Sprintf(`cd %s || exit 1
+%s
+if alive omega-watchdog && alive omega; then
+    echo running
+else
+    rm -f log/error.log
+    unit=/etc/systemd/system/omega-watchdog.service
+    if [ -e ${unit} ] && grep -qxF %s ${unit}; then
+        systemctl restart omega-watchdog || exit 1
+    else
+        (cd bin && ./omega-watchdog --daemon) || exit 1
+    fi
+fi
+i=0
+while [ ${i} -lt %d ]; do
+    if [ -s log/error.log ]; then
+        tail -n 1 log/error.log
+        exit 1
+    fi
+    if alive omega-watchdog && alive omega; then
+        echo "omega-watchdog: $(cat var/run/omega-watchdog.pid) omega: $(cat var/run/omega.pid)"
+        exit 0
+    fi
+    sleep 1
+    i=$((i+1))
+done
+echo "omega isn't started in %s"
+exit 1`, Quote(i.path("omega")), aliveFunc, Quote("WorkingDirectory="+i.path("omega/bin")), int(StartTimeout/time.Second), StartTimeout), StartTimeout+Timeout)
+	if err != nil {
+		return false, "", err
+	}
+	var lines = strings.Split(strings.TrimSpace(output), "\n")
+	if lines[0] == "running" {
+		return false, lines[len(lines)-1], nil
+	}
+	return true, lines[len(lines)-1], nil
+}
+
+// undoStart stops omega-watchdog and omega which are started
+func (i *Installer) undoStart() error {
+	if !i.started {
+		return nil
+	}
+	_, _, err := i.stop()
+	return err
+}
+
+// verify waits until omega-watchdog and omega are registered in etcd
+func (i *Installer) verify() (bool, string, error) {
+	if i.Registered == nil {
+		return false, "", nil
+	}
+	var deadline = time.Now().Add(VerifyTimeout)
+	for {
+		ok, err := i.Registered()
+		if err == nil && ok {
+			return true, "registered in etcd", nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return false, "", err
+			}
+			return false, "", fmt.Errorf("omega-watchdog and omega aren't registered in etcd in %v", VerifyTimeout)
+		}
+		time.Sleep(VerifyPeriod)
+	}
+}
+
+// aliveFunc reports whether the process of pid file var/run/$1.pid is running,
+// zombies which aren't reaped, e.g. by init of containers, are dead
+const aliveFunc = `alive() {
+    pid=$(cat var/run/$1.pid 2> /dev/null) && kill -0 ${pid} 2> /dev/null && [ "$(cut -d' ' -f3 /proc/${pid}/stat 2> /dev/null)" != "Z" ]
+}`
+
+// run runs script with sh on Remote, and returns its output
+func (i *Installer) run(script string, timeout time.Duration) (string, error) {
+	return Run(i.Remote, script, timeout)
+}
+
+// Run runs script with sh on remote, and returns its output
+func Run(remote Remote, script string, timeout time.Duration) (string, error) {
+	stdout, stderr, err := remote.Run(fmt.Sprintf("sh -c %s", Quote(script)), timeout)
+	var output = string(stdout) + string(stderr)
+	if err != nil {
+		return output, fmt.Errorf("error: %v, output: %s", err, strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
+// Quote quotes s as a single argument of sh
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
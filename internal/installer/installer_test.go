@@ -0,0 +1,221 @@
+package installer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/api/hub"
+	"github.com/stretchr/testify/assert"
+)
+
+// local runs steps on this host
+type local struct{}
+
+func (local) Upload(localFile, remoteFile string) error {
+	buf, err := ioutil.ReadFile(localFile)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(filepath.Dir(remoteFile), filepath.Base(localFile)), buf, 0644)
+}
+
+func (local) Run(c string, timeout time.Duration) ([]byte, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "sh", "-c", c).CombinedOutput()
+	return output, nil, err
+}
+
+// watchdog is omega-watchdog of test images, it starts sleeps as omega-watchdog
+// and omega, or fails to start with error.log if broken
+const watchdog = `#!/bin/sh
+case "$1" in
+config)
+    shift
+    echo "# %s"
+    echo "args = \"$*\""
+    ;;
+--daemon)
+    cd ..
+    if [ "%s" = "broken" ]; then
+        echo "listen tcp :28500: bind: address already in use" > log/error.log
+        exit 0
+    fi
+    sleep 300 > /dev/null 2>&1 &
+    echo $! > var/run/omega-watchdog.pid
+    sleep 300 > /dev/null 2>&1 &
+    echo $! > var/run/omega.pid
+    ;;
+esac
+`
+
+func image(t *testing.T, version string) string {
+	var dir = t.TempDir()
+	for _, name := range []string{"omega/bin", "omega/etc"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var script = strings.Replace(strings.Replace(watchdog, "%s", version, 1), "%s", version, 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "omega/bin/omega-watchdog"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := exec.Command("tar", "-czf", filepath.Join(dir, "omega.tar.gz"), "-C", dir, "omega").CombinedOutput(); err != nil {
+		t.Fatalf("tar failure: %v, %s", err, output)
+	}
+	return filepath.Join(dir, "omega.tar.gz")
+}
+
+func pidOf(home, name string) int {
+	buf, err := ioutil.ReadFile(filepath.Join(home, "omega/var/run", name+".pid"))
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(buf)))
+	return pid
+}
+
+// alive reports whether pid is running, a zombie which isn't reaped by init
+// of containers is dead
+func alive(pid int) bool {
+	if pid <= 0 || syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	buf, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	var fields = strings.Fields(string(buf[strings.LastIndex(string(buf), ")")+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func installTest(t *testing.T) (string, *[]string) {
+	StopTimeout, StartTimeout, VerifyPeriod = time.Second, 5*time.Second, 10*time.Millisecond
+	var home = t.TempDir()
+	t.Cleanup(func() {
+		for _, name := range []string{"omega-watchdog", "omega"} {
+			if pid := pidOf(home, name); pid > 0 {
+				syscall.Kill(pid, syscall.SIGKILL)
+			}
+		}
+	})
+	var progress = make([]string, 0, 16)
+	return home, &progress
+}
+
+func newInstaller(home string, progress *[]string, image string) *Installer {
+	*progress = (*progress)[:0]
+	return &Installer{
+		Remote: local{},
+		Target: Target{
+			InnerIP:   "10.0.0.1",
+			HomeDir:   home,
+			Endpoints: "10.0.0.100:2379",
+			Group:     "omega-01",
+			Config:    map[string]string{"watchdog.memory-limit": "512MB"},
+		},
+		Image:      image,
+		Registered: func() (bool, error) { return true, nil },
+		Progress: func(step, state, info string) {
+			*progress = append(*progress, step+" "+state)
+		},
+	}
+}
+
+func TestInstall(t *testing.T) {
+	_assert := assert.New(t)
+	var (
+		home, progress = installTest(t)
+		v1             = image(t, "v1")
+	)
+
+	// fresh install
+	_, err := newInstaller(home, progress, v1).Install()
+	_assert.Nil(err)
+	_assert.Equal([]string{"upload done", "stop skipped", "unpack done", "config done", "keys skipped", "folders done", "start done", "verify done"}, *progress)
+	conf, err := ioutil.ReadFile(filepath.Join(home, "omega/etc/omega.conf"))
+	_assert.Nil(err)
+	_assert.Contains(string(conf), "--inner_ip 10.0.0.1 --outer_ip 10.0.0.1 --endpoints 10.0.0.100:2379 --group omega-01 --set watchdog.memory-limit=512MB")
+	var pid = pidOf(home, "omega")
+	_assert.True(alive(pid))
+
+	// install again, files of etc are kept, and trusted keys are put beside them
+	_assert.Nil(os.MkdirAll(filepath.Join(home, "omega/etc/trusted-keys"), 0755))
+	_assert.Nil(ioutil.WriteFile(filepath.Join(home, "omega/etc/trusted-keys/old.pub"), []byte("key"), 0644))
+	var key = filepath.Join(t.TempDir(), "release")
+	_, err = hub.GenerateKey(key)
+	_assert.Nil(err)
+	var i = newInstaller(home, progress, v1)
+	i.Target.TrustedKeys = []string{key + ".pub"}
+	_, err = i.Install()
+	_assert.Nil(err)
+	_assert.Equal([]string{"upload skipped", "stop done", "unpack done", "config skipped", "keys done", "folders done", "start done", "verify done"}, *progress)
+	_assert.False(alive(pid))
+	_assert.True(alive(pidOf(home, "omega")))
+	_assert.FileExists(filepath.Join(home, "omega/etc/trusted-keys/old.pub"))
+	_assert.FileExists(filepath.Join(home, "omega/etc/trusted-keys/release.pub"))
+
+	// a private key isn't a trusted key
+	i = newInstaller(home, progress, v1)
+	i.Target.TrustedKeys = []string{key}
+	_, err = i.Install()
+	_assert.NotNil(err)
+	_assert.Contains(err.Error(), "*.pub")
+	_assert.True(alive(pidOf(home, "omega")))
+	_assert.NoDirExists(filepath.Join(home, "omega.bak"))
+
+	// uninstall stops it the same way
+	pid = pidOf(home, "omega")
+	running, err := Stop(local{}, filepath.Join(home, "omega"))
+	_assert.Nil(err)
+	_assert.Equal([]string{"omega-watchdog", "omega"}, running)
+	_assert.False(alive(pid))
+	running, err = Stop(local{}, filepath.Join(home, "omega"))
+	_assert.Nil(err)
+	_assert.Empty(running)
+}
+
+func TestInstallRollback(t *testing.T) {
+	_assert := assert.New(t)
+	var home, progress = installTest(t)
+
+	// a failed fresh install leaves nothing
+	_, err := newInstaller(home, progress, image(t, "broken")).Install()
+	_assert.NotNil(err)
+	_assert.Contains(err.Error(), "address already in use")
+	_assert.Equal([]string{"upload done", "stop skipped", "unpack done", "config done", "keys skipped", "folders done", "start failed",
+		"start rolled back", "unpack rolled back", "stop rolled back", "upload rolled back"}, *progress)
+	_assert.NoDirExists(filepath.Join(home, "omega"))
+	_assert.NoFileExists(filepath.Join(home, "omega.tar.gz"))
+
+	// a failed upgrade restores and starts the former install
+	_, err = newInstaller(home, progress, image(t, "v1")).Install()
+	_assert.Nil(err)
+	_, err = newInstaller(home, progress, image(t, "broken")).Install()
+	_assert.NotNil(err)
+	conf, err := ioutil.ReadFile(filepath.Join(home, "omega/etc/omega.conf"))
+	_assert.Nil(err)
+	_assert.Contains(string(conf), "# v1")
+	_assert.True(alive(pidOf(home, "omega-watchdog")))
+	_assert.True(alive(pidOf(home, "omega")))
+	_assert.NoDirExists(filepath.Join(home, "omega.bak"))
+
+	// omega isn't registered in etcd
+	var i = newInstaller(home, progress, image(t, "v2"))
+	VerifyTimeout = 100 * time.Millisecond
+	i.Registered = func() (bool, error) { return false, nil }
+	_, err = i.Install()
+	_assert.NotNil(err)
+	conf, err = ioutil.ReadFile(filepath.Join(home, "omega/etc/omega.conf"))
+	_assert.Nil(err)
+	_assert.Contains(string(conf), "# v1")
+	_assert.True(alive(pidOf(home, "omega")))
+}
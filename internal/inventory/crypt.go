@@ -0,0 +1,149 @@
+package inventory
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	kdfScrypt  = "scrypt"
+	kdfKeyFile = "keyfile"
+)
+
+// scrypt parameters of passphrases
+var (
+	ScryptN = 1 << 15
+	ScryptR = 8
+	ScryptP = 1
+)
+
+var ErrDecrypt = errors.New("decrypt inventory failure, wrong passphrase or key file")
+
+// Secret unlocks an inventory with a passphrase or a key file, KeyFile is
+// used if both are set.
+type Secret struct {
+	Passphrase string
+	// KeyFile is any file, its sha256 is the key
+	KeyFile string
+}
+
+// envelope is the encrypted inventory file
+type envelope struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt,omitempty"`
+	N       int    `json:"n,omitempty"`
+	R       int    `json:"r,omitempty"`
+	P       int    `json:"p,omitempty"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+func (s Secret) kdf() (string, error) {
+	switch {
+	case s.KeyFile != "":
+		return kdfKeyFile, nil
+	case s.Passphrase != "":
+		return kdfScrypt, nil
+	default:
+		return "", fmt.Errorf("passphrase or key file is required")
+	}
+}
+
+// key derives the AES-256 key of e from s
+func (s Secret) key(e *envelope) ([]byte, error) {
+	switch e.KDF {
+	case kdfKeyFile:
+		if s.KeyFile == "" {
+			return nil, fmt.Errorf("inventory is encrypted with a key file")
+		}
+		buf, err := os.ReadFile(s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read key file failure, nest error: %v", err)
+		}
+		if len(buf) < 32 {
+			return nil, fmt.Errorf("key file is shorter than 32 bytes")
+		}
+		var sum = sha256.Sum256(buf)
+		return sum[:], nil
+
+	case kdfScrypt:
+		if s.Passphrase == "" {
+			return nil, fmt.Errorf("inventory is encrypted with a passphrase")
+		}
+		return scrypt.Key([]byte(s.Passphrase), e.Salt, e.N, e.R, e.P, 32)
+
+	default:
+		return nil, fmt.Errorf("unknown kdf[%s] of inventory", e.KDF)
+	}
+}
+
+func seal(plain []byte, s Secret) ([]byte, error) {
+	kdf, err := s.kdf()
+	if err != nil {
+		return nil, err
+	}
+	var e = &envelope{Version: 1, KDF: kdf}
+	if kdf == kdfScrypt {
+		e.Salt, e.N, e.R, e.P = make([]byte, 16), ScryptN, ScryptR, ScryptP
+		if _, err := rand.Read(e.Salt); err != nil {
+			return nil, err
+		}
+	}
+	key, err := s.key(e)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	e.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, err
+	}
+	e.Data = gcm.Seal(nil, e.Nonce, plain, []byte(e.KDF))
+	return json.MarshalIndent(e, "", "  ")
+}
+
+func open(buf []byte, s Secret) ([]byte, error) {
+	var e = &envelope{}
+	if err := json.Unmarshal(buf, e); err != nil {
+		return nil, fmt.Errorf("inventory isn't encrypted, nest error: %v", err)
+	}
+	if e.Version != 1 {
+		return nil, fmt.Errorf("unknown version[%d] of inventory", e.Version)
+	}
+	key, err := s.key(e)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plain, err := gcm.Open(nil, e.Nonce, e.Data, []byte(e.KDF))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
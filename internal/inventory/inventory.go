@@ -0,0 +1,339 @@
+// Package inventory keeps hosts which omega is installed on in a file
+// encrypted with AES-256-GCM, unlocked by a passphrase or a key file.
+package inventory
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// well known vars of hosts
+const (
+	VarHomeDir   = "home_dir"
+	VarEndpoints = "endpoints"
+	// VarTrustedKeys is local *.pub files separated by comma, which are put in
+	// etc/trusted-keys of omega-watchdog by install
+	VarTrustedKeys = "trusted_keys"
+)
+
+// ConfigVars returns vars named <section>.<key>, which override omega.conf of
+// omega-watchdog, e.g. watchdog.memory-limit
+func ConfigVars(vars map[string]string) map[string]string {
+	var config = make(map[string]string, len(vars))
+	for k, v := range vars {
+		if strings.Contains(k, ".") {
+			config[k] = v
+		}
+	}
+	return config
+}
+
+// KeyFilePrefix refers to a private key file instead of a key in Keys
+const KeyFilePrefix = "file:"
+
+type Inventory struct {
+	Groups map[string]*Group `json:"groups"`
+	Hosts  []*Host           `json:"hosts"`
+	// Keys are ssh private keys referred by hosts, by name
+	Keys map[string]string `json:"keys"`
+}
+
+// Group is the group of omega in etcd, its vars are the defaults of its hosts
+type Group struct {
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+type Host struct {
+	// Name is unique, inner ip by default
+	Name     string `json:"name"`
+	InnerIP  string `json:"inner_ip"`
+	OuterIP  string `json:"outer_ip,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	// Key refers to Keys, or to a private key file with KeyFilePrefix
+	Key   string            `json:"key,omitempty"`
+	Group string            `json:"group"`
+	Vars  map[string]string `json:"vars,omitempty"`
+}
+
+func New() *Inventory {
+	return &Inventory{Groups: map[string]*Group{}, Hosts: []*Host{}, Keys: map[string]string{}}
+}
+
+// Load decrypts inventory in path with s
+func Load(path string, s Secret) (*Inventory, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := open(buf, s)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(plain)
+}
+
+// Parse parses plain inventory and validates it
+func Parse(plain []byte) (*Inventory, error) {
+	var inv = New()
+	if err := json.Unmarshal(plain, inv); err != nil {
+		return nil, fmt.Errorf("unmarshal inventory failure, nest error: %v", err)
+	}
+	if inv.Groups == nil {
+		inv.Groups = map[string]*Group{}
+	}
+	if inv.Keys == nil {
+		inv.Keys = map[string]string{}
+	}
+	if err := inv.Validate(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Plain returns the inventory as indented json, secrets included
+func (inv *Inventory) Plain() []byte {
+	buf, _ := json.MarshalIndent(inv, "", "  ")
+	return buf
+}
+
+// Save encrypts inventory with s into path
+func (inv *Inventory) Save(path string, s Secret) error {
+	if err := inv.Validate(); err != nil {
+		return err
+	}
+	buf, err := seal(inv.Plain(), s)
+	if err != nil {
+		return err
+	}
+	var tmp = path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Validate checks that names of hosts are unique, and groups and keys they
+// refer to exist
+func (inv *Inventory) Validate() error {
+	var names = make(map[string]bool, len(inv.Hosts))
+	for _, h := range inv.Hosts {
+		if h.Name == "" || h.InnerIP == "" || h.Username == "" {
+			return fmt.Errorf("host[%s] must have name, inner_ip and username", h.Name)
+		}
+		if names[h.Name] {
+			return fmt.Errorf("host[%s] is duplicated", h.Name)
+		}
+		names[h.Name] = true
+		if _, ok := inv.Groups[h.Group]; !ok {
+			return fmt.Errorf("group[%s] of host[%s] not exist", h.Group, h.Name)
+		}
+		if h.Password == "" && h.Key == "" {
+			return fmt.Errorf("host[%s] must have password or key", h.Name)
+		}
+		if h.Key != "" && !strings.HasPrefix(h.Key, KeyFilePrefix) {
+			if _, ok := inv.Keys[h.Key]; !ok {
+				return fmt.Errorf("key[%s] of host[%s] not exist", h.Key, h.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// PutHost adds h or replaces the host with the same name, it returns true if
+// a host is replaced. The group of h is created if it doesn't exist.
+func (inv *Inventory) PutHost(h *Host) bool {
+	if h.Name == "" {
+		h.Name = h.InnerIP
+	}
+	if _, ok := inv.Groups[h.Group]; !ok {
+		inv.Groups[h.Group] = &Group{}
+	}
+	for i, old := range inv.Hosts {
+		if old.Name == h.Name {
+			inv.Hosts[i] = h
+			return true
+		}
+	}
+	inv.Hosts = append(inv.Hosts, h)
+	return false
+}
+
+// Host returns the host of name or ip
+func (inv *Inventory) Host(name string) *Host {
+	for _, h := range inv.Hosts {
+		if h.Name == name || h.InnerIP == name || h.OuterIP == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// Select returns hosts of target, which is all, groups or hosts separated by
+// comma. Groups are matched before hosts.
+func (inv *Inventory) Select(target string) ([]*Host, error) {
+	if target == "" || target == "all" {
+		return inv.Hosts, nil
+	}
+
+	var (
+		hosts = make([]*Host, 0, len(inv.Hosts))
+		seen  = make(map[*Host]bool, len(inv.Hosts))
+	)
+	for _, name := range strings.Split(target, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := inv.Groups[name]; ok {
+			for _, h := range inv.Hosts {
+				if h.Group == name && !seen[h] {
+					hosts, seen[h] = append(hosts, h), true
+				}
+			}
+			continue
+		}
+		var h = inv.Host(name)
+		if h == nil {
+			return nil, fmt.Errorf("no group or host is named %s", name)
+		}
+		if !seen[h] {
+			hosts, seen[h] = append(hosts, h), true
+		}
+	}
+	return hosts, nil
+}
+
+// Vars returns vars of group of h overridden by vars of h
+func (inv *Inventory) Vars(h *Host) map[string]string {
+	var vars = make(map[string]string, 8)
+	if g, ok := inv.Groups[h.Group]; ok {
+		for k, v := range g.Vars {
+			vars[k] = v
+		}
+	}
+	for k, v := range h.Vars {
+		vars[k] = v
+	}
+	return vars
+}
+
+// PrivateKey returns the private key h refers to, nil if it has no key
+func (inv *Inventory) PrivateKey(h *Host) ([]byte, error) {
+	if h.Key == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(h.Key, KeyFilePrefix) {
+		return os.ReadFile(strings.TrimPrefix(h.Key, KeyFilePrefix))
+	}
+	key, ok := inv.Keys[h.Key]
+	if !ok {
+		return nil, fmt.Errorf("key[%s] not exist", h.Key)
+	}
+	return []byte(key), nil
+}
+
+// GroupNames returns names of groups in order
+func (inv *Inventory) GroupNames() []string {
+	var names = make([]string, 0, len(inv.Groups))
+	for name := range inv.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseVars parses k=v pairs
+func ParseVars(pairs []string) (map[string]string, error) {
+	var vars = make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		var idx = strings.Index(pair, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid var[%s], expect: key=value", pair)
+		}
+		vars[pair[:idx]] = pair[idx+1:]
+	}
+	return vars, nil
+}
+
+// resource is a line of resource.txt
+type resource struct {
+	OuterIP        string `json:"outer_ip"`
+	InnerIP        string `json:"inner_ip"`
+	Port           int    `json:"port"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	PrivateKeyPath string `json:"private_key_path"`
+	HomeDir        string `json:"home_dir"`
+	Endpoints      string `json:"endpoints"`
+	GroupName      string `json:"group_name"`
+}
+
+// Import adds hosts of resource.txt in json lines. Endpoints and home_dir
+// of the first host of a new group become vars of the group, private keys
+// are copied into Keys. It returns the count of imported hosts.
+func (inv *Inventory) Import(reader io.Reader) (int, error) {
+	var (
+		scanner = bufio.NewScanner(reader)
+		count   int
+		line    int
+	)
+	for scanner.Scan() {
+		line++
+		var text = strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var r = &resource{}
+		if err := json.Unmarshal([]byte(text), r); err != nil {
+			return count, fmt.Errorf("unmarshal line %d failure, nest error: %v", line, err)
+		}
+		if net.ParseIP(r.InnerIP) == nil || r.GroupName == "" {
+			return count, fmt.Errorf("line %d must have inner_ip and group_name", line)
+		}
+
+		var h = &Host{
+			Name:     r.InnerIP,
+			InnerIP:  r.InnerIP,
+			OuterIP:  r.OuterIP,
+			Port:     r.Port,
+			Username: r.Username,
+			Password: r.Password,
+			Group:    r.GroupName,
+			Vars:     map[string]string{},
+		}
+		if r.PrivateKeyPath != "" {
+			buf, err := os.ReadFile(r.PrivateKeyPath)
+			if err != nil {
+				return count, fmt.Errorf("read private key of line %d failure, nest error: %v", line, err)
+			}
+			var name = filepath.Base(r.PrivateKeyPath)
+			inv.Keys[name], h.Key = string(buf), name
+		}
+
+		g, ok := inv.Groups[r.GroupName]
+		if !ok {
+			g = &Group{Vars: map[string]string{VarHomeDir: r.HomeDir, VarEndpoints: r.Endpoints}}
+			inv.Groups[r.GroupName] = g
+		}
+		if g.Vars == nil {
+			g.Vars = map[string]string{}
+		}
+		for k, v := range map[string]string{VarHomeDir: r.HomeDir, VarEndpoints: r.Endpoints} {
+			if g.Vars[k] != v {
+				h.Vars[k] = v
+			}
+		}
+		inv.PutHost(h)
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, err
+	}
+	return count, inv.Validate()
+}
@@ -0,0 +1,181 @@
+// Package remoteconf distributes config of omega through etcd. Config of a
+// group is overlaid on omega.conf of its agents, and config of a host is
+// overlaid on config of its group. Agents apply a new version without restart
+// and report the version they apply.
+package remoteconf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/conf"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	KeyPrefix = "omega/config"
+	Timeout   = 5 * time.Second
+)
+
+// GroupKey is the key of config of group
+func GroupKey(group string) string {
+	return fmt.Sprintf("/%s/%s/group", KeyPrefix, group)
+}
+
+// HostKey is the key of config of the host of inner ip in group
+func HostKey(group, ip string) string {
+	return fmt.Sprintf("/%s/%s/host/%s", KeyPrefix, group, ip)
+}
+
+// StatusKey is the key of Status of the host of inner ip in group
+func StatusKey(group, ip string) string {
+	return fmt.Sprintf("/%s/%s/status/%s", KeyPrefix, group, ip)
+}
+
+// Version is the etcd revisions of config of group and host, 0 if there is
+// no config
+type Version struct {
+	Group int64 `json:"group"`
+	Host  int64 `json:"host"`
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("group@%d host@%d", v.Group, v.Host)
+}
+
+// Status is reported by agents after they apply or reject a version
+type Status struct {
+	Applied Version `json:"applied"`
+	Time    int64   `json:"time"`
+	// Rejected is the latest version which fails, and Error is why
+	Rejected *Version `json:"rejected,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Value is config of a key at Version, which is its etcd mod revision
+type Value struct {
+	Text    string
+	Version int64
+}
+
+// Compose overlays config of group and host on base, base is unchanged
+func Compose(base *conf.Config, group, host string) (*conf.Config, error) {
+	var c = *base
+	if err := c.Overlay(group); err != nil {
+		return nil, fmt.Errorf("config of group: %v", err)
+	}
+	if err := c.Overlay(host); err != nil {
+		return nil, fmt.Errorf("config of host: %v", err)
+	}
+	return &c, nil
+}
+
+// Validate checks that text may be overlaid on omega.conf
+func Validate(text string) error {
+	return (&conf.Config{}).Overlay(text)
+}
+
+// Get returns config of key at revision rev, the latest if rev is 0. It
+// returns nil if key doesn't exist.
+func Get(client *clientv3.Client, key string, rev int64) (*Value, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	var opts []clientv3.OpOption
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev))
+	}
+	resp, err := client.Get(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return &Value{Text: string(resp.Kvs[0].Value), Version: resp.Kvs[0].ModRevision}, nil
+}
+
+// Set validates text and puts it into key, it is deleted if text is empty.
+// The key must be at version expect unless expect is negative, 0 means the
+// key must not exist. It returns the new version.
+func Set(client *clientv3.Client, key, text string, expect int64) (int64, error) {
+	if err := Validate(text); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	var op = clientv3.OpPut(key, text)
+	if strings.TrimSpace(text) == "" {
+		op = clientv3.OpDelete(key)
+	}
+	var txn = client.Txn(ctx)
+	if expect >= 0 {
+		txn = txn.If(clientv3.Compare(clientv3.ModRevision(key), "=", expect))
+	}
+	resp, err := txn.Then(op).Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, fmt.Errorf("key[%s] isn't at version %d, it is changed by others", key, expect)
+	}
+	return resp.Header.Revision, nil
+}
+
+// History returns versions of key from the latest, at most limit. Versions
+// which are compacted by etcd aren't returned.
+func History(client *clientv3.Client, key string, limit int) ([]*Value, error) {
+	var values = make([]*Value, 0, limit)
+	var rev int64
+	for len(values) < limit {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		var opts []clientv3.OpOption
+		if rev > 0 {
+			opts = append(opts, clientv3.WithRev(rev))
+		}
+		resp, err := client.Get(ctx, key, opts...)
+		cancel()
+		if err != nil {
+			if len(values) != 0 && strings.Contains(err.Error(), "compacted") {
+				break
+			}
+			return values, err
+		}
+		if len(resp.Kvs) == 0 {
+			break
+		}
+		var kv = resp.Kvs[0]
+		values = append(values, &Value{Text: string(kv.Value), Version: kv.ModRevision})
+		// the key is created at Version 1
+		if kv.Version == 1 {
+			break
+		}
+		rev = kv.ModRevision - 1
+	}
+	return values, nil
+}
+
+// Statuses returns Status of hosts in group by inner ip
+func Statuses(client *clientv3.Client, group string) (map[string]*Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	var prefix = StatusKey(group, "")
+	resp, err := client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var statuses = make(map[string]*Status, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var s = &Status{}
+		if err := json.Unmarshal(kv.Value, s); err != nil {
+			continue
+		}
+		statuses[strings.TrimPrefix(string(kv.Key), prefix)] = s
+	}
+	return statuses, nil
+}
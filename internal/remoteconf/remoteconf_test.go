@@ -0,0 +1,52 @@
+package remoteconf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompose(t *testing.T) {
+	_assert := assert.New(t)
+
+	var base = &conf.Config{
+		Global:  conf.Global{GroupName: "omega-01"},
+		Agent:   conf.Agent{Period: conf.Duration{Duration: time.Minute}},
+		Plugins: map[string]conf.Plugin{"cpu": {"percpu": false}},
+	}
+
+	// host overrides group
+	c, err := Compose(base, `[agent]
+period = "30s"
+collector-group = "collector-02"
+
+[plugins.cpu]
+percpu = true
+`, `[agent]
+period = "10s"
+`)
+	_assert.Nil(err)
+	_assert.Equal(10*time.Second, c.Agent.Period.Duration)
+	_assert.Equal("collector-02", c.Agent.CollectorGroup)
+	_assert.Equal(conf.Plugin{"percpu": true}, c.Plugins["cpu"])
+	_assert.Equal(time.Minute, base.Agent.Period.Duration)
+	_assert.Equal(conf.Plugin{"percpu": false}, base.Plugins["cpu"])
+
+	// omega.conf alone
+	c, err = Compose(base, "", "")
+	_assert.Nil(err)
+	_assert.Equal(base.Agent, c.Agent)
+
+	_, err = Compose(base, "", `[global]
+group-name = "omega-02"`)
+	_assert.NotNil(err)
+	_assert.Contains(err.Error(), "config of host")
+	_assert.NotNil(Validate(`[agent]
+period = 10`))
+
+	_assert.Equal("/omega/config/omega-01/group", GroupKey("omega-01"))
+	_assert.Equal("/omega/config/omega-01/host/10.0.0.1", HostKey("omega-01", "10.0.0.1"))
+	_assert.Equal("/omega/config/omega-01/status/", StatusKey("omega-01", ""))
+}
@@ -0,0 +1,145 @@
+package remoteconf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/eviltomorrow/omega/internal/conf"
+	"github.com/eviltomorrow/omega/pkg/zlog"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// RetryPeriod is how long Watcher waits before it watches again after etcd fails
+var RetryPeriod = 5 * time.Second
+
+// Watcher applies config of Group and host IP whenever it changes in etcd
+type Watcher struct {
+	Client *clientv3.Client
+	Group  string
+	IP     string
+	// Base is omega.conf, config in etcd is overlaid on it
+	Base *conf.Config
+	// Apply applies a valid config, the version is rejected if it fails
+	Apply func(c *conf.Config) error
+
+	applied  Version
+	rejected *Version
+	reported bool
+}
+
+// Run applies the latest config, and watches it until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	for {
+		rev, err := w.reload()
+		if err != nil {
+			zlog.Error("Load config from etcd failure", zap.String("group", w.Group), zap.Error(err))
+		} else {
+			w.watch(ctx, rev)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(RetryPeriod):
+		}
+	}
+}
+
+// watch reloads config after a change of the keys of config since rev, it
+// returns once the watch fails or ctx is done
+func (w *Watcher) watch(ctx context.Context, rev int64) {
+	var (
+		groupKey = GroupKey(w.Group)
+		hostKey  = HostKey(w.Group, w.IP)
+	)
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+
+	for resp := range w.Client.Watch(ctx, fmt.Sprintf("/%s/%s/", KeyPrefix, w.Group), clientv3.WithPrefix(), clientv3.WithRev(rev+1)) {
+		if err := resp.Err(); err != nil {
+			zlog.Error("Watch config in etcd failure", zap.String("group", w.Group), zap.Error(err))
+			return
+		}
+		var changed bool
+		for _, event := range resp.Events {
+			if key := string(event.Kv.Key); key == groupKey || key == hostKey {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if _, err := w.reload(); err != nil {
+			zlog.Error("Load config from etcd failure", zap.String("group", w.Group), zap.Error(err))
+			return
+		}
+	}
+}
+
+// reload applies config of group and host unless it is applied or rejected
+// already, it returns the revision of etcd which config is read at
+func (w *Watcher) reload() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	// both keys are read at the same revision, omega.conf alone is version 0
+	// of both and it is reported once
+	resp, err := w.Client.Txn(ctx).Then(clientv3.OpGet(GroupKey(w.Group)), clientv3.OpGet(HostKey(w.Group, w.IP))).Commit()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		texts   [2]string
+		version Version
+	)
+	for i, r := range resp.Responses {
+		if kvs := r.GetResponseRange().Kvs; len(kvs) != 0 {
+			texts[i] = string(kvs[0].Value)
+			if i == 0 {
+				version.Group = kvs[0].ModRevision
+			} else {
+				version.Host = kvs[0].ModRevision
+			}
+		}
+	}
+	if version == w.applied || (w.rejected != nil && version == *w.rejected) {
+		if !w.reported {
+			w.report(nil)
+		}
+		return resp.Header.Revision, nil
+	}
+
+	c, err := Compose(w.Base, texts[0], texts[1])
+	if err == nil {
+		err = w.Apply(c)
+	}
+	if err != nil {
+		zlog.Error("Apply config failure", zap.String("version", version.String()), zap.Error(err))
+		w.rejected = &version
+		w.report(err)
+	} else {
+		zlog.Info("Apply config success", zap.String("version", version.String()))
+		w.applied, w.rejected = version, nil
+		w.report(nil)
+	}
+	return resp.Header.Revision, nil
+}
+
+// report puts Status into etcd
+func (w *Watcher) report(err error) {
+	var s = &Status{Applied: w.applied, Time: time.Now().Unix(), Rejected: w.rejected}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	buf, _ := json.Marshal(s)
+	w.reported = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if _, err := w.Client.Put(ctx, StatusKey(w.Group, w.IP), string(buf)); err != nil {
+		zlog.Error("Report config status failure", zap.String("group", w.Group), zap.Error(err))
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/eviltomorrow/omega/internal/middleware"
 	"github.com/eviltomorrow/omega/pkg/grpclb"
 	"github.com/eviltomorrow/omega/pkg/tools"
+	_ "github.com/eviltomorrow/omega/pkg/zstd" // compressed transfers
 	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip" // compressed transfers
 	"google.golang.org/grpc/reflection"
 )
 
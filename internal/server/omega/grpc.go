@@ -13,10 +13,14 @@ import (
 	pb_file "github.com/eviltomorrow/omega/internal/api/file/pb"
 	"github.com/eviltomorrow/omega/internal/api/terminal"
 	pb_terminal "github.com/eviltomorrow/omega/internal/api/terminal/pb"
+	"github.com/eviltomorrow/omega/internal/api/tunnel"
+	pb_tunnel "github.com/eviltomorrow/omega/internal/api/tunnel/pb"
 	"github.com/eviltomorrow/omega/internal/middleware"
 	"github.com/eviltomorrow/omega/pkg/grpclb"
 	"github.com/eviltomorrow/omega/pkg/tools"
+	_ "github.com/eviltomorrow/omega/pkg/zstd" // compressed transfers
 	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip" // compressed transfers
 	"google.golang.org/grpc/reflection"
 )
 
@@ -65,6 +69,7 @@ func StartupGRPC() error {
 	pb_exec.RegisterExecServer(server, &exec.Server{})
 	pb_file.RegisterFileServer(server, &file.Server{})
 	pb_terminal.RegisterTerminalServer(server, &terminal.Server{})
+	pb_tunnel.RegisterTunnelServer(server, &tunnel.Server{})
 
 	close, err := grpclb.Register(Key, InnerIP, OuterIP, Port, Endpoints, 10)
 	if err != nil {
@@ -3,6 +3,7 @@ package archive
 import (
 	"archive/tar"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -19,7 +20,13 @@ func CompressWithRAR(source string, target string) error {
 	}
 	defer writer.Close()
 
-	gwriter := gzip.NewWriter(writer)
+	return Compress(source, writer)
+}
+
+// Compress writes source as a tar.gz stream to w, entries of a folder are
+// named under the base name of the folder.
+func Compress(source string, w io.Writer) error {
+	gwriter := gzip.NewWriter(w)
 	defer gwriter.Close()
 
 	twriter := tar.NewWriter(gwriter)
@@ -33,22 +40,28 @@ func CompressWithRAR(source string, target string) error {
 	if fi.IsDir() {
 		base = filepath.Base(source)
 	}
-	return filepath.Walk(source,
+	err = filepath.Walk(source,
 		func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			header, err := tar.FileInfoHeader(info, info.Name())
+			var link string
+			if info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(path); err != nil {
+					return err
+				}
+			}
+			header, err := tar.FileInfoHeader(info, link)
 			if err != nil {
 				return err
 			}
 			if base != "" {
-				header.Name = filepath.Join(base, strings.TrimPrefix(path, source))
+				header.Name = filepath.ToSlash(filepath.Join(base, strings.TrimPrefix(path, source)))
 			}
 			if err := twriter.WriteHeader(header); err != nil {
 				return err
 			}
-			if info.IsDir() {
+			if !info.Mode().IsRegular() {
 				return nil
 			}
 			file, err := os.Open(path)
@@ -59,16 +72,41 @@ func CompressWithRAR(source string, target string) error {
 			_, err = io.Copy(twriter, file)
 			return err
 		})
+	if err != nil {
+		return err
+	}
+	if err := twriter.Close(); err != nil {
+		return err
+	}
+	return gwriter.Close()
 }
 
 func UncompressWithRAR(source, target string) error {
-	hardLinks := make(map[string]string)
 	reader, err := os.Open(source)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
-	tarReader := tar.NewReader(reader)
+
+	return Uncompress(reader, target)
+}
+
+// Uncompress extracts a tar.gz stream into target, entries which would be
+// extracted out of target, by name or through a symlink extracted before, are
+// rejected before anything is created for them.
+func Uncompress(r io.Reader, target string) error {
+	greader, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer greader.Close()
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+
+	hardLinks := make(map[string]string)
+	tarReader := tar.NewReader(greader)
 
 	for {
 		header, err := tarReader.Next()
@@ -79,6 +117,13 @@ func UncompressWithRAR(source, target string) error {
 		}
 
 		path := filepath.Join(target, header.Name)
+		if !within(target, path) {
+			return fmt.Errorf("illegal entry[%s] in archive", header.Name)
+		}
+		/* A symlink extracted before must not lead the entry out of target */
+		if err := checkPath(target, path); err != nil {
+			return err
+		}
 		info := header.FileInfo()
 
 		switch header.Typeflag {
@@ -91,13 +136,14 @@ func UncompressWithRAR(source, target string) error {
 		case tar.TypeLink:
 			/* Store details of hard links, which we process finally */
 			linkPath := filepath.Join(target, header.Linkname)
-			linkPath2 := filepath.Join(target, header.Name)
-			hardLinks[linkPath2] = linkPath
+			if !within(target, linkPath) {
+				return fmt.Errorf("illegal link[%s] in archive", header.Linkname)
+			}
+			hardLinks[path] = linkPath
 			continue
 
 		case tar.TypeSymlink:
-			linkPath := filepath.Join(target, header.Name)
-			if err := os.Symlink(header.Linkname, linkPath); err != nil {
+			if err := os.Symlink(header.Linkname, path); err != nil {
 				if os.IsExist(err) {
 					continue
 				}
@@ -107,8 +153,8 @@ func UncompressWithRAR(source, target string) error {
 
 		case tar.TypeReg:
 			/* Ensure any missing directories are created */
-			if _, err := os.Stat(filepath.Dir(path)); os.IsNotExist(err) {
-				os.MkdirAll(filepath.Dir(path), 0755)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
 			}
 			file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
 			if os.IsExist(err) {
@@ -130,9 +176,51 @@ func UncompressWithRAR(source, target string) error {
 
 	/* To create hard links the targets must exist, so we do this finally */
 	for k, v := range hardLinks {
+		if err := checkPath(target, v); err != nil {
+			return err
+		}
+		if err := checkPath(target, k); err != nil {
+			return err
+		}
 		if err := os.Link(v, k); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkPath checks that path is in target after symlinks of its nearest
+// existing ancestor, or of path itself if it exists, are resolved
+func checkPath(target, path string) error {
+	dir, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return err
+	}
+	var existing, rest = path, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if parent := filepath.Dir(existing); parent != existing {
+			existing, rest = parent, filepath.Join(filepath.Base(existing), rest)
+		} else {
+			break
+		}
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		// a dangling symlink may be created later anywhere
+		return fmt.Errorf("illegal entry[%s] in archive, nest error: %v", path, err)
+	}
+	if !within(dir, filepath.Join(resolved, rest)) {
+		return fmt.Errorf("illegal entry[%s] in archive", path)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		dir    = t.TempDir()
+		source = filepath.Join(dir, "conf")
+		target = filepath.Join(dir, "conf.tar.gz")
+	)
+	_assert.Nil(os.MkdirAll(filepath.Join(source, "etc"), 0755))
+	_assert.Nil(os.WriteFile(filepath.Join(source, "etc/omega.conf"), []byte("[log]"), 0644))
+
+	_assert.Nil(CompressWithRAR(source, target))
+	_assert.Nil(UncompressWithRAR(target, filepath.Join(dir, "out")))
+	buf, err := os.ReadFile(filepath.Join(dir, "out/conf/etc/omega.conf"))
+	_assert.Nil(err)
+	_assert.Equal("[log]", string(buf))
+}
+
+func TestUncompressIllegalEntry(t *testing.T) {
+	_assert := assert.New(t)
+
+	var archive = func(headers ...*tar.Header) *bytes.Buffer {
+		var (
+			buf     = &bytes.Buffer{}
+			gwriter = gzip.NewWriter(buf)
+			twriter = tar.NewWriter(gwriter)
+		)
+		for _, header := range headers {
+			_assert.Nil(twriter.WriteHeader(header))
+			if header.Size > 0 {
+				twriter.Write(make([]byte, header.Size))
+			}
+		}
+		twriter.Close()
+		gwriter.Close()
+		return buf
+	}
+
+	var dir = t.TempDir()
+	_assert.Nil(os.MkdirAll(filepath.Join(dir, "a"), 0755))
+	_assert.Nil(os.MkdirAll(filepath.Join(dir, "b"), 0755))
+	_assert.NotNil(Uncompress(archive(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}), filepath.Join(dir, "a")))
+	_assert.NotNil(Uncompress(archive(
+		&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: dir},
+		&tar.Header{Name: "link/escape", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+	), filepath.Join(dir, "b")))
+
+	// symlink, then dir through it
+	_assert.Nil(os.MkdirAll(filepath.Join(dir, "c"), 0755))
+	_assert.NotNil(Uncompress(archive(
+		&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: dir},
+		&tar.Header{Name: "a/x/", Typeflag: tar.TypeDir, Mode: 0755},
+	), filepath.Join(dir, "c")))
+	_assert.NotNil(Uncompress(archive(
+		&tar.Header{Name: "a/y/z", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+	), filepath.Join(dir, "c")))
+
+	// hard link to a file through a symlink
+	_assert.Nil(os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600))
+	_assert.Nil(os.MkdirAll(filepath.Join(dir, "d"), 0755))
+	_assert.NotNil(Uncompress(archive(
+		&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: dir},
+		&tar.Header{Name: "secret", Typeflag: tar.TypeLink, Linkname: "a/secret"},
+	), filepath.Join(dir, "d")))
+	_, err := os.Stat(filepath.Join(dir, "d/secret"))
+	_assert.True(os.IsNotExist(err))
+
+	for _, name := range []string{"escape", "x", "y"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		_assert.True(os.IsNotExist(err), name)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -12,12 +13,20 @@ import (
 )
 
 func RegisterRebootWatchdog() error {
-	var (
-		c       = "crontab -l"
-		rebootC = fmt.Sprintf("@reboot cd %s; sleep 3; ./omega-watchdog --daemon", system.RootDir)
-	)
+	return RegisterReboot("omega-watchdog", system.RootDir)
+}
 
-	stdout, stderr, err := exec.RunCmd(c, 5*time.Second)
+// RebootLine returns the @reboot entry which starts service name in dir as daemon
+func RebootLine(name, dir string) string {
+	return fmt.Sprintf("@reboot cd %s; sleep 3; ./%s --daemon", dir, name)
+}
+
+// RegisterReboot adds the @reboot entry of service name in dir to crontab of
+// the current user, it is not added twice.
+func RegisterReboot(name, dir string) error {
+	var rebootC = RebootLine(name, dir)
+
+	stdout, stderr, err := exec.RunCmd("crontab -l", 5*time.Second)
 	if err != nil {
 		return err
 	}
@@ -39,7 +48,54 @@ func RegisterRebootWatchdog() error {
 		}
 	}
 
-	c = fmt.Sprintf(`crontab -l > crontab.conf && echo "%s" >> crontab.conf && crontab crontab.conf && rm -f crontab.conf`, rebootC)
+	var c = fmt.Sprintf(`crontab -l > crontab.conf && echo "%s" >> crontab.conf && crontab crontab.conf && rm -f crontab.conf`, rebootC)
 	_, _, err = exec.RunCmd(c, 5*time.Second)
 	return err
 }
+
+// RemoveReboot removes the @reboot entry of service name in dir from crontab
+// of the current user, it returns false if the entry isn't found.
+func RemoveReboot(name, dir string) (bool, error) {
+	var rebootC = RebootLine(name, dir)
+
+	// crontab -l fails if the user has no crontab
+	stdout, _, err := exec.RunCmd("crontab -l", 5*time.Second)
+	if err != nil {
+		return false, nil
+	}
+
+	var (
+		buf     bytes.Buffer
+		found   bool
+		scanner = bufio.NewScanner(strings.NewReader(stdout))
+	)
+	for scanner.Scan() {
+		var text = scanner.Text()
+		if strings.TrimSpace(text) == rebootC {
+			found = true
+			continue
+		}
+		buf.WriteString(text)
+		buf.WriteString("\n")
+	}
+	if !found {
+		return false, nil
+	}
+
+	file, err := os.CreateTemp("", "crontab-*.conf")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return false, err
+	}
+	if err := file.Close(); err != nil {
+		return false, err
+	}
+	if _, stderr, err := exec.RunCmd(fmt.Sprintf("crontab %s", file.Name()), 5*time.Second); err != nil {
+		return false, fmt.Errorf("crontab %s failure, nest error: %v, output: %s", file.Name(), err, stderr)
+	}
+	return true, nil
+}
@@ -0,0 +1,386 @@
+// Package delta computes binary patches in the way of bsdiff, so that a new
+// version of a binary is sent as its difference to the old one.
+//
+// A patch is the magic "OMGDIFF1", the size of new in 8 bytes big endian, and
+// a gzip stream of blocks. Every block is three varints, the length of diff
+// bytes, the length of extra bytes and the seek of old, followed by diff bytes
+// which are added to old and extra bytes which are copied.
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const magic = "OMGDIFF1"
+
+var ErrCorruptPatch = errors.New("corrupt patch")
+
+// Diff writes the patch which turns old into new to w
+func Diff(old, new []byte, w io.Writer) error {
+	if len(old) >= math.MaxInt32 || len(new) >= math.MaxInt32 {
+		return fmt.Errorf("file is too large to diff, max: %d", math.MaxInt32-1)
+	}
+
+	var header [len(magic) + 8]byte
+	copy(header[:], magic)
+	binary.BigEndian.PutUint64(header[len(magic):], uint64(len(new)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	var (
+		gwriter = gzip.NewWriter(w)
+		bwriter = bufio.NewWriter(gwriter)
+	)
+	if err := diff(old, new, bwriter); err != nil {
+		return err
+	}
+	if err := bwriter.Flush(); err != nil {
+		return err
+	}
+	return gwriter.Close()
+}
+
+// Patch applies patch to old and returns new
+func Patch(old []byte, patch io.Reader) ([]byte, error) {
+	var header [len(magic) + 8]byte
+	if _, err := io.ReadFull(patch, header[:]); err != nil {
+		return nil, fmt.Errorf("%w, read header failure, nest error: %v", ErrCorruptPatch, err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("%w, unknown magic", ErrCorruptPatch)
+	}
+	var size = binary.BigEndian.Uint64(header[len(magic):])
+	if size >= math.MaxInt32 {
+		return nil, fmt.Errorf("%w, size[%d] is too large", ErrCorruptPatch, size)
+	}
+
+	greader, err := gzip.NewReader(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w, nest error: %v", ErrCorruptPatch, err)
+	}
+	defer greader.Close()
+	var reader = bufio.NewReader(greader)
+
+	var (
+		new            = make([]byte, size)
+		newpos, oldpos int64
+	)
+	for newpos < int64(size) {
+		var ctrl [3]int64
+		for i := range ctrl {
+			if ctrl[i], err = binary.ReadVarint(reader); err != nil {
+				return nil, fmt.Errorf("%w, read block failure, nest error: %v", ErrCorruptPatch, err)
+			}
+		}
+		if ctrl[0] < 0 || ctrl[1] < 0 || newpos+ctrl[0]+ctrl[1] > int64(size) {
+			return nil, fmt.Errorf("%w, block exceeds size[%d]", ErrCorruptPatch, size)
+		}
+
+		if _, err := io.ReadFull(reader, new[newpos:newpos+ctrl[0]]); err != nil {
+			return nil, fmt.Errorf("%w, read diff failure, nest error: %v", ErrCorruptPatch, err)
+		}
+		for i := int64(0); i < ctrl[0]; i++ {
+			if oldpos+i >= 0 && oldpos+i < int64(len(old)) {
+				new[newpos+i] += old[oldpos+i]
+			}
+		}
+		newpos += ctrl[0]
+		oldpos += ctrl[0]
+
+		if _, err := io.ReadFull(reader, new[newpos:newpos+ctrl[1]]); err != nil {
+			return nil, fmt.Errorf("%w, read extra failure, nest error: %v", ErrCorruptPatch, err)
+		}
+		newpos += ctrl[1]
+		oldpos += ctrl[2]
+	}
+	// checksum of gzip is verified at the end of stream
+	if _, err := reader.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w, trailing data or bad checksum, nest error: %v", ErrCorruptPatch, err)
+	}
+	return new, nil
+}
+
+// diff is bsdiff of Colin Percival without its file format
+func diff(old, new []byte, w *bufio.Writer) error {
+	var (
+		oldsize, newsize = int32(len(old)), int32(len(new))
+		varint           [binary.MaxVarintLen64]byte
+		block            = func(lenf, extra, seek int32, lastscan, lastpos int32) error {
+			for _, v := range []int32{lenf, extra, seek} {
+				if _, err := w.Write(varint[:binary.PutVarint(varint[:], int64(v))]); err != nil {
+					return err
+				}
+			}
+			for i := int32(0); i < lenf; i++ {
+				if err := w.WriteByte(new[lastscan+i] - old[lastpos+i]); err != nil {
+					return err
+				}
+			}
+			_, err := w.Write(new[lastscan+lenf : lastscan+lenf+extra])
+			return err
+		}
+	)
+	if oldsize == 0 {
+		return block(0, newsize, 0, 0, 0)
+	}
+
+	var (
+		I                                  = qsufsort(old)
+		scan, pos, length                  int32
+		lastscan, lastpos, lastoffset      int32
+		oldscore, scsc                     int32
+		s, sf, lenf, sb, lenb, overlap, ss int32
+		lens, i                            int32
+	)
+	for scan < newsize {
+		oldscore = 0
+
+		scan += length
+		for scsc = scan; scan < newsize; scan++ {
+			pos, length = search(I, old, new[scan:], 0, oldsize)
+
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastoffset < oldsize && old[scsc+lastoffset] == new[scsc] {
+					oldscore++
+				}
+			}
+			if (length == oldscore && length != 0) || length > oldscore+8 {
+				break
+			}
+			if scan+lastoffset < oldsize && old[scan+lastoffset] == new[scan] {
+				oldscore--
+			}
+		}
+
+		if length == oldscore && scan != newsize {
+			continue
+		}
+
+		s, sf, lenf = 0, 0, 0
+		for i = 0; lastscan+i < scan && lastpos+i < oldsize; {
+			if old[lastpos+i] == new[lastscan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenf {
+				sf, lenf = s, i
+			}
+		}
+
+		lenb = 0
+		if scan < newsize {
+			s, sb = 0, 0
+			for i = 1; scan >= lastscan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenb {
+					sb, lenb = s, i
+				}
+			}
+		}
+
+		if lastscan+lenf > scan-lenb {
+			overlap = (lastscan + lenf) - (scan - lenb)
+			s, ss, lens = 0, 0, 0
+			for i = 0; i < overlap; i++ {
+				if new[lastscan+lenf-overlap+i] == old[lastpos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > ss {
+					ss, lens = s, i+1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		if err := block(lenf, (scan-lenb)-(lastscan+lenf), (pos-lenb)-(lastpos+lenf), lastscan, lastpos); err != nil {
+			return err
+		}
+		lastscan, lastpos, lastoffset = scan-lenb, pos-lenb, pos-scan
+	}
+	return nil
+}
+
+// search returns the longest match of new in old with suffix array I
+func search(I []int32, old, new []byte, st, en int32) (int32, int32) {
+	for en-st >= 2 {
+		var (
+			x = st + (en-st)/2
+			n = min(int32(len(old))-I[x], int32(len(new)))
+		)
+		if bytes.Compare(old[I[x]:I[x]+n], new[:n]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+
+	var (
+		x = matchlen(old[I[st]:], new)
+		y = matchlen(old[I[en]:], new)
+	)
+	if x > y {
+		return I[st], x
+	}
+	return I[en], y
+}
+
+func matchlen(old, new []byte) int32 {
+	var i int
+	for i < len(old) && i < len(new) && old[i] == new[i] {
+		i++
+	}
+	return int32(i)
+}
+
+func min(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// qsufsort is the suffix sort of Larsson and Sadakane
+func qsufsort(old []byte) []int32 {
+	var (
+		n       = int32(len(old))
+		I       = make([]int32, n+1)
+		V       = make([]int32, n+1)
+		buckets [256]int32
+	)
+	for _, c := range old {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	copy(buckets[1:], buckets[:255])
+	buckets[0] = 0
+
+	for i, c := range old {
+		buckets[c]++
+		I[buckets[c]] = int32(i)
+	}
+	I[0] = n
+	for i, c := range old {
+		V[i] = buckets[c]
+	}
+	V[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := int32(1); I[0] != -(n + 1); h += h {
+		var length, i int32
+		for i < n+1 {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+				continue
+			}
+			if length != 0 {
+				I[i-length] = -length
+			}
+			length = V[I[i]] + 1 - i
+			split(I, V, i, length, h)
+			i += length
+			length = 0
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+
+	for i := int32(0); i < n+1; i++ {
+		I[V[i]] = i
+	}
+	return I
+}
+
+func split(I, V []int32, start, length, h int32) {
+	var i, j, k, x, jj, kk int32
+
+	if length < 16 {
+		for k = start; k < start+length; k += j {
+			j, x = 1, V[I[k]+h]
+			for i = 1; k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x, j = V[I[k+i]+h], 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i = 0; i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+		}
+		return
+	}
+
+	x = V[I[start+length/2]+h]
+	for i = start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	for i = start; i < jj; {
+		switch {
+		case V[I[i]+h] < x:
+			i++
+		case V[I[i]+h] == x:
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		default:
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+	for i = 0; i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
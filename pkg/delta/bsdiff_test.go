@@ -0,0 +1,63 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	_assert := assert.New(t)
+
+	var (
+		random = rand.New(rand.NewSource(1))
+		old    = make([]byte, 64*1024)
+	)
+	random.Read(old)
+
+	// a new version changes some bytes, inserts and removes blocks
+	var new = append([]byte{}, old[:10000]...)
+	new = append(new, []byte("omega v3.2.0")...)
+	new = append(new, old[10000:30000]...)
+	new = append(new, old[40000:]...)
+	for i := 0; i < 100; i++ {
+		new[random.Intn(len(new))]++
+	}
+
+	var patch bytes.Buffer
+	_assert.Nil(Diff(old, new, &patch))
+	_assert.Less(patch.Len(), len(new)/4)
+
+	buf, err := Patch(old, bytes.NewReader(patch.Bytes()))
+	_assert.Nil(err)
+	_assert.Equal(new, buf)
+
+	for _, c := range []struct{ old, new []byte }{
+		{nil, []byte("omega")},
+		{[]byte("omega"), nil},
+		{old, old},
+		{[]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), []byte("aaaaaaaaaabaaaaaaaaa")},
+	} {
+		var patch bytes.Buffer
+		_assert.Nil(Diff(c.old, c.new, &patch))
+		buf, err := Patch(c.old, &patch)
+		_assert.Nil(err)
+		_assert.Equal(len(c.new), len(buf))
+		_assert.True(bytes.Equal(c.new, buf))
+	}
+}
+
+func TestPatchCorrupt(t *testing.T) {
+	_assert := assert.New(t)
+
+	var patch bytes.Buffer
+	_assert.Nil(Diff([]byte("omega v3.1.0"), []byte("omega v3.2.0"), &patch))
+
+	_, err := Patch(nil, bytes.NewReader([]byte("BSDIFF40")))
+	_assert.True(errors.Is(err, ErrCorruptPatch))
+	_, err = Patch(nil, bytes.NewReader(patch.Bytes()[:patch.Len()-4]))
+	_assert.True(errors.Is(err, ErrCorruptPatch))
+}
@@ -0,0 +1,38 @@
+package file
+
+import (
+	"github.com/eviltomorrow/omega/pkg/zstd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+)
+
+// Compressor compresses streams of transfers: zstd, gzip or "identity" which
+// disables it
+var Compressor = zstd.Name
+
+// Negotiate runs call with Compressor, and runs it again with gzip and then
+// without compression if peer doesn't support it, peers before zstd support
+// gzip only. The accepted call options are returned for later calls to the
+// same peer.
+func Negotiate(call func(opts ...grpc.CallOption) error) ([]grpc.CallOption, error) {
+	var names []string
+	switch Compressor {
+	case "", "identity":
+		return nil, call()
+	case zstd.Name:
+		names = []string{zstd.Name, gzip.Name}
+	default:
+		names = []string{Compressor}
+	}
+
+	for _, name := range names {
+		var opts = []grpc.CallOption{grpc.UseCompressor(name)}
+		err := call(opts...)
+		if status.Code(err) != codes.Unimplemented {
+			return opts, err
+		}
+	}
+	return nil, call()
+}
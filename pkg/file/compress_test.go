@@ -0,0 +1,40 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNegotiate(t *testing.T) {
+	_assert := assert.New(t)
+
+	// peer supports gzip only
+	var calls int
+	opts, err := Negotiate(func(opts ...grpc.CallOption) error {
+		calls++
+		if calls == 1 {
+			return status.Error(codes.Unimplemented, `grpc: Decompressor is not installed for grpc-encoding "zstd"`)
+		}
+		return nil
+	})
+	_assert.Nil(err)
+	_assert.Equal(2, calls)
+	_assert.Equal([]grpc.CallOption{grpc.UseCompressor("gzip")}, opts)
+
+	// peer supports neither
+	calls = 0
+	opts, err = Negotiate(func(opts ...grpc.CallOption) error {
+		calls++
+		if len(opts) != 0 {
+			return status.Error(codes.Unimplemented, "unsupported compressor")
+		}
+		return nil
+	})
+	_assert.Nil(err)
+	_assert.Equal(3, calls)
+	_assert.Nil(opts)
+}
@@ -0,0 +1,186 @@
+package file
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrUnexpectedOffset = errors.New("unexpected offset")
+	ErrCRCMismatch      = errors.New("crc mismatch")
+	ErrSHA256Mismatch   = errors.New("sha256 mismatch")
+)
+
+var (
+	Retries       = 5
+	RetryInterval = 3 * time.Second
+)
+
+// Part is a partially transferred file, it is kept on disk when the transfer
+// is interrupted, so that the transfer can be resumed from Offset.
+type Part struct {
+	f      *os.File
+	name   string
+	offset int64
+}
+
+// PartName returns the name of part file for target, it lives in the same
+// folder with target, so that Commit is an atomic rename.
+func PartName(target, id string) string {
+	return filepath.Join(filepath.Dir(target), fmt.Sprintf(".%s.%s.part", filepath.Base(target), id))
+}
+
+// TransferID returns a stable id for transferring content with sha256 to path
+func TransferID(path, sha256sum string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(path+":"+sha256sum)))[:16]
+}
+
+func OpenPart(name string) (*Part, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Part{f: f, name: name, offset: offset}, nil
+}
+
+// PartOffset returns the size of part file, 0 if it does not exist
+func PartOffset(name string) (int64, error) {
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (p *Part) Offset() int64 {
+	return p.offset
+}
+
+// Truncate discards data after offset, offset must not be greater than Offset
+func (p *Part) Truncate(offset int64) error {
+	if offset < 0 || offset > p.offset {
+		return fmt.Errorf("%w, expect: <= %d, actual: %d", ErrUnexpectedOffset, p.offset, offset)
+	}
+	if offset == p.offset {
+		return nil
+	}
+	if err := p.f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := p.f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	p.offset = offset
+	return nil
+}
+
+// Write appends buf at offset, offset must be equal to Offset
+func (p *Part) Write(offset int64, buf []byte) error {
+	if offset != p.offset {
+		return fmt.Errorf("%w, expect: %d, actual: %d", ErrUnexpectedOffset, p.offset, offset)
+	}
+	n, err := p.f.Write(buf)
+	p.offset += int64(n)
+	return err
+}
+
+// Commit verifies part file with sha256sum and renames it to target. Part file
+// is removed if verification fails. Verification is skipped if sha256sum is empty.
+func (p *Part) Commit(target string, sha256sum string, mode os.FileMode) error {
+	if err := p.f.Sync(); err != nil {
+		p.f.Close()
+		return err
+	}
+	if err := p.f.Close(); err != nil {
+		return err
+	}
+
+	if sha256sum != "" {
+		actual, err := CalculateSHA256(p.name)
+		if err != nil {
+			return err
+		}
+		if actual != sha256sum {
+			os.Remove(p.name)
+			return fmt.Errorf("%w, expect: %s, actual: %s", ErrSHA256Mismatch, sha256sum, actual)
+		}
+	}
+
+	if err := os.Chmod(p.name, mode); err != nil {
+		return err
+	}
+	return os.Rename(p.name, target)
+}
+
+func (p *Part) Close() error {
+	return p.f.Close()
+}
+
+// Remove closes and removes part file
+func (p *Part) Remove() error {
+	p.f.Close()
+	return os.Remove(p.name)
+}
+
+func CRC(buf []byte) uint32 {
+	return crc32.ChecksumIEEE(buf)
+}
+
+func CheckCRC(buf []byte, crc uint32) error {
+	if actual := CRC(buf); actual != crc {
+		return fmt.Errorf("%w, expect: %d, actual: %d", ErrCRCMismatch, crc, actual)
+	}
+	return nil
+}
+
+// Retryable reports whether a failed transfer is worth to be resumed
+func Retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.DataLoss:
+		return true
+	default:
+		return errors.Is(err, ErrCRCMismatch) || errors.Is(err, ErrUnexpectedOffset)
+	}
+}
+
+// Retry runs f until it succeeds or the error is not retryable, f is expected
+// to resume the transfer from the last offset.
+func Retry(f func() error) error {
+	var err error
+	for i := 0; i <= Retries; i++ {
+		if err = f(); err == nil || !Retryable(err) {
+			return err
+		}
+		time.Sleep(RetryInterval)
+	}
+	return err
+}
+
+// Progress returns a reporter which adds transferred bytes to counter, bytes
+// transferred again after resuming are not counted twice.
+func Progress(counter chan int) func(int64) {
+	var counted int64
+	return func(pos int64) {
+		if pos > counted {
+			counter <- int(pos - counted)
+			counted = pos
+		}
+	}
+}
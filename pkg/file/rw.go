@@ -2,6 +2,7 @@ package file
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"time"
@@ -32,6 +33,11 @@ func Write(path string, mode os.FileMode, data chan []byte, signal chan error) e
 }
 
 func Read(path string) (os.FileInfo, chan []byte, chan error, error) {
+	return ReadFrom(path, 0)
+}
+
+// ReadFrom is like Read, but starts reading at offset
+func ReadFrom(path string, offset int64) (os.FileInfo, chan []byte, chan error, error) {
 	f, err := os.OpenFile(path, os.O_RDONLY, 0644)
 	if err != nil {
 		return nil, nil, nil, err
@@ -42,6 +48,14 @@ func Read(path string) (os.FileInfo, chan []byte, chan error, error) {
 		f.Close()
 		return nil, nil, nil, err
 	}
+	if offset < 0 || offset > fi.Size() {
+		f.Close()
+		return nil, nil, nil, fmt.Errorf("invalid offset[%d], size: %d", offset, fi.Size())
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
 
 	var (
 		p      = make(chan []byte, 32)
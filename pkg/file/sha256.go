@@ -0,0 +1,57 @@
+package file
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+func CalculateSHA256(path string) (string, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("path is a folder")
+	}
+
+	sha256h := sha256.New()
+	if _, err = io.Copy(sha256h, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256h.Sum(nil)), nil
+}
+
+// CalculateDigests returns md5 and sha256 of path, the file is read once
+func CalculateDigests(path string) (string, string, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", "", err
+	}
+	if info.IsDir() {
+		return "", "", fmt.Errorf("path is a folder")
+	}
+
+	var (
+		md5h    = md5.New()
+		sha256h = sha256.New()
+	)
+	if _, err = io.Copy(io.MultiWriter(md5h, sha256h), file); err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("%x", md5h.Sum(nil)), fmt.Sprintf("%x", sha256h.Sum(nil)), nil
+}
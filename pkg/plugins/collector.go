@@ -1,6 +1,8 @@
 package plugins
 
 import (
+	"reflect"
+
 	"github.com/eviltomorrow/omega"
 )
 
@@ -10,8 +12,36 @@ type Collector interface {
 	Gather() ([]omega.Metric, error)
 }
 
-var Repository = map[string]Collector{}
+var (
+	Repository = map[string]Collector{}
+	// defaults keeps a copy of the collector registered first by name
+	defaults = map[string]Collector{}
+)
 
 func Register(name string, collector Collector) {
+	if _, ok := defaults[name]; !ok {
+		defaults[name] = clone(collector)
+	}
 	Repository[name] = collector
 }
+
+// New returns a copy of the collector registered first by name, so that it
+// has the default config
+func New(name string) (Collector, bool) {
+	collector, ok := defaults[name]
+	if !ok {
+		return nil, false
+	}
+	return clone(collector), true
+}
+
+// clone copies the struct which collector points to
+func clone(collector Collector) Collector {
+	var v = reflect.ValueOf(collector)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return collector
+	}
+	var c = reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface().(Collector)
+}
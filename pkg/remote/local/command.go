@@ -0,0 +1,83 @@
+package local
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/eviltomorrow/omega/pkg/remote"
+)
+
+type Command struct {
+	cmd *exec.Cmd
+
+	stdin          io.WriteCloser
+	stdout, stderr io.Reader
+}
+
+func NewCommand(program string, args []string) (remote.Command, error) {
+	c := exec.Command(program, args...)
+	c.Env = os.Environ()
+
+	homeDir, err := os.UserHomeDir()
+	if err == nil {
+		c.Dir = homeDir
+	}
+
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := c.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Start(); err != nil {
+		return nil, fmt.Errorf("start command[%s] failure, nest error: %v", program, err)
+	}
+	return &Command{cmd: c, stdin: stdin, stdout: stdout, stderr: stderr}, nil
+}
+
+func (c *Command) ChangeWindow(ws *remote.WinSize) error {
+	return fmt.Errorf("command has no pty")
+}
+
+func (c *Command) Close() error {
+	if c.cmd.ProcessState == nil && c.cmd.Process != nil {
+		return c.cmd.Process.Kill()
+	}
+	return nil
+}
+
+func (c *Command) Stdout() (io.Reader, error) {
+	return c.stdout, nil
+}
+
+func (c *Command) Stdin() (io.WriteCloser, error) {
+	return c.stdin, nil
+}
+
+func (c *Command) Stderr() (io.Reader, error) {
+	return c.stderr, nil
+}
+
+func (c *Command) Wait() error {
+	return c.cmd.Wait()
+}
+
+func (c *Command) SetSignal(signal chan error) error {
+	return nil
+}
+
+func (c *Command) ExitCode() int {
+	if c.cmd.ProcessState == nil {
+		return -1
+	}
+	return c.cmd.ProcessState.ExitCode()
+}
@@ -19,47 +19,9 @@ type Client struct {
 }
 
 func New(host string, port int, username, password string, pk []byte, ws *remote.WinSize, timeout time.Duration) (remote.Terminal, error) {
-	var authMethods = make([]ssh.AuthMethod, 0, 4)
-	if len(pk) != 0 {
-		signer, err := ssh.ParsePrivateKey(pk)
-		if err != nil {
-			return nil, fmt.Errorf("parse private key failure, nest error: %v", err)
-		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-	}
-
-	if password != "" {
-		authMethods = append(authMethods, ssh.KeyboardInteractive(setKeyboard(password)))
-		authMethods = append(authMethods, ssh.Password(password))
-	}
-
-	if len(authMethods) == 0 {
-		return nil, fmt.Errorf("panic: no valid auth method is included, nest error: password or pk may not be exist")
-	}
-
-	config := ssh.ClientConfig{
-		User: username,
-		Auth: authMethods,
-		Config: ssh.Config{
-			Ciphers: []string{
-				"aes128-ctr",
-				"aes192-ctr",
-				"aes256-ctr",
-				"aes128-gcm@openssh.com",
-				"arcfour256",
-				"arcfour128",
-				"aes128-cbc",
-			},
-		},
-		Timeout: timeout,
-		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-			return nil
-		},
-	}
-
-	conn, err := ssh.Dial("tcp", net.JoinHostPort(host, fmt.Sprintf("%d", port)), &config)
+	conn, err := Dial(host, port, username, password, pk, timeout)
 	if err != nil {
-		return nil, fmt.Errorf("dial [%s@%s:%d] failure, nest error: %v", username, host, port, err)
+		return nil, err
 	}
 
 	session, err := conn.NewSession()
@@ -105,6 +67,52 @@ func New(host string, port int, username, password string, pk []byte, ws *remote
 	return &Client{conn: conn, session: session, stdout: stdout, stderr: stderr, stdin: stdin}, nil
 }
 
+func Dial(host string, port int, username, password string, pk []byte, timeout time.Duration) (*ssh.Client, error) {
+	var authMethods = make([]ssh.AuthMethod, 0, 4)
+	if len(pk) != 0 {
+		signer, err := ssh.ParsePrivateKey(pk)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key failure, nest error: %v", err)
+		}
+		authMethods = append(authMethods, ssh.PublicKeys(signer))
+	}
+
+	if password != "" {
+		authMethods = append(authMethods, ssh.KeyboardInteractive(setKeyboard(password)))
+		authMethods = append(authMethods, ssh.Password(password))
+	}
+
+	if len(authMethods) == 0 {
+		return nil, fmt.Errorf("panic: no valid auth method is included, nest error: password or pk may not be exist")
+	}
+
+	config := ssh.ClientConfig{
+		User: username,
+		Auth: authMethods,
+		Config: ssh.Config{
+			Ciphers: []string{
+				"aes128-ctr",
+				"aes192-ctr",
+				"aes256-ctr",
+				"aes128-gcm@openssh.com",
+				"arcfour256",
+				"arcfour128",
+				"aes128-cbc",
+			},
+		},
+		Timeout: timeout,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return nil
+		},
+	}
+
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(host, fmt.Sprintf("%d", port)), &config)
+	if err != nil {
+		return nil, fmt.Errorf("dial [%s@%s:%d] failure, nest error: %v", username, host, port, err)
+	}
+	return conn, nil
+}
+
 func setKeyboard(password string) func(user, instruction string, questions []string, echos []bool) (answers []string, err error) {
 	return func(user, instruction string, questions []string, echos []bool) (answers []string, err error) {
 		answers = make([]string, len(questions))
@@ -0,0 +1,89 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eviltomorrow/omega/pkg/remote"
+	"golang.org/x/crypto/ssh"
+)
+
+type Command struct {
+	Client
+
+	exitCode int
+}
+
+func NewCommand(host string, port int, username, password string, pk []byte, program string, args []string, timeout time.Duration) (remote.Command, error) {
+	conn, err := Dial(host, port, username, password, pk, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := conn.NewSession()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("new session failure, nest error: %v", err)
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		conn.Close()
+		return nil, err
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		session.Close()
+		conn.Close()
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		conn.Close()
+		return nil, err
+	}
+
+	if err := session.Start(commandLine(program, args)); err != nil {
+		session.Close()
+		conn.Close()
+		return nil, fmt.Errorf("start command[%s] failure, nest error: %v", program, err)
+	}
+	return &Command{
+		Client:   Client{conn: conn, session: session, stdout: stdout, stderr: stderr, stdin: stdin},
+		exitCode: -1,
+	}, nil
+}
+
+func (c *Command) ChangeWindow(ws *remote.WinSize) error {
+	return fmt.Errorf("command has no pty")
+}
+
+func (c *Command) Wait() error {
+	err := c.Client.Wait()
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		c.exitCode = 0
+	case errors.As(err, &exitErr):
+		c.exitCode = exitErr.ExitStatus()
+	}
+	return err
+}
+
+func (c *Command) ExitCode() int {
+	return c.exitCode
+}
+
+// commandLine quotes program and args for the remote shell
+func commandLine(program string, args []string) string {
+	var words = make([]string, 0, len(args)+1)
+	for _, word := range append([]string{program}, args...) {
+		words = append(words, "'"+strings.ReplaceAll(word, "'", `'\''`)+"'")
+	}
+	return strings.Join(words, " ")
+}
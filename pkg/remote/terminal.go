@@ -17,6 +17,13 @@ type Terminal interface {
 	Wait() error
 }
 
+// Command is a terminal which runs one program without pty, stdout and stderr
+// are separated, ExitCode is valid after Wait returns.
+type Command interface {
+	Terminal
+	ExitCode() int
+}
+
 type WinSize struct {
 	Rows uint16 // ws_row: Number of rows (in cells)
 	Cols uint16 // ws_col: Number of columns (in cells)
@@ -0,0 +1,41 @@
+package systemd
+
+import (
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// Ready tells systemd the service is started, it does nothing if the service
+// isn't started by systemd.
+func Ready() error {
+	_, err := daemon.SdNotify(false, daemon.SdNotifyReady)
+	return err
+}
+
+// Stopping tells systemd the service is stopping
+func Stopping() error {
+	_, err := daemon.SdNotify(false, daemon.SdNotifyStopping)
+	return err
+}
+
+// Keepalive sends keepalives to systemd at half of WatchdogSec until stop is
+// closed, it returns at once if WatchdogSec of the unit isn't set.
+func Keepalive(stop <-chan struct{}) {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil || interval <= 0 {
+		return
+	}
+
+	var ticker = time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		daemon.SdNotify(false, daemon.SdNotifyWatchdog)
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
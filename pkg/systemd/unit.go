@@ -0,0 +1,130 @@
+// Package systemd generates, installs and removes systemd units of omega
+// services, and notifies systemd of their readiness and liveness.
+package systemd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/eviltomorrow/omega/pkg/exec"
+)
+
+var (
+	// UnitDir is where units are installed
+	UnitDir = "/etc/systemd/system"
+	// RuntimeDir exists only if the system is booted with systemd
+	RuntimeDir = "/run/systemd/system"
+	Timeout    = 30 * time.Second
+)
+
+// Unit is a service of Type=notify which is restarted on failure, and killed
+// by systemd if it doesn't send keepalives within WatchdogSec.
+type Unit struct {
+	Name        string
+	Description string
+	// Dir is the working directory, bin of omega home
+	Dir         string
+	ExecStart   string
+	User        string
+	WatchdogSec time.Duration
+	// KillProcess kills the main process only on stop, children such as
+	// omega of omega-watchdog keep running and are adopted after restart
+	KillProcess bool
+}
+
+// Available returns true if the system is booted with systemd
+func Available() bool {
+	fi, err := os.Stat(RuntimeDir)
+	return err == nil && fi.IsDir()
+}
+
+// Path returns the file of unit name in UnitDir
+func Path(name string) string {
+	return filepath.Join(UnitDir, name+".service")
+}
+
+// Render returns the unit file
+func (u Unit) Render() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("[Unit]\n")
+	fmt.Fprintf(&buf, "Description=%s\n", u.Description)
+	buf.WriteString("After=network-online.target\n")
+	buf.WriteString("Wants=network-online.target\n")
+
+	buf.WriteString("\n[Service]\n")
+	buf.WriteString("Type=notify\n")
+	buf.WriteString("NotifyAccess=main\n")
+	if u.User != "" {
+		fmt.Fprintf(&buf, "User=%s\n", u.User)
+	}
+	fmt.Fprintf(&buf, "WorkingDirectory=%s\n", u.Dir)
+	fmt.Fprintf(&buf, "ExecStart=%s\n", u.ExecStart)
+	buf.WriteString("Restart=on-failure\n")
+	buf.WriteString("RestartSec=3s\n")
+	if u.WatchdogSec > 0 {
+		fmt.Fprintf(&buf, "WatchdogSec=%d\n", int64(u.WatchdogSec/time.Second))
+	}
+	if u.KillProcess {
+		buf.WriteString("KillMode=process\n")
+	}
+	buf.WriteString("KillSignal=SIGQUIT\n")
+	buf.WriteString("LimitNOFILE=65535\n")
+
+	buf.WriteString("\n[Install]\n")
+	buf.WriteString("WantedBy=multi-user.target\n")
+	return buf.Bytes()
+}
+
+// Install writes the unit to UnitDir, then enables and starts it
+func Install(u Unit) error {
+	if !Available() {
+		return fmt.Errorf("systemd is not running")
+	}
+	var path = Path(u.Name)
+	if err := os.WriteFile(path, u.Render(), 0644); err != nil {
+		return fmt.Errorf("write unit[%s] failure, nest error: %v", path, err)
+	}
+	for _, c := range []string{
+		"systemctl daemon-reload",
+		fmt.Sprintf("systemctl enable %s", u.Name),
+		fmt.Sprintf("systemctl restart %s", u.Name),
+	} {
+		if err := systemctl(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove stops and disables unit name, then removes it from UnitDir. It is
+// not an error if the unit isn't installed.
+func Remove(name string) error {
+	var path = Path(name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if err := systemctl(fmt.Sprintf("systemctl disable --now %s", name)); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove unit[%s] failure, nest error: %v", path, err)
+	}
+	return systemctl("systemctl daemon-reload")
+}
+
+// Installed returns true if unit name is in UnitDir
+func Installed(name string) bool {
+	_, err := os.Stat(Path(name))
+	return err == nil
+}
+
+func systemctl(c string) error {
+	stdout, stderr, err := exec.RunCmd(c, Timeout)
+	if err != nil {
+		return fmt.Errorf("%s failure, nest error: %v, output: %s%s", c, err, stdout, stderr)
+	}
+	return nil
+}
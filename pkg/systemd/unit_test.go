@@ -0,0 +1,88 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	_assert := assert.New(t)
+
+	var unit = Unit{
+		Name:        "omega-watchdog",
+		Description: "omega watchdog",
+		Dir:         "/opt/omega/bin",
+		ExecStart:   "/opt/omega/bin/omega-watchdog",
+		User:        "omega",
+		WatchdogSec: 30 * time.Second,
+		KillProcess: true,
+	}
+	var text = string(unit.Render())
+	for _, line := range []string{
+		"Type=notify",
+		"User=omega",
+		"WorkingDirectory=/opt/omega/bin",
+		"ExecStart=/opt/omega/bin/omega-watchdog",
+		"WatchdogSec=30",
+		"KillMode=process",
+		"WantedBy=multi-user.target",
+	} {
+		_assert.Contains(text, line+"\n")
+	}
+
+	unit.WatchdogSec, unit.KillProcess, unit.User = 0, false, ""
+	text = string(unit.Render())
+	_assert.False(strings.Contains(text, "WatchdogSec"))
+	_assert.False(strings.Contains(text, "KillMode"))
+	_assert.False(strings.Contains(text, "User="))
+}
+
+func TestInstallWithoutSystemd(t *testing.T) {
+	_assert := assert.New(t)
+
+	var dir = t.TempDir()
+	RuntimeDir, UnitDir = filepath.Join(dir, "run"), dir
+	_assert.False(Available())
+	_assert.NotNil(Install(Unit{Name: "omega-hub"}))
+	_assert.False(Installed("omega-hub"))
+	_assert.Nil(Remove("omega-hub"))
+}
+
+func TestKeepalive(t *testing.T) {
+	_assert := assert.New(t)
+
+	var path = filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	_assert.Nil(err)
+	defer conn.Close()
+	os.Setenv("NOTIFY_SOCKET", path)
+	os.Setenv("WATCHDOG_USEC", "100000")
+	os.Setenv("WATCHDOG_PID", "")
+	defer func() {
+		os.Unsetenv("NOTIFY_SOCKET")
+		os.Unsetenv("WATCHDOG_USEC")
+		os.Unsetenv("WATCHDOG_PID")
+	}()
+
+	_assert.Nil(Ready())
+	var stop = make(chan struct{})
+	go Keepalive(stop)
+	defer close(stop)
+
+	var buf = make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	_assert.Nil(err)
+	_assert.Equal("READY=1", string(buf[:n]))
+	for i := 0; i < 2; i++ {
+		n, err = conn.Read(buf)
+		_assert.Nil(err)
+		_assert.Equal("WATCHDOG=1", string(buf[:n]))
+	}
+}